@@ -0,0 +1,522 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/peaberberian/GoBanks/database"
+)
+
+// Alert rules are evaluated a few seconds after the transactions of their
+// user change, and at regular intervals. A rule fires at most one alert per
+// period, which is notified through the notifiers of the rule (see
+// RegisterNotifier).
+
+// kinds of alert rules
+const (
+	// balance (credits minus debits) of AccountId below Threshold.
+	// Fires at most once a day.
+	balanceBelowAlert = "balanceBelow"
+
+	// spend (debits minus credits) in CategoryId this month above
+	// Threshold, in AccountId only if set. Fires at most once a month.
+	categorySpendAlert = "categorySpendOver"
+
+	// single transaction with a debit or a credit of at least Threshold, in
+	// AccountId only if set. Fires once per transaction.
+	largeTransactionAlert = "transactionAbove"
+
+	// spend in CategoryId this month above Threshold times its median over
+	// the alert_median_months previous months, in AccountId only if set.
+	// Fires at most once a month.
+	unusualSpendAlert = "unusualSpend"
+)
+
+var alert_kinds = []string{balanceBelowAlert, categorySpendAlert,
+	largeTransactionAlert, unusualSpendAlert}
+
+// type of the events published by the webhook notifier
+const alert_fired_event_type = "alert.fired"
+
+// number of previous months an unusual spend is compared to
+const alert_median_months = 6
+
+// default interval between two evaluations of every rule
+const alert_default_interval = time.Hour
+
+// delay between a modification of the transactions and the evaluation of
+// the rules, to evaluate them once for many modifications
+const alert_debounce_delay = 5 * time.Second
+
+// maximum number of transactions checked for each rule on a scheduled
+// evaluation
+const alert_transactions_batch = 100
+
+// every DBAlertRule property
+var alert_rule_fields = []string{"Id", "UserId", "Kind", "AccountId",
+	"CategoryId", "Threshold", "Notifiers", "Email", "CreationDate"}
+
+// every DBAlert property
+var alert_fields = []string{"Id", "RuleId", "UserId", "Kind", "Period",
+	"Value", "Threshold", "Message", "CreationDate"}
+
+// alertEvaluator evaluates the alert rules and notifies the alerts fired.
+type alertEvaluator struct {
+	db database.GoBanksDataBase
+}
+
+// StartAlerts starts evaluating the alert rules stored in the given
+// database, each time the transactions published on the given bus change
+// and at the given interval (alert_default_interval if 0).
+func StartAlerts(db database.GoBanksDataBase, bus *database.EventBus,
+	interval time.Duration) {
+
+	if interval <= 0 {
+		interval = alert_default_interval
+	}
+	var ae = &alertEvaluator{db: db}
+	go ae.run(bus, interval)
+}
+
+// run evaluates the rules of the users whose transactions changed, once
+// alert_debounce_delay passed, and every rule at the given interval.
+func (ae *alertEvaluator) run(bus *database.EventBus,
+	interval time.Duration) {
+
+	var sub, _, _ = bus.Subscribe(0, 0)
+	var lastId = sub.LastEventId
+	var ticker = time.NewTicker(interval)
+	defer ticker.Stop()
+
+	// users whose rules should be evaluated
+	var changed = map[int]bool{}
+	var debounce <-chan time.Time
+
+	for {
+		select {
+		case evt, ok := <-sub.C:
+			if !ok {
+				// too slow: resume from the last event read. Missed
+				// events are caught by the next scheduled evaluation.
+				sub, _, _ = bus.Subscribe(0, lastId)
+				continue
+			}
+			lastId = evt.Id
+			if !strings.HasPrefix(evt.Type, "transaction.") {
+				continue
+			}
+			trn, _ := evt.Data.(database.DBTransaction)
+			for _, userId := range evt.UserIds {
+				changed[userId] = true
+				if evt.Type != "transaction."+database.DeletedEventAction {
+					ae.checkTransaction(userId, trn, time.Now())
+				}
+			}
+			if debounce == nil {
+				debounce = time.After(alert_debounce_delay)
+			}
+
+		case <-debounce:
+			for userId := range changed {
+				var f database.DBAlertRuleFilters
+				f.UserId.SetFilter(userId)
+				ae.evaluate(f, time.Now())
+			}
+			changed = map[int]bool{}
+			debounce = nil
+
+		case <-ticker.C:
+			ae.evaluate(database.DBAlertRuleFilters{}, time.Now())
+		}
+	}
+}
+
+// evaluate evaluates the rules corresponding to the given filters.
+func (ae *alertEvaluator) evaluate(f database.DBAlertRuleFilters,
+	now time.Time) {
+
+	rls, err := ae.db.GetAlertRules(f, alert_rule_fields, 0)
+	if err != nil {
+		log.Println("Alerts: could not read the rules:", err)
+		return
+	}
+	for _, rl := range rls {
+		visible, err := ae.canSeeRuleTargets(rl)
+		if err == nil && visible {
+			switch rl.Kind {
+			case balanceBelowAlert:
+				err = ae.evaluateBalance(rl, now)
+			case categorySpendAlert:
+				err = ae.evaluateCategorySpend(rl, now)
+			case largeTransactionAlert:
+				err = ae.evaluateTransactions(rl, now)
+			case unusualSpendAlert:
+				err = ae.evaluateUnusualSpend(rl, now)
+			}
+		}
+		if err != nil {
+			log.Printf("Alerts: could not evaluate rule %d: %s\n", rl.Id, err)
+		}
+	}
+}
+
+// checkTransaction evaluates the largeTransactionAlert rules of the given
+// user on a transaction just added or updated.
+func (ae *alertEvaluator) checkTransaction(userId int,
+	trn database.DBTransaction, now time.Time) {
+
+	var f database.DBAlertRuleFilters
+	f.UserId.SetFilter(userId)
+	rls, err := ae.db.GetAlertRules(f, alert_rule_fields, 0)
+	if err != nil {
+		log.Println("Alerts: could not read the rules:", err)
+		return
+	}
+	for _, rl := range rls {
+		if rl.Kind != largeTransactionAlert ||
+			(rl.AccountId != 0 && rl.AccountId != trn.AccountId) {
+			continue
+		}
+		if amount := transactionAmount(trn); amount >= rl.Threshold {
+			if err := ae.fire(rl, transactionPeriod(trn), amount,
+				largeTransactionMessage(trn, amount), now); err != nil {
+				log.Printf("Alerts: could not evaluate rule %d: %s\n",
+					rl.Id, err)
+			}
+		}
+	}
+}
+
+// evaluateBalance evaluates a balanceBelowAlert rule.
+func (ae *alertEvaluator) evaluateBalance(rl database.DBAlertRule,
+	now time.Time) error {
+
+	var f = alertTransactionFilters(rl)
+	report, err := ae.db.GetReport(f)
+	if err != nil {
+		return err
+	}
+
+	var balance = report.Credit - report.Debit
+	if balance >= rl.Threshold {
+		return nil
+	}
+	var message = fmt.Sprintf("balance of account %s is %s, below %s",
+		ae.accountName(rl), formatAlertAmount(balance),
+		formatAlertAmount(rl.Threshold))
+	return ae.fire(rl, now.Format("2006-01-02"), balance, message, now)
+}
+
+// evaluateCategorySpend evaluates a categorySpendAlert rule.
+func (ae *alertEvaluator) evaluateCategorySpend(rl database.DBAlertRule,
+	now time.Time) error {
+
+	var monthStart = startOfMonth(now)
+	spend, err := ae.getSpend(rl, monthStart, now)
+	if err != nil || spend <= rl.Threshold {
+		return err
+	}
+	var message = fmt.Sprintf("spend in category %s is %s this month, "+
+		"over %s", ae.categoryName(rl), formatAlertAmount(spend),
+		formatAlertAmount(rl.Threshold))
+	return ae.fire(rl, now.Format("2006-01"), spend, message, now)
+}
+
+// evaluateUnusualSpend evaluates an unusualSpendAlert rule.
+func (ae *alertEvaluator) evaluateUnusualSpend(rl database.DBAlertRule,
+	now time.Time) error {
+
+	var monthStart = startOfMonth(now)
+	spend, err := ae.getSpend(rl, monthStart, now)
+	if err != nil || spend <= 0 {
+		return err
+	}
+
+	var spends []float32
+	for i := 1; i <= alert_median_months; i++ {
+		var from = monthStart.AddDate(0, -i, 0)
+		var to = from.AddDate(0, 1, 0).Add(-time.Nanosecond)
+		monthSpend, err := ae.getSpend(rl, from, to)
+		if err != nil {
+			return err
+		}
+		spends = append(spends, monthSpend)
+	}
+
+	var med = median(spends)
+	if med <= 0 || spend <= med*rl.Threshold {
+		return nil
+	}
+	var message = fmt.Sprintf("spend in category %s is %s this month, "+
+		"%s times its median of the last %d months (%s)",
+		ae.categoryName(rl), formatAlertAmount(spend),
+		strconv.FormatFloat(float64(spend/med), 'f', 1, 32),
+		alert_median_months, formatAlertAmount(med))
+	return ae.fire(rl, now.Format("2006-01"), spend, message, now)
+}
+
+// evaluateTransactions evaluates a largeTransactionAlert rule on the
+// transactions done since its creation, in case some changes were missed.
+// They are read by batches of alert_transactions_batch, in the order of
+// their ids.
+func (ae *alertEvaluator) evaluateTransactions(rl database.DBAlertRule,
+	now time.Time) error {
+
+	var y, m, d = rl.CreationDate.Date()
+	var from = time.Date(y, m, d, 0, 0, 0, 0, rl.CreationDate.Location())
+
+	for _, field := range []string{"Debit", "Credit"} {
+		var f = alertTransactionFilters(rl)
+		f.FromTransactionDate.SetFilter(from)
+		if field == "Debit" {
+			f.MinDebit.SetFilter(rl.Threshold)
+		} else {
+			f.MinCredit.SetFilter(rl.Threshold)
+		}
+		f.Sort.SetFilter([]database.DBSortField{{Field: "Id"}})
+
+		for {
+			trns, err := ae.db.GetTransactions(f, []string{"Id", "AccountId",
+				"Label", "Debit", "Credit"}, alert_transactions_batch)
+			if err != nil {
+				return err
+			}
+			if err := ae.fireTransactions(rl, trns, now); err != nil {
+				return err
+			}
+			if len(trns) < alert_transactions_batch {
+				break
+			}
+			f.After.SetFilter(database.DBCursor{Id: trns[len(trns)-1].Id})
+		}
+	}
+	return nil
+}
+
+// fireTransactions fires an alert of the given largeTransactionAlert rule
+// for each of the given transactions which did not fire one yet.
+func (ae *alertEvaluator) fireTransactions(rl database.DBAlertRule,
+	trns []database.DBTransaction, now time.Time) error {
+
+	if len(trns) == 0 {
+		return nil
+	}
+
+	var periods []string
+	for _, trn := range trns {
+		periods = append(periods, transactionPeriod(trn))
+	}
+	var af database.DBAlertFilters
+	af.RuleIds.SetFilter([]int{rl.Id})
+	af.Periods.SetFilter(periods)
+	alts, err := ae.db.GetAlerts(af, []string{"Period"}, 0)
+	if err != nil {
+		return err
+	}
+	var fired = map[string]bool{}
+	for _, alt := range alts {
+		fired[alt.Period] = true
+	}
+
+	for _, trn := range trns {
+		var period = transactionPeriod(trn)
+		if fired[period] {
+			continue
+		}
+		fired[period] = true
+		var amount = transactionAmount(trn)
+		if err := ae.record(rl, period, amount,
+			largeTransactionMessage(trn, amount), now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getSpend returns the debits minus the credits of the transactions
+// concerned by a rule between the given dates.
+func (ae *alertEvaluator) getSpend(rl database.DBAlertRule, from time.Time,
+	to time.Time) (float32, error) {
+
+	var f = alertTransactionFilters(rl)
+	f.FromTransactionDate.SetFilter(from)
+	f.ToTransactionDate.SetFilter(to)
+	report, err := ae.db.GetReport(f)
+	return report.Debit - report.Credit, err
+}
+
+// fire records an alert for the given rule and period, and notifies it,
+// unless the rule already fired for this period.
+func (ae *alertEvaluator) fire(rl database.DBAlertRule, period string,
+	value float32, message string, now time.Time) error {
+
+	var f database.DBAlertFilters
+	f.RuleIds.SetFilter([]int{rl.Id})
+	f.Periods.SetFilter([]string{period})
+	alts, err := ae.db.GetAlerts(f, []string{"Id"}, 1)
+	if err != nil || len(alts) > 0 {
+		return err
+	}
+	return ae.record(rl, period, value, message, now)
+}
+
+// record records an alert for the given rule and period, and notifies it.
+func (ae *alertEvaluator) record(rl database.DBAlertRule, period string,
+	value float32, message string, now time.Time) error {
+
+	alt, err := ae.db.AddAlert(database.DBAlertParams{
+		RuleId:       rl.Id,
+		UserId:       rl.UserId,
+		Kind:         rl.Kind,
+		Period:       period,
+		Value:        value,
+		Threshold:    rl.Threshold,
+		Message:      message,
+		CreationDate: now,
+	})
+	if err != nil {
+		return err
+	}
+
+	var names = rl.Notifiers
+	if len(names) == 0 {
+		names = getNotifierNames()
+	}
+	for _, name := range names {
+		n, ok := alert_notifiers[name]
+		if !ok {
+			log.Printf("Alerts: unknown notifier %q for rule %d\n", name,
+				rl.Id)
+			continue
+		}
+		if err := n.Notify(rl, alt); err != nil {
+			log.Printf("Alerts: could not notify alert %d with %s: %s\n",
+				alt.Id, name, err)
+		}
+	}
+	return nil
+}
+
+// canSeeRuleTargets returns false if the user of a rule cannot see its
+// account or category anymore, e.g. once the share giving access to the
+// account was removed. Such a rule is not evaluated.
+func (ae *alertEvaluator) canSeeRuleTargets(rl database.DBAlertRule) (bool,
+	error) {
+
+	if rl.AccountId != 0 {
+		var f database.DBAccountFilters
+		f.Ids.SetFilter([]int{rl.AccountId})
+		f.UserId.SetFilter(rl.UserId)
+		f.Roles.SetFilter(rolesFrom(viewerRole))
+		accs, err := ae.db.GetAccounts(f, []string{"Id"}, 1)
+		if err != nil || len(accs) == 0 {
+			return false, err
+		}
+	}
+	if rl.CategoryId != 0 {
+		var f database.DBCategoryFilters
+		f.Ids.SetFilter([]int{rl.CategoryId})
+		f.UserId.SetFilter(rl.UserId)
+		ctgs, err := ae.db.GetCategories(f, []string{"Id"}, 1)
+		if err != nil || len(ctgs) == 0 {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// accountName returns the name of the given account of a rule, between
+// quotes, or its id if it cannot be read.
+func (ae *alertEvaluator) accountName(rl database.DBAlertRule) string {
+	var id = rl.AccountId
+	var f database.DBAccountFilters
+	f.Ids.SetFilter([]int{id})
+	f.UserId.SetFilter(rl.UserId)
+	f.Roles.SetFilter(rolesFrom(viewerRole))
+	accs, err := ae.db.GetAccounts(f, []string{"Name"}, 1)
+	if err != nil || len(accs) == 0 {
+		return strconv.Itoa(id)
+	}
+	return strconv.Quote(accs[0].Name)
+}
+
+// categoryName returns the name of the category of a rule, between quotes,
+// or its id if it cannot be read.
+func (ae *alertEvaluator) categoryName(rl database.DBAlertRule) string {
+	var id = rl.CategoryId
+	var f database.DBCategoryFilters
+	f.Ids.SetFilter([]int{id})
+	f.UserId.SetFilter(rl.UserId)
+	cats, err := ae.db.GetCategories(f, []string{"Name"}, 1)
+	if err != nil || len(cats) == 0 {
+		return strconv.Itoa(id)
+	}
+	return strconv.Quote(cats[0].Name)
+}
+
+// alertTransactionFilters returns the filters of the transactions a rule is
+// about, among the ones its user can see.
+func alertTransactionFilters(rl database.DBAlertRule,
+) database.DBTransactionFilters {
+
+	var f database.DBTransactionFilters
+	f.UserId.SetFilter(rl.UserId)
+	f.Roles.SetFilter(rolesFrom(viewerRole))
+	if rl.AccountId != 0 {
+		f.AccountIds.SetFilter([]int{rl.AccountId})
+	}
+	if rl.CategoryId != 0 {
+		f.CategoryIds.SetFilter([]int{rl.CategoryId})
+	}
+	return f
+}
+
+// transactionAmount returns the debit of a transaction, or its credit if
+// bigger.
+func transactionAmount(trn database.DBTransaction) float32 {
+	if trn.Credit > trn.Debit {
+		return trn.Credit
+	}
+	return trn.Debit
+}
+
+// transactionPeriod returns the period of the alert fired by a
+// largeTransactionAlert rule for the given transaction.
+func transactionPeriod(trn database.DBTransaction) string {
+	return "transaction:" + strconv.Itoa(trn.Id)
+}
+
+func largeTransactionMessage(trn database.DBTransaction,
+	amount float32) string {
+	return fmt.Sprintf("transaction %s of %s", strconv.Quote(trn.Label),
+		formatAlertAmount(amount))
+}
+
+// formatAlertAmount formats an amount for the message of an alert.
+func formatAlertAmount(amount float32) string {
+	return strconv.FormatFloat(float64(amount), 'f', 2, 32)
+}
+
+// startOfMonth returns the first instant of the month of the given time.
+func startOfMonth(t time.Time) time.Time {
+	var y, m, _ = t.Date()
+	return time.Date(y, m, 1, 0, 0, 0, 0, t.Location())
+}
+
+// median returns the median of the given values, 0 if there are none.
+func median(vals []float32) float32 {
+	if len(vals) == 0 {
+		return 0
+	}
+	var sorted = append([]float32{}, vals...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	var mid = len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
@@ -0,0 +1,371 @@
+package api
+
+import (
+	"bufio"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/peaberberian/GoBanks/database"
+)
+
+// alertTestDataBase is the database used to evaluate the alert rules in the
+// tests. Its reports and transactions are returned in order, one by call,
+// whatever the filters.
+type alertTestDataBase struct {
+	database.GoBanksDataBase
+	rules        []database.DBAlertRule
+	reports      []database.DBReport
+	transactions [][]database.DBTransaction
+	alerts       []database.DBAlert
+
+	// true if the accounts cannot be seen anymore
+	hiddenAccounts bool
+}
+
+func (db *alertTestDataBase) GetAlertRules(f database.DBAlertRuleFilters,
+	fields []string, limit uint) ([]database.DBAlertRule, error) {
+	return db.rules, nil
+}
+
+func (db *alertTestDataBase) GetReport(f database.DBTransactionFilters,
+) (database.DBReport, error) {
+	if len(db.reports) == 0 {
+		return database.DBReport{}, nil
+	}
+	var report = db.reports[0]
+	db.reports = db.reports[1:]
+	return report, nil
+}
+
+func (db *alertTestDataBase) GetTransactions(f database.DBTransactionFilters,
+	fields []string, limit uint) ([]database.DBTransaction, error) {
+	if len(db.transactions) == 0 {
+		return nil, nil
+	}
+	var trns = db.transactions[0]
+	db.transactions = db.transactions[1:]
+	return trns, nil
+}
+
+// GetAlerts returns every alert fired
+func (db *alertTestDataBase) GetAlerts(f database.DBAlertFilters,
+	fields []string, limit uint) ([]database.DBAlert, error) {
+	return db.alerts, nil
+}
+
+func (db *alertTestDataBase) AddAlert(p database.DBAlertParams,
+) (database.DBAlert, error) {
+	var alt = database.DBAlert{
+		Id:           len(db.alerts) + 1,
+		RuleId:       p.RuleId,
+		UserId:       p.UserId,
+		Kind:         p.Kind,
+		Period:       p.Period,
+		Value:        p.Value,
+		Threshold:    p.Threshold,
+		Message:      p.Message,
+		CreationDate: p.CreationDate,
+	}
+	db.alerts = append(db.alerts, alt)
+	return alt, nil
+}
+
+func (db *alertTestDataBase) GetAccounts(f database.DBAccountFilters,
+	fields []string, limit uint) ([]database.DBAccount, error) {
+	if db.hiddenAccounts {
+		return nil, nil
+	}
+	return []database.DBAccount{{Name: "checking"}}, nil
+}
+
+func (db *alertTestDataBase) GetCategories(f database.DBCategoryFilters,
+	fields []string, limit uint) ([]database.DBCategory, error) {
+	return []database.DBCategory{{Name: "groceries"}}, nil
+}
+
+// alertTestNotifier records the alerts it is asked to notify.
+type alertTestNotifier struct {
+	alerts *[]database.DBAlert
+}
+
+func (n alertTestNotifier) Notify(rl database.DBAlertRule,
+	alt database.DBAlert) error {
+	*n.alerts = append(*n.alerts, alt)
+	return nil
+}
+
+// newTestAlertRule returns a rule of the given kind notified to a notifier
+// recording the alerts in the returned slice.
+func newTestAlertRule(t *testing.T, kind string,
+	threshold float32) (database.DBAlertRule, *[]database.DBAlert) {
+
+	var notified = &[]database.DBAlert{}
+	RegisterNotifier("test", alertTestNotifier{notified})
+	t.Cleanup(func() { delete(alert_notifiers, "test") })
+	return database.DBAlertRule{
+		Id:           1,
+		UserId:       2,
+		Kind:         kind,
+		AccountId:    3,
+		CategoryId:   4,
+		Threshold:    threshold,
+		Notifiers:    []string{"test"},
+		CreationDate: time.Now().AddDate(0, -1, 0),
+	}, notified
+}
+
+func TestMedian(t *testing.T) {
+	var tests = []struct {
+		vals []float32
+		want float32
+	}{
+		{nil, 0},
+		{[]float32{4}, 4},
+		{[]float32{9, 1, 5}, 5},
+		{[]float32{100, 80, 120, 100, 90, 110}, 100},
+		{[]float32{3, 1, 4, 2}, 2.5},
+	}
+	for _, test := range tests {
+		if got := median(test.vals); got != test.want {
+			t.Errorf("median(%v) = %v, want %v", test.vals, got, test.want)
+		}
+	}
+
+	var vals = []float32{3, 1, 2}
+	median(vals)
+	if vals[0] != 3 || vals[1] != 1 || vals[2] != 2 {
+		t.Errorf("median modified its argument: %v", vals)
+	}
+}
+
+func TestEvaluateBalance(t *testing.T) {
+	var rl, notified = newTestAlertRule(t, balanceBelowAlert, 0)
+	var db = &alertTestDataBase{reports: []database.DBReport{
+		{Debit: 100, Credit: 150},
+		{Debit: 200, Credit: 150},
+		{Debit: 300, Credit: 150},
+	}}
+	var ae = &alertEvaluator{db: db}
+	var now = time.Date(2020, 3, 15, 10, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 3; i++ {
+		if err := ae.evaluateBalance(rl, now); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(*notified) != 1 {
+		t.Fatalf("expected a single alert, got %+v", *notified)
+	}
+	var alt = (*notified)[0]
+	if alt.Period != "2020-03-15" || alt.Value != -50 ||
+		alt.Message != `balance of account "checking" is -50.00, below 0.00` {
+		t.Fatalf("unexpected alert: %+v", alt)
+	}
+}
+
+func TestEvaluateSkipsRulesOfHiddenAccounts(t *testing.T) {
+	var rl, notified = newTestAlertRule(t, balanceBelowAlert, 100)
+	var db = &alertTestDataBase{rules: []database.DBAlertRule{rl},
+		hiddenAccounts: true}
+	var ae = &alertEvaluator{db: db}
+
+	ae.evaluate(database.DBAlertRuleFilters{}, time.Now())
+	if len(*notified) != 0 {
+		t.Fatalf("expected no alert, got %+v", *notified)
+	}
+
+	db.hiddenAccounts = false
+	ae.evaluate(database.DBAlertRuleFilters{}, time.Now())
+	if len(*notified) != 1 {
+		t.Fatalf("expected a single alert, got %+v", *notified)
+	}
+}
+
+func TestEvaluateUnusualSpend(t *testing.T) {
+	// this month, then the alert_median_months previous ones
+	var reports = []database.DBReport{{Debit: 300}, {Debit: 100},
+		{Debit: 80}, {Debit: 120}, {Debit: 100, Credit: 10}, {Debit: 100},
+		{Debit: 110}}
+	var now = time.Date(2020, 3, 15, 10, 0, 0, 0, time.UTC)
+
+	var rl, notified = newTestAlertRule(t, unusualSpendAlert, 3)
+	var ae = &alertEvaluator{db: &alertTestDataBase{reports: reports}}
+	if err := ae.evaluateUnusualSpend(rl, now); err != nil {
+		t.Fatal(err)
+	}
+	if len(*notified) != 0 {
+		t.Fatalf("expected no alert under the threshold, got %+v", *notified)
+	}
+
+	rl, notified = newTestAlertRule(t, unusualSpendAlert, 2)
+	ae = &alertEvaluator{db: &alertTestDataBase{reports: reports}}
+	if err := ae.evaluateUnusualSpend(rl, now); err != nil {
+		t.Fatal(err)
+	}
+	if len(*notified) != 1 {
+		t.Fatalf("expected a single alert, got %+v", *notified)
+	}
+	var alt = (*notified)[0]
+	if alt.Period != "2020-03" || alt.Value != 300 ||
+		!strings.Contains(alt.Message, "3.0 times its median") {
+		t.Fatalf("unexpected alert: %+v", alt)
+	}
+}
+
+func TestEvaluateTransactionsReadsEveryPage(t *testing.T) {
+	var rl, notified = newTestAlertRule(t, largeTransactionAlert, 500)
+
+	var page []database.DBTransaction
+	for i := 1; i <= alert_transactions_batch; i++ {
+		page = append(page, database.DBTransaction{Id: i, AccountId: 3,
+			Debit: 600})
+	}
+	var db = &alertTestDataBase{transactions: [][]database.DBTransaction{
+		page,
+		{{Id: alert_transactions_batch + 1, AccountId: 3, Debit: 700}},
+		{{Id: alert_transactions_batch + 2, AccountId: 3, Credit: 800}},
+	}}
+	// the first transaction already fired an alert
+	db.alerts = []database.DBAlert{{Id: 1, RuleId: rl.Id,
+		Period: transactionPeriod(page[0])}}
+
+	var ae = &alertEvaluator{db: db}
+	if err := ae.evaluateTransactions(rl, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if len(db.transactions) != 0 {
+		t.Fatalf("%d pages were not read", len(db.transactions))
+	}
+	if len(*notified) != alert_transactions_batch+1 {
+		t.Fatalf("expected %d alerts, got %d", alert_transactions_batch+1,
+			len(*notified))
+	}
+	var last = (*notified)[len(*notified)-1]
+	if last.Period != "transaction:102" || last.Value != 800 {
+		t.Fatalf("unexpected alert: %+v", last)
+	}
+}
+
+func TestCheckTransaction(t *testing.T) {
+	var rl, notified = newTestAlertRule(t, largeTransactionAlert, 500)
+	var ae = &alertEvaluator{db: &alertTestDataBase{
+		rules: []database.DBAlertRule{rl}}}
+
+	ae.checkTransaction(rl.UserId, database.DBTransaction{Id: 7,
+		AccountId: 4, Debit: 800}, time.Now())
+	ae.checkTransaction(rl.UserId, database.DBTransaction{Id: 8,
+		AccountId: 3, Debit: 400}, time.Now())
+	if len(*notified) != 0 {
+		t.Fatalf("expected no alert, got %+v", *notified)
+	}
+
+	ae.checkTransaction(rl.UserId, database.DBTransaction{Id: 9,
+		AccountId: 3, Label: "rent", Debit: 800}, time.Now())
+	if len(*notified) != 1 {
+		t.Fatalf("expected a single alert, got %+v", *notified)
+	}
+	var alt = (*notified)[0]
+	if alt.Period != "transaction:9" ||
+		alt.Message != `transaction "rent" of 800.00` {
+		t.Fatalf("unexpected alert: %+v", alt)
+	}
+}
+
+// newSmtpServer starts a local SMTP server accepting a single e-mail, and
+// returns its address and a channel receiving the recipients and the
+// content of the e-mail.
+func newSmtpServer(t *testing.T) (string, chan []string) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	var received = make(chan []string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		var tp = textproto.NewConn(conn)
+		var mail []string
+		tp.PrintfLine("220 localhost ESMTP")
+		for {
+			line, err := tp.ReadLine()
+			if err != nil {
+				return
+			}
+			var cmd = strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+			switch cmd {
+			case "EHLO", "HELO", "MAIL", "RSET", "NOOP":
+				tp.PrintfLine("250 OK")
+			case "RCPT":
+				mail = append(mail, line)
+				tp.PrintfLine("250 OK")
+			case "DATA":
+				tp.PrintfLine("354 go ahead")
+				data, err := tp.ReadDotLines()
+				if err != nil {
+					return
+				}
+				mail = append(mail, data...)
+				tp.PrintfLine("250 OK")
+			case "QUIT":
+				tp.PrintfLine("221 bye")
+				received <- mail
+				return
+			default:
+				tp.PrintfLine("502 unknown command")
+			}
+		}
+	}()
+	return ln.Addr().String(), received
+}
+
+func TestSmtpNotifierSendsMail(t *testing.T) {
+	addr, received := newSmtpServer(t)
+	var n = NewSmtpNotifier(SmtpConfig{Address: addr,
+		From: "gobanks@example.com"})
+
+	var rl = database.DBAlertRule{Id: 1, Email: "user@example.com"}
+	var alt = database.DBAlert{Id: 2, Message: "transaction \"a\r\nBcc: b\"",
+		CreationDate: time.Now()}
+	if err := n.Notify(rl, alt); err != nil {
+		t.Fatal(err)
+	}
+
+	var mail []string
+	select {
+	case mail = <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no e-mail received")
+	}
+	if mail[0] != "RCPT TO:<user@example.com>" {
+		t.Fatalf("unexpected recipient: %q", mail[0])
+	}
+
+	var headers = map[string]bool{}
+	var scanner = bufio.NewScanner(strings.NewReader(
+		strings.Join(mail[1:], "\n")))
+	for scanner.Scan() && scanner.Text() != "" {
+		headers[scanner.Text()] = true
+	}
+	if !headers["To: user@example.com"] ||
+		!headers["From: gobanks@example.com"] ||
+		!headers[`Subject: GoBanks alert: transaction "a  Bcc: b"`] {
+		t.Fatalf("unexpected headers: %v", headers)
+	}
+}
+
+func TestSmtpNotifierIgnoresRulesWithoutEmail(t *testing.T) {
+	var n = NewSmtpNotifier(SmtpConfig{Address: "127.0.0.1:1"})
+	if err := n.Notify(database.DBAlertRule{Id: 1},
+		database.DBAlert{Message: "test"}); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,145 @@
+package api
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/peaberberian/GoBanks/database"
+	"github.com/peaberberian/GoBanks/storage"
+)
+
+// interval between two removals of the files no attachment refers to
+const attachment_cleanup_interval = 24 * time.Hour
+
+// number of files checked at once by the cleanup
+const attachment_cleanup_batch = 100
+
+// files more recent than this are never removed by the cleanup: they may be
+// being attached
+const attachment_cleanup_grace = time.Hour
+
+// Held while files no attachment refers to are removed, and while a file is
+// attached, so a file is never removed between the addition of its
+// attachment and its storage.
+var attachmentFilesLock sync.Mutex
+
+// Configuration of the files attached to transactions
+type AttachmentConfig struct {
+	// Where the attached files are stored
+	Storage storage.Storage
+
+	// Maximum size of an attached file, in bytes
+	MaxSize int64
+
+	// Media types allowed, as detected from the content of the files
+	MimeTypes []string
+}
+
+// Current configuration of the attachments. No file can be attached without
+// a Storage.
+var attachmentConfig = AttachmentConfig{
+	MaxSize: 10 << 20,
+	MimeTypes: []string{"application/pdf", "image/jpeg", "image/png",
+		"image/gif", "image/webp"},
+}
+
+// SetAttachmentConfig modifies where and which files can be attached to
+// transactions. Zero values keep the current setting.
+func SetAttachmentConfig(c AttachmentConfig) {
+	if c.Storage != nil {
+		attachmentConfig.Storage = c.Storage
+	}
+	if c.MaxSize > 0 {
+		attachmentConfig.MaxSize = c.MaxSize
+	}
+	if len(c.MimeTypes) > 0 {
+		attachmentConfig.MimeTypes = c.MimeTypes
+	}
+}
+
+// StartAttachmentCleanup regularly removes from the storage the files no
+// attachment refers to anymore, such as the ones of the transactions
+// removed along with their account or bank.
+func StartAttachmentCleanup(db database.GoBanksDataBase) {
+	if attachmentConfig.Storage == nil {
+		return
+	}
+	go func() {
+		for {
+			if err := cleanAttachmentFiles(db); err != nil {
+				log.Println("Attachments: cleanup failed:", err)
+			}
+			time.Sleep(attachment_cleanup_interval)
+		}
+	}()
+}
+
+// cleanAttachmentFiles removes every stored file no attachment refers to,
+// except the most recent ones (see attachment_cleanup_grace).
+func cleanAttachmentFiles(db database.GoBanksDataBase) error {
+	var limit = time.Now().Add(-attachment_cleanup_grace)
+	var hashes []string
+	err := attachmentConfig.Storage.Walk(func(key string,
+		modTime time.Time) error {
+
+		if modTime.Before(limit) {
+			hashes = append(hashes, key)
+		}
+		if len(hashes) == attachment_cleanup_batch {
+			removeUnusedAttachmentFiles(db, hashes)
+			hashes = nil
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	removeUnusedAttachmentFiles(db, hashes)
+	return nil
+}
+
+// removeUnusedAttachmentFiles removes from the storage the files with the
+// given hashes no attachment refers to anymore, checking
+// attachment_cleanup_batch of them at once.
+// The given database should see the attachments committed: the files of
+// attachments removed in a transaction not committed yet are kept, and
+// removed later by the cleanup (see StartAttachmentCleanup).
+func removeUnusedAttachmentFiles(db database.GoBanksDataBase,
+	hashes []string) {
+
+	if attachmentConfig.Storage == nil {
+		return
+	}
+	for len(hashes) > attachment_cleanup_batch {
+		removeUnusedAttachmentFiles(db, hashes[:attachment_cleanup_batch])
+		hashes = hashes[attachment_cleanup_batch:]
+	}
+	if len(hashes) == 0 {
+		return
+	}
+
+	attachmentFilesLock.Lock()
+	defer attachmentFilesLock.Unlock()
+
+	var af database.DBAttachmentFilters
+	af.Hashes.SetFilter(hashes)
+	atts, err := db.GetAttachments(af, []string{"Hash"}, 0)
+	if err != nil {
+		log.Println("Attachments: could not check the files used:", err)
+		return
+	}
+
+	var used = map[string]bool{}
+	for _, att := range atts {
+		used[att.Hash] = true
+	}
+	for _, hash := range hashes {
+		if used[hash] {
+			continue
+		}
+		if err := attachmentConfig.Storage.Remove(hash); err != nil {
+			log.Println("Attachments: could not remove a file:", err)
+		}
+	}
+}
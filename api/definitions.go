@@ -1,5 +1,10 @@
 package api
 
+import (
+	"encoding/json"
+	"time"
+)
+
 // used on json.marshall for constructing the API response
 type UserJSON struct {
 	Id   int    `json:"id"`
@@ -9,6 +14,7 @@ type UserJSON struct {
 // used on json.marshall for constructing the API response
 type BankJSON struct {
 	Id          int    `json:"id"`
+	Version     int    `json:"version"`
 	Name        string `json:"name"`
 	Description string `json:"description"`
 }
@@ -16,6 +22,7 @@ type BankJSON struct {
 // used on json.marshall for constructing the API response
 type AccountJSON struct {
 	Id          int    `json:"id"`
+	Version     int    `json:"version"`
 	BankId      int    `json:"bankId"`
 	Name        string `json:"name"`
 	Description string `json:"description"`
@@ -24,6 +31,7 @@ type AccountJSON struct {
 // used on json.marshall for constructing the API response
 type TransactionJSON struct {
 	Id              int     `json:"id"`
+	Version         int     `json:"version"`
 	AccountId       int     `json:"accountId"`
 	Description     string  `json:"description"`
 	Label           string  `json:"label"`
@@ -35,31 +43,251 @@ type TransactionJSON struct {
 	Reference       string  `json:"reference"`
 }
 
+// used on json.marshall for constructing the API response
+type ShareJSON struct {
+	Id        int    `json:"id"`
+	Version   int    `json:"version"`
+	UserId    int    `json:"userId"`
+	BankId    int    `json:"bankId,omitempty"`
+	AccountId int    `json:"accountId,omitempty"`
+	Role      string `json:"role"`
+}
+
 type CategoryJSON struct {
 	Id          int    `json:"id"`
+	Version     int    `json:"version"`
 	Name        string `json:"name"`
 	Description string `json:"description"`
 	// TODO
 	// Childs      *CategoryJSON `json"childs"`
 }
 
+type TagJSON struct {
+	Id   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// sums of the transactions with a tag, from the /report/tags API
+type TagReportJSON struct {
+	TagId  int     `json:"tagId"`
+	Name   string  `json:"name"`
+	Debit  float32 `json:"debit"`
+	Credit float32 `json:"credit"`
+}
+
+// used on json.marshall for constructing the API response
+type AttachmentJSON struct {
+	Id            int    `json:"id"`
+	TransactionId int    `json:"transactionId"`
+	Name          string `json:"name"`
+	MimeType      string `json:"mimeType"`
+	Size          int64  `json:"size"`
+	Hash          string `json:"hash"`
+	CreationDate  int64  `json:"creationDate"`
+}
+
+type PersonalTokenJSON struct {
+	Id             int      `json:"id"`
+	Name           string   `json:"name"`
+	Token          string   `json:"token,omitempty"`
+	Scopes         []string `json:"scopes"`
+	AccountIds     []int    `json:"accountIds"`
+	CreationDate   int64    `json:"creationDate"`
+	ExpirationDate int64    `json:"expirationDate,omitempty"`
+}
+
 type TokenJSON struct {
 	Token     string `json:"access_token"`
 	TokenType string `json:"token_type"`
 	Expires   int    `json:"expires_in"`
 }
 
+// returned instead of a TokenJSON when the user has to give a two-factor
+// code to finish logging in
+type MFAChallengeJSON struct {
+	MFARequired bool   `json:"mfa_required"`
+	Token       string `json:"mfa_token"`
+	Expires     int    `json:"expires_in"`
+}
+
+type MFALoginJSON struct {
+	Token string `json:"mfa_token"`
+	Code  string `json:"code"`
+}
+
+type MFACodeJSON struct {
+	Code string `json:"code"`
+}
+
+type TOTPEnrollmentJSON struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+type RecoveryCodesJSON struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
 type AuthenticationJSON struct {
 	User     string `json:"user"`
 	Password string `json:"password"`
 }
 
+type LoginAttemptJSON struct {
+	Id          int    `json:"id"`
+	UserName    string `json:"user"`
+	IpAddress   string `json:"ip"`
+	Success     bool   `json:"success"`
+	AttemptDate int64  `json:"date"`
+}
+
+// Result of a single operation of a batch request
+type BatchResultJSON struct {
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    json.RawMessage   `json:"body,omitempty"`
+}
+
+type BatchResponseJSON struct {
+	Committed bool              `json:"committed"`
+	Results   []BatchResultJSON `json:"results"`
+}
+
+type CacheStatsJSON struct {
+	Enabled       bool   `json:"enabled"`
+	Hits          uint64 `json:"hits"`
+	Misses        uint64 `json:"misses"`
+	Evictions     uint64 `json:"evictions"`
+	Invalidations uint64 `json:"invalidations"`
+	Users         int    `json:"users"`
+	Entries       int    `json:"entries"`
+}
+
+// data of an event sent by the /events API
+type EventJSON struct {
+	Id         uint64 `json:"id"`
+	Type       string `json:"type"`
+	ResourceId int    `json:"resourceId"`
+	Date       int64  `json:"date"`
+}
+
+// manifest.json file of the archives of the /export and /import APIs
+type ArchiveManifestJSON struct {
+	FormatVersion int                        `json:"formatVersion"`
+	CreationDate  int64                      `json:"creationDate"`
+	Files         map[string]ArchiveFileJSON `json:"files"`
+}
+
+// a single JSON file of an archive, by its name in the manifest
+type ArchiveFileJSON struct {
+	Count  int    `json:"count"`
+	Sha256 string `json:"sha256"`
+}
+
+// categories in an archive also keep their parent
+type ArchiveCategoryJSON struct {
+	CategoryJSON
+	ParentId int `json:"parentId,omitempty"`
+}
+
+// response of the /import API, with the number of elements restored
+type ArchiveImportJSON struct {
+	Banks        int `json:"banks"`
+	Accounts     int `json:"accounts"`
+	Categories   int `json:"categories"`
+	Transactions int `json:"transactions"`
+}
+
+// webhook of the /webhooks API. The secret is only sent at its creation.
+type WebhookJSON struct {
+	Id           int      `json:"id"`
+	Url          string   `json:"url"`
+	Secret       string   `json:"secret,omitempty"`
+	EventTypes   []string `json:"eventTypes"`
+	AccountIds   []int    `json:"accountIds"`
+	MinDebit     float32  `json:"minDebit,omitempty"`
+	MinCredit    float32  `json:"minCredit,omitempty"`
+	CreationDate int64    `json:"creationDate"`
+}
+
+// delivery of an event, from the /webhooks/{id}/deliveries API
+type WebhookDeliveryJSON struct {
+	Id              int    `json:"id"`
+	EventId         uint64 `json:"eventId"`
+	EventType       string `json:"eventType"`
+	Status          string `json:"status"`
+	Attempts        int    `json:"attempts"`
+	StatusCode      int    `json:"statusCode,omitempty"`
+	Error           string `json:"error,omitempty"`
+	CreationDate    int64  `json:"creationDate"`
+	NextAttemptDate int64  `json:"nextAttemptDate,omitempty"`
+	LastAttemptDate int64  `json:"lastAttemptDate,omitempty"`
+}
+
+// body sent to webhooks, the data being the resource concerned (e.g. a
+// TransactionJSON)
+type WebhookPayloadJSON struct {
+	Id         uint64      `json:"id"`
+	Type       string      `json:"type"`
+	ResourceId int         `json:"resourceId"`
+	Date       int64       `json:"date"`
+	Data       interface{} `json:"data"`
+}
+
+// rule of the /alerts/rules API
+type AlertRuleJSON struct {
+	Id           int      `json:"id"`
+	Kind         string   `json:"kind"`
+	AccountId    int      `json:"accountId,omitempty"`
+	CategoryId   int      `json:"categoryId,omitempty"`
+	Threshold    float32  `json:"threshold"`
+	Notifiers    []string `json:"notifiers"`
+	Email        string   `json:"email,omitempty"`
+	CreationDate int64    `json:"creationDate"`
+}
+
+// alert fired by a rule, from the /alerts API
+type AlertJSON struct {
+	Id           int     `json:"id"`
+	RuleId       int     `json:"ruleId"`
+	Kind         string  `json:"kind"`
+	Period       string  `json:"period"`
+	Value        float32 `json:"value"`
+	Threshold    float32 `json:"threshold"`
+	Message      string  `json:"message"`
+	CreationDate int64   `json:"creationDate"`
+}
+
 type ErrorJSON struct {
-	Error string `json:"error"`
-	Code  uint32 `json:"code"`
+	Error      string            `json:"error"`
+	Code       uint32            `json:"code"`
+	RetryAfter int               `json:"retryAfter,omitempty"`
+	Details    *ErrorDetailsJSON `json:"details,omitempty"`
+}
+
+// Details given for validation errors
+type ErrorDetailsJSON struct {
+	Field        string `json:"field"`
+	ExpectedType string `json:"expectedType,omitempty"`
+}
+
+type ErrorCodeJSON struct {
+	Code        uint32 `json:"code"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
 }
 
 type GoBanksError interface {
 	error
 	ErrorCode() uint32
 }
+
+// Implemented by errors which can give details about the invalid field
+type detailedError interface {
+	ErrorDetails() *ErrorDetailsJSON
+}
+
+// Implemented by errors after which the client has to wait before retrying
+type retryableError interface {
+	RetryAfter() time.Duration
+}
@@ -0,0 +1,116 @@
+package api
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/peaberberian/GoBanks/database"
+)
+
+// Banks, accounts, categories, transactions and shares have a version,
+// incremented each time they are updated, used for optimistic concurrency:
+//   - GET responses have an ETag header. A GET request with an
+//     If-None-Match header matching it gets an empty 304 response
+//   - PUT, PATCH and DELETE requests on a single resource need an If-Match
+//     header with the ETags of the versions which can be modified ("*" for
+//     any version). The request fails with a 412 if the resource has none
+//     of them anymore.
+
+// versionETag returns the ETag of a single resource at the given version.
+// example: versionETag(3) => "\"3\""
+func versionETag(version int) string {
+	return "\"" + strconv.Itoa(version) + "\""
+}
+
+// listETag returns a weak ETag for a list response, computed from the total
+// number of results and the id and version of each element returned.
+// element returns the id and version of the i-th element.
+func listETag(total int, count int, element func(int) (int, int)) string {
+	var hash = sha1.New()
+	hash.Write([]byte(strconv.Itoa(total)))
+	for i := 0; i < count; i++ {
+		id, version := element(i)
+		hash.Write([]byte("," + strconv.Itoa(id) + ":" + strconv.Itoa(version)))
+	}
+	return "W/\"" + hex.EncodeToString(hash.Sum(nil)) + "\""
+}
+
+// handleNotModified sets the ETag header of a GET response. If the request
+// has an If-None-Match header matching it, a 304 is sent and true is
+// returned: nothing should be written after.
+func handleNotModified(w http.ResponseWriter, r *http.Request,
+	etag string) bool {
+
+	w.Header().Set("ETag", etag)
+
+	var ifNoneMatch = r.Header.Get("If-None-Match")
+	if ifNoneMatch == "" {
+		return false
+	}
+	for _, tag := range strings.Split(ifNoneMatch, ",") {
+		// If-None-Match uses the weak comparison
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == strings.TrimPrefix(etag, "W/") {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
+
+// readIfMatchVersions reads the versions given in the If-Match header of a
+// request modifying a single resource, which is modified only if it has one
+// of them. No version is returned for "*" (any version).
+// Returns a preconditionRequiredError if there is no If-Match header and a
+// preconditionFailedError if it cannot match any version.
+func readIfMatchVersions(r *http.Request) ([]int, error) {
+	var ifMatch = r.Header.Get("If-Match")
+	if ifMatch == "" {
+		return nil, preconditionRequiredError{}
+	}
+	var versions []int
+	for _, tag := range strings.Split(ifMatch, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			return nil, nil
+		}
+
+		// If-Match uses the strong comparison: weak tags never match
+		if len(tag) < 2 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+			continue
+		}
+		if version, err := strconv.Atoi(tag[1 : len(tag)-1]); err == nil &&
+			version > 0 && !intInArray(version, versions) {
+			versions = append(versions, version)
+		}
+	}
+	if len(versions) == 0 {
+		return nil, preconditionFailedError{}
+	}
+	return versions, nil
+}
+
+// setUpdatedETag sets the ETag header of the response to a request which
+// updated a resource having one of the given versions (see
+// readIfMatchVersions).
+// Nothing is set unless a single version was given, as the new version is
+// not known otherwise.
+func setUpdatedETag(w http.ResponseWriter, versions []int) {
+	if len(versions) == 1 {
+		w.Header().Set("ETag", versionETag(versions[0]+1))
+	}
+}
+
+// versionedWriteError converts an error returned by the database when
+// updating or removing a single resource into the error to send: version
+// mismatches are kept, other errors become a queryOperationError.
+func versionedWriteError(err error) error {
+	if val, ok := err.(GoBanksError); ok &&
+		val.ErrorCode() == database.VersionMismatchErrorCode {
+		return err
+	}
+	return queryOperationError{}
+}
@@ -0,0 +1,292 @@
+package api
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Some GET APIs can send their results as a spreadsheet instead of JSON,
+// when the request's Accept header asks for one of the export_formats.
+// Values are written following the current ExportLocale.
+
+// media type of Excel workbooks
+const xlsx_media_type = "application/vnd.openxmlformats-officedocument." +
+	"spreadsheetml.sheet"
+
+// exportFormat is a spreadsheet format results can be exported to.
+type exportFormat struct {
+	mediaType string
+	extension string
+
+	// newWriter returns the tableWriter writing a table in this format with
+	// the given name in w.
+	newWriter func(w io.Writer, name string) tableWriter
+}
+
+// every format results can be exported to
+var export_formats = []exportFormat{
+	{"text/csv", "csv", newCsvTableWriter},
+	{xlsx_media_type, "xlsx", newXlsxTableWriter},
+}
+
+// ExportLocale describes how values are written in exported spreadsheets.
+type ExportLocale struct {
+	// Character separating the integer part of a number from its decimal
+	// part (e.g. ",")
+	DecimalSeparator string
+
+	// Layout of the dates, as understood by time.Format (e.g.
+	// "02/01/2006")
+	DateFormat string
+
+	// Character separating the values of a CSV line (e.g. ";")
+	CsvSeparator string
+}
+
+// Current export locale
+var exportLocale = ExportLocale{
+	DecimalSeparator: ".",
+	DateFormat:       "2006-01-02",
+	CsvSeparator:     ",",
+}
+
+// SetExportLocale modifies how values are written in exported spreadsheets.
+// Zero values keep the current setting.
+// Returns an error if the CSV separator is not a single character, or is the
+// decimal separator.
+func SetExportLocale(l ExportLocale) error {
+	var newLocale = exportLocale
+	if l.DecimalSeparator != "" {
+		newLocale.DecimalSeparator = l.DecimalSeparator
+	}
+	if l.DateFormat != "" {
+		newLocale.DateFormat = l.DateFormat
+	}
+	if l.CsvSeparator != "" {
+		newLocale.CsvSeparator = l.CsvSeparator
+	}
+
+	if utf8.RuneCountInString(newLocale.CsvSeparator) != 1 ||
+		newLocale.CsvSeparator == newLocale.DecimalSeparator {
+		return invalidParameterError{"csvSeparator",
+			"single character, different from the decimal separator"}
+	}
+	exportLocale = newLocale
+	return nil
+}
+
+// getExportFormat returns the format asked through the Accept header of the
+// given request, false if none of the export_formats is asked.
+func getExportFormat(r *http.Request) (exportFormat, bool) {
+	for _, format := range export_formats {
+		if acceptsMediaType(r, format.mediaType) {
+			return format, true
+		}
+	}
+	return exportFormat{}, false
+}
+
+// setExportHeaders sets the headers of a response exported in the given
+// format, as a file with the given name (without extension).
+func setExportHeaders(w http.ResponseWriter, format exportFormat,
+	name string) {
+	w.Header().Set("content-type", format.mediaType)
+	w.Header().Set("content-disposition",
+		"attachment; filename=\""+name+"."+format.extension+"\"")
+}
+
+// unsetExportHeaders removes the headers set by setExportHeaders, for an
+// error to be sent instead.
+func unsetExportHeaders(w http.ResponseWriter) {
+	w.Header().Set("content-type", "application/json")
+	w.Header().Del("content-disposition")
+}
+
+// tableCell is a single value of an exported table.
+type tableCell struct {
+	// number written with a "." as decimal separator if isNumber, text
+	// else
+	value    string
+	isNumber bool
+}
+
+// textCell returns the tableCell of the given text.
+func textCell(text string) tableCell {
+	return tableCell{value: text}
+}
+
+// intCell returns the tableCell of the given integer.
+func intCell(val int) tableCell {
+	return tableCell{value: strconv.Itoa(val), isNumber: true}
+}
+
+// amountCell returns the tableCell of the given amount of money.
+func amountCell(val float32) tableCell {
+	return tableCell{value: strconv.FormatFloat(float64(val), 'f', -1, 32),
+		isNumber: true}
+}
+
+// dateCell returns the tableCell of the given date, written following the
+// export locale. The cell is empty for a zero date.
+func dateCell(date time.Time) tableCell {
+	if date.IsZero() {
+		return textCell("")
+	}
+	return textCell(date.Format(exportLocale.DateFormat))
+}
+
+// tableWriter writes a table in an exported spreadsheet, one row at a time.
+type tableWriter interface {
+	writeRow(cells []tableCell) error
+
+	// close ends the table. Nothing can be written after.
+	close() error
+}
+
+// csvTableWriter is the tableWriter of CSV files.
+type csvTableWriter struct {
+	w *csv.Writer
+}
+
+func newCsvTableWriter(w io.Writer, name string) tableWriter {
+	var cw = csv.NewWriter(w)
+	cw.Comma, _ = utf8.DecodeRuneInString(exportLocale.CsvSeparator)
+	return csvTableWriter{cw}
+}
+
+func (ctw csvTableWriter) writeRow(cells []tableCell) error {
+	var record = make([]string, len(cells))
+	for i, cell := range cells {
+		if cell.isNumber {
+			record[i] = strings.Replace(cell.value, ".",
+				exportLocale.DecimalSeparator, 1)
+		} else if strings.IndexAny(cell.value, "=+-@") == 0 {
+			// spreadsheets would read those as formulas
+			record[i] = "'" + cell.value
+		} else {
+			record[i] = cell.value
+		}
+	}
+	return ctw.w.Write(record)
+}
+
+func (ctw csvTableWriter) close() error {
+	ctw.w.Flush()
+	return ctw.w.Error()
+}
+
+// xlsxTableWriter is the tableWriter of Excel workbooks. The table is the
+// workbook's single sheet.
+type xlsxTableWriter struct {
+	zw    *zip.Writer
+	sheet io.Writer
+	name  string
+
+	// first error encountered, nothing is written after it
+	err error
+}
+
+// files of an Excel workbook other than its sheet, with a %s for the sheet
+// name in the workbook
+var xlsx_files = [][2]string{
+	{"[Content_Types].xml", `<?xml version="1.0" encoding="UTF-8" ` +
+		`standalone="yes"?>` +
+		`<Types xmlns="http://schemas.openxmlformats.org/package/2006/` +
+		`content-types">` +
+		`<Default Extension="rels" ContentType="application/` +
+		`vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/` +
+		`vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+		`<Override PartName="/xl/worksheets/sheet1.xml" ` +
+		`ContentType="application/` +
+		`vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+		`</Types>`},
+	{"_rels/.rels", `<?xml version="1.0" encoding="UTF-8" ` +
+		`standalone="yes"?>` +
+		`<Relationships xmlns="http://schemas.openxmlformats.org/package/` +
+		`2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/` +
+		`officeDocument/2006/relationships/officeDocument" ` +
+		`Target="xl/workbook.xml"/>` +
+		`</Relationships>`},
+	{"xl/workbook.xml", `<?xml version="1.0" encoding="UTF-8" ` +
+		`standalone="yes"?>` +
+		`<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/` +
+		`2006/main" xmlns:r="http://schemas.openxmlformats.org/` +
+		`officeDocument/2006/relationships">` +
+		`<sheets><sheet name="%s" sheetId="1" r:id="rId1"/></sheets>` +
+		`</workbook>`},
+	{"xl/_rels/workbook.xml.rels", `<?xml version="1.0" encoding="UTF-8" ` +
+		`standalone="yes"?>` +
+		`<Relationships xmlns="http://schemas.openxmlformats.org/package/` +
+		`2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/` +
+		`officeDocument/2006/relationships/worksheet" ` +
+		`Target="worksheets/sheet1.xml"/>` +
+		`</Relationships>`},
+}
+
+func newXlsxTableWriter(w io.Writer, name string) tableWriter {
+	var xtw = &xlsxTableWriter{zw: zip.NewWriter(w), name: name}
+	xtw.sheet, xtw.err = xtw.zw.Create("xl/worksheets/sheet1.xml")
+	xtw.writeString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` +
+		`<worksheet xmlns="http://schemas.openxmlformats.org/` +
+		`spreadsheetml/2006/main"><sheetData>`)
+	return xtw
+}
+
+// writeString writes s in the sheet, unless an error was encountered.
+func (xtw *xlsxTableWriter) writeString(s string) {
+	if xtw.err == nil {
+		_, xtw.err = io.WriteString(xtw.sheet, s)
+	}
+}
+
+// escapeXml returns s escaped to be written as XML text.
+func escapeXml(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+func (xtw *xlsxTableWriter) writeRow(cells []tableCell) error {
+	var b strings.Builder
+	b.WriteString("<row>")
+	for _, cell := range cells {
+		if cell.isNumber {
+			b.WriteString("<c><v>" + cell.value + "</v></c>")
+		} else {
+			b.WriteString(`<c t="inlineStr"><is><t xml:space="preserve">` +
+				escapeXml(cell.value) + "</t></is></c>")
+		}
+	}
+	b.WriteString("</row>")
+	xtw.writeString(b.String())
+	return xtw.err
+}
+
+func (xtw *xlsxTableWriter) close() error {
+	xtw.writeString("</sheetData></worksheet>")
+	for _, file := range xlsx_files {
+		if xtw.err != nil {
+			return xtw.err
+		}
+		var f io.Writer
+		if f, xtw.err = xtw.zw.Create(file[0]); xtw.err == nil {
+			_, xtw.err = io.WriteString(f, strings.Replace(file[1], "%s",
+				escapeXml(xtw.name), 1))
+		}
+	}
+	if xtw.err != nil {
+		return xtw.err
+	}
+	return xtw.zw.Close()
+}
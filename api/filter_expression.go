@@ -0,0 +1,378 @@
+package api
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/peaberberian/GoBanks/database"
+)
+
+// Filter expressions are given in the "filter" query string property of
+// some list APIs, to combine conditions which cannot be expressed with the
+// other properties.
+// example: filter=(category in [3,4] or label ~ "uber") and debit > 20
+//
+// Grammar (keywords are case-insensitive):
+//   expression := and_expr { "or" and_expr }
+//   and_expr   := term { "and" term }
+//   term       := "(" expression ")" | comparison
+//   comparison := field operator value | field "in" "[" value { "," value } "]"
+//   operator   := "=" | "!=" | ">" | ">=" | "<" | "<=" | "~"
+//   value      := number | string between double quotes
+//
+// "~" means "contains" and is only usable on text fields. Dates are given
+// as ms timestamps.
+
+// Maximum length of a filter expression and maximum nesting of its
+// parentheses, to limit the size of the generated queries.
+const (
+	max_filter_expression_length = 1000
+	max_filter_expression_depth  = 10
+)
+
+// Kinds of value a filterable field accepts
+const (
+	intFilterField = iota
+	floatFilterField
+	stringFilterField
+	timeFilterField
+)
+
+// filterableField describes a field which can be used in a filter
+// expression.
+type filterableField struct {
+	// name of the property in the database struct (e.g. "TransactionDate")
+	property string
+
+	// kind of the values it is compared to (e.g. timeFilterField)
+	kind int
+}
+
+// Types of the tokens of a filter expression
+const (
+	endToken = iota
+	identToken
+	numberToken
+	stringToken
+	operatorToken
+	punctuationToken
+)
+
+type filterToken struct {
+	kind  int
+	text  string
+	start int
+}
+
+// filterParser is a recursive descent parser for filter expressions.
+type filterParser struct {
+	tokens     []filterToken
+	pos        int
+	depth      int
+	filterable map[string]filterableField
+}
+
+// parseFilterExpression parses a filter expression, only allowing the
+// given fields. Returns an invalidFilterExpressionError describing the
+// first problem encountered if the expression is not valid.
+func parseFilterExpression(str string,
+	filterable map[string]filterableField) (database.DBFilterExpression,
+	error) {
+
+	if len(str) > max_filter_expression_length {
+		return database.DBFilterExpression{}, invalidFilterExpressionError{
+			max_filter_expression_length, "expression too long"}
+	}
+
+	tokens, err := tokenizeFilterExpression(str)
+	if err != nil {
+		return database.DBFilterExpression{}, err
+	}
+
+	var p = filterParser{tokens: tokens, filterable: filterable}
+	expr, err := p.parseOr()
+	if err != nil {
+		return database.DBFilterExpression{}, err
+	}
+	if tok := p.peek(); tok.kind != endToken {
+		return database.DBFilterExpression{}, invalidFilterExpressionError{
+			tok.start, "unexpected \"" + tok.text + "\""}
+	}
+	return expr, nil
+}
+
+// tokenizeFilterExpression splits a filter expression into tokens. The
+// last token is always an endToken.
+func tokenizeFilterExpression(str string) ([]filterToken, error) {
+	var tokens []filterToken
+	var runes = []rune(str)
+
+	for i := 0; i < len(runes); {
+		var r = runes[i]
+		var start = i
+
+		switch {
+		case unicode.IsSpace(r):
+			i++
+			continue
+		case strings.ContainsRune("()[],", r):
+			i++
+			tokens = append(tokens,
+				filterToken{punctuationToken, string(r), start})
+		case strings.ContainsRune("=!<>~", r):
+			i++
+			if i < len(runes) && runes[i] == '=' && r != '=' && r != '~' {
+				i++
+			}
+			var op = string(runes[start:i])
+			if op == "!" {
+				return nil, invalidFilterExpressionError{start,
+					"unknown operator \"!\""}
+			}
+			tokens = append(tokens, filterToken{operatorToken, op, start})
+		case r == '"':
+			text, end, ok := readFilterString(runes, i)
+			if !ok {
+				return nil, invalidFilterExpressionError{start,
+					"unclosed string"}
+			}
+			i = end
+			tokens = append(tokens, filterToken{stringToken, text, start})
+		case r == '-' || r == '.' || unicode.IsDigit(r):
+			i++
+			for i < len(runes) && (runes[i] == '.' || unicode.IsDigit(runes[i])) {
+				i++
+			}
+			tokens = append(tokens,
+				filterToken{numberToken, string(runes[start:i]), start})
+		case r == '_' || unicode.IsLetter(r):
+			for i < len(runes) && (runes[i] == '_' ||
+				unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i])) {
+				i++
+			}
+			tokens = append(tokens,
+				filterToken{identToken, string(runes[start:i]), start})
+		default:
+			return nil, invalidFilterExpressionError{start,
+				"unexpected character \"" + string(r) + "\""}
+		}
+	}
+	return append(tokens, filterToken{endToken, "end of expression",
+		len(runes)}), nil
+}
+
+// readFilterString reads a string between double quotes beginning at the
+// given position. A backslash escapes the following character.
+// Returns the unescaped string and the position following it.
+func readFilterString(runes []rune, start int) (string, int, bool) {
+	var text []rune
+	for i := start + 1; i < len(runes); i++ {
+		switch runes[i] {
+		case '\\':
+			if i+1 < len(runes) {
+				i++
+				text = append(text, runes[i])
+			}
+		case '"':
+			return string(text), i + 1, true
+		default:
+			text = append(text, runes[i])
+		}
+	}
+	return "", len(runes), false
+}
+
+func (p *filterParser) peek() filterToken {
+	return p.tokens[p.pos]
+}
+
+func (p *filterParser) next() filterToken {
+	var tok = p.tokens[p.pos]
+	if tok.kind != endToken {
+		p.pos++
+	}
+	return tok
+}
+
+// isKeyword checks if the next token is the given keyword.
+func (p *filterParser) isKeyword(keyword string) bool {
+	var tok = p.peek()
+	return tok.kind == identToken && strings.EqualFold(tok.text, keyword)
+}
+
+// expect consumes the next token, which should be the given punctuation.
+func (p *filterParser) expect(punctuation string) error {
+	var tok = p.next()
+	if tok.kind != punctuationToken || tok.text != punctuation {
+		return invalidFilterExpressionError{tok.start,
+			"expected \"" + punctuation + "\", got \"" + tok.text + "\""}
+	}
+	return nil
+}
+
+// parseOr parses an expression.
+func (p *filterParser) parseOr() (database.DBFilterExpression, error) {
+	return p.parseOperands(database.ExpressionOr, p.parseAnd)
+}
+
+// parseAnd parses an and_expr.
+func (p *filterParser) parseAnd() (database.DBFilterExpression, error) {
+	return p.parseOperands(database.ExpressionAnd, p.parseTerm)
+}
+
+// parseOperands parses operands separated by the given keyword. A single
+// operand is returned as is.
+func (p *filterParser) parseOperands(keyword string,
+	parseOperand func() (database.DBFilterExpression, error),
+) (database.DBFilterExpression, error) {
+
+	first, err := parseOperand()
+	if err != nil {
+		return first, err
+	}
+	if !p.isKeyword(keyword) {
+		return first, nil
+	}
+
+	var expr = database.DBFilterExpression{Operator: keyword,
+		Operands: []database.DBFilterExpression{first}}
+	for p.isKeyword(keyword) {
+		p.next()
+		operand, err := parseOperand()
+		if err != nil {
+			return expr, err
+		}
+		expr.Operands = append(expr.Operands, operand)
+	}
+	return expr, nil
+}
+
+// parseTerm parses a term.
+func (p *filterParser) parseTerm() (database.DBFilterExpression, error) {
+	var tok = p.peek()
+	if tok.kind != punctuationToken || tok.text != "(" {
+		return p.parseComparison()
+	}
+
+	p.next()
+	if p.depth++; p.depth > max_filter_expression_depth {
+		return database.DBFilterExpression{}, invalidFilterExpressionError{
+			tok.start, "too many nested parentheses"}
+	}
+	expr, err := p.parseOr()
+	if err != nil {
+		return expr, err
+	}
+	p.depth--
+	return expr, p.expect(")")
+}
+
+// parseComparison parses a comparison.
+func (p *filterParser) parseComparison() (database.DBFilterExpression,
+	error) {
+
+	var expr database.DBFilterExpression
+
+	var fieldTok = p.next()
+	if fieldTok.kind != identToken {
+		return expr, invalidFilterExpressionError{fieldTok.start,
+			"expected a field, got \"" + fieldTok.text + "\""}
+	}
+	field, ok := p.filterable[fieldTok.text]
+	if !ok {
+		return expr, invalidFilterExpressionError{fieldTok.start,
+			"unknown field \"" + fieldTok.text + "\", expected one of " +
+				strings.Join(filterableFieldNames(p.filterable), ", ")}
+	}
+	expr.Field = field.property
+
+	if p.isKeyword("in") {
+		p.next()
+		expr.Operator = database.ExpressionIn
+		if err := p.expect("["); err != nil {
+			return expr, err
+		}
+		for {
+			val, err := p.parseValue(field)
+			if err != nil {
+				return expr, err
+			}
+			expr.Values = append(expr.Values, val)
+			if tok := p.peek(); tok.kind != punctuationToken ||
+				tok.text != "," {
+				break
+			}
+			p.next()
+		}
+		return expr, p.expect("]")
+	}
+
+	var opTok = p.next()
+	if opTok.kind != operatorToken {
+		return expr, invalidFilterExpressionError{opTok.start,
+			"expected an operator, got \"" + opTok.text + "\""}
+	}
+	if opTok.text == database.ExpressionContains &&
+		field.kind != stringFilterField {
+		return expr, invalidFilterExpressionError{opTok.start,
+			"\"~\" can only be used on text fields"}
+	}
+	expr.Operator = opTok.text
+
+	val, err := p.parseValue(field)
+	if err != nil {
+		return expr, err
+	}
+	expr.Values = []interface{}{val}
+	return expr, nil
+}
+
+// parseValue parses a value and converts it to the type of the given field.
+func (p *filterParser) parseValue(field filterableField) (interface{},
+	error) {
+
+	var tok = p.next()
+	if field.kind == stringFilterField {
+		if tok.kind != stringToken {
+			return nil, invalidFilterExpressionError{tok.start,
+				"expected a string between double quotes, got \"" +
+					tok.text + "\""}
+		}
+		return tok.text, nil
+	}
+
+	var invalidErr = invalidFilterExpressionError{tok.start,
+		"expected a number, got \"" + tok.text + "\""}
+	if tok.kind != numberToken {
+		return nil, invalidErr
+	}
+
+	switch field.kind {
+	case intFilterField:
+		if val, err := strconv.Atoi(tok.text); err == nil {
+			return val, nil
+		}
+	case floatFilterField:
+		if val, err := strconv.ParseFloat(tok.text, 32); err == nil {
+			return float32(val), nil
+		}
+	case timeFilterField:
+		if val, err := strconv.ParseInt(tok.text, 10, 64); err == nil {
+			return int64TimeStampToTime(val), nil
+		}
+	}
+	return nil, invalidErr
+}
+
+// filterableFieldNames returns the field names usable in a filter
+// expression.
+func filterableFieldNames(filterable map[string]filterableField) []string {
+	var names []string
+	for name := range filterable {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
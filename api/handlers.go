@@ -1,62 +1,170 @@
 package api
 
-import "log"
-import "net/http"
-
 import "github.com/peaberberian/GoBanks/auth"
 
-var apiCalls = map[string]string{
-	"authentication": "auth",
-	"transactions":   "transactions",
-	"banks":          "banks",
-	"accounts":       "accounts",
-	"categories":     "categories",
-	"users":          "users",
-}
+// newV1Router creates the router for all calls concerning the API version 1
+func newV1Router(prefix string) *router {
+	var rt = newRouter(prefix)
+
+	// only routes where the token shouldn't be needed
+	rt.handle("POST", "/authentication", handleAuthentication)
+	// second step of a two-factor login
+	rt.handle("POST", "/authentication/mfa", handleMFAAuthentication)
+	// catalogue of every error code
+	rt.handle("GET", "/errors", handleErrorCodeRead)
+
+	var authenticated = rt.with(withAuthentication)
+
+	var transactions = authenticated.with(withScope("transactions"))
+	transactions.handle("GET", "/transactions", handleTransactionRead)
+	transactions.handle("POST", "/transactions", handleTransactionCreate)
+	transactions.handle("PUT", "/transactions", handleTransactionReplace)
+	transactions.handle("DELETE", "/transactions", handleTransactionDelete)
+	transactions.handle("GET", "/transactions/{id:int}", handleTransactionRead)
+	transactions.handle("PUT", "/transactions/{id:int}",
+		handleTransactionUpdate)
+	transactions.handle("PATCH", "/transactions/{id:int}",
+		handleTransactionUpdate)
+	transactions.handle("DELETE", "/transactions/{id:int}",
+		handleTransactionDelete)
+	transactions.handle("GET", "/accounts/{accountId:int}/transactions",
+		handleTransactionRead)
+
+	// files attached to transactions
+	transactions.handle("GET", "/transactions/{id:int}/attachments",
+		handleAttachmentRead)
+	transactions.handle("POST", "/transactions/{id:int}/attachments",
+		handleAttachmentCreate)
+	transactions.handle("GET",
+		"/transactions/{id:int}/attachments/{attachmentId:int}",
+		handleAttachmentDownload)
+	transactions.handle("DELETE",
+		"/transactions/{id:int}/attachments/{attachmentId:int}",
+		handleAttachmentDelete)
+
+	var banks = authenticated.with(withScope("banks"))
+	banks.handle("GET", "/banks", handleBankRead)
+	banks.handle("POST", "/banks", handleBankCreate)
+	banks.handle("PUT", "/banks", handleBankReplace)
+	banks.handle("DELETE", "/banks", handleBankDelete)
+	banks.handle("GET", "/banks/{id:int}", handleBankRead)
+	banks.handle("PUT", "/banks/{id:int}", handleBankUpdate)
+	banks.handle("PATCH", "/banks/{id:int}", handleBankUpdate)
+	banks.handle("DELETE", "/banks/{id:int}", handleBankDelete)
+
+	var accounts = authenticated.with(withScope("accounts"))
+	accounts.handle("GET", "/accounts", handleAccountRead)
+	accounts.handle("POST", "/accounts", handleAccountCreate)
+	accounts.handle("PUT", "/accounts", handleAccountReplace)
+	accounts.handle("DELETE", "/accounts", handleAccountDelete)
+	accounts.handle("GET", "/accounts/{id:int}", handleAccountRead)
+	accounts.handle("PUT", "/accounts/{id:int}", handleAccountUpdate)
+	accounts.handle("PATCH", "/accounts/{id:int}", handleAccountUpdate)
+	accounts.handle("DELETE", "/accounts/{id:int}", handleAccountDelete)
+
+	var categories = authenticated.with(withScope("categories"))
+	categories.handle("GET", "/categories", handleCategoryRead)
+	categories.handle("POST", "/categories", handleCategoryCreate)
+	categories.handle("PUT", "/categories", handleCategoryReplace)
+	categories.handle("DELETE", "/categories", handleCategoryDelete)
+	categories.handle("GET", "/categories/{id:int}", handleCategoryRead)
+	categories.handle("PUT", "/categories/{id:int}", handleCategoryUpdate)
+	categories.handle("PATCH", "/categories/{id:int}", handleCategoryUpdate)
+	categories.handle("DELETE", "/categories/{id:int}", handleCategoryDelete)
+
+	// tags, set on transactions in addition to their category
+	var tags = authenticated.with(withScope("tags"))
+	tags.handle("GET", "/tags", handleTagRead)
+	tags.handle("POST", "/tags", handleTagCreate)
+	tags.handle("GET", "/tags/{id:int}", handleTagRead)
+	tags.handle("PUT", "/tags/{id:int}", handleTagUpdate)
+	tags.handle("PATCH", "/tags/{id:int}", handleTagUpdate)
+	tags.handle("DELETE", "/tags/{id:int}", handleTagDelete)
+	tags.handle("POST", "/transactions/tags", handleTransactionTagBulk)
+	tags.handle("GET", "/transactions/{id:int}/tags", handleTransactionTagRead)
+	tags.handle("POST", "/transactions/{id:int}/tags",
+		handleTransactionTagAdd)
+	tags.handle("DELETE", "/transactions/{id:int}/tags/{tagId:int}",
+		handleTransactionTagRemove)
+
+	var reports = authenticated.with(withScope("reports"))
+	reports.handle("GET", "/report/tags", handleTagReport)
+
+	// shares concern whole banks and accounts, which a token restricted to
+	// some accounts should not manage
+	var shares = authenticated.with(withScope("shares"), withUnrestrictedToken)
+	shares.handle("GET", "/shares", handleShareRead)
+	shares.handle("POST", "/shares", handleShareCreate)
+	shares.handle("GET", "/shares/{id:int}", handleShareRead)
+	shares.handle("PUT", "/shares/{id:int}", handleShareUpdate)
+	shares.handle("DELETE", "/shares/{id:int}", handleShareDelete)
 
-// handlerV1 is the handler for all calls concerning the API version 1
-func handlerV1(w http.ResponseWriter, r *http.Request) {
-	var route = getApiRoute(r.URL.Path)
-	log.Println("Request received for API:", route)
+	// operations on the resources above, performed in a single transaction
+	authenticated.handle("POST", "/batch", newBatchHandler(rt))
 
-	w.Header().Set("content-type", "application/json")
+	// routes which cannot be accessed with a personal access token
+	var userOnly = authenticated.with(withScope(""))
 
-	var token auth.UserToken
+	// enrollment in and removal of two-factor authentication
+	userOnly.handle("POST", "/mfa", handleMFAEnrollment)
+	userOnly.handle("POST", "/mfa/confirm", handleMFAConfirmation)
+	userOnly.handle("DELETE", "/mfa", handleMFADisable)
 
-	// only route where the token shouldn't be needed
-	if route != apiCalls["authentication"] {
-		var tokenString = getTokenFromRequest(r)
-		var err error
-		token, err = auth.ParseToken(tokenString)
-		if err != nil {
-			handleError(w, err)
-			return
-		}
+	userOnly.handle("GET", "/logins", handleLoginRead)
+
+	userOnly.handle("GET", "/tokens", handlePersonalTokenRead)
+	userOnly.handle("POST", "/tokens", handlePersonalTokenCreate)
+	userOnly.handle("DELETE", "/tokens/{id:int}", handlePersonalTokenDelete)
+
+	// stream of the modifications of the user's data
+	userOnly.handle("GET", "/events", handleEventRead)
+
+	// events sent to URLs registered by the user
+	userOnly.handle("GET", "/webhooks", handleWebhookRead)
+	userOnly.handle("POST", "/webhooks", handleWebhookCreate)
+	userOnly.handle("DELETE", "/webhooks/{id:int}", handleWebhookDelete)
+	userOnly.handle("GET", "/webhooks/{id:int}/deliveries",
+		handleWebhookDeliveryRead)
+
+	// rules checked on the user's data and the alerts they fired
+	userOnly.handle("GET", "/alerts", handleAlertRead)
+	userOnly.handle("GET", "/alerts/rules", handleAlertRuleRead)
+	userOnly.handle("POST", "/alerts/rules", handleAlertRuleCreate)
+	userOnly.handle("DELETE", "/alerts/rules/{id:int}", handleAlertRuleDelete)
+
+	// backup and restoration of the whole data of the user
+	userOnly.handle("GET", "/export", handleArchiveExport)
+	userOnly.handle("POST", "/import", handleArchiveImport)
+
+	// statistics of the database cache, for administrators
+	userOnly.handle("GET", "/cache", handleCacheRead)
+
+	return rt
+}
+
+// checkTokenScope returns an error if the given token does not grant the
+// scope needed to call a route of the given resource with the given HTTP
+// method.
+// GET requests need the "<resource>:read" scope, the other methods the
+// "<resource>:write" one. An empty resource cannot be accessed with a
+// personal access token.
+func checkTokenScope(t *auth.UserToken, resource string,
+	method string) OperationError {
+
+	if !t.IsPersonalToken {
+		return nil
 	}
 
-	switch route {
-	case apiCalls["authentication"]:
-		handleAuthentication(w, r, &token)
-	case apiCalls["transactions"]:
-		handleTransactions(w, r, &token)
-	case apiCalls["banks"]:
-		handleBanks(w, r, &token)
-	case apiCalls["accounts"]:
-		handleAccounts(w, r, &token)
-	case apiCalls["categories"]:
-		handleCategories(w, r, &token)
-	default:
-		http.NotFound(w, r)
+	if resource == "" {
+		return insufficientScopeError{}
 	}
-}
 
-// routeIsInApi simply checks if the given route is in the
-// apiCalls map values
-func routeIsInApi(route string) bool {
-	for _, val := range apiCalls {
-		if val == route {
-			return true
-		}
+	var scope = resource + ":write"
+	if method == "GET" {
+		scope = resource + ":read"
+	}
+	if !t.HasScope(scope) {
+		return insufficientScopeError{scope}
 	}
-	return false
+	return nil
 }
@@ -12,54 +12,56 @@ import (
 // DBAccount properties gettable through this handler
 var gettable_account_fields = []string{
 	"Id",
+	"Version",
 	"BankId",
 	"Name",
 	"Description",
 }
 
-// handleAccounts is the main handler for call on the /accounts api. It
-// dispatches to other function based on the HTTP method used the typical
-// REST CRUD naming scheme.
-func handleAccounts(w http.ResponseWriter, r *http.Request,
-	t *auth.UserToken) {
+// DBAccount properties modified when an account is replaced through a PUT
+// request
+var updatable_account_fields = []string{
+	"BankId",
+	"Name",
+	"Description",
+}
 
-	switch r.Method {
-	case "GET":
-		handleAccountRead(w, r, t)
-	case "POST":
-		handleAccountCreate(w, r, t)
-	case "PUT":
-		handleAccountUpdate(w, r, t)
-	case "DELETE":
-		handleAccountDelete(w, r, t)
-	default:
-		handleNotSupportedMethod(w, r.Method)
-	}
+// DBAccount properties which can be used to sort the accounts, by their
+// name in the sort query string property
+var sortable_account_fields = map[string]sortableField{
+	"id":          {"Id", false},
+	"bankId":      {"BankId", false},
+	"name":        {"Name", false},
+	"description": {"Description", false},
 }
 
 // handleAccountRead handle GET requests on the /accounts API
 func handleAccountRead(w http.ResponseWriter, r *http.Request,
 	t *auth.UserToken) {
 
+	var db = getDatabase(r)
+
 	// look if we have an id (GET /accounts/35 => id == 35)
-	var id, hasIDinURL = getApiId(r.URL.Path)
+	var id, hasIDinURL = getApiId(r)
 
 	var queryString = r.URL.Query()
 	var f database.DBAccountFilters
 	var limit int
+	var pg pagination
 
-	// recuperate every bank attached to this user.
+	// recuperate every account this user can see (in his banks or shared
+	// with him).
 	// (blocking database request here :(, TODO see what I can do, cache?)
-	bankIds, err := getBankIdsForUserId(t.UserId)
+	accountIds, err := getAccountIdsForToken(db, t, viewerRole)
 	if err != nil {
 		handleError(w, queryOperationError{})
 		return
 	}
-	f.BankIds.SetFilter(bankIds)
+	f.Ids.SetFilter(accountIds)
 
 	// if an id was set in the url, filter to the record corresponding to it
 	if hasIDinURL {
-		f.Ids.SetFilter([]int{id})
+		f.Ids.SetFilter(intersectInts([]int{id}, accountIds))
 	} else {
 		// if only some bank account names are wanted, filter
 		wantedAccountNames, _ := queryStringPropertyToStringArray(queryString, "name")
@@ -70,7 +72,7 @@ func handleAccountRead(w http.ResponseWriter, r *http.Request,
 		// if only some bank account ids are wanted, filter
 		wantedAccountIds, _ := queryStringPropertyToIntArray(queryString, "id")
 		if len(wantedAccountIds) > 0 {
-			f.Ids.SetFilter(wantedAccountIds)
+			f.Ids.SetFilter(intersectInts(wantedAccountIds, accountIds))
 		}
 
 		// if only some bank ids are wanted, filter
@@ -81,10 +83,18 @@ func handleAccountRead(w http.ResponseWriter, r *http.Request,
 
 		// obtain limit of wanted records, if set
 		limit, _ = queryStringPropertyToInt(queryString, "limit")
+
+		// obtain the wanted order and position in the results, if set
+		pg, err = readPagination(queryString, sortable_account_fields)
+		if err != nil {
+			handleError(w, err)
+			return
+		}
+		pg.setFilters(&f.Sort, &f.After)
 	}
 
 	// perform the database request
-	vals, err := database.GoDB.GetAccounts(f, gettable_account_fields, uint(limit))
+	vals, err := db.GetAccounts(f, gettable_account_fields, uint(limit))
 	if err != nil {
 		handleError(w, queryOperationError{})
 		return
@@ -93,13 +103,28 @@ func handleAccountRead(w http.ResponseWriter, r *http.Request,
 	// if an id was given, we're awaiting an object, not an array.
 	if hasIDinURL {
 		if len(vals) == 0 {
-			fmt.Fprintf(w, "{}")
-		} else {
+			handleError(w, notFoundError{})
+		} else if !handleNotModified(w, r, versionETag(vals[0].Version)) {
 			fmt.Fprintf(w, generateAccountResponse(vals[0]))
 		}
 		return
 	}
 
+	// count every result and give the link to the next ones
+	total, err := db.CountAccounts(f)
+	if err != nil {
+		handleError(w, queryOperationError{})
+		return
+	}
+	pg.setHeaders(w, r, total, len(vals), limit,
+		func(property string) interface{} {
+			return accountSortValue(vals[len(vals)-1], property)
+		})
+	if handleNotModified(w, r, listETag(total, len(vals),
+		func(i int) (int, int) { return vals[i].Id, vals[i].Version })) {
+		return
+	}
+
 	// else respond directly with the result
 	if len(vals) == 0 {
 		fmt.Fprintf(w, "[]")
@@ -112,15 +137,17 @@ func handleAccountRead(w http.ResponseWriter, r *http.Request,
 func handleAccountCreate(w http.ResponseWriter, r *http.Request,
 	t *auth.UserToken) {
 
-	// you cannot post on a specific id, reject if you want to do that
-	if _, hasID := getApiId(r.URL.Path); hasID {
-		handleNotSupportedMethod(w, r.Method)
+	var db = getDatabase(r)
+
+	// a token restricted to some accounts cannot create new ones
+	if err := checkUnrestrictedToken(t); err != nil {
+		handleError(w, err)
 		return
 	}
 
-	// recuperate every bank attached to this user.
+	// recuperate every bank this user can add accounts to.
 	// (blocking database request here :(, TODO see what I can do, cache?)
-	bankIds, err := getBankIdsForUserId(t.UserId)
+	bankIds, err := getBankIdsForToken(db, t, editorRole)
 	if err != nil {
 		handleError(w, queryOperationError{})
 		return
@@ -148,48 +175,40 @@ func handleAccountCreate(w http.ResponseWriter, r *http.Request,
 	}
 
 	// perform database add request
-	account, err := database.GoDB.AddAccount(accountElem)
+	account, err := db.AddAccount(accountElem)
 	if err != nil {
 		handleError(w, queryOperationError{})
 		return
 	}
 
+	handleCreated(w, r, account.Id)
 	fmt.Fprintf(w, generateAccountResponse(account))
 }
 
-// handleAccountUpdate handle PUT requests on the /accounts API
+// handleAccountUpdate handle PUT and PATCH requests on the /accounts/{id}
+// API. PUT replaces the whole account, PATCH only modifies the properties
+// present in its JSON merge patch body (see accountPatchToParams).
 func handleAccountUpdate(w http.ResponseWriter, r *http.Request,
 	t *auth.UserToken) {
 
-	// look if we have an id (GET /accounts/35 => id == 35)
-	var id, hasID = getApiId(r.URL.Path)
+	var db = getDatabase(r)
 
-	// if an id was found, it means that we want to replace an element
-	// redirect to the right function
-	if !hasID {
-		handleAccountReplace(w, r, t)
-		return
-	}
+	// id of the wanted element (PUT /accounts/35 => id == 35)
+	var id, _ = getApiId(r)
 
-	// recuperate every bank ids associated to this user
-	// (blocking database request here :(, TODO see what I can do, cache?)
-	bankIds, err := getBankIdsForUserId(t.UserId)
-	if err != nil {
-		handleError(w, queryOperationError{})
-		return
-	}
+	setAcceptPatchHeader(w)
 
-	// recuperate every account ids associated to this user
+	// if the user cannot modify the wanted account, reject
 	// (blocking database request here :(, TODO see what I can do, cache?)
-	accountIds, err := getAccountIdsForBankIds(bankIds)
-	if err != nil {
-		handleError(w, queryOperationError{})
+	if err := checkPermissionForAccount(db, t, id, editorRole); err != nil {
+		handleError(w, err)
 		return
 	}
 
-	// if the wanted account does not belong to the user, reject
-	if !intInArray(id, accountIds) {
-		handleError(w, notPermittedOperationError{})
+	// the If-Match header gives the versions which can be modified
+	versions, err := readIfMatchVersions(r)
+	if err != nil {
+		handleError(w, err)
 		return
 	}
 
@@ -200,85 +219,166 @@ func handleAccountUpdate(w http.ResponseWriter, r *http.Request,
 		return
 	}
 
-	// -- check fields and update only the ones there --
-
 	var fields []string
 	var accountElem database.DBAccountParams
 
-	if val, ok := bodyMap["name"]; ok {
-		if str, ok := val.(string); !ok {
-			handleError(w, bodyParsingError{})
-			return
-		} else {
-			accountElem.Name = str
-			fields = append(fields, "Name")
-		}
+	if r.Method == "PATCH" {
+		accountElem, fields, err = accountPatchToParams(bodyMap)
+	} else {
+		accountElem, err = inputToAccountParams(bodyMap)
+		fields = updatable_account_fields
+	}
+	if err != nil {
+		handleError(w, err)
+		return
 	}
-	if val, ok := bodyMap["description"]; ok {
-		if str, ok := val.(string); !ok {
-			handleError(w, bodyParsingError{})
+
+	// if the account is moved, check that the user can move it
+	if stringInArray("BankId", fields) {
+		if err := checkAccountMove(db, t, id, accountElem.BankId); err != nil {
+			handleError(w, err)
 			return
-		} else {
-			accountElem.Description = str
-			fields = append(fields, "Description")
 		}
 	}
 
+	// an empty patch does not modify anything
+	if len(fields) == 0 {
+		handleSuccess(w, r)
+		return
+	}
+
 	// Filter the account id
 	var f database.DBAccountFilters
 	f.Ids.SetFilter([]int{id})
+	if len(versions) > 0 {
+		f.Versions.SetFilter(versions)
+	}
 
 	// perform the database request
-	if err = database.GoDB.UpdateAccounts(f, fields,
+	if err = db.UpdateAccounts(f, fields,
 		accountElem); err != nil {
-		handleError(w, queryOperationError{})
+		handleError(w, versionedWriteError(err))
 		return
 	}
 
+	setUpdatedETag(w, versions)
 	handleSuccess(w, r)
 }
 
-// handleAccountDelete handle DELETE requests on the /accounts API
-func handleAccountDelete(w http.ResponseWriter, r *http.Request,
-	t *auth.UserToken) {
+// checkPermissionForAccount checks if an user related to the given token
+// can access the given account with at least the given role. It returns a
+// notFoundError if the user cannot see this account, a
+// notPermittedOperationError if he can but without the given role, or an
+// error if the database query failed.
+func checkPermissionForAccount(db database.GoBanksDataBase,
+	t *auth.UserToken, accountId int, minRole string) OperationError {
 
-	// look if we have an id (GET /banks/35 => id == 35)
-	var id, hasID = getApiId(r.URL.Path)
+	accountIds, err := getAccountIdsForToken(db, t, viewerRole)
+	if err != nil {
+		return queryOperationError{}
+	}
+	if !intInArray(accountId, accountIds) {
+		return notFoundError{}
+	}
+	if minRole == viewerRole {
+		return nil
+	}
+
+	accountIds, err = getAccountIdsForToken(db, t, minRole)
+	if err != nil {
+		return queryOperationError{}
+	}
+	if !intInArray(accountId, accountIds) {
+		return notPermittedOperationError{}
+	}
+	return nil
+}
+
+// checkAccountMove returns an error if the user cannot move the given
+// account to the given bank: he has to own the account, as it leaves the
+// bank it may be shared through, and to be able to add accounts to its new
+// bank. Keeping the account in its current bank only needs the editor
+// role, already checked by the caller.
+func checkAccountMove(db database.GoBanksDataBase, t *auth.UserToken,
+	id int, bankId int) error {
 
 	var f database.DBAccountFilters
+	f.Ids.SetFilter([]int{id})
+	accs, err := db.GetAccounts(f, []string{"BankId"}, 1)
+	if err != nil {
+		return queryOperationError{}
+	}
+	if len(accs) > 0 && accs[0].BankId == bankId {
+		return nil
+	}
 
-	// recuperate every bank ids associated to this user
 	// (blocking database request here :(, TODO see what I can do, cache?)
-	bankIds, err := getBankIdsForUserId(t.UserId)
+	if err := checkPermissionForAccount(db, t, id, ownerRole); err != nil {
+		return err
+	}
+
+	// (blocking database request here :(, TODO see what I can do, cache?)
+	bankIds, err := getBankIdsForToken(db, t, editorRole)
 	if err != nil {
-		handleError(w, queryOperationError{})
-		return
+		return queryOperationError{}
 	}
+	if !intInArray(bankId, bankIds) {
+		return notPermittedOperationError{}
+	}
+	return nil
+}
+
+// handleAccountDelete handle DELETE requests on the /accounts API
+func handleAccountDelete(w http.ResponseWriter, r *http.Request,
+	t *auth.UserToken) {
+
+	var db = getDatabase(r)
+
+	// look if we have an id (GET /banks/35 => id == 35)
+	var id, hasID = getApiId(r)
+
+	var f database.DBAccountFilters
 
 	// if we have an id, check permission and set filter
 	if hasID {
-		// recuperate every account ids associated to this user
 		// (blocking database request here :(, TODO see what I can do, cache?)
-		accountIds, err := getAccountIdsForBankIds(bankIds)
-		if err != nil {
-			handleError(w, queryOperationError{})
+		if err := checkPermissionForAccount(db, t, id, ownerRole); err != nil {
+			handleError(w, err)
 			return
 		}
 
-		// (blocking database request here :(, TODO see what I can do, cache?)
-		if !intInArray(id, accountIds) {
-			handleError(w, notPermittedOperationError{})
+		// the If-Match header gives the versions which can be removed
+		versions, err := readIfMatchVersions(r)
+		if err != nil {
+			handleError(w, err)
 			return
 		}
 		f.Ids.SetFilter([]int{id})
+		if len(versions) > 0 {
+			f.Versions.SetFilter(versions)
+		}
 	} else {
+		if err := checkUnrestrictedToken(t); err != nil {
+			handleError(w, err)
+			return
+		}
+
+		// recuperate every bank ids associated to this user (banks shared
+		// with him are not concerned)
+		// (blocking database request here :(, TODO see what I can do, cache?)
+		bankIds, err := getBankIdsForUserId(db, t.UserId)
+		if err != nil {
+			handleError(w, queryOperationError{})
+			return
+		}
+
 		// filter by bankId
 		f.BankIds.SetFilter(bankIds)
 	}
 
 	// perform the database request
-	if err := database.GoDB.RemoveAccounts(f); err != nil {
-		handleError(w, queryOperationError{})
+	if err := db.RemoveAccounts(f); err != nil {
+		handleError(w, versionedWriteError(err))
 		return
 	}
 	handleSuccess(w, r)
@@ -287,9 +387,23 @@ func handleAccountDelete(w http.ResponseWriter, r *http.Request,
 // handleAccountReplace handle specifically PUT requests on the main /accounts
 // API.
 // (not restricted to a certain id).
+// As every account not given is removed, it has to be confirmed (see
+// checkReplaceConfirmation).
 func handleAccountReplace(w http.ResponseWriter, r *http.Request,
 	t *auth.UserToken) {
 
+	var db = getDatabase(r)
+
+	if err := checkUnrestrictedToken(t); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	if err := checkReplaceConfirmation(r); err != nil {
+		handleError(w, err)
+		return
+	}
+
 	var bodyMaps, err = readBodyAsArrayOfStringMap(r.Body)
 	if err != nil {
 		handleError(w, queryOperationError{})
@@ -298,7 +412,7 @@ func handleAccountReplace(w http.ResponseWriter, r *http.Request,
 
 	// recuperate every account ids associated to this user
 	// (blocking database request here :(, TODO see what I can do, cache?)
-	bankIds, err := getBankIdsForUserId(t.UserId)
+	bankIds, err := getBankIdsForUserId(db, t.UserId)
 	if err != nil {
 		handleError(w, queryOperationError{})
 		return
@@ -323,21 +437,27 @@ func handleAccountReplace(w http.ResponseWriter, r *http.Request,
 		accs = append(accs, accElem)
 	}
 
-	// Remove old accounts linked to this user
-	var f database.DBAccountFilters
-	f.BankIds.SetFilter(bankIds)
+	// replace the accounts in a single transaction, to never lose them
+	err = db.WithTx(func(db database.GoBanksDataBase) error {
+		// Remove old accounts linked to this user
+		var f database.DBAccountFilters
+		f.BankIds.SetFilter(bankIds)
 
-	if err := database.GoDB.RemoveAccounts(f); err != nil {
-		handleError(w, queryOperationError{})
-		return
-	}
+		if err := db.RemoveAccounts(f); err != nil {
+			return err
+		}
 
-	// add each account indicated to the database
-	for _, acc := range accs {
-		if _, err := database.GoDB.AddAccount(acc); err != nil {
-			handleError(w, queryOperationError{})
-			return
+		// add each account indicated to the database
+		for _, acc := range accs {
+			if _, err := db.AddAccount(acc); err != nil {
+				return err
+			}
 		}
+		return nil
+	})
+	if err != nil {
+		handleError(w, queryOperationError{})
+		return
 	}
 	handleSuccess(w, r)
 }
@@ -375,6 +495,7 @@ func generateAccountsResponse(acc []database.DBAccount) string {
 func dbAccountToAccountJSON(acc database.DBAccount) AccountJSON {
 	return AccountJSON{
 		Id:          acc.Id,
+		Version:     acc.Version,
 		Name:        acc.Name,
 		Description: acc.Description,
 		BankId:      acc.BankId,
@@ -390,7 +511,7 @@ func inputToAccountParams(input map[string]interface{}) (database.DBAccountParam
 	// The "name" field is mandatory
 	res.Name, valid = input["name"].(string)
 	if !valid {
-		return res, missingParameterError{"name"}
+		return res, missingParameterError{"name", "string"}
 	}
 
 	// The "name" field is mandatory
@@ -398,7 +519,7 @@ func inputToAccountParams(input map[string]interface{}) (database.DBAccountParam
 	// (don't ask me why. It just werks...)
 	bankIDStr, valid := input["bankId"].(float64)
 	if !valid {
-		return res, missingParameterError{"bankId"}
+		return res, missingParameterError{"bankId", "number"}
 	}
 
 	res.BankId = int(bankIDStr)
@@ -407,6 +528,41 @@ func inputToAccountParams(input map[string]interface{}) (database.DBAccountParam
 	return res, nil
 }
 
+// accountPatchToParams reads the JSON merge patch (RFC 7396) given to
+// modify an account. It returns the new values and the properties to
+// update.
+func accountPatchToParams(patch map[string]interface{}) (
+	database.DBAccountParams, []string, error) {
+
+	var res database.DBAccountParams
+	var fields []string
+	var present bool
+	var err error
+
+	if res.BankId, present, err = readPatchInt(patch, "bankId",
+		true); err != nil {
+		return res, nil, err
+	} else if present {
+		fields = append(fields, "BankId")
+	}
+
+	if res.Name, present, err = readPatchString(patch, "name",
+		true); err != nil {
+		return res, nil, err
+	} else if present {
+		fields = append(fields, "Name")
+	}
+
+	if res.Description, present, err = readPatchString(patch, "description",
+		false); err != nil {
+		return res, nil, err
+	} else if present {
+		fields = append(fields, "Description")
+	}
+
+	return res, fields, nil
+}
+
 // // readBodyAsAccountParams generates a DBBankParams structs from the
 // // body passed with the given http request.
 // func readBodyAsAccountParamsArray(r io.reader) (database.DBAccountParams,
@@ -456,3 +612,19 @@ func inputToAccountParams(input map[string]interface{}) (database.DBAccountParam
 // 	}
 // 	return res, nil
 // }
+
+// accountSortValue returns the value of a sortable DBAccount property (see
+// sortable_account_fields).
+func accountSortValue(acc database.DBAccount, property string) interface{} {
+	switch property {
+	case "Id":
+		return acc.Id
+	case "BankId":
+		return acc.BankId
+	case "Name":
+		return acc.Name
+	case "Description":
+		return acc.Description
+	}
+	return nil
+}
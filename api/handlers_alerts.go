@@ -0,0 +1,272 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/mail"
+	"time"
+
+	"github.com/peaberberian/GoBanks/auth"
+	"github.com/peaberberian/GoBanks/database"
+)
+
+// handleAlertRead handle GET requests on the /alerts API, returning the
+// alerts fired by the rules of the user, the most recent first.
+// The ruleId query string property only returns the alerts of a rule.
+func handleAlertRead(w http.ResponseWriter, r *http.Request,
+	t *auth.UserToken) {
+
+	var db = getDatabase(r)
+	var queryString = r.URL.Query()
+
+	var f database.DBAlertFilters
+	f.UserId.SetFilter(t.UserId)
+	if ruleId, ok := queryStringPropertyToInt(queryString, "ruleId"); ok {
+		f.RuleIds.SetFilter([]int{ruleId})
+	}
+	f.Sort.SetFilter([]database.DBSortField{{Field: "Id", Descending: true}})
+
+	// obtain limit of wanted records, if set
+	limit, _ := queryStringPropertyToInt(queryString, "limit")
+
+	alts, err := db.GetAlerts(f, alert_fields, uint(limit))
+	if err != nil {
+		handleError(w, queryOperationError{})
+		return
+	}
+
+	var resJson = []AlertJSON{}
+	for _, alt := range alts {
+		resJson = append(resJson, dbAlertToAlertJSON(alt))
+	}
+	resBytes, err := json.Marshal(resJson)
+	if err != nil {
+		handleError(w, genericOperationError{})
+		return
+	}
+	w.Write(resBytes)
+}
+
+// handleAlertRuleRead handle GET requests on the /alerts/rules API
+func handleAlertRuleRead(w http.ResponseWriter, r *http.Request,
+	t *auth.UserToken) {
+
+	var db = getDatabase(r)
+
+	var f database.DBAlertRuleFilters
+	f.UserId.SetFilter(t.UserId)
+	rls, err := db.GetAlertRules(f, alert_rule_fields, 0)
+	if err != nil {
+		handleError(w, queryOperationError{})
+		return
+	}
+
+	var resJson = []AlertRuleJSON{}
+	for _, rl := range rls {
+		resJson = append(resJson, dbAlertRuleToAlertRuleJSON(rl))
+	}
+	resBytes, err := json.Marshal(resJson)
+	if err != nil {
+		handleError(w, genericOperationError{})
+		return
+	}
+	w.Write(resBytes)
+}
+
+// handleAlertRuleCreate handle POST requests on the /alerts/rules API
+func handleAlertRuleCreate(w http.ResponseWriter, r *http.Request,
+	t *auth.UserToken) {
+
+	var db = getDatabase(r)
+
+	// convert body to map[string]interface{}
+	bodyMap, err := readBodyAsStringMap(r.Body)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	kind, valid := bodyMap["kind"].(string)
+	if !valid {
+		handleError(w, missingParameterError{"kind", "string"})
+		return
+	}
+	if !stringInArray(kind, alert_kinds) {
+		handleError(w, invalidParameterError{"kind", "kind of alert"})
+		return
+	}
+
+	thresholdFl64, valid := bodyMap["threshold"].(float64)
+	if !valid {
+		handleError(w, missingParameterError{"threshold", "number"})
+		return
+	}
+	if kind == unusualSpendAlert && thresholdFl64 <= 0 {
+		handleError(w, invalidParameterError{"threshold", "positive number"})
+		return
+	}
+
+	var accountId, categoryId int
+	if accountIdFl64, ok := bodyMap["accountId"].(float64); ok {
+		accountId = int(accountIdFl64)
+	} else if kind == balanceBelowAlert {
+		handleError(w, missingParameterError{"accountId", "number"})
+		return
+	}
+	if categoryIdFl64, ok := bodyMap["categoryId"].(float64); ok {
+		categoryId = int(categoryIdFl64)
+	} else if kind == categorySpendAlert || kind == unusualSpendAlert {
+		handleError(w, missingParameterError{"categoryId", "number"})
+		return
+	}
+
+	// only the accounts the user can see and his own categories
+	if accountId != 0 {
+		accountIds, err := getAccountIdsForToken(db, t, viewerRole)
+		if err != nil {
+			handleError(w, queryOperationError{})
+			return
+		}
+		if !intInArray(accountId, accountIds) {
+			handleError(w, notPermittedOperationError{})
+			return
+		}
+	}
+	if categoryId != 0 {
+		var cf database.DBCategoryFilters
+		cf.Ids.SetFilter([]int{categoryId})
+		cf.UserId.SetFilter(t.UserId)
+		cats, err := db.GetCategories(cf, []string{"Id"}, 1)
+		if err != nil {
+			handleError(w, queryOperationError{})
+			return
+		}
+		if len(cats) == 0 {
+			handleError(w, notPermittedOperationError{})
+			return
+		}
+	}
+
+	var notifiers []string
+	notifiersArr, _ := bodyMap["notifiers"].([]interface{})
+	for _, val := range notifiersArr {
+		name, ok := val.(string)
+		if _, registered := alert_notifiers[name]; !ok || !registered {
+			handleError(w, invalidParameterError{"notifiers",
+				"array of notifier names"})
+			return
+		}
+		notifiers = append(notifiers, name)
+	}
+
+	var email string
+	if val, ok := bodyMap["email"]; ok {
+		email, ok = val.(string)
+		if !ok {
+			handleError(w, invalidParameterError{"email", "string"})
+			return
+		}
+		// only the address is kept, without any display name
+		addr, err := mail.ParseAddress(email)
+		if err != nil {
+			handleError(w, invalidParameterError{"email", "e-mail address"})
+			return
+		}
+		email = addr.Address
+	}
+
+	rl, err := db.AddAlertRule(database.DBAlertRuleParams{
+		UserId:       t.UserId,
+		Kind:         kind,
+		AccountId:    accountId,
+		CategoryId:   categoryId,
+		Threshold:    float32(thresholdFl64),
+		Notifiers:    notifiers,
+		Email:        email,
+		CreationDate: time.Now(),
+	})
+	if err != nil {
+		handleError(w, queryOperationError{})
+		return
+	}
+
+	resBytes, err := json.Marshal(dbAlertRuleToAlertRuleJSON(rl))
+	if err != nil {
+		handleError(w, genericOperationError{})
+		return
+	}
+	handleCreated(w, r, rl.Id)
+	w.Write(resBytes)
+}
+
+// handleAlertRuleDelete handle DELETE requests on the /alerts/rules API.
+// The alerts fired by the rule are removed with it.
+func handleAlertRuleDelete(w http.ResponseWriter, r *http.Request,
+	t *auth.UserToken) {
+
+	var db = getDatabase(r)
+
+	// id of the wanted element (DELETE /alerts/rules/35 => id == 35)
+	var id, _ = getApiId(r)
+
+	var f database.DBAlertRuleFilters
+	f.Ids.SetFilter([]int{id})
+	f.UserId.SetFilter(t.UserId)
+	rls, err := db.GetAlertRules(f, []string{"Id"}, 1)
+	if err != nil {
+		handleError(w, queryOperationError{})
+		return
+	}
+	if len(rls) == 0 {
+		handleError(w, notFoundError{})
+		return
+	}
+
+	err = db.WithTx(func(db database.GoBanksDataBase) error {
+		var af database.DBAlertFilters
+		af.RuleIds.SetFilter([]int{id})
+		if err := db.RemoveAlerts(af); err != nil {
+			return err
+		}
+		return db.RemoveAlertRules(f)
+	})
+	if err != nil {
+		handleError(w, queryOperationError{})
+		return
+	}
+	handleSuccess(w, r)
+}
+
+// dbAlertRuleToAlertRuleJSON takes a DBAlertRule and convert it to its
+// corresponding AlertRuleJSON response.
+func dbAlertRuleToAlertRuleJSON(rl database.DBAlertRule) AlertRuleJSON {
+	var res = AlertRuleJSON{
+		Id:           rl.Id,
+		Kind:         rl.Kind,
+		AccountId:    rl.AccountId,
+		CategoryId:   rl.CategoryId,
+		Threshold:    rl.Threshold,
+		Notifiers:    rl.Notifiers,
+		Email:        rl.Email,
+		CreationDate: rl.CreationDate.UnixNano() / 1e6,
+	}
+	if res.Notifiers == nil {
+		res.Notifiers = []string{}
+	}
+	return res
+}
+
+// dbAlertToAlertJSON takes a DBAlert and convert it to its corresponding
+// AlertJSON response.
+func dbAlertToAlertJSON(alt database.DBAlert) AlertJSON {
+	return AlertJSON{
+		Id:           alt.Id,
+		RuleId:       alt.RuleId,
+		Kind:         alt.Kind,
+		Period:       alt.Period,
+		Value:        alt.Value,
+		Threshold:    alt.Threshold,
+		Message:      alt.Message,
+		CreationDate: alt.CreationDate.UnixNano() / 1e6,
+	}
+}
@@ -0,0 +1,516 @@
+package api
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/peaberberian/GoBanks/auth"
+	"github.com/peaberberian/GoBanks/database"
+)
+
+// An archive is a zip file with the whole data of an user, to move it
+// between installations. It contains:
+//   - a JSON array file for each of the archive_files
+//   - a manifest.json file (see ArchiveManifestJSON) with the version of the
+//     archive format, and the number of elements and the SHA-256 of every
+//     file
+// Elements keep their ids in the archive. New ids are given when it is
+// restored.
+
+// version of the archives written. Only this version can be restored.
+const archive_format_version = 1
+
+// maximum size of an archive, compressed or not
+const max_archive_size = 64 << 20
+
+// name of the manifest in an archive
+const archive_manifest_file = "manifest.json"
+
+// JSON files of an archive, other than the manifest
+var archive_files = []string{
+	"banks.json",
+	"accounts.json",
+	"categories.json",
+	"transactions.json",
+}
+
+// DBBank, DBAccount and DBCategory properties written in an archive
+var bank_archive_fields = []string{"Id", "Version", "Name", "Description"}
+var account_archive_fields = []string{"Id", "Version", "BankId", "Name",
+	"Description"}
+var category_archive_fields = []string{"Id", "Version", "Name",
+	"Description", "ParentId"}
+
+// archiveContent is the data read from an archive.
+type archiveContent struct {
+	banks        []BankJSON
+	accounts     []AccountJSON
+	categories   []ArchiveCategoryJSON
+	transactions []TransactionJSON
+}
+
+// archiveWriter writes the files of an archive, keeping their number of
+// elements and checksum for the manifest.
+type archiveWriter struct {
+	zw       *zip.Writer
+	manifest ArchiveManifestJSON
+}
+
+// handleArchiveExport handle GET requests on the /export API, sending an
+// archive of the banks (with their accounts and transactions) and
+// categories of the user.
+func handleArchiveExport(w http.ResponseWriter, r *http.Request,
+	t *auth.UserToken) {
+
+	var db = getDatabase(r)
+
+	var bf database.DBBankFilters
+	bf.UserId.SetFilter(t.UserId)
+	bnks, err := db.GetBanks(bf, bank_archive_fields, 0)
+	if err != nil {
+		handleError(w, queryOperationError{})
+		return
+	}
+
+	var accs = []database.DBAccount{}
+	var bankIds []int
+	for _, bnk := range bnks {
+		bankIds = append(bankIds, bnk.Id)
+	}
+	if len(bankIds) > 0 {
+		var af database.DBAccountFilters
+		af.BankIds.SetFilter(bankIds)
+		accs, err = db.GetAccounts(af, account_archive_fields, 0)
+		if err != nil {
+			handleError(w, queryOperationError{})
+			return
+		}
+	}
+
+	var cf database.DBCategoryFilters
+	cf.UserId.SetFilter(t.UserId)
+	cats, err := db.GetCategories(cf, category_archive_fields, 0)
+	if err != nil {
+		handleError(w, queryOperationError{})
+		return
+	}
+
+	var categoryIds = map[int]bool{}
+	for _, cat := range cats {
+		categoryIds[cat.Id] = true
+	}
+
+	w.Header().Set("content-type", "application/zip")
+	w.Header().Set("content-disposition",
+		"attachment; filename=\"gobanks-archive.zip\"")
+
+	var aw = archiveWriter{zw: zip.NewWriter(w), manifest: ArchiveManifestJSON{
+		FormatVersion: archive_format_version,
+		CreationDate:  time.Now().UnixNano() / 1e6,
+		Files:         map[string]ArchiveFileJSON{},
+	}}
+
+	err = aw.writeFile("banks.json", func(add func(interface{}) error) error {
+		for _, bnk := range bnks {
+			if err := add(dbBankToBankJSON(bnk)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err == nil {
+		err = aw.writeFile("accounts.json",
+			func(add func(interface{}) error) error {
+				for _, acc := range accs {
+					if err := add(dbAccountToAccountJSON(acc)); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+	}
+	if err == nil {
+		err = aw.writeFile("categories.json",
+			func(add func(interface{}) error) error {
+				for _, cat := range cats {
+					if err := add(ArchiveCategoryJSON{
+						CategoryJSON: dbCategoryToCategoryJSON(cat),
+						ParentId:     cat.ParentId,
+					}); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+	}
+	if err == nil {
+		err = aw.writeFile("transactions.json",
+			func(add func(interface{}) error) error {
+				if len(accs) == 0 {
+					return nil
+				}
+				var accountIds []int
+				for _, acc := range accs {
+					accountIds = append(accountIds, acc.Id)
+				}
+				var f database.DBTransactionFilters
+				f.AccountIds.SetFilter(accountIds)
+				return db.ForEachTransaction(f, gettable_transaction_fields,
+					0, func(trn database.DBTransaction) error {
+						// categories set by users the account is shared
+						// with are not archived
+						if !categoryIds[trn.CategoryId] {
+							trn.CategoryId = 0
+						}
+						return add(dbTransactionToTransactionJSON(trn))
+					})
+			})
+	}
+	if err == nil {
+		err = aw.close()
+	}
+
+	// the response has already begun: the archive is left incomplete
+	if err != nil {
+		log.Println("Archive export interrupted:", err)
+	}
+}
+
+// handleArchiveImport handle POST requests on the /import API, restoring
+// the archive sent as body (see handleArchiveExport) for the user, who
+// should not have any bank or category yet.
+func handleArchiveImport(w http.ResponseWriter, r *http.Request,
+	t *auth.UserToken) {
+
+	var db = getDatabase(r)
+
+	data, err := ioutil.ReadAll(io.LimitReader(r.Body, max_archive_size+1))
+	if err != nil {
+		handleError(w, bodyParsingError{})
+		return
+	}
+	if len(data) > max_archive_size {
+		handleError(w, invalidParameterError{"archive",
+			"zip archive of at most 64 MiB"})
+		return
+	}
+
+	arc, err := readArchive(data)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	var res ArchiveImportJSON
+	err = db.WithTx(func(db database.GoBanksDataBase) error {
+		var err error
+		res, err = restoreArchive(db, t.UserId, arc)
+		return err
+	})
+	switch err.(type) {
+	case nil:
+	case notPermittedOperationError, invalidParameterError:
+		handleError(w, err)
+		return
+	default:
+		handleError(w, queryOperationError{})
+		return
+	}
+
+	resBytes, err := json.Marshal(res)
+	if err != nil {
+		handleError(w, genericOperationError{})
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	w.Write(resBytes)
+}
+
+// writeFile writes a JSON array file in the archive. elements is called
+// with a function adding a single element to the array.
+func (aw *archiveWriter) writeFile(name string,
+	elements func(add func(interface{}) error) error) error {
+
+	f, err := aw.zw.Create(name)
+	if err != nil {
+		return err
+	}
+	var hash = sha256.New()
+	var out = io.MultiWriter(f, hash)
+	var count int
+
+	if _, err = io.WriteString(out, "["); err != nil {
+		return err
+	}
+	err = elements(func(elem interface{}) error {
+		elemBytes, err := json.Marshal(elem)
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			elemBytes = append([]byte(","), elemBytes...)
+		}
+		count++
+		_, err = out.Write(elemBytes)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if _, err = io.WriteString(out, "]"); err != nil {
+		return err
+	}
+
+	aw.manifest.Files[name] = ArchiveFileJSON{
+		Count:  count,
+		Sha256: hex.EncodeToString(hash.Sum(nil)),
+	}
+	return nil
+}
+
+// close writes the manifest and ends the archive.
+func (aw *archiveWriter) close() error {
+	manifestBytes, err := json.Marshal(aw.manifest)
+	if err != nil {
+		return err
+	}
+	f, err := aw.zw.Create(archive_manifest_file)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(manifestBytes); err != nil {
+		return err
+	}
+	return aw.zw.Close()
+}
+
+// readArchive reads the given archive, checking it against its manifest.
+// Returns an invalidParameterError if the archive is not valid.
+func readArchive(data []byte) (archiveContent, error) {
+	var arc archiveContent
+
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return arc, invalidParameterError{"archive", "zip archive"}
+	}
+
+	// uncompressed size left to read, to not be fooled by zip bombs
+	var sizeLeft int64 = max_archive_size
+
+	var readFile = func(name string) ([]byte, error) {
+		for _, f := range zr.File {
+			if f.Name != name {
+				continue
+			}
+			rc, err := f.Open()
+			if err != nil {
+				return nil, invalidParameterError{name, "readable file"}
+			}
+			defer rc.Close()
+			content, err := ioutil.ReadAll(io.LimitReader(rc, sizeLeft+1))
+			if err != nil {
+				return nil, invalidParameterError{name, "readable file"}
+			}
+			sizeLeft -= int64(len(content))
+			if sizeLeft < 0 {
+				return nil, invalidParameterError{"archive",
+					"zip archive of at most 64 MiB once uncompressed"}
+			}
+			return content, nil
+		}
+		return nil, missingParameterError{name, "JSON file"}
+	}
+
+	manifestBytes, err := readFile(archive_manifest_file)
+	if err != nil {
+		return arc, err
+	}
+	var manifest ArchiveManifestJSON
+	if err = json.Unmarshal(manifestBytes, &manifest); err != nil {
+		return arc, invalidParameterError{archive_manifest_file,
+			"JSON object"}
+	}
+	if manifest.FormatVersion != archive_format_version {
+		return arc, invalidParameterError{"formatVersion", "1"}
+	}
+
+	var targets = map[string]interface{}{
+		"banks.json":        &arc.banks,
+		"accounts.json":     &arc.accounts,
+		"categories.json":   &arc.categories,
+		"transactions.json": &arc.transactions,
+	}
+	for _, name := range archive_files {
+		entry, ok := manifest.Files[name]
+		if !ok {
+			return arc, missingParameterError{name,
+				"file listed in the manifest"}
+		}
+
+		content, err := readFile(name)
+		if err != nil {
+			return arc, err
+		}
+		var sum = sha256.Sum256(content)
+		if hex.EncodeToString(sum[:]) != entry.Sha256 {
+			return arc, invalidParameterError{name,
+				"file matching the manifest's checksum"}
+		}
+		if err = json.Unmarshal(content, targets[name]); err != nil {
+			return arc, invalidParameterError{name, "JSON array"}
+		}
+	}
+
+	var counts = map[string]int{
+		"banks.json":        len(arc.banks),
+		"accounts.json":     len(arc.accounts),
+		"categories.json":   len(arc.categories),
+		"transactions.json": len(arc.transactions),
+	}
+	for name, count := range counts {
+		if count != manifest.Files[name].Count {
+			return arc, invalidParameterError{name,
+				"file matching the manifest's count"}
+		}
+	}
+	return arc, nil
+}
+
+// restoreArchive adds the content of the given archive for the given user,
+// with new ids. Returns a notPermittedOperationError if the user already
+// has banks or categories, and an invalidParameterError if an element
+// references an element missing from the archive.
+func restoreArchive(db database.GoBanksDataBase, userId int,
+	arc archiveContent) (ArchiveImportJSON, error) {
+
+	var res ArchiveImportJSON
+
+	var bf database.DBBankFilters
+	bf.UserId.SetFilter(userId)
+	nbBanks, err := db.CountBanks(bf)
+	if err != nil {
+		return res, err
+	}
+	var cf database.DBCategoryFilters
+	cf.UserId.SetFilter(userId)
+	nbCategories, err := db.CountCategories(cf)
+	if err != nil {
+		return res, err
+	}
+	if nbBanks > 0 || nbCategories > 0 {
+		return res, notPermittedOperationError{}
+	}
+
+	// new ids, by their id in the archive
+	var categoryIds = map[int]int{}
+	var bankIds = map[int]int{}
+	var accountIds = map[int]int{}
+
+	// parent categories have to be added before their children
+	for remaining := arc.categories; len(remaining) > 0; {
+		var next []ArchiveCategoryJSON
+		for _, cat := range remaining {
+			parentId, ok := categoryIds[cat.ParentId]
+			if cat.ParentId != 0 && !ok {
+				next = append(next, cat)
+				continue
+			}
+			if _, ok := categoryIds[cat.Id]; ok {
+				return res, invalidParameterError{"categories.json",
+					"array of categories with different ids"}
+			}
+			newCat, err := db.AddCategory(database.DBCategoryParams{
+				UserId:      userId,
+				Name:        cat.Name,
+				Description: cat.Description,
+				ParentId:    parentId,
+			})
+			if err != nil {
+				return res, err
+			}
+			categoryIds[cat.Id] = newCat.Id
+			res.Categories++
+		}
+		if len(next) == len(remaining) {
+			return res, invalidParameterError{"categories.json",
+				"array of categories whose parents are in the archive"}
+		}
+		remaining = next
+	}
+
+	for _, bnk := range arc.banks {
+		if _, ok := bankIds[bnk.Id]; ok {
+			return res, invalidParameterError{"banks.json",
+				"array of banks with different ids"}
+		}
+		newBnk, err := db.AddBank(database.DBBankParams{
+			UserId:      userId,
+			Name:        bnk.Name,
+			Description: bnk.Description,
+		})
+		if err != nil {
+			return res, err
+		}
+		bankIds[bnk.Id] = newBnk.Id
+		res.Banks++
+	}
+
+	for _, acc := range arc.accounts {
+		bankId, ok := bankIds[acc.BankId]
+		if !ok {
+			return res, invalidParameterError{"accounts.json",
+				"array of accounts whose banks are in the archive"}
+		}
+		if _, ok := accountIds[acc.Id]; ok {
+			return res, invalidParameterError{"accounts.json",
+				"array of accounts with different ids"}
+		}
+		newAcc, err := db.AddAccount(database.DBAccountParams{
+			BankId:      bankId,
+			Name:        acc.Name,
+			Description: acc.Description,
+		})
+		if err != nil {
+			return res, err
+		}
+		accountIds[acc.Id] = newAcc.Id
+		res.Accounts++
+	}
+
+	for _, trn := range arc.transactions {
+		accountId, ok := accountIds[trn.AccountId]
+		if !ok {
+			return res, invalidParameterError{"transactions.json",
+				"array of transactions whose accounts are in the archive"}
+		}
+		categoryId, ok := categoryIds[trn.CategoryId]
+		if trn.CategoryId != 0 && !ok {
+			return res, invalidParameterError{"transactions.json",
+				"array of transactions whose categories are in the archive"}
+		}
+		_, err := db.AddTransaction(database.DBTransactionParams{
+			AccountId:       accountId,
+			Label:           trn.Label,
+			CategoryId:      categoryId,
+			Description:     trn.Description,
+			TransactionDate: int64TimeStampToTime(trn.TransactionDate),
+			RecordDate:      int64TimeStampToTime(trn.RecordDate),
+			Debit:           trn.Debit,
+			Credit:          trn.Credit,
+			Reference:       trn.Reference,
+		})
+		if err != nil {
+			return res, err
+		}
+		res.Transactions++
+	}
+	return res, nil
+}
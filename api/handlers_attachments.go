@@ -0,0 +1,344 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/peaberberian/GoBanks/auth"
+	"github.com/peaberberian/GoBanks/database"
+	"github.com/peaberberian/GoBanks/storage"
+)
+
+// size allowed for the multipart body of an upload in addition to the file
+// itself, for its boundaries, headers and other form fields
+const attachment_form_overhead = 64 << 10
+
+// maximum length in bytes of the name of an attached file
+const attachment_max_name_length = 255
+
+// attachment properties sent by the /transactions/{id}/attachments API
+var gettable_attachment_fields = []string{"Id", "TransactionId", "Name",
+	"MimeType", "Size", "Hash", "CreationDate"}
+
+// handleAttachmentRead handle GET requests on the
+// /transactions/{id}/attachments API, returning the attachments of a
+// transaction without their content.
+func handleAttachmentRead(w http.ResponseWriter, r *http.Request,
+	t *auth.UserToken) {
+
+	var db = getDatabase(r)
+
+	var id, _ = getApiId(r)
+	if err := checkTransactionAccess(db, t, id, viewerRole); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	var f database.DBAttachmentFilters
+	f.TransactionIds.SetFilter([]int{id})
+	atts, err := db.GetAttachments(f, gettable_attachment_fields, 0)
+	if err != nil {
+		handleError(w, queryOperationError{})
+		return
+	}
+
+	var resJson = []AttachmentJSON{}
+	for _, att := range atts {
+		resJson = append(resJson, dbAttachmentToAttachmentJSON(att))
+	}
+	resBytes, err := json.Marshal(resJson)
+	if err != nil {
+		handleError(w, genericOperationError{})
+		return
+	}
+	w.Write(resBytes)
+}
+
+// handleAttachmentCreate handle POST requests on the
+// /transactions/{id}/attachments API. The file is read from the "file" field
+// of a multipart/form-data body.
+// The type of the file is detected from its content. Attaching the same
+// content twice to a transaction returns the existing attachment.
+func handleAttachmentCreate(w http.ResponseWriter, r *http.Request,
+	t *auth.UserToken) {
+
+	var db = getDatabase(r)
+
+	var id, _ = getApiId(r)
+	if err := checkTransactionAccess(db, t, id, editorRole); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	var store = attachmentConfig.Storage
+	if store == nil {
+		handleError(w, genericOperationError{})
+		return
+	}
+
+	name, content, err := readAttachmentFile(w, r)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	mimeType, _, _ := mime.ParseMediaType(http.DetectContentType(content))
+	if !stringInArray(mimeType, attachmentConfig.MimeTypes) {
+		handleError(w, unsupportedMediaTypeError{mimeType})
+		return
+	}
+
+	var sum = sha256.Sum256(content)
+	var hash = hex.EncodeToString(sum[:])
+
+	var f database.DBAttachmentFilters
+	f.TransactionIds.SetFilter([]int{id})
+	f.Hashes.SetFilter([]string{hash})
+	atts, err := db.GetAttachments(f, gettable_attachment_fields, 1)
+	if err != nil {
+		handleError(w, queryOperationError{})
+		return
+	}
+	if len(atts) > 0 {
+		writeAttachmentResponse(w, atts[0])
+		return
+	}
+
+	// the attachment is added before its file is stored, and both while
+	// no unused file can be removed: a file used by another attachment
+	// being removed is kept for this one
+	attachmentFilesLock.Lock()
+	defer attachmentFilesLock.Unlock()
+
+	att, err := db.AddAttachment(database.DBAttachmentParams{
+		TransactionId: id,
+		UserId:        t.UserId,
+		Name:          name,
+		MimeType:      mimeType,
+		Size:          int64(len(content)),
+		Hash:          hash,
+		CreationDate:  time.Now(),
+	})
+	if err != nil {
+		handleError(w, queryOperationError{})
+		return
+	}
+
+	// files already stored for another attachment are not stored again
+	if err := store.Put(hash, bytes.NewReader(content)); err != nil {
+		log.Println("Attachments: could not store a file:", err)
+		var rf database.DBAttachmentFilters
+		rf.Ids.SetFilter([]int{att.Id})
+		if err := db.RemoveAttachments(rf); err != nil {
+			log.Println("Attachments: could not remove an attachment:", err)
+		}
+		handleError(w, genericOperationError{})
+		return
+	}
+
+	handleCreated(w, r, att.Id)
+	writeAttachmentResponse(w, att)
+}
+
+// handleAttachmentDownload handle GET requests on the
+// /transactions/{id}/attachments/{attachmentId} API, sending the content of
+// the file.
+func handleAttachmentDownload(w http.ResponseWriter, r *http.Request,
+	t *auth.UserToken) {
+
+	var db = getDatabase(r)
+
+	var id, _ = getApiId(r)
+	var attachmentId, _ = getApiIntParam(r, "attachmentId")
+	if err := checkTransactionAccess(db, t, id, viewerRole); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	att, err := getTransactionAttachment(db, id, attachmentId)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	var store = attachmentConfig.Storage
+	if store == nil {
+		handleError(w, genericOperationError{})
+		return
+	}
+	file, err := store.Open(att.Hash)
+	if err == storage.ErrNotFound {
+		handleError(w, notFoundError{})
+		return
+	} else if err != nil {
+		log.Println("Attachments: could not open a file:", err)
+		handleError(w, genericOperationError{})
+		return
+	}
+	defer file.Close()
+
+	// the content never changes: its hash is a strong ETag
+	w.Header().Set("ETag", "\""+att.Hash+"\"")
+	w.Header().Set("content-type", att.MimeType)
+	w.Header().Set("content-disposition", mime.FormatMediaType("attachment",
+		map[string]string{"filename": att.Name}))
+	w.Header().Set("x-content-type-options", "nosniff")
+	http.ServeContent(w, r, "", att.CreationDate, file)
+}
+
+// handleAttachmentDelete handle DELETE requests on the
+// /transactions/{id}/attachments/{attachmentId} API. The file is removed
+// from the storage if no other attachment uses it.
+func handleAttachmentDelete(w http.ResponseWriter, r *http.Request,
+	t *auth.UserToken) {
+
+	var db = getDatabase(r)
+
+	var id, _ = getApiId(r)
+	var attachmentId, _ = getApiIntParam(r, "attachmentId")
+	if err := checkTransactionAccess(db, t, id, editorRole); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	att, err := getTransactionAttachment(db, id, attachmentId)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	var f database.DBAttachmentFilters
+	f.Ids.SetFilter([]int{att.Id})
+	if err := db.RemoveAttachments(f); err != nil {
+		handleError(w, queryOperationError{})
+		return
+	}
+	removeUnusedAttachmentFiles(database.GoDB, []string{att.Hash})
+	handleSuccess(w, r)
+}
+
+// getTransactionAttachment returns the attachment with the given id, if it
+// is attached to the given transaction. Returns a notFoundError else.
+func getTransactionAttachment(db database.GoBanksDataBase, transactionId int,
+	id int) (database.DBAttachment, error) {
+
+	var f database.DBAttachmentFilters
+	f.Ids.SetFilter([]int{id})
+	f.TransactionIds.SetFilter([]int{transactionId})
+	atts, err := db.GetAttachments(f, gettable_attachment_fields, 1)
+	if err != nil {
+		return database.DBAttachment{}, queryOperationError{}
+	}
+	if len(atts) == 0 {
+		return database.DBAttachment{}, notFoundError{}
+	}
+	return atts[0], nil
+}
+
+// readAttachmentFile reads the name and content of the file sent in the
+// "file" field of a multipart/form-data body.
+// Returns a fileTooLargeError if the file is larger than the maximum size
+// of the attachments.
+func readAttachmentFile(w http.ResponseWriter, r *http.Request) (string,
+	[]byte, error) {
+
+	var maxSize = attachmentConfig.MaxSize
+	r.Body = http.MaxBytesReader(w, r.Body, maxSize+attachment_form_overhead)
+
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return "", nil, invalidParameterError{"file", "multipart/form-data file"}
+	}
+
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return "", nil, missingParameterError{"file", "file"}
+		} else if err != nil {
+			return "", nil, attachmentReadError(err)
+		}
+		if part.FormName() != "file" {
+			continue
+		}
+
+		content, err := io.ReadAll(io.LimitReader(part, maxSize+1))
+		if err != nil {
+			return "", nil, attachmentReadError(err)
+		}
+		if int64(len(content)) > maxSize {
+			return "", nil, fileTooLargeError{maxSize}
+		}
+		if len(content) == 0 {
+			return "", nil, invalidParameterError{"file", "non-empty file"}
+		}
+		return attachmentName(part.FileName()), content, nil
+	}
+}
+
+// attachmentReadError returns the error to send when the body of an upload
+// could not be read.
+func attachmentReadError(err error) error {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return fileTooLargeError{attachmentConfig.MaxSize}
+	}
+	return bodyParsingError{}
+}
+
+// attachmentName returns the name under which a file sent with the given
+// name is attached: without its directories, control characters and
+// truncated to attachment_max_name_length bytes.
+func attachmentName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.TrimSpace(path.Base(strings.ReplaceAll(name, "\\", "/")))
+
+	for len(name) > attachment_max_name_length {
+		_, size := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-size]
+	}
+	if name == "" || name == "." || name == "/" {
+		return "attachment"
+	}
+	return name
+}
+
+// writeAttachmentResponse writes the given attachment as the JSON response
+func writeAttachmentResponse(w http.ResponseWriter, att database.DBAttachment) {
+	resBytes, err := json.Marshal(dbAttachmentToAttachmentJSON(att))
+	if err != nil {
+		handleError(w, genericOperationError{})
+		return
+	}
+	w.Write(resBytes)
+}
+
+// dbAttachmentToAttachmentJSON takes a DBAttachment and convert it to its
+// corresponding AttachmentJSON response.
+func dbAttachmentToAttachmentJSON(att database.DBAttachment) AttachmentJSON {
+	return AttachmentJSON{
+		Id:            att.Id,
+		TransactionId: att.TransactionId,
+		Name:          att.Name,
+		MimeType:      att.MimeType,
+		Size:          att.Size,
+		Hash:          att.Hash,
+		CreationDate:  att.CreationDate.UnixNano() / 1e6,
+	}
+}
@@ -1,6 +1,8 @@
 package api
 
+import "net"
 import "net/http"
+import "strings"
 import "log"
 import "fmt"
 import "time"
@@ -13,11 +15,6 @@ import "github.com/peaberberian/GoBanks/auth"
 func handleAuthentication(w http.ResponseWriter, r *http.Request,
 	t *auth.UserToken) {
 
-	if r.Method != "POST" {
-		handleNotSupportedMethod(w, r.Method)
-		return
-	}
-
 	// 1 - parse request
 	decoder := json.NewDecoder(r.Body)
 	var authJson AuthenticationJSON
@@ -31,12 +28,21 @@ func handleAuthentication(w http.ResponseWriter, r *http.Request,
 	var password string = authJson.Password
 
 	// 2 - login user
-	token, err := auth.LoginUser(user, password)
+	token, mfaRequired, err := auth.LoginUser(user, password,
+		getClientIp(r))
 	if err != nil {
 		handleError(w, err)
 		return
 	}
 
+	// 2b - a two-factor code is needed, send back the challenge token
+	if mfaRequired {
+		var expiration = int(auth.MFAChallengeExpiration)
+		fmt.Fprintf(w, generateMFAChallengeResponse(token, expiration))
+		log.Println(user, "needs a two-factor code to log in")
+		return
+	}
+
 	// 3 - send back token
 	var expiration int = auth.GetTokenExpiration() * int(time.Hour)
 	fmt.Fprintf(w, generateTokenResponse(token, expiration))
@@ -44,10 +50,51 @@ func handleAuthentication(w http.ResponseWriter, r *http.Request,
 	log.Println(user, "just logged in")
 }
 
+// handleMFAAuthentication is called when an user sends the challenge token
+// received from handleAuthentication along with a two-factor code.
+func handleMFAAuthentication(w http.ResponseWriter, r *http.Request,
+	t *auth.UserToken) {
+
+	// 1 - parse request
+	decoder := json.NewDecoder(r.Body)
+	var mfaJson MFALoginJSON
+	if err := decoder.Decode(&mfaJson); err != nil {
+		handleError(w, bodyParsingError{})
+		return
+	}
+
+	// 2 - check the two-factor code
+	token, err := auth.CompleteMFALogin(mfaJson.Token, mfaJson.Code,
+		getClientIp(r))
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	// 3 - send back token
+	var expiration int = auth.GetTokenExpiration() * int(time.Hour)
+	fmt.Fprintf(w, generateTokenResponse(token, expiration))
+}
+
+// getClientIp returns the IP address of the client which made the request.
+// Headers set by proxies (X-Forwarded-For...) are not trusted.
+func getClientIp(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
 // getTokenFromRequest recuperates the token string from an http request.
 func getTokenFromRequest(r *http.Request) string {
-	// Token should be in the Authorization header
-	return r.Header.Get("Authorization")
+	// Token should be in the Authorization header, the "Bearer" scheme is
+	// optional
+	var header = r.Header.Get("Authorization")
+	if len(header) > 7 && strings.EqualFold(header[:7], "bearer ") {
+		return header[7:]
+	}
+	return header
 }
 
 // generateTokenResponse generates a JSON ready to be sent describing
@@ -65,3 +112,20 @@ func generateTokenResponse(token string, expires int) string {
 		return string(resBytes)
 	}
 }
+
+// generateMFAChallengeResponse generates a JSON ready to be sent describing
+// the two-factor challenge token given in argument. See MFAChallengeJSON for
+// more informations.
+func generateMFAChallengeResponse(token string, expires int) string {
+	var resJSON = MFAChallengeJSON{
+		MFARequired: true,
+		Token:       token,
+		Expires:     expires / 1e6,
+	}
+	resBytes, err := json.Marshal(resJSON)
+	if err != nil {
+		return ""
+	} else {
+		return string(resBytes)
+	}
+}
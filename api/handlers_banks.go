@@ -12,54 +12,59 @@ import (
 // DBBank properties gettable through this handler
 var gettable_bank_fields = []string{
 	"Id",
+	"Version",
 	"UserId",
 	"Name",
 	"Description",
 }
 
-// handleBanks is the main handler for call on the /banks api. It dispatches
-// to other function based on the HTTP method used the typical REST CRUD
-// naming scheme.
-func handleBanks(w http.ResponseWriter, r *http.Request,
-	t *auth.UserToken) {
+// DBBank properties modified when a bank is replaced through a PUT request
+var updatable_bank_fields = []string{
+	"Name",
+	"Description",
+}
 
-	switch r.Method {
-	case "GET":
-		handleBankRead(w, r, t)
-	case "POST":
-		handleBankCreate(w, r, t)
-	case "PUT":
-		handleBankUpdate(w, r, t)
-	case "DELETE":
-		handleBankDelete(w, r, t)
-	default:
-		handleNotSupportedMethod(w, r.Method)
-	}
+// DBBank properties which can be used to sort the banks, by their name in
+// the sort query string property
+var sortable_bank_fields = map[string]sortableField{
+	"id":          {"Id", false},
+	"name":        {"Name", false},
+	"description": {"Description", false},
 }
 
 // handleBankRead handle GET requests on the /banks API
 func handleBankRead(w http.ResponseWriter, r *http.Request,
 	t *auth.UserToken) {
 
+	var db = getDatabase(r)
+
 	// look if we have an id (GET /banks/35 => id == 35)
-	var id, hasIdInUrl = getApiId(r.URL.Path)
+	var id, hasIdInUrl = getApiId(r)
 
 	var queryString = r.URL.Query()
 	var f database.DBBankFilters
 	var limit int
+	var pg pagination
 
-	// always filter on the current user
-	f.UserId.SetFilter(t.UserId)
+	// always filter on the banks the current user can see (his own and the
+	// ones shared with him)
+	// (blocking database request here :(, TODO see what I can do, cache?)
+	bankIds, err := getBankIdsForToken(db, t, viewerRole)
+	if err != nil {
+		handleError(w, queryOperationError{})
+		return
+	}
+	f.Ids.SetFilter(bankIds)
 
 	// if an id was set in the url, filter to the record corresponding to it
 	if hasIdInUrl {
-		f.Ids.SetFilter([]int{id})
+		f.Ids.SetFilter(intersectInts([]int{id}, bankIds))
 	} else {
 		// if only some bank ids are wanted, filter
 		wantedIds, _ := queryStringPropertyToIntArray(queryString, "id")
 		fmt.Println(wantedIds)
 		if len(wantedIds) > 0 {
-			f.Ids.SetFilter(wantedIds)
+			f.Ids.SetFilter(intersectInts(wantedIds, bankIds))
 		}
 
 		// if only some bank names are wanted, filter
@@ -70,10 +75,18 @@ func handleBankRead(w http.ResponseWriter, r *http.Request,
 
 		// obtain limit of wanted records, if set
 		limit, _ = queryStringPropertyToInt(queryString, "limit")
+
+		// obtain the wanted order and position in the results, if set
+		pg, err = readPagination(queryString, sortable_bank_fields)
+		if err != nil {
+			handleError(w, err)
+			return
+		}
+		pg.setFilters(&f.Sort, &f.After)
 	}
 
 	// perform the database request
-	vals, err := database.GoDB.GetBanks(f, gettable_bank_fields, uint(limit))
+	vals, err := db.GetBanks(f, gettable_bank_fields, uint(limit))
 	if err != nil {
 		handleError(w, queryOperationError{})
 		return
@@ -82,13 +95,28 @@ func handleBankRead(w http.ResponseWriter, r *http.Request,
 	// if an id was given, we're awaiting an object, not an array.
 	if hasIdInUrl {
 		if len(vals) == 0 {
-			fmt.Fprintf(w, "{}")
-		} else {
+			handleError(w, notFoundError{})
+		} else if !handleNotModified(w, r, versionETag(vals[0].Version)) {
 			fmt.Fprintf(w, generateBankResponse(vals[0]))
 		}
 		return
 	}
 
+	// count every result and give the link to the next ones
+	total, err := db.CountBanks(f)
+	if err != nil {
+		handleError(w, queryOperationError{})
+		return
+	}
+	pg.setHeaders(w, r, total, len(vals), limit,
+		func(property string) interface{} {
+			return bankSortValue(vals[len(vals)-1], property)
+		})
+	if handleNotModified(w, r, listETag(total, len(vals),
+		func(i int) (int, int) { return vals[i].Id, vals[i].Version })) {
+		return
+	}
+
 	// else respond directly with the result
 	if len(vals) == 0 {
 		fmt.Fprintf(w, "[]")
@@ -101,9 +129,10 @@ func handleBankRead(w http.ResponseWriter, r *http.Request,
 func handleBankCreate(w http.ResponseWriter, r *http.Request,
 	t *auth.UserToken) {
 
-	// you cannot post on a specific id, reject if you want to do that
-	if _, hasIdInUrl := getApiId(r.URL.Path); hasIdInUrl {
-		handleNotSupportedMethod(w, r.Method)
+	var db = getDatabase(r)
+
+	if err := checkUnrestrictedToken(t); err != nil {
+		handleError(w, err)
 		return
 	}
 
@@ -126,32 +155,39 @@ func handleBankCreate(w http.ResponseWriter, r *http.Request,
 	bankElem.UserId = t.UserId
 
 	// perform database add request
-	bank, err := database.GoDB.AddBank(bankElem)
+	bank, err := db.AddBank(bankElem)
 	if err != nil {
 		handleError(w, queryOperationError{})
 		return
 	}
 
+	handleCreated(w, r, bank.Id)
 	fmt.Fprintf(w, generateBankResponse(bank))
 }
 
-// handleBankUpdate handle PUT requests on the /banks API
+// handleBankUpdate handle PUT and PATCH requests on the /banks/{id} API.
+// PUT replaces the whole bank, PATCH only modifies the properties present
+// in its JSON merge patch body (see bankPatchToParams).
 func handleBankUpdate(w http.ResponseWriter, r *http.Request,
 	t *auth.UserToken) {
 
-	// look if we have an id (GET /banks/35 => id == 35)
-	var id, hasIdInUrl = getApiId(r.URL.Path)
+	var db = getDatabase(r)
 
-	// if an id was found, it means that we want to replace an element
-	// redirect to the right function
-	if !hasIdInUrl {
-		handleBankReplace(w, r, t)
-		return
-	}
+	// id of the wanted element (PUT /banks/35 => id == 35)
+	var id, _ = getApiId(r)
+
+	setAcceptPatchHeader(w)
 
 	// check that we can modify this bank params
 	// (blocking database request here :(, TODO see what I can do, jwt?)
-	if err := checkPermissionForBank(t, id); err != nil {
+	if err := checkPermissionForBank(db, t, id, editorRole); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	// the If-Match header gives the versions which can be modified
+	versions, err := readIfMatchVersions(r)
+	if err != nil {
 		handleError(w, err)
 		return
 	}
@@ -163,40 +199,40 @@ func handleBankUpdate(w http.ResponseWriter, r *http.Request,
 		return
 	}
 
-	// -- check fields and update only the ones there --
-
 	var fields []string
 	var bankElem database.DBBankParams
 
-	if val, ok := bodyMap["name"]; ok {
-		if str, ok := val.(string); !ok {
-			handleError(w, bodyParsingError{})
-			return
-		} else {
-			bankElem.Name = str
-			fields = append(fields, "Name")
-		}
+	if r.Method == "PATCH" {
+		bankElem, fields, err = bankPatchToParams(bodyMap)
+	} else {
+		bankElem, err = inputToBankParams(bodyMap)
+		fields = updatable_bank_fields
 	}
-	if val, ok := bodyMap["description"]; ok {
-		if str, ok := val.(string); !ok {
-			handleError(w, bodyParsingError{})
-			return
-		} else {
-			bankElem.Description = str
-			fields = append(fields, "Description")
-		}
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	// an empty patch does not modify anything
+	if len(fields) == 0 {
+		handleSuccess(w, r)
+		return
 	}
 
 	// Filter the bank id
 	var f database.DBBankFilters
 	f.Ids.SetFilter([]int{id})
+	if len(versions) > 0 {
+		f.Versions.SetFilter(versions)
+	}
 
 	// perform the database request
-	if err = database.GoDB.UpdateBanks(f, fields, bankElem); err != nil {
-		handleError(w, queryOperationError{})
+	if err = db.UpdateBanks(f, fields, bankElem); err != nil {
+		handleError(w, versionedWriteError(err))
 		return
 	}
 
+	setUpdatedETag(w, versions)
 	handleSuccess(w, r)
 }
 
@@ -204,27 +240,44 @@ func handleBankUpdate(w http.ResponseWriter, r *http.Request,
 func handleBankDelete(w http.ResponseWriter, r *http.Request,
 	t *auth.UserToken) {
 
+	var db = getDatabase(r)
+
 	// look if we have an id (GET /banks/35 => id == 35)
-	var id, hasIdInUrl = getApiId(r.URL.Path)
+	var id, hasIdInUrl = getApiId(r)
 
 	var f database.DBBankFilters
 
 	// if we have an id, check permission and set filter
 	if hasIdInUrl {
 		// (blocking database request here :(, TODO see what I can do, jwt?)
-		if err := checkPermissionForBank(t, id); err != nil {
+		if err := checkPermissionForBank(db, t, id, ownerRole); err != nil {
+			handleError(w, err)
+			return
+		}
+
+		// the If-Match header gives the versions which can be removed
+		versions, err := readIfMatchVersions(r)
+		if err != nil {
 			handleError(w, err)
 			return
 		}
 		f.Ids.SetFilter([]int{id})
+		if len(versions) > 0 {
+			f.Versions.SetFilter(versions)
+		}
 	} else {
-		// filter by userId
+		if err := checkUnrestrictedToken(t); err != nil {
+			handleError(w, err)
+			return
+		}
+
+		// filter by userId (banks shared with him are not concerned)
 		f.UserId.SetFilter(t.UserId)
 	}
 
 	// perform the database request
-	if err := database.GoDB.RemoveBanks(f); err != nil {
-		handleError(w, queryOperationError{})
+	if err := db.RemoveBanks(f); err != nil {
+		handleError(w, versionedWriteError(err))
 		return
 	}
 	handleSuccess(w, r)
@@ -232,9 +285,23 @@ func handleBankDelete(w http.ResponseWriter, r *http.Request,
 
 // handleBankReplace handle specifically PUT requests on the main /banks API
 // (not restricted to a certain id).
+// As every bank not given is removed, it has to be confirmed (see
+// checkReplaceConfirmation).
 func handleBankReplace(w http.ResponseWriter, r *http.Request,
 	t *auth.UserToken) {
 
+	var db = getDatabase(r)
+
+	if err := checkUnrestrictedToken(t); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	if err := checkReplaceConfirmation(r); err != nil {
+		handleError(w, err)
+		return
+	}
+
 	var bodyMaps, err = readBodyAsArrayOfStringMap(r.Body)
 	if err != nil {
 		handleError(w, queryOperationError{})
@@ -254,52 +321,68 @@ func handleBankReplace(w http.ResponseWriter, r *http.Request,
 		bnks = append(bnks, bankElem)
 	}
 
-	// Remove old banks linked to this user
-	var f database.DBBankFilters
-	f.UserId.SetFilter(t.UserId)
+	// replace the banks in a single transaction, to never lose them
+	err = db.WithTx(func(db database.GoBanksDataBase) error {
+		// Remove old banks linked to this user
+		var f database.DBBankFilters
+		f.UserId.SetFilter(t.UserId)
 
-	if err := database.GoDB.RemoveBanks(f); err != nil {
-		handleError(w, queryOperationError{})
-		return
-	}
+		if err := db.RemoveBanks(f); err != nil {
+			return err
+		}
 
-	// add each bank indicated to the database
-	for _, bnk := range bnks {
-		bnk.UserId = t.UserId
-		if _, err := database.GoDB.AddBank(bnk); err != nil {
-			handleError(w, queryOperationError{})
-			return
+		// add each bank indicated to the database
+		for _, bnk := range bnks {
+			bnk.UserId = t.UserId
+			if _, err := db.AddBank(bnk); err != nil {
+				return err
+			}
 		}
+		return nil
+	})
+	if err != nil {
+		handleError(w, queryOperationError{})
+		return
 	}
 	handleSuccess(w, r)
 }
 
 // checkPermissionForBank checks if an user related to the given token has
-// the given bankId. It returns an error if the user doesn't have this bank
-// or if the database query failed.
-func checkPermissionForBank(t *auth.UserToken, bankId int) OperationError {
-	if val, err := userHasBank(t.UserId, bankId); !val {
-		return notPermittedOperationError{}
-	} else if err != nil {
+// the given bankId, or if it was shared with him with at least the given
+// role. It returns a notFoundError if the user cannot see this bank, a
+// notPermittedOperationError if he can but without the given role, or an
+// error if the database query failed.
+func checkPermissionForBank(db database.GoBanksDataBase, t *auth.UserToken,
+	bankId int, minRole string) OperationError {
+
+	if val, err := userHasBank(db, t, bankId, viewerRole); err != nil {
 		return queryOperationError{}
+	} else if !val {
+		return notFoundError{}
+	}
+	if minRole == viewerRole {
+		return nil
+	}
+
+	if val, err := userHasBank(db, t, bankId, minRole); err != nil {
+		return queryOperationError{}
+	} else if !val {
+		return notPermittedOperationError{}
 	}
 	return nil
 }
 
-// userHasBank checks if the userId given possess the bankId also given in
-// argument. It can return an error if the database query failed.
-func userHasBank(userId int, bankId int) (bool, error) {
-	var f database.DBBankFilters
-
-	f.UserId.SetFilter(userId)
-	f.Ids.SetFilter([]int{bankId})
+// userHasBank checks if the user of the given token possess the bankId also
+// given in argument, or has it shared with at least the given role. It can
+// return an error if the database query failed.
+func userHasBank(db database.GoBanksDataBase, t *auth.UserToken, bankId int,
+	minRole string) (bool, error) {
 
-	var fields = gettable_bank_fields
-	val, err := database.GoDB.GetBanks(f, fields, 0)
-	if len(val) == 0 || err != nil {
+	bankIds, err := getBankIdsForToken(db, t, minRole)
+	if err != nil {
 		return false, err
 	}
-	return true, nil
+	return intInArray(bankId, bankIds), nil
 }
 
 // generateBankResponse generates a JSON string representing the DBBank
@@ -335,6 +418,7 @@ func generateBanksResponse(bnk []database.DBBank) string {
 func dbBankToBankJSON(bnk database.DBBank) BankJSON {
 	return BankJSON{
 		Id:          bnk.Id,
+		Version:     bnk.Version,
 		Name:        bnk.Name,
 		Description: bnk.Description,
 	}
@@ -349,7 +433,7 @@ func inputToBankParams(input map[string]interface{}) (database.DBBankParams, err
 	// The "name" field is mandatory
 	res.Name, valid = input["name"].(string)
 	if !valid {
-		return res, missingParameterError{"name"}
+		return res, missingParameterError{"name", "string"}
 	}
 
 	res.Description, _ = input["description"].(string)
@@ -357,6 +441,33 @@ func inputToBankParams(input map[string]interface{}) (database.DBBankParams, err
 	return res, nil
 }
 
+// bankPatchToParams reads the JSON merge patch (RFC 7396) given to modify a
+// bank. It returns the new values and the properties to update.
+func bankPatchToParams(patch map[string]interface{}) (database.DBBankParams,
+	[]string, error) {
+
+	var res database.DBBankParams
+	var fields []string
+	var present bool
+	var err error
+
+	if res.Name, present, err = readPatchString(patch, "name",
+		true); err != nil {
+		return res, nil, err
+	} else if present {
+		fields = append(fields, "Name")
+	}
+
+	if res.Description, present, err = readPatchString(patch, "description",
+		false); err != nil {
+		return res, nil, err
+	} else if present {
+		fields = append(fields, "Description")
+	}
+
+	return res, fields, nil
+}
+
 // // readBodyAsBankParamsArray generates an array of DBBankParams structs from the
 // // body passed with the given http request.
 // func readBodyAsBankParamsArray(r io.Reader) ([]database.DBBankParams, error) {
@@ -400,3 +511,17 @@ func inputToBankParams(input map[string]interface{}) (database.DBBankParams, err
 // 		Description: bnkj.Description,
 // 	}
 // }
+
+// bankSortValue returns the value of a sortable DBBank property (see
+// sortable_bank_fields).
+func bankSortValue(bnk database.DBBank, property string) interface{} {
+	switch property {
+	case "Id":
+		return bnk.Id
+	case "Name":
+		return bnk.Name
+	case "Description":
+		return bnk.Description
+	}
+	return nil
+}
@@ -0,0 +1,295 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/peaberberian/GoBanks/auth"
+	"github.com/peaberberian/GoBanks/database"
+)
+
+// maximum number of operations in a single batch request
+const max_batch_operations = 100
+
+// resources which can be modified through a batch request
+var batch_resources = []string{"banks", "accounts", "categories",
+	"transactions", "shares"}
+
+// batchOperation is a single API call of a batch request.
+type batchOperation struct {
+	method string
+
+	// path relative to the API version (e.g. "/banks/3"), with an optional
+	// query string
+	path string
+
+	// JSON body, nil if none
+	body []byte
+
+	headers map[string]string
+}
+
+// batchRollbackError is returned to roll back the transaction of a batch
+// request when one of its operations failed with the given HTTP status.
+type batchRollbackError struct{ status int }
+
+func (e batchRollbackError) Error() string {
+	return fmt.Sprintf("A batch operation failed with the status %d.",
+		e.status)
+}
+
+// batchResponseWriter is the http.ResponseWriter recording the response of
+// a single operation of a batch request.
+type batchResponseWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newBatchResponseWriter() *batchResponseWriter {
+	return &batchResponseWriter{header: http.Header{}}
+}
+
+func (bw *batchResponseWriter) Header() http.Header {
+	return bw.header
+}
+
+func (bw *batchResponseWriter) Write(b []byte) (int, error) {
+	if bw.status == 0 {
+		bw.status = http.StatusOK
+	}
+	return bw.body.Write(b)
+}
+
+func (bw *batchResponseWriter) WriteHeader(status int) {
+	if bw.status == 0 {
+		bw.status = status
+	}
+}
+
+// newBatchHandler returns the handler of POST requests on the /batch API,
+// performing the operations asked through the routes of the given router.
+//
+// Its body is an object with an "operations" array. Each operation has:
+//   - a "method" and a "path", relative to the API version (e.g.
+//     "/banks/3?limit=2"), on banks, accounts, categories, transactions
+//     or shares
+//   - an optional JSON "body"
+//   - optional "headers" (e.g. If-Match). The Authorization header of the
+//     batch request is always given, replacing the one of the operation
+//
+// The operations are performed in order, in a single database transaction.
+// An operation failing (with an error status) stops the batch and rolls
+// back the whole transaction. The response status is then the failed
+// operation's one.
+// If the "continueOnError" property is true, each operation is instead
+// performed in its own transaction: a failed operation is rolled back
+// without stopping the following ones.
+//
+// The status, headers and body of every operation performed are returned
+// (see BatchResponseJSON).
+func newBatchHandler(rt *router) routeHandler {
+	return func(w http.ResponseWriter, r *http.Request, t *auth.UserToken) {
+		bodyMap, err := readBodyAsStringMap(r.Body)
+		if err != nil {
+			handleError(w, err)
+			return
+		}
+
+		ops, err := inputToBatchOperations(bodyMap)
+		if err != nil {
+			handleError(w, err)
+			return
+		}
+
+		var continueOnError, _ = bodyMap["continueOnError"].(bool)
+		var res = BatchResponseJSON{Committed: true}
+		var status = http.StatusOK
+
+		if continueOnError {
+			for _, op := range ops {
+				results, err := runBatchTransaction(rt, r, op)
+				if _, ok := err.(batchRollbackError); err != nil && !ok {
+					results = append(results, batchErrorResult(
+						queryOperationError{}))
+				}
+				res.Results = append(res.Results, results...)
+			}
+		} else {
+			res.Results, err = runBatchTransaction(rt, r, ops...)
+			if val, ok := err.(batchRollbackError); ok {
+				res.Committed = false
+				status = val.status
+			} else if err != nil {
+				handleError(w, queryOperationError{})
+				return
+			}
+		}
+
+		resBytes, err := json.Marshal(res)
+		if err != nil {
+			handleError(w, genericOperationError{})
+			return
+		}
+		w.WriteHeader(status)
+		w.Write(resBytes)
+	}
+}
+
+// runBatchTransaction performs the given operations in order, in a single
+// database transaction (see newBatchHandler), and returns their results.
+// A batchRollbackError is returned if an operation failed: the transaction
+// has then been rolled back.
+func runBatchTransaction(rt *router, r *http.Request,
+	ops ...batchOperation) ([]BatchResultJSON, error) {
+
+	var results []BatchResultJSON
+	err := getDatabase(r).WithTx(func(db database.GoBanksDataBase) error {
+		for _, op := range ops {
+			var result = performBatchOperation(rt, r, db, op)
+			results = append(results, result)
+			if result.Status >= 400 {
+				return batchRollbackError{result.Status}
+			}
+		}
+		return nil
+	})
+	return results, err
+}
+
+// performBatchOperation performs a single operation of the batch request r,
+// with the given database, and returns its result.
+func performBatchOperation(rt *router, r *http.Request,
+	db database.GoBanksDataBase, op batchOperation) BatchResultJSON {
+
+	req, err := http.NewRequest(op.method, rt.prefix+op.path,
+		bytes.NewReader(op.body))
+	if err != nil {
+		return batchErrorResult(invalidParameterError{"path", "string"})
+	}
+
+	for name, value := range op.headers {
+		req.Header.Set(name, value)
+	}
+	// set last, so an operation is always performed as the batch's user
+	req.Header.Set("Authorization", r.Header.Get("Authorization"))
+	req.RemoteAddr = r.RemoteAddr
+	req = req.WithContext(context.WithValue(r.Context(), databaseKey{}, db))
+
+	var bw = newBatchResponseWriter()
+	rt.ServeHTTP(bw, req)
+
+	var result = BatchResultJSON{Status: bw.status}
+	if result.Status == 0 {
+		result.Status = http.StatusOK
+	}
+
+	for name := range bw.header {
+		if name != "Content-Type" {
+			if result.Headers == nil {
+				result.Headers = map[string]string{}
+			}
+			result.Headers[name] = bw.header.Get(name)
+		}
+	}
+
+	// error messages which are not JSON are given as a JSON string
+	if json.Valid(bw.body.Bytes()) {
+		result.Body = bw.body.Bytes()
+	} else if bw.body.Len() > 0 {
+		result.Body, _ = json.Marshal(strings.TrimSpace(bw.body.String()))
+	}
+	return result
+}
+
+// batchErrorResult returns the result of an operation which failed with the
+// given error.
+func batchErrorResult(err error) BatchResultJSON {
+	return BatchResultJSON{
+		Status: getErrorStatus(err),
+		Body:   json.RawMessage(generateErrorResponse(err)),
+	}
+}
+
+// inputToBatchOperations reads the operations of a batch request body (see
+// newBatchHandler).
+func inputToBatchOperations(input map[string]interface{}) ([]batchOperation,
+	error) {
+
+	list, ok := input["operations"].([]interface{})
+	if !ok {
+		return nil, missingParameterError{"operations", "array of objects"}
+	}
+	if len(list) == 0 || len(list) > max_batch_operations {
+		return nil, invalidParameterError{"operations",
+			fmt.Sprintf("array of 1 to %d objects", max_batch_operations)}
+	}
+
+	var ops []batchOperation
+	for _, elem := range list {
+		opMap, ok := elem.(map[string]interface{})
+		if !ok {
+			return nil, invalidParameterError{"operations", "array of objects"}
+		}
+
+		var op batchOperation
+
+		method, ok := opMap["method"].(string)
+		if !ok {
+			return nil, missingParameterError{"method", "string"}
+		}
+		op.method = strings.ToUpper(method)
+
+		if op.path, ok = opMap["path"].(string); !ok {
+			return nil, missingParameterError{"path", "string"}
+		}
+		if !isBatchPath(op.path) {
+			return nil, invalidParameterError{"path", "path of a bank, " +
+				"account, category, transaction or share"}
+		}
+
+		if body, ok := opMap["body"]; ok && body != nil {
+			var err error
+			if op.body, err = json.Marshal(body); err != nil {
+				return nil, invalidParameterError{"body", "JSON value"}
+			}
+		}
+
+		if headers, ok := opMap["headers"]; ok && headers != nil {
+			headersMap, ok := headers.(map[string]interface{})
+			if !ok {
+				return nil, invalidParameterError{"headers",
+					"object of strings"}
+			}
+			op.headers = map[string]string{}
+			for name, value := range headersMap {
+				str, ok := value.(string)
+				if !ok {
+					return nil, invalidParameterError{"headers",
+						"object of strings"}
+				}
+				op.headers[name] = str
+			}
+		}
+
+		ops = append(ops, op)
+	}
+	return ops, nil
+}
+
+// isBatchPath returns true if the given path (with an optional query string)
+// is the one of a resource which can be modified through a batch request.
+// example: isBatchPath("/accounts/3/transactions?limit=2") => true
+func isBatchPath(path string) bool {
+	u, err := url.Parse(path)
+	if err != nil || u.IsAbs() || !strings.HasPrefix(u.Path, "/") {
+		return false
+	}
+	var segments = splitPath(u.Path)
+	return len(segments) > 0 && stringInArray(segments[0], batch_resources)
+}
@@ -0,0 +1,39 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/peaberberian/GoBanks/auth"
+	"github.com/peaberberian/GoBanks/database"
+)
+
+// handleCacheRead handle GET requests on the /cache API, giving the
+// statistics of the database cache (see database.NewCachedDataBase).
+// Only administrators can access it.
+func handleCacheRead(w http.ResponseWriter, r *http.Request,
+	t *auth.UserToken) {
+
+	if !t.IsAdministrator {
+		handleError(w, notPermittedOperationError{})
+		return
+	}
+
+	stats, enabled := database.GetCacheStats(database.GoDB)
+	var resJson = CacheStatsJSON{
+		Enabled:       enabled,
+		Hits:          stats.Hits,
+		Misses:        stats.Misses,
+		Evictions:     stats.Evictions,
+		Invalidations: stats.Invalidations,
+		Users:         stats.Users,
+		Entries:       stats.Entries,
+	}
+
+	resBytes, err := json.Marshal(resJson)
+	if err != nil {
+		handleError(w, genericOperationError{})
+		return
+	}
+	w.Write(resBytes)
+}
@@ -12,6 +12,7 @@ import (
 // DBCategory properties gettable through this handler
 var gettable_category_fields = []string{
 	"Id",
+	"Version",
 	"UserId",
 	"Name",
 	"Description",
@@ -19,36 +20,34 @@ var gettable_category_fields = []string{
 	// "ParentId",
 }
 
-// handleCategories is the main handler for call on the /categories api. It dispatches
-// to other function based on the HTTP method used the typical REST CRUD
-// naming scheme.
-func handleCategories(w http.ResponseWriter, r *http.Request,
-	t *auth.UserToken) {
+// DBCategory properties modified when a category is replaced through a PUT
+// request
+var updatable_category_fields = []string{
+	"Name",
+	"Description",
+}
 
-	switch r.Method {
-	case "GET":
-		handleCategoryRead(w, r, t)
-	case "POST":
-		handleCategoryCreate(w, r, t)
-	case "PUT":
-		handleCategoryUpdate(w, r, t)
-	case "DELETE":
-		handleCategoryDelete(w, r, t)
-	default:
-		handleNotSupportedMethod(w, r.Method)
-	}
+// DBCategory properties which can be used to sort the categories, by their
+// name in the sort query string property
+var sortable_category_fields = map[string]sortableField{
+	"id":          {"Id", false},
+	"name":        {"Name", false},
+	"description": {"Description", false},
 }
 
 // handleCategoryRead handle GET requests on the /categories API
 func handleCategoryRead(w http.ResponseWriter, r *http.Request,
 	t *auth.UserToken) {
 
+	var db = getDatabase(r)
+
 	// look if we have an id (GET /categories/35 => id == 35)
-	var id, hasIdInUrl = getApiId(r.URL.Path)
+	var id, hasIdInUrl = getApiId(r)
 
 	var queryString = r.URL.Query()
 	var f database.DBCategoryFilters
 	var limit int
+	var pg pagination
 
 	// always filter on the current user
 	f.UserId.SetFilter(t.UserId)
@@ -79,10 +78,19 @@ func handleCategoryRead(w http.ResponseWriter, r *http.Request,
 		// obtain limit of wanted records, if set
 		limit, _ = queryStringPropertyToInt(queryString, "limit")
 		fmt.Println("limit", limit)
+
+		// obtain the wanted order and position in the results, if set
+		var err error
+		pg, err = readPagination(queryString, sortable_category_fields)
+		if err != nil {
+			handleError(w, err)
+			return
+		}
+		pg.setFilters(&f.Sort, &f.After)
 	}
 
 	// perform the database request
-	vals, err := database.GoDB.GetCategories(f, gettable_category_fields, uint(limit))
+	vals, err := db.GetCategories(f, gettable_category_fields, uint(limit))
 	if err != nil {
 		handleError(w, queryOperationError{})
 		return
@@ -91,13 +99,28 @@ func handleCategoryRead(w http.ResponseWriter, r *http.Request,
 	// if an id was given, we're awaiting an object, not an array.
 	if hasIdInUrl {
 		if len(vals) == 0 {
-			fmt.Fprintf(w, "{}")
-		} else {
+			handleError(w, notFoundError{})
+		} else if !handleNotModified(w, r, versionETag(vals[0].Version)) {
 			fmt.Fprintf(w, generateCategoryResponse(vals[0]))
 		}
 		return
 	}
 
+	// count every result and give the link to the next ones
+	total, err := db.CountCategories(f)
+	if err != nil {
+		handleError(w, queryOperationError{})
+		return
+	}
+	pg.setHeaders(w, r, total, len(vals), limit,
+		func(property string) interface{} {
+			return categorySortValue(vals[len(vals)-1], property)
+		})
+	if handleNotModified(w, r, listETag(total, len(vals),
+		func(i int) (int, int) { return vals[i].Id, vals[i].Version })) {
+		return
+	}
+
 	// else respond directly with the result
 	if len(vals) == 0 {
 		fmt.Fprintf(w, "[]")
@@ -110,11 +133,7 @@ func handleCategoryRead(w http.ResponseWriter, r *http.Request,
 func handleCategoryCreate(w http.ResponseWriter, r *http.Request,
 	t *auth.UserToken) {
 
-	// you cannot post on a specific id, reject if you want to do that
-	if _, hasIdInUrl := getApiId(r.URL.Path); hasIdInUrl {
-		handleNotSupportedMethod(w, r.Method)
-		return
-	}
+	var db = getDatabase(r)
 
 	// convert body to map[string]interface{}
 	bodyMap, err := readBodyAsStringMap(r.Body)
@@ -135,32 +154,39 @@ func handleCategoryCreate(w http.ResponseWriter, r *http.Request,
 	categoryElem.UserId = t.UserId
 
 	// perform database add request
-	category, err := database.GoDB.AddCategory(categoryElem)
+	category, err := db.AddCategory(categoryElem)
 	if err != nil {
 		handleError(w, queryOperationError{})
 		return
 	}
 
+	handleCreated(w, r, category.Id)
 	fmt.Fprintf(w, generateCategoryResponse(category))
 }
 
-// handleCategoryUpdate handle PUT requests on the /categories API
+// handleCategoryUpdate handle PUT and PATCH requests on the /categories/{id}
+// API. PUT replaces the whole category, PATCH only modifies the properties
+// present in its JSON merge patch body (see categoryPatchToParams).
 func handleCategoryUpdate(w http.ResponseWriter, r *http.Request,
 	t *auth.UserToken) {
 
-	// look if we have an id (GET /categories/35 => id == 35)
-	var id, hasIdInUrl = getApiId(r.URL.Path)
+	var db = getDatabase(r)
 
-	// if an id was found, it means that we want to replace an element
-	// redirect to the right function
-	if !hasIdInUrl {
-		handleCategoryReplace(w, r, t)
-		return
-	}
+	// id of the wanted element (PUT /categories/35 => id == 35)
+	var id, _ = getApiId(r)
+
+	setAcceptPatchHeader(w)
 
 	// check that we can modify this category params
 	// (blocking database request here :(, TODO see what I can do, jwt?)
-	if err := checkPermissionForCategory(t, id); err != nil {
+	if err := checkPermissionForCategory(db, t, id); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	// the If-Match header gives the versions which can be modified
+	versions, err := readIfMatchVersions(r)
+	if err != nil {
 		handleError(w, err)
 		return
 	}
@@ -172,43 +198,40 @@ func handleCategoryUpdate(w http.ResponseWriter, r *http.Request,
 		return
 	}
 
-	// -- check fields and update only the ones there --
-
 	var fields []string
 	var categoryElem database.DBCategoryParams
 
-	if val, ok := bodyMap["name"]; ok {
-		if str, ok := val.(string); !ok {
-			handleError(w, bodyParsingError{})
-			return
-		} else {
-			categoryElem.Name = str
-			fields = append(fields, "Name")
-		}
+	if r.Method == "PATCH" {
+		categoryElem, fields, err = categoryPatchToParams(bodyMap)
+	} else {
+		categoryElem, err = inputToCategoryParams(bodyMap)
+		fields = updatable_category_fields
 	}
-	if val, ok := bodyMap["description"]; ok {
-		if str, ok := val.(string); !ok {
-			handleError(w, bodyParsingError{})
-			return
-		} else {
-			categoryElem.Description = str
-			fields = append(fields, "Description")
-		}
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	// an empty patch does not modify anything
+	if len(fields) == 0 {
+		handleSuccess(w, r)
+		return
 	}
-	// TODO
-	// if val, ok := bodyMap["parentId"]; ok {
-	// }
 
 	// Filter the category id
 	var f database.DBCategoryFilters
 	f.Ids.SetFilter([]int{id})
+	if len(versions) > 0 {
+		f.Versions.SetFilter(versions)
+	}
 
 	// perform the database request
-	if err = database.GoDB.UpdateCategories(f, fields, categoryElem); err != nil {
-		handleError(w, queryOperationError{})
+	if err = db.UpdateCategories(f, fields, categoryElem); err != nil {
+		handleError(w, versionedWriteError(err))
 		return
 	}
 
+	setUpdatedETag(w, versions)
 	handleSuccess(w, r)
 }
 
@@ -216,27 +239,39 @@ func handleCategoryUpdate(w http.ResponseWriter, r *http.Request,
 func handleCategoryDelete(w http.ResponseWriter, r *http.Request,
 	t *auth.UserToken) {
 
+	var db = getDatabase(r)
+
 	// look if we have an id (GET /categories/35 => id == 35)
-	var id, hasIdInUrl = getApiId(r.URL.Path)
+	var id, hasIdInUrl = getApiId(r)
 
 	var f database.DBCategoryFilters
 
 	// if we have an id, check permission and set filter
 	if hasIdInUrl {
 		// (blocking database request here :(, TODO see what I can do, jwt?)
-		if err := checkPermissionForCategory(t, id); err != nil {
+		if err := checkPermissionForCategory(db, t, id); err != nil {
+			handleError(w, err)
+			return
+		}
+
+		// the If-Match header gives the versions which can be removed
+		versions, err := readIfMatchVersions(r)
+		if err != nil {
 			handleError(w, err)
 			return
 		}
 		f.Ids.SetFilter([]int{id})
+		if len(versions) > 0 {
+			f.Versions.SetFilter(versions)
+		}
 	} else {
 		// filter by userId
 		f.UserId.SetFilter(t.UserId)
 	}
 
 	// perform the database request
-	if err := database.GoDB.RemoveCategories(f); err != nil {
-		handleError(w, queryOperationError{})
+	if err := db.RemoveCategories(f); err != nil {
+		handleError(w, versionedWriteError(err))
 		return
 	}
 	handleSuccess(w, r)
@@ -244,9 +279,18 @@ func handleCategoryDelete(w http.ResponseWriter, r *http.Request,
 
 // handleCategoryReplace handle specifically PUT requests on the main /categories API
 // (not restricted to a certain id).
+// As every category not given is removed, it has to be confirmed (see
+// checkReplaceConfirmation).
 func handleCategoryReplace(w http.ResponseWriter, r *http.Request,
 	t *auth.UserToken) {
 
+	var db = getDatabase(r)
+
+	if err := checkReplaceConfirmation(r); err != nil {
+		handleError(w, err)
+		return
+	}
+
 	var bodyMaps, err = readBodyAsArrayOfStringMap(r.Body)
 	if err != nil {
 		handleError(w, queryOperationError{})
@@ -266,48 +310,59 @@ func handleCategoryReplace(w http.ResponseWriter, r *http.Request,
 		bnks = append(bnks, categoryElem)
 	}
 
-	// Remove old categories linked to this user
-	var f database.DBCategoryFilters
-	f.UserId.SetFilter(t.UserId)
+	// replace the categories in a single transaction, to never lose them
+	err = db.WithTx(func(db database.GoBanksDataBase) error {
+		// Remove old categories linked to this user
+		var f database.DBCategoryFilters
+		f.UserId.SetFilter(t.UserId)
 
-	if err := database.GoDB.RemoveCategories(f); err != nil {
-		handleError(w, queryOperationError{})
-		return
-	}
+		if err := db.RemoveCategories(f); err != nil {
+			return err
+		}
 
-	// add each category indicated to the database
-	for _, ctg := range bnks {
-		ctg.UserId = t.UserId
-		if _, err := database.GoDB.AddCategory(ctg); err != nil {
-			handleError(w, queryOperationError{})
-			return
+		// add each category indicated to the database
+		for _, ctg := range bnks {
+			ctg.UserId = t.UserId
+			if _, err := db.AddCategory(ctg); err != nil {
+				return err
+			}
 		}
+		return nil
+	})
+	if err != nil {
+		handleError(w, queryOperationError{})
+		return
 	}
 	handleSuccess(w, r)
 }
 
 // checkPermissionForCategory checks if an user related to the given token has
-// the given categoryId. It returns an error if the user doesn't have this category
-// or if the database query failed.
-func checkPermissionForCategory(t *auth.UserToken, categoryId int) OperationError {
-	if val, err := userHasCategory(t.UserId, categoryId); !val {
-		return notPermittedOperationError{}
-	} else if err != nil {
+// the given categoryId. As categories are only seen by their user, it
+// returns a notFoundError if the user doesn't have this category, or an
+// error if the database query failed.
+func checkPermissionForCategory(db database.GoBanksDataBase,
+	t *auth.UserToken, categoryId int) OperationError {
+
+	if val, err := userHasCategory(db, t.UserId, categoryId); err != nil {
 		return queryOperationError{}
+	} else if !val {
+		return notFoundError{}
 	}
 	return nil
 }
 
 // userHasCategory checks if the userId given possess the categoryId also given in
 // argument. It can return an error if the database query failed.
-func userHasCategory(userId int, categoryId int) (bool, error) {
+func userHasCategory(db database.GoBanksDataBase, userId int,
+	categoryId int) (bool, error) {
+
 	var f database.DBCategoryFilters
 
 	f.UserId.SetFilter(userId)
 	f.Ids.SetFilter([]int{categoryId})
 
 	var fields = gettable_category_fields
-	val, err := database.GoDB.GetCategories(f, fields, 0)
+	val, err := db.GetCategories(f, fields, 0)
 	if len(val) == 0 || err != nil {
 		return false, err
 	}
@@ -347,6 +402,7 @@ func generateCategoriesResponse(ctg []database.DBCategory) string {
 func dbCategoryToCategoryJSON(ctg database.DBCategory) CategoryJSON {
 	return CategoryJSON{
 		Id:          ctg.Id,
+		Version:     ctg.Version,
 		Name:        ctg.Name,
 		Description: ctg.Description,
 	}
@@ -361,7 +417,7 @@ func inputToCategoryParams(input map[string]interface{}) (database.DBCategoryPar
 	// The "name" field is mandatory
 	res.Name, valid = input["name"].(string)
 	if !valid {
-		return res, missingParameterError{"name"}
+		return res, missingParameterError{"name", "string"}
 	}
 
 	res.Description, _ = input["description"].(string)
@@ -372,3 +428,45 @@ func inputToCategoryParams(input map[string]interface{}) (database.DBCategoryPar
 
 	return res, nil
 }
+
+// categoryPatchToParams reads the JSON merge patch (RFC 7396) given to
+// modify a category. It returns the new values and the properties to update.
+func categoryPatchToParams(patch map[string]interface{}) (
+	database.DBCategoryParams, []string, error) {
+
+	var res database.DBCategoryParams
+	var fields []string
+	var present bool
+	var err error
+
+	if res.Name, present, err = readPatchString(patch, "name",
+		true); err != nil {
+		return res, nil, err
+	} else if present {
+		fields = append(fields, "Name")
+	}
+
+	if res.Description, present, err = readPatchString(patch, "description",
+		false); err != nil {
+		return res, nil, err
+	} else if present {
+		fields = append(fields, "Description")
+	}
+
+	return res, fields, nil
+}
+
+// categorySortValue returns the value of a sortable DBCategory property
+// (see sortable_category_fields).
+func categorySortValue(cat database.DBCategory,
+	property string) interface{} {
+	switch property {
+	case "Id":
+		return cat.Id
+	case "Name":
+		return cat.Name
+	case "Description":
+		return cat.Description
+	}
+	return nil
+}
@@ -0,0 +1,30 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/peaberberian/GoBanks/auth"
+	"github.com/peaberberian/GoBanks/errorcodes"
+)
+
+// handleErrorCodeRead handle GET requests on the /errors API
+func handleErrorCodeRead(w http.ResponseWriter, r *http.Request,
+	t *auth.UserToken) {
+
+	var resJson = []ErrorCodeJSON{}
+	for _, c := range errorcodes.Catalogue() {
+		resJson = append(resJson, ErrorCodeJSON{
+			Code:        c.Code,
+			Name:        c.Name,
+			Description: c.Description,
+		})
+	}
+
+	resBytes, err := json.Marshal(resJson)
+	if err != nil {
+		handleError(w, genericOperationError{})
+		return
+	}
+	w.Write(resBytes)
+}
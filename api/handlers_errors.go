@@ -1,13 +1,76 @@
 package api
 
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/peaberberian/GoBanks/auth"
+	"github.com/peaberberian/GoBanks/database"
+	"github.com/peaberberian/GoBanks/errorcodes"
+)
+
 const (
-	UnknownOperationErrorCode = 700 + iota
+	UnknownOperationErrorCode = errorcodes.OperationErrors + iota
 	BodyParsingErrorCode
 	QueryOperationErrorCode
 	MissingParameterErrorCode
 	NotPermittedOperationErrorCode
+	InsufficientScopeErrorCode
+	NotFoundErrorCode
+	InvalidParameterErrorCode
+	InvalidFilterExpressionErrorCode
+	PreconditionRequiredErrorCode
+	PreconditionFailedErrorCode
+	FileTooLargeErrorCode
+	UnsupportedMediaTypeErrorCode
+	AlreadySharedErrorCode
 )
 
+func init() {
+	errorcodes.Register(errorcodes.OperationErrors,
+		UnknownOperationErrorCode, "UnknownOperationError",
+		"The operation failed for an unknown reason.")
+	errorcodes.Register(errorcodes.OperationErrors,
+		BodyParsingErrorCode, "BodyParsing",
+		"The request body could not be read.")
+	errorcodes.Register(errorcodes.OperationErrors,
+		QueryOperationErrorCode, "QueryOperation",
+		"The query to perform the operation failed.")
+	errorcodes.Register(errorcodes.OperationErrors,
+		MissingParameterErrorCode, "MissingParameter",
+		"A mandatory parameter is missing.")
+	errorcodes.Register(errorcodes.OperationErrors,
+		NotPermittedOperationErrorCode, "NotPermittedOperation",
+		"The operation is not permitted.")
+	errorcodes.Register(errorcodes.OperationErrors,
+		InsufficientScopeErrorCode, "InsufficientScope",
+		"The personal access token does not grant the needed scope.")
+	errorcodes.Register(errorcodes.OperationErrors,
+		NotFoundErrorCode, "NotFound",
+		"The wanted resource does not exist.")
+	errorcodes.Register(errorcodes.OperationErrors,
+		InvalidParameterErrorCode, "InvalidParameter",
+		"A parameter does not have the expected type.")
+	errorcodes.Register(errorcodes.OperationErrors,
+		InvalidFilterExpressionErrorCode, "InvalidFilterExpression",
+		"The filter expression could not be parsed.")
+	errorcodes.Register(errorcodes.OperationErrors,
+		PreconditionRequiredErrorCode, "PreconditionRequired",
+		"The If-Match header is needed to modify this resource.")
+	errorcodes.Register(errorcodes.OperationErrors,
+		PreconditionFailedErrorCode, "PreconditionFailed",
+		"The If-Match header does not match any version of the resource.")
+	errorcodes.Register(errorcodes.OperationErrors,
+		FileTooLargeErrorCode, "FileTooLarge",
+		"The file sent is larger than allowed.")
+	errorcodes.Register(errorcodes.OperationErrors,
+		UnsupportedMediaTypeErrorCode, "UnsupportedMediaType",
+		"The type of the file sent is not allowed.")
+	errorcodes.Register(errorcodes.OperationErrors,
+		AlreadySharedErrorCode, "AlreadyShared",
+		"The bank or account is already shared with this user.")
+}
+
 type OperationError interface {
 	error
 	ErrorCode() uint32
@@ -16,8 +79,20 @@ type OperationError interface {
 type bodyParsingError struct{}
 type genericOperationError struct{}
 type queryOperationError struct{}
-type missingParameterError struct{ parameter string }
+type missingParameterError struct{ parameter, expectedType string }
 type notPermittedOperationError struct{}
+type insufficientScopeError struct{ scope string }
+type notFoundError struct{}
+type invalidParameterError struct{ parameter, expectedType string }
+type preconditionRequiredError struct{}
+type preconditionFailedError struct{}
+type fileTooLargeError struct{ maxSize int64 }
+type unsupportedMediaTypeError struct{ mimeType string }
+type alreadySharedError struct{}
+type invalidFilterExpressionError struct {
+	position int
+	reason   string
+}
 
 func (e genericOperationError) Error() string {
 	return "The operation failed."
@@ -54,6 +129,13 @@ func (e missingParameterError) ErrorCode() uint32 {
 	return MissingParameterErrorCode
 }
 
+func (e missingParameterError) ErrorDetails() *ErrorDetailsJSON {
+	if e.parameter == "" {
+		return nil
+	}
+	return &ErrorDetailsJSON{Field: e.parameter, ExpectedType: e.expectedType}
+}
+
 func (e notPermittedOperationError) Error() string {
 	return "The wanted operation is not permitted."
 }
@@ -61,3 +143,141 @@ func (e notPermittedOperationError) Error() string {
 func (e notPermittedOperationError) ErrorCode() uint32 {
 	return NotPermittedOperationErrorCode
 }
+
+func (e insufficientScopeError) Error() string {
+	if e.scope != "" {
+		return "This token does not grant the needed scope: " + e.scope
+	}
+	return "This route cannot be accessed with a personal access token."
+}
+
+func (e insufficientScopeError) ErrorCode() uint32 {
+	return InsufficientScopeErrorCode
+}
+
+func (e notFoundError) Error() string {
+	return "The wanted resource does not exist."
+}
+
+func (e notFoundError) ErrorCode() uint32 {
+	return NotFoundErrorCode
+}
+
+func (e invalidParameterError) Error() string {
+	return "Invalid request. The parameter \"" + e.parameter +
+		"\" should be of type " + e.expectedType + "."
+}
+
+func (e invalidParameterError) ErrorCode() uint32 {
+	return InvalidParameterErrorCode
+}
+
+func (e invalidParameterError) ErrorDetails() *ErrorDetailsJSON {
+	return &ErrorDetailsJSON{Field: e.parameter, ExpectedType: e.expectedType}
+}
+
+func (e invalidFilterExpressionError) Error() string {
+	return "Invalid filter expression at position " +
+		strconv.Itoa(e.position) + ": " + e.reason + "."
+}
+
+func (e invalidFilterExpressionError) ErrorCode() uint32 {
+	return InvalidFilterExpressionErrorCode
+}
+
+func (e invalidFilterExpressionError) ErrorDetails() *ErrorDetailsJSON {
+	return &ErrorDetailsJSON{Field: "filter", ExpectedType: "filter expression"}
+}
+
+func (e preconditionRequiredError) Error() string {
+	return "An If-Match header is needed to modify this resource."
+}
+
+func (e preconditionRequiredError) ErrorCode() uint32 {
+	return PreconditionRequiredErrorCode
+}
+
+func (e preconditionFailedError) Error() string {
+	return "The If-Match header does not match the version of the resource."
+}
+
+func (e preconditionFailedError) ErrorCode() uint32 {
+	return PreconditionFailedErrorCode
+}
+
+func (e fileTooLargeError) Error() string {
+	return "The file is too large. Maximum size: " +
+		strconv.FormatInt(e.maxSize, 10) + " bytes."
+}
+
+func (e fileTooLargeError) ErrorCode() uint32 {
+	return FileTooLargeErrorCode
+}
+
+func (e unsupportedMediaTypeError) Error() string {
+	return "Files of type \"" + e.mimeType + "\" are not allowed."
+}
+
+func (e unsupportedMediaTypeError) ErrorCode() uint32 {
+	return UnsupportedMediaTypeErrorCode
+}
+
+func (e alreadySharedError) Error() string {
+	return "This bank or account is already shared with this user."
+}
+
+func (e alreadySharedError) ErrorCode() uint32 {
+	return AlreadySharedErrorCode
+}
+
+// getErrorStatus returns the HTTP status code which should be sent for the
+// given error.
+func getErrorStatus(err error) int {
+	val, ok := err.(GoBanksError)
+	if !ok {
+		return http.StatusInternalServerError
+	}
+
+	switch val.ErrorCode() {
+	case BodyParsingErrorCode,
+		MissingParameterErrorCode,
+		InvalidParameterErrorCode,
+		InvalidFilterExpressionErrorCode,
+		auth.InvalidScopeErrorCode,
+		auth.WeakPasswordErrorCode:
+		return http.StatusBadRequest
+	case auth.UserNotFoundErrorCode,
+		auth.WrongPasswordErrorCode,
+		auth.ExpiredTokenErrorCode,
+		auth.InvalidTokenErrorCode,
+		auth.NoTokenErrorCode,
+		auth.InvalidTokenSigningMethodErrorCode,
+		auth.UnreadableTokenErrorCode,
+		auth.InvalidMFACodeErrorCode:
+		return http.StatusUnauthorized
+	case NotPermittedOperationErrorCode,
+		InsufficientScopeErrorCode:
+		return http.StatusForbidden
+	case NotFoundErrorCode:
+		return http.StatusNotFound
+	case auth.AlreadyTakenUsernameErrorCode,
+		auth.MFAAlreadyEnabledErrorCode,
+		auth.MFANotEnabledErrorCode,
+		AlreadySharedErrorCode:
+		return http.StatusConflict
+	case PreconditionFailedErrorCode,
+		database.VersionMismatchErrorCode:
+		return http.StatusPreconditionFailed
+	case PreconditionRequiredErrorCode:
+		return http.StatusPreconditionRequired
+	case FileTooLargeErrorCode:
+		return http.StatusRequestEntityTooLarge
+	case UnsupportedMediaTypeErrorCode:
+		return http.StatusUnsupportedMediaType
+	case auth.TooManyLoginAttemptsErrorCode:
+		return http.StatusTooManyRequests
+	case database.DatabaseConnectionErrorCode:
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
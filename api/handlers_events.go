@@ -0,0 +1,101 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/peaberberian/GoBanks/auth"
+	"github.com/peaberberian/GoBanks/database"
+)
+
+// interval between two comments sent to keep an events stream open
+const events_keepalive_interval = 30 * time.Second
+
+// handleEventRead handle GET requests on the /events API, streaming the
+// modifications of the data the user can access as Server-Sent Events.
+// Each event has the id of the modification, its type (e.g.
+// "transaction.created") and an EventJSON as data.
+//
+// A client reconnecting with a Last-Event-ID header (or a lastEventId query
+// string property) first receives the events it missed. If some of them
+// are not known anymore, a "reset" event is sent instead: the client should
+// then read its data again.
+func handleEventRead(w http.ResponseWriter, r *http.Request,
+	t *auth.UserToken) {
+
+	var bus = database.GoEvents
+	flusher, ok := w.(http.Flusher)
+	if bus == nil || !ok {
+		handleError(w, genericOperationError{})
+		return
+	}
+
+	var lastId uint64
+	var lastIdStr = r.Header.Get("Last-Event-ID")
+	if lastIdStr == "" {
+		lastIdStr = r.URL.Query().Get("lastEventId")
+	}
+	if lastIdStr != "" {
+		var err error
+		if lastId, err = strconv.ParseUint(lastIdStr, 10, 64); err != nil {
+			handleError(w, invalidParameterError{"Last-Event-ID", "integer"})
+			return
+		}
+	}
+
+	sub, missed, complete := bus.Subscribe(t.UserId, lastId)
+	defer sub.Close()
+
+	w.Header().Set("content-type", "text/event-stream")
+	w.Header().Set("cache-control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	if !complete {
+		fmt.Fprintf(w, "id: %d\nevent: reset\ndata: {}\n\n", sub.LastEventId)
+	}
+	for _, evt := range missed {
+		if writeServerSentEvent(w, evt) != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	var keepalive = time.NewTicker(events_keepalive_interval)
+	defer keepalive.Stop()
+	for {
+		select {
+		case evt, ok := <-sub.C:
+			// closed if this client was too slow, it will reconnect
+			if !ok || writeServerSentEvent(w, evt) != nil {
+				return
+			}
+		case <-keepalive.C:
+			if _, err := io.WriteString(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+// writeServerSentEvent writes the given event in an events stream.
+func writeServerSentEvent(w io.Writer, evt database.Event) error {
+	data, err := json.Marshal(EventJSON{
+		Id:         evt.Id,
+		Type:       evt.Type,
+		ResourceId: evt.ResourceId,
+		Date:       evt.Date.UnixNano() / 1e6,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", evt.Id,
+		evt.Type, data)
+	return err
+}
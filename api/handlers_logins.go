@@ -0,0 +1,52 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/peaberberian/GoBanks/auth"
+	"github.com/peaberberian/GoBanks/database"
+)
+
+// handleLoginRead handle GET requests on the /logins API
+func handleLoginRead(w http.ResponseWriter, r *http.Request,
+	t *auth.UserToken) {
+
+	// obtain limit of wanted records, if set
+	limit, _ := queryStringPropertyToInt(r.URL.Query(), "limit")
+
+	vals, err := auth.GetLoginAttempts(t.UserId, uint(limit))
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	if len(vals) == 0 {
+		fmt.Fprintf(w, "[]")
+	} else {
+		fmt.Fprintf(w, generateLoginAttemptsResponse(vals))
+	}
+}
+
+// generateLoginAttemptsResponse generates a JSON string representing a
+// collection of DBLoginAttempt structs provided for the API user. If the
+// marshalling fails or if the result is nil, an empty JSON array is returned
+// ('[]')
+func generateLoginAttemptsResponse(las []database.DBLoginAttempt) string {
+	var resJson []LoginAttemptJSON
+	for _, la := range las {
+		resJson = append(resJson, LoginAttemptJSON{
+			Id:          la.Id,
+			UserName:    la.UserName,
+			IpAddress:   la.IpAddress,
+			Success:     la.Success,
+			AttemptDate: la.AttemptDate.UnixNano() / 1e6,
+		})
+	}
+	resBytes, err := json.Marshal(resJson)
+	if err != nil || resBytes == nil {
+		return "[]"
+	}
+	return string(resBytes)
+}
@@ -0,0 +1,67 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/peaberberian/GoBanks/auth"
+)
+
+// handleMFAEnrollment handle POST requests on the /mfa API
+func handleMFAEnrollment(w http.ResponseWriter, r *http.Request,
+	t *auth.UserToken) {
+
+	secret, uri, err := auth.BeginTOTPEnrollment(t.UserId)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	resBytes, jerr := json.Marshal(TOTPEnrollmentJSON{Secret: secret, URI: uri})
+	if jerr != nil {
+		handleError(w, genericOperationError{})
+		return
+	}
+	w.Write(resBytes)
+}
+
+// handleMFAConfirmation handle POST requests on the /mfa/confirm API
+func handleMFAConfirmation(w http.ResponseWriter, r *http.Request,
+	t *auth.UserToken) {
+
+	var codeJson MFACodeJSON
+	if err := json.NewDecoder(r.Body).Decode(&codeJson); err != nil {
+		handleError(w, bodyParsingError{})
+		return
+	}
+
+	codes, err := auth.ConfirmTOTPEnrollment(t.UserId, codeJson.Code)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	resBytes, jerr := json.Marshal(RecoveryCodesJSON{RecoveryCodes: codes})
+	if jerr != nil {
+		handleError(w, genericOperationError{})
+		return
+	}
+	w.Write(resBytes)
+}
+
+// handleMFADisable handle DELETE requests on the /mfa API
+func handleMFADisable(w http.ResponseWriter, r *http.Request,
+	t *auth.UserToken) {
+
+	var codeJson MFACodeJSON
+	if err := json.NewDecoder(r.Body).Decode(&codeJson); err != nil {
+		handleError(w, bodyParsingError{})
+		return
+	}
+
+	if err := auth.DisableTOTP(t.UserId, codeJson.Code); err != nil {
+		handleError(w, err)
+		return
+	}
+	handleSuccess(w, r)
+}
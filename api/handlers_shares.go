@@ -0,0 +1,392 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/peaberberian/GoBanks/auth"
+	"github.com/peaberberian/GoBanks/database"
+)
+
+// DBShare properties gettable through this handler
+var gettable_share_fields = []string{
+	"Id",
+	"Version",
+	"UserId",
+	"BankId",
+	"AccountId",
+	"Role",
+}
+
+// handleShareRead handle GET requests on the /shares API.
+// Both the shares the user made on his banks and accounts and the ones
+// other users made with him are returned.
+func handleShareRead(w http.ResponseWriter, r *http.Request,
+	t *auth.UserToken) {
+
+	var db = getDatabase(r)
+
+	// look if we have an id (GET /shares/35 => id == 35)
+	var id, hasIdInUrl = getApiId(r)
+
+	shrs, err := getVisibleShares(db, t.UserId)
+	if err != nil {
+		handleError(w, queryOperationError{})
+		return
+	}
+
+	// if an id was given, we're awaiting an object, not an array.
+	if hasIdInUrl {
+		for _, shr := range shrs {
+			if shr.Id == id {
+				if !handleNotModified(w, r, versionETag(shr.Version)) {
+					fmt.Fprintf(w, generateShareResponse(shr))
+				}
+				return
+			}
+		}
+		handleError(w, notFoundError{})
+		return
+	}
+
+	if handleNotModified(w, r, listETag(len(shrs), len(shrs),
+		func(i int) (int, int) { return shrs[i].Id, shrs[i].Version })) {
+		return
+	}
+
+	if len(shrs) == 0 {
+		fmt.Fprintf(w, "[]")
+	} else {
+		fmt.Fprintf(w, generateSharesResponse(shrs))
+	}
+}
+
+// handleShareCreate handle POST requests on the /shares API. A bank or
+// account already shared with the user cannot be shared again: the role of
+// its share is updated instead.
+func handleShareCreate(w http.ResponseWriter, r *http.Request,
+	t *auth.UserToken) {
+
+	var db = getDatabase(r)
+
+	// convert body to map[string]interface{}
+	bodyMap, err := readBodyAsStringMap(r.Body)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	// translate data into a DBShareParams element
+	// (also check mandatory fields)
+	shareElem, err := inputToShareParams(db, bodyMap)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	// sharing with yourself makes no sense
+	if shareElem.UserId == t.UserId {
+		handleError(w, notPermittedOperationError{})
+		return
+	}
+
+	// only owners can share a bank or an account
+	if err := checkPermissionForShare(db, t, shareElem.BankId,
+		shareElem.AccountId); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	// a bank or account is shared once with a user: the role of its share
+	// is the one given
+	var sf database.DBShareFilters
+	sf.UserId.SetFilter(shareElem.UserId)
+	if shareElem.BankId != 0 {
+		sf.BankIds.SetFilter([]int{shareElem.BankId})
+	} else {
+		sf.AccountIds.SetFilter([]int{shareElem.AccountId})
+	}
+	shrs, err := db.GetShares(sf, []string{"Id"}, 1)
+	if err != nil {
+		handleError(w, queryOperationError{})
+		return
+	}
+	if len(shrs) > 0 {
+		handleError(w, alreadySharedError{})
+		return
+	}
+
+	// perform database add request
+	share, err := db.AddShare(shareElem)
+	if err != nil {
+		handleError(w, queryOperationError{})
+		return
+	}
+
+	handleCreated(w, r, share.Id)
+	fmt.Fprintf(w, generateShareResponse(share))
+}
+
+// handleShareUpdate handle PUT requests on the /shares API. Only the role
+// of a share can be updated.
+func handleShareUpdate(w http.ResponseWriter, r *http.Request,
+	t *auth.UserToken) {
+
+	var db = getDatabase(r)
+
+	// id of the wanted element (PUT /shares/35 => id == 35)
+	var id, _ = getApiId(r)
+
+	shr, shrErr := getShare(db, id)
+	if shrErr != nil {
+		handleError(w, shrErr)
+		return
+	}
+
+	// only owners can modify a share
+	if err := checkPermissionForShare(db, t, shr.BankId,
+		shr.AccountId); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	// the If-Match header gives the versions which can be modified
+	versions, err := readIfMatchVersions(r)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	// convert body to map[string]interface{}
+	bodyMap, err := readBodyAsStringMap(r.Body)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	var shareElem database.DBShareParams
+	shareElem.Role, _ = bodyMap["role"].(string)
+	if !stringInArray(shareElem.Role, share_roles) {
+		handleError(w, missingParameterError{"role", "string"})
+		return
+	}
+
+	var f database.DBShareFilters
+	f.Ids.SetFilter([]int{id})
+	if len(versions) > 0 {
+		f.Versions.SetFilter(versions)
+	}
+
+	// perform the database request
+	if err = db.UpdateShares(f, []string{"Role"},
+		shareElem); err != nil {
+		handleError(w, versionedWriteError(err))
+		return
+	}
+
+	setUpdatedETag(w, versions)
+	handleSuccess(w, r)
+}
+
+// handleShareDelete handle DELETE requests on the /shares API. A share can
+// be removed by an owner of the bank/account or by the user it was made to.
+func handleShareDelete(w http.ResponseWriter, r *http.Request,
+	t *auth.UserToken) {
+
+	var db = getDatabase(r)
+
+	// id of the wanted element (DELETE /shares/35 => id == 35)
+	var id, _ = getApiId(r)
+
+	shr, err := getShare(db, id)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	if shr.UserId != t.UserId {
+		if err := checkPermissionForShare(db, t, shr.BankId,
+			shr.AccountId); err != nil {
+			handleError(w, err)
+			return
+		}
+	}
+
+	// the If-Match header gives the versions which can be removed
+	versions, ifMatchErr := readIfMatchVersions(r)
+	if ifMatchErr != nil {
+		handleError(w, ifMatchErr)
+		return
+	}
+
+	var f database.DBShareFilters
+	f.Ids.SetFilter([]int{id})
+	if len(versions) > 0 {
+		f.Versions.SetFilter(versions)
+	}
+
+	// perform the database request
+	if err := db.RemoveShares(f); err != nil {
+		handleError(w, versionedWriteError(err))
+		return
+	}
+	handleSuccess(w, r)
+}
+
+// checkPermissionForShare checks if an user related to the given token is
+// an owner of the given bank or account (only one of them should be set).
+// It returns a notFoundError if the user cannot see them.
+func checkPermissionForShare(db database.GoBanksDataBase, t *auth.UserToken,
+	bankId int, accountId int) OperationError {
+
+	if bankId != 0 {
+		return checkPermissionForBank(db, t, bankId, ownerRole)
+	}
+	return checkPermissionForAccount(db, t, accountId, ownerRole)
+}
+
+// getShare returns the share with the given id. An error is returned if it
+// does not exist or if the database query failed.
+func getShare(db database.GoBanksDataBase, id int) (database.DBShare,
+	OperationError) {
+
+	var f database.DBShareFilters
+	f.Ids.SetFilter([]int{id})
+	shrs, err := db.GetShares(f, gettable_share_fields, 1)
+	if err != nil {
+		return database.DBShare{}, queryOperationError{}
+	}
+	if len(shrs) == 0 {
+		return database.DBShare{}, notFoundError{}
+	}
+	return shrs[0], nil
+}
+
+// getVisibleShares returns every share made on the banks and accounts the
+// given user owns, as well as every share made with him.
+func getVisibleShares(db database.GoBanksDataBase, userId int) (
+	[]database.DBShare, error) {
+
+	var res []database.DBShare
+	var addShares = func(shrs []database.DBShare) {
+		for _, shr := range shrs {
+			var found = false
+			for _, r := range res {
+				if r.Id == shr.Id {
+					found = true
+				}
+			}
+			if !found {
+				res = append(res, shr)
+			}
+		}
+	}
+
+	bankIds, err := getBankIdsForUser(db, userId, ownerRole)
+	if err != nil {
+		return res, err
+	}
+	accountIds, err := getAccountIdsForUser(db, userId, ownerRole)
+	if err != nil {
+		return res, err
+	}
+
+	var bf database.DBShareFilters
+	bf.BankIds.SetFilter(bankIds)
+	var af database.DBShareFilters
+	af.AccountIds.SetFilter(accountIds)
+	var uf database.DBShareFilters
+	uf.UserId.SetFilter(userId)
+
+	for _, f := range []database.DBShareFilters{bf, af, uf} {
+		shrs, err := db.GetShares(f, gettable_share_fields, 0)
+		if err != nil {
+			return res, err
+		}
+		addShares(shrs)
+	}
+	return res, nil
+}
+
+// generateShareResponse generates a JSON string representing the DBShare
+// struct provided for the API user. If the marshalling fails or if the
+// result is nil, an empty JSON object is returned ('{}')
+func generateShareResponse(shr database.DBShare) string {
+	var resJson = dbShareToShareJSON(shr)
+
+	resBytes, err := json.Marshal(resJson)
+	if err != nil || resBytes == nil {
+		return "{}"
+	}
+	return string(resBytes)
+}
+
+// generateSharesResponse generates a JSON string representing a collection
+// of DBShare structs provided for the API user. If the marshalling fails or
+// if the result is nil, an empty JSON array is returned ('[]')
+func generateSharesResponse(shrs []database.DBShare) string {
+	var resJson []ShareJSON
+	for _, shr := range shrs {
+		resJson = append(resJson, dbShareToShareJSON(shr))
+	}
+	resBytes, err := json.Marshal(resJson)
+	if err != nil || resBytes == nil {
+		return "[]"
+	}
+	return string(resBytes)
+}
+
+// dbShareToShareJSON takes a DBShare and convert it to its corresponding
+// ShareJSON response.
+func dbShareToShareJSON(shr database.DBShare) ShareJSON {
+	return ShareJSON{
+		Id:        shr.Id,
+		Version:   shr.Version,
+		UserId:    shr.UserId,
+		BankId:    shr.BankId,
+		AccountId: shr.AccountId,
+		Role:      shr.Role,
+	}
+}
+
+// process map[string]interface{} input to create a DBShareParams object.
+// The user the resource is shared with is given by its name ("user").
+// Exactly one of "bankId" or "accountId" has to be set.
+// if mandatory fields are not found, this function returns an error.
+func inputToShareParams(db database.GoBanksDataBase,
+	input map[string]interface{}) (database.DBShareParams, error) {
+
+	var res database.DBShareParams
+
+	userName, valid := input["user"].(string)
+	if !valid {
+		return res, missingParameterError{"user", "string"}
+	}
+
+	var uf database.DBUserFilters
+	uf.Name.SetFilter(userName)
+	usr, err := db.GetUser(uf, []string{"Id", "Name"})
+	if err != nil {
+		return res, queryOperationError{}
+	}
+	if usr.Id == 0 {
+		return res, missingParameterError{"user", "string"}
+	}
+	res.UserId = usr.Id
+
+	bankIdFl64, hasBank := input["bankId"].(float64)
+	accountIdFl64, hasAccount := input["accountId"].(float64)
+	if hasBank == hasAccount {
+		return res, missingParameterError{"bankId", "number"}
+	}
+	res.BankId = int(bankIdFl64)
+	res.AccountId = int(accountIdFl64)
+
+	res.Role, _ = input["role"].(string)
+	if !stringInArray(res.Role, share_roles) {
+		return res, missingParameterError{"role", "string"}
+	}
+
+	return res, nil
+}
@@ -0,0 +1,505 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/peaberberian/GoBanks/auth"
+	"github.com/peaberberian/GoBanks/database"
+)
+
+// DBTag properties gettable through the /tags API
+var gettable_tag_fields = []string{"Id", "Name"}
+
+// handleTagRead handle GET requests on the /tags API
+func handleTagRead(w http.ResponseWriter, r *http.Request,
+	t *auth.UserToken) {
+
+	var db = getDatabase(r)
+
+	// look if we have an id (GET /tags/35 => id == 35)
+	var id, hasIdInUrl = getApiId(r)
+
+	var f database.DBTagFilters
+	f.UserId.SetFilter(t.UserId)
+	if hasIdInUrl {
+		f.Ids.SetFilter([]int{id})
+	}
+
+	tags, err := db.GetTags(f, gettable_tag_fields, 0)
+	if err != nil {
+		handleError(w, queryOperationError{})
+		return
+	}
+
+	// if an id was given, we're awaiting an object, not an array.
+	if hasIdInUrl {
+		if len(tags) == 0 {
+			handleError(w, notFoundError{})
+			return
+		}
+		writeTagsResponse(w, dbTagToTagJSON(tags[0]))
+		return
+	}
+
+	var resJson = []TagJSON{}
+	for _, tag := range tags {
+		resJson = append(resJson, dbTagToTagJSON(tag))
+	}
+	writeTagsResponse(w, resJson)
+}
+
+// handleTagCreate handle POST requests on the /tags API
+func handleTagCreate(w http.ResponseWriter, r *http.Request,
+	t *auth.UserToken) {
+
+	var db = getDatabase(r)
+
+	// convert body to map[string]interface{}
+	bodyMap, err := readBodyAsStringMap(r.Body)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	name, err := readTagName(db, t, bodyMap)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	tag, err := db.AddTag(database.DBTagParams{UserId: t.UserId, Name: name})
+	if err != nil {
+		handleError(w, queryOperationError{})
+		return
+	}
+
+	handleCreated(w, r, tag.Id)
+	writeTagsResponse(w, dbTagToTagJSON(tag))
+}
+
+// handleTagUpdate handle PUT and PATCH requests on the /tags/{id} API,
+// renaming the tag.
+func handleTagUpdate(w http.ResponseWriter, r *http.Request,
+	t *auth.UserToken) {
+
+	var db = getDatabase(r)
+
+	// id of the wanted element (PUT /tags/35 => id == 35)
+	var id, _ = getApiId(r)
+
+	var f database.DBTagFilters
+	f.Ids.SetFilter([]int{id})
+	f.UserId.SetFilter(t.UserId)
+	tags, err := db.GetTags(f, gettable_tag_fields, 1)
+	if err != nil {
+		handleError(w, queryOperationError{})
+		return
+	}
+	if len(tags) == 0 {
+		handleError(w, notFoundError{})
+		return
+	}
+
+	// convert body to map[string]interface{}
+	bodyMap, err := readBodyAsStringMap(r.Body)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	var tag = tags[0]
+	var newName, _ = bodyMap["name"].(string)
+	if strings.TrimSpace(newName) != tag.Name {
+		name, err := readTagName(db, t, bodyMap)
+		if err != nil {
+			handleError(w, err)
+			return
+		}
+		if err = db.UpdateTags(f, []string{"Name"},
+			database.DBTagParams{Name: name}); err != nil {
+			handleError(w, queryOperationError{})
+			return
+		}
+		tag.Name = name
+	}
+
+	writeTagsResponse(w, dbTagToTagJSON(tag))
+}
+
+// handleTagDelete handle DELETE requests on the /tags/{id} API. The tag is
+// removed from every transaction.
+func handleTagDelete(w http.ResponseWriter, r *http.Request,
+	t *auth.UserToken) {
+
+	var db = getDatabase(r)
+
+	// id of the wanted element (DELETE /tags/35 => id == 35)
+	var id, _ = getApiId(r)
+
+	var f database.DBTagFilters
+	f.Ids.SetFilter([]int{id})
+	f.UserId.SetFilter(t.UserId)
+	tags, err := db.GetTags(f, []string{"Id"}, 1)
+	if err != nil {
+		handleError(w, queryOperationError{})
+		return
+	}
+	if len(tags) == 0 {
+		handleError(w, notFoundError{})
+		return
+	}
+
+	if err := db.RemoveTags(f); err != nil {
+		handleError(w, queryOperationError{})
+		return
+	}
+	handleSuccess(w, r)
+}
+
+// handleTransactionTagRead handle GET requests on the
+// /transactions/{id}/tags API, returning the tags of the user set on a
+// transaction.
+func handleTransactionTagRead(w http.ResponseWriter, r *http.Request,
+	t *auth.UserToken) {
+
+	var db = getDatabase(r)
+
+	var id, _ = getApiId(r)
+	ok, err := userCanAccessTransaction(db, t, id, viewerRole)
+	if err != nil {
+		handleError(w, queryOperationError{})
+		return
+	} else if !ok {
+		handleError(w, notFoundError{})
+		return
+	}
+
+	var ttf database.DBTransactionTagFilters
+	ttf.TransactionIds.SetFilter([]int{id})
+	tts, err := db.GetTransactionTags(ttf)
+	if err != nil {
+		handleError(w, queryOperationError{})
+		return
+	}
+
+	var resJson = []TagJSON{}
+	if len(tts) > 0 {
+		var tagIds []int
+		for _, tt := range tts {
+			tagIds = append(tagIds, tt.TagId)
+		}
+		var f database.DBTagFilters
+		f.Ids.SetFilter(tagIds)
+		f.UserId.SetFilter(t.UserId)
+		tags, err := db.GetTags(f, gettable_tag_fields, 0)
+		if err != nil {
+			handleError(w, queryOperationError{})
+			return
+		}
+		for _, tag := range tags {
+			resJson = append(resJson, dbTagToTagJSON(tag))
+		}
+	}
+	writeTagsResponse(w, resJson)
+}
+
+// handleTransactionTagAdd handle POST requests on the
+// /transactions/{id}/tags API, setting the tags of the "tagIds" array of the
+// body on a transaction.
+func handleTransactionTagAdd(w http.ResponseWriter, r *http.Request,
+	t *auth.UserToken) {
+
+	var db = getDatabase(r)
+
+	var id, _ = getApiId(r)
+
+	// convert body to map[string]interface{}
+	bodyMap, err := readBodyAsStringMap(r.Body)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	tagIds, err := readIntArray(bodyMap, "tagIds")
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	if err := tagTransactions(db, t, []int{id}, tagIds, nil); err != nil {
+		handleError(w, err)
+		return
+	}
+	handleSuccess(w, r)
+}
+
+// handleTransactionTagRemove handle DELETE requests on the
+// /transactions/{id}/tags/{tagId} API, removing a tag from a transaction.
+func handleTransactionTagRemove(w http.ResponseWriter, r *http.Request,
+	t *auth.UserToken) {
+
+	var db = getDatabase(r)
+
+	var id, _ = getApiId(r)
+	var tagId, _ = getApiIntParam(r, "tagId")
+
+	if err := tagTransactions(db, t, []int{id}, nil,
+		[]int{tagId}); err != nil {
+		handleError(w, err)
+		return
+	}
+	handleSuccess(w, r)
+}
+
+// handleTransactionTagBulk handle POST requests on the /transactions/tags
+// API: the tags of the "add" array of the body are set on every transaction
+// of the "transactionIds" array, and the ones of the "remove" array are
+// removed from them.
+func handleTransactionTagBulk(w http.ResponseWriter, r *http.Request,
+	t *auth.UserToken) {
+
+	var db = getDatabase(r)
+
+	// convert body to map[string]interface{}
+	bodyMap, err := readBodyAsStringMap(r.Body)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	transactionIds, err := readIntArray(bodyMap, "transactionIds")
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+	if len(transactionIds) == 0 {
+		handleError(w, missingParameterError{"transactionIds",
+			"array of numbers"})
+		return
+	}
+
+	var added, removed []int
+	if _, ok := bodyMap["add"]; ok {
+		if added, err = readIntArray(bodyMap, "add"); err != nil {
+			handleError(w, err)
+			return
+		}
+	}
+	if _, ok := bodyMap["remove"]; ok {
+		if removed, err = readIntArray(bodyMap, "remove"); err != nil {
+			handleError(w, err)
+			return
+		}
+	}
+
+	if err := tagTransactions(db, t, transactionIds, added,
+		removed); err != nil {
+		handleError(w, err)
+		return
+	}
+	handleSuccess(w, r)
+}
+
+// handleTagReport handle GET requests on the /report/tags API, returning
+// the sums of the debits and credits of the transactions of each tag of the
+// user, sorted by name.
+// The transactions can be filtered like on the /transactions API. The tags
+// property only reports the given tags.
+// The report is sent as a spreadsheet if the Accept header asks for one.
+func handleTagReport(w http.ResponseWriter, r *http.Request,
+	t *auth.UserToken) {
+
+	var db = getDatabase(r)
+	var queryString = r.URL.Query()
+
+	var f database.DBTransactionFilters
+	setTransactionAccessFilters(&f, t, viewerRole)
+	if err := setTransactionFilters(&f, queryString); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	var tf database.DBTagFilters
+	tf.UserId.SetFilter(t.UserId)
+	if tagIds, isDefined := queryStringPropertyToIntArray(queryString,
+		query_string_properties["Tags"]); isDefined {
+		tf.Ids.SetFilter(tagIds)
+	}
+	tags, err := db.GetTags(tf, gettable_tag_fields, 0)
+	if err != nil {
+		handleError(w, queryOperationError{})
+		return
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i].Name < tags[j].Name })
+
+	var tagIds []int
+	for _, tag := range tags {
+		tagIds = append(tagIds, tag.Id)
+	}
+	// the tags property selects the tags reported, not the transactions
+	f.Tags = database.DBTagFilter{}
+	reports, err := db.GetTagReports(f, tagIds)
+	if err != nil {
+		handleError(w, queryOperationError{})
+		return
+	}
+
+	var resJson = []TagReportJSON{}
+	for _, tag := range tags {
+		var report = reports[tag.Id]
+		resJson = append(resJson, TagReportJSON{
+			TagId:  tag.Id,
+			Name:   tag.Name,
+			Debit:  report.Debit,
+			Credit: report.Credit,
+		})
+	}
+
+	w.Header().Add("vary", "Accept")
+	if format, ok := getExportFormat(r); ok {
+		writeTagReportExport(w, format, resJson)
+		return
+	}
+	writeTagsResponse(w, resJson)
+}
+
+// writeTagReportExport writes the response of the /report/tags API as a
+// spreadsheet in the given format (see getExportFormat).
+func writeTagReportExport(w http.ResponseWriter, format exportFormat,
+	reports []TagReportJSON) {
+
+	setExportHeaders(w, format, "tags")
+	var table = format.newWriter(w, "Tags")
+	var err = table.writeRow([]tableCell{textCell("tagId"),
+		textCell("name"), textCell("debit"), textCell("credit")})
+	for _, report := range reports {
+		if err != nil {
+			break
+		}
+		err = table.writeRow([]tableCell{intCell(report.TagId),
+			textCell(report.Name), amountCell(report.Debit),
+			amountCell(report.Credit)})
+	}
+	if err == nil {
+		err = table.close()
+	}
+	if err != nil {
+		log.Println("Tag report export interrupted:", err)
+	}
+}
+
+// tagTransactions sets the added tags on the given transactions and
+// removes the removed ones from them, in a single transaction. The tags
+// must belong to the user of the given token, who must be able to see the
+// transactions.
+func tagTransactions(db database.GoBanksDataBase, t *auth.UserToken,
+	transactionIds []int, added []int, removed []int) error {
+
+	ok, err := userCanAccessTransactions(db, t, transactionIds, viewerRole)
+	if err != nil {
+		return queryOperationError{}
+	} else if !ok {
+		return notPermittedOperationError{}
+	}
+
+	var tagIds []int
+	for _, tagId := range append(append([]int{}, added...), removed...) {
+		if !intInArray(tagId, tagIds) {
+			tagIds = append(tagIds, tagId)
+		}
+	}
+	if len(tagIds) == 0 {
+		return nil
+	}
+
+	var f database.DBTagFilters
+	f.Ids.SetFilter(tagIds)
+	f.UserId.SetFilter(t.UserId)
+	tags, err := db.GetTags(f, []string{"Id"}, 0)
+	if err != nil {
+		return queryOperationError{}
+	}
+	if len(tags) != len(tagIds) {
+		return notPermittedOperationError{}
+	}
+
+	err = db.WithTx(func(db database.GoBanksDataBase) error {
+		if len(removed) > 0 {
+			var ttf database.DBTransactionTagFilters
+			ttf.TransactionIds.SetFilter(transactionIds)
+			ttf.TagIds.SetFilter(removed)
+			if err := db.RemoveTransactionTags(ttf); err != nil {
+				return err
+			}
+		}
+		return db.AddTransactionTags(transactionIds, added)
+	})
+	if err != nil {
+		return queryOperationError{}
+	}
+	return nil
+}
+
+// readTagName returns the "name" property of the body of a request creating
+// or renaming a tag. Returns an error if it is missing or already used by
+// another tag of the user.
+func readTagName(db database.GoBanksDataBase, t *auth.UserToken,
+	bodyMap map[string]interface{}) (string, error) {
+
+	name, _ := bodyMap["name"].(string)
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", missingParameterError{"name", "string"}
+	}
+
+	var f database.DBTagFilters
+	f.UserId.SetFilter(t.UserId)
+	f.Names.SetFilter([]string{name})
+	tags, err := db.GetTags(f, []string{"Id"}, 1)
+	if err != nil {
+		return "", queryOperationError{}
+	}
+	if len(tags) > 0 {
+		return "", invalidParameterError{"name", "unused tag name"}
+	}
+	return name, nil
+}
+
+// readIntArray returns the array of numbers of the given body property.
+func readIntArray(bodyMap map[string]interface{}, property string) ([]int,
+	error) {
+
+	arr, ok := bodyMap[property].([]interface{})
+	if !ok {
+		return nil, missingParameterError{property, "array of numbers"}
+	}
+	var ints []int
+	for _, val := range arr {
+		fl64, ok := val.(float64)
+		if !ok {
+			return nil, invalidParameterError{property, "array of numbers"}
+		}
+		ints = append(ints, int(fl64))
+	}
+	return ints, nil
+}
+
+// writeTagsResponse writes the given tags response as JSON.
+func writeTagsResponse(w http.ResponseWriter, res interface{}) {
+	resBytes, err := json.Marshal(res)
+	if err != nil {
+		handleError(w, genericOperationError{})
+		return
+	}
+	w.Write(resBytes)
+}
+
+// dbTagToTagJSON takes a DBTag and convert it to its corresponding TagJSON
+// response.
+func dbTagToTagJSON(tag database.DBTag) TagJSON {
+	return TagJSON{Id: tag.Id, Name: tag.Name}
+}
@@ -0,0 +1,153 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/peaberberian/GoBanks/auth"
+	"github.com/peaberberian/GoBanks/database"
+)
+
+// handlePersonalTokenRead handle GET requests on the /tokens API
+func handlePersonalTokenRead(w http.ResponseWriter, r *http.Request,
+	t *auth.UserToken) {
+
+	tkns, err := auth.GetPersonalTokens(t.UserId)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	if len(tkns) == 0 {
+		fmt.Fprintf(w, "[]")
+	} else {
+		fmt.Fprintf(w, generatePersonalTokensResponse(tkns))
+	}
+}
+
+// handlePersonalTokenCreate handle POST requests on the /tokens API.
+// The token is only returned in clear in this response.
+func handlePersonalTokenCreate(w http.ResponseWriter, r *http.Request,
+	t *auth.UserToken) {
+
+	var db = getDatabase(r)
+
+	// convert body to map[string]interface{}
+	bodyMap, err := readBodyAsStringMap(r.Body)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	name, valid := bodyMap["name"].(string)
+	if !valid {
+		handleError(w, missingParameterError{"name", "string"})
+		return
+	}
+
+	var scopes []string
+	scopesArr, _ := bodyMap["scopes"].([]interface{})
+	for _, val := range scopesArr {
+		if scope, ok := val.(string); ok {
+			scopes = append(scopes, scope)
+		} else {
+			handleError(w, invalidParameterError{"scopes", "array of strings"})
+			return
+		}
+	}
+
+	// the token can only be restricted to accounts the user can see
+	var accountIds []int
+	accountIdsArr, _ := bodyMap["accountIds"].([]interface{})
+	if len(accountIdsArr) > 0 {
+		userAccountIds, err := getAccountIdsForToken(db, t, viewerRole)
+		if err != nil {
+			handleError(w, queryOperationError{})
+			return
+		}
+		for _, val := range accountIdsArr {
+			accountId, ok := val.(float64)
+			if !ok {
+				handleError(w, invalidParameterError{"accountIds", "array of numbers"})
+				return
+			}
+			if !intInArray(int(accountId), userAccountIds) {
+				handleError(w, notPermittedOperationError{})
+				return
+			}
+			accountIds = append(accountIds, int(accountId))
+		}
+	}
+
+	var expiration time.Time
+	if expirationFl64, ok := bodyMap["expirationDate"].(float64); ok {
+		expiration = int64TimeStampToTime(int64(expirationFl64))
+	}
+
+	token, tkn, aerr := auth.CreatePersonalToken(t.UserId, name, scopes,
+		accountIds, expiration)
+	if aerr != nil {
+		handleError(w, aerr)
+		return
+	}
+
+	var resJson = dbPersonalTokenToPersonalTokenJSON(tkn)
+	resJson.Token = token
+	resBytes, err := json.Marshal(resJson)
+	if err != nil {
+		handleError(w, genericOperationError{})
+		return
+	}
+	handleCreated(w, r, tkn.Id)
+	w.Write(resBytes)
+}
+
+// handlePersonalTokenDelete handle DELETE requests on the /tokens API
+func handlePersonalTokenDelete(w http.ResponseWriter, r *http.Request,
+	t *auth.UserToken) {
+
+	// id of the wanted element (DELETE /tokens/35 => id == 35)
+	var id, _ = getApiId(r)
+
+	if err := auth.RevokePersonalToken(t.UserId, id); err != nil {
+		handleError(w, err)
+		return
+	}
+	handleSuccess(w, r)
+}
+
+// generatePersonalTokensResponse generates a JSON string representing a
+// collection of DBPersonalToken structs provided for the API user. If the
+// marshalling fails or if the result is nil, an empty JSON array is returned
+// ('[]')
+func generatePersonalTokensResponse(tkns []database.DBPersonalToken) string {
+	var resJson []PersonalTokenJSON
+	for _, tkn := range tkns {
+		resJson = append(resJson, dbPersonalTokenToPersonalTokenJSON(tkn))
+	}
+	resBytes, err := json.Marshal(resJson)
+	if err != nil || resBytes == nil {
+		return "[]"
+	}
+	return string(resBytes)
+}
+
+// dbPersonalTokenToPersonalTokenJSON takes a DBPersonalToken and convert it
+// to its corresponding PersonalTokenJSON response.
+func dbPersonalTokenToPersonalTokenJSON(
+	tkn database.DBPersonalToken,
+) PersonalTokenJSON {
+	var res = PersonalTokenJSON{
+		Id:           tkn.Id,
+		Name:         tkn.Name,
+		Scopes:       tkn.Scopes,
+		AccountIds:   tkn.AccountIds,
+		CreationDate: tkn.CreationDate.UnixNano() / 1e6,
+	}
+	if !tkn.ExpirationDate.IsZero() {
+		res.ExpirationDate = tkn.ExpirationDate.UnixNano() / 1e6
+	}
+	return res
+}
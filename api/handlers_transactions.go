@@ -3,6 +3,7 @@ package api
 import (
 	"fmt"
 	"net/http"
+	"net/url"
 
 	"encoding/json"
 
@@ -13,6 +14,7 @@ import (
 // DBTransaction properties gettable through this handler
 var gettable_transaction_fields = []string{
 	"Id",
+	"Version",
 	"AccountId",
 	"Label",
 	"CategoryId",
@@ -24,24 +26,72 @@ var gettable_transaction_fields = []string{
 	"Reference",
 }
 
-// TODO
-// Make relation between DBTransactionFilters names and their property name in
+// DBTransaction properties modified when a transaction is replaced through a
+// PUT request
+var updatable_transaction_fields = []string{
+	"AccountId",
+	"Label",
+	"CategoryId",
+	"Description",
+	"TransactionDate",
+	"RecordDate",
+	"Debit",
+	"Credit",
+	"Reference",
+}
+
+// DBTransaction properties which can be used to sort the transactions, by
+// their name in the sort query string property
+var sortable_transaction_fields = map[string]sortableField{
+	"id":              {"Id", false},
+	"accountId":       {"AccountId", false},
+	"label":           {"Label", false},
+	"category":        {"CategoryId", false},
+	"transactionDate": {"TransactionDate", true},
+	"recordDate":      {"RecordDate", true},
+	"debit":           {"Debit", false},
+	"credit":          {"Credit", false},
+	"reference":       {"Reference", false},
+}
+
+// DBTransaction properties which can be used in the filter query string
+// property (see parseFilterExpression), by their name in the expression
+var filterable_transaction_fields = map[string]filterableField{
+	"id":              {"Id", intFilterField},
+	"accountId":       {"AccountId", intFilterField},
+	"label":           {"Label", stringFilterField},
+	"category":        {"CategoryId", intFilterField},
+	"description":     {"Description", stringFilterField},
+	"transactionDate": {"TransactionDate", timeFilterField},
+	"recordDate":      {"RecordDate", timeFilterField},
+	"debit":           {"Debit", floatFilterField},
+	"credit":          {"Credit", floatFilterField},
+	"reference":       {"Reference", stringFilterField},
+}
+
+// Relation between DBTransactionFilters names and their property name in
 // the query string
 var query_string_properties = map[string]string{
 	"Ids":                 "id",
-	"AccountIds":          "aid",
-	"CategoryIds":         "cid",
+	"CategoryIds":         "category",
 	"FromTransactionDate": "tfrom",
 	"ToTransactionDate":   "tto",
 	"FromRecordDate":      "rfrom",
 	"ToRecordDate":        "rto",
-	"MinDebit":            "mind",
-	"MaxDebit":            "maxd",
-	"MinCredit":           "minc",
-	"MaxCredit":           "maxc",
-	"References":          "ref",
+	"MinDebit":            "min_debit",
+	"MaxDebit":            "max_debit",
+	"MinCredit":           "min_credit",
+	"MaxCredit":           "max_credit",
+	"References":          "reference",
+	"Search":              "q",
+	"Expression":          "filter",
+	"Tags":                "tags",
 }
 
+// query string property set to "all" to only get the transactions having
+// every tag of the Tags property, instead of any of them
+const tags_match_property = "tags_match"
+
 // madatory_transaction_json_fields list all mandatory parameters when the user
 // wants to create a new transaction.
 // If one of those field is not present as a request is received, an error
@@ -50,126 +100,99 @@ var mandatory_transaction_json_fields = []string{
 	"accountId",
 }
 
-// handleTransactions is the main handler for call on the /accounts api. It
-// dispatches to other function based on the HTTP method used the typical
-// REST CRUD naming scheme.
-func handleTransactions(w http.ResponseWriter, r *http.Request,
-	t *auth.UserToken) {
-
-	switch r.Method {
-	case "GET":
-		handleTransactionRead(w, r, t)
-	case "POST":
-		handleTransactionCreate(w, r, t)
-	case "PUT":
-		handleTransactionUpdate(w, r, t)
-	case "DELETE":
-		handleTransactionDelete(w, r, t)
-	default:
-		handleNotSupportedMethod(w, r.Method)
-	}
-}
-
-// handleAccountRead handle GET requests on the /accounts API
+// handleTransactionRead handle GET requests on the /transactions and
+// /accounts/{id}/transactions APIs
 func handleTransactionRead(w http.ResponseWriter, r *http.Request,
 	t *auth.UserToken) {
 
+	var db = getDatabase(r)
+
 	// look if we have an id (GET /transactions/35 => id == 35)
-	var id, hasIdInUrl = getApiId(r.URL.Path)
+	var id, hasIdInUrl = getApiId(r)
 
 	var queryString = r.URL.Query()
 	var f database.DBTransactionFilters
 	var limit int
+	var pg pagination
+	var err error
 
-	// recuperate every bank attached to this user.
-	// (blocking database request here :(, TODO see what I can do, cache?)
-	bankIds, err := getBankIdsForUserId(t.UserId)
-	if err != nil {
-		handleError(w, queryOperationError{})
-		return
-	}
+	// only keep the transactions of the accounts this user can see (in his
+	// banks or shared with him).
+	setTransactionAccessFilters(&f, t, viewerRole)
 
-	accountIds, err := getAccountIdsForBankIds(bankIds)
-	if err != nil {
-		handleError(w, queryOperationError{})
-		return
+	// only the transactions of a single account are wanted
+	// (GET /accounts/3/transactions => accountId == 3)
+	if accountId, hasAccountId := getApiIntParam(r, "accountId"); hasAccountId {
+		ok, err := userCanAccessAccounts(db, t, []int{accountId}, viewerRole)
+		if err != nil {
+			handleError(w, queryOperationError{})
+			return
+		} else if !ok {
+			handleError(w, notFoundError{})
+			return
+		}
+		f.AccountIds.SetFilter([]int{accountId})
 	}
 
-	f.AccountIds.SetFilter(accountIds)
-
 	// if an id was set in the url, filter to the record corresponding to it
 	if hasIdInUrl {
 		f.Ids.SetFilter([]int{id})
 	} else {
-		// if only some transaction ids are wanted, filter
-		wantedTransactionIds, _ := queryStringPropertyToIntArray(queryString, "id")
-		if len(wantedTransactionIds) > 0 {
-			f.Ids.SetFilter(wantedTransactionIds)
-		}
-
-		// if only some category ids are wanted, filter
-		wantedCategoryIds, _ :=
-			queryStringPropertyToIntArray(queryString, "category")
-		if len(wantedCategoryIds) > 0 {
-			f.CategoryIds.SetFilter(wantedCategoryIds)
-		}
-
-		// if a FromTransactionDate timestamp has been provided, filter
-		if wantedFromTDate, isDefined :=
-			queryStringPropertyToTime(queryString, "tfrom"); isDefined {
-			f.FromTransactionDate.SetFilter(wantedFromTDate)
-		}
-
-		// if a ToTransactionDate timestamp has been provided, filter
-		if wantedToTDate, isDefined :=
-			queryStringPropertyToTime(queryString, "tto"); isDefined {
-			f.ToTransactionDate.SetFilter(wantedToTDate)
-		}
-
-		// if a FromRecordDate timestamp has been provided, filter
-		if wantedFromRDate, isDefined :=
-			queryStringPropertyToTime(queryString, "rfrom"); isDefined {
-			f.FromRecordDate.SetFilter(wantedFromRDate)
-		}
-
-		// if a ToRecordDate timestamp has been provided, filter
-		if wantedToRDate, isDefined :=
-			queryStringPropertyToTime(queryString, "rto"); isDefined {
-			f.ToRecordDate.SetFilter(wantedToRDate)
+		if err = setTransactionFilters(&f, queryString); err != nil {
+			handleError(w, err)
+			return
 		}
 
-		if wantedMinDebit, isDefined :=
-			queryStringPropertyToFloat32(queryString, "min_debit"); isDefined {
-			f.MinDebit.SetFilter(wantedMinDebit)
-		}
+		// obtain limit of wanted records, if set
+		limit, _ = queryStringPropertyToInt(queryString, "limit")
 
-		if wantedMaxDebit, isDefined :=
-			queryStringPropertyToFloat32(queryString, "max_debit"); isDefined {
-			f.MaxDebit.SetFilter(wantedMaxDebit)
+		// obtain the wanted order and position in the results, if set
+		pg, err = readPagination(queryString, sortable_transaction_fields)
+		if err != nil {
+			handleError(w, err)
+			return
 		}
+		pg.setFilters(&f.Sort, &f.After)
+	}
 
-		if wantedMinCredit, isDefined :=
-			queryStringPropertyToFloat32(queryString, "min_debit"); isDefined {
-			f.MinCredit.SetFilter(wantedMinCredit)
+	// if an id was given, we're awaiting an object, not an array.
+	if hasIdInUrl {
+		vals, err := db.GetTransactions(f, gettable_transaction_fields, 0)
+		if err != nil {
+			handleError(w, queryOperationError{})
+		} else if len(vals) == 0 {
+			handleError(w, notFoundError{})
+		} else if !handleNotModified(w, r, versionETag(vals[0].Version)) {
+			fmt.Fprintf(w, dbTransactionToJSONString(vals[0]))
 		}
+		return
+	}
 
-		if wantedMaxCredit, isDefined :=
-			queryStringPropertyToFloat32(queryString, "max_debit"); isDefined {
-			f.MaxCredit.SetFilter(wantedMaxCredit)
-		}
+	// count every result and give the link to the next ones
+	total, err := db.CountTransactions(f)
+	if err != nil {
+		handleError(w, queryOperationError{})
+		return
+	}
 
-		// if only some transaction names are wanted, filter
-		if wantedTransactionReferences, isDefined :=
-			queryStringPropertyToStringArray(queryString, "reference"); isDefined {
-			f.References.SetFilter(wantedTransactionReferences)
+	// without limit, transactions are written as soon as they are read from
+	// the database instead of all being loaded first. No ETag can then be
+	// given.
+	if limit == 0 {
+		pg.setHeaders(w, r, total, 0, limit, nil)
+		tw, err := newTransactionWriter(db, w, r, t)
+		if err != nil {
+			handleError(w, queryOperationError{})
+			return
 		}
-
-		// obtain limit of wanted records, if set
-		limit, _ = queryStringPropertyToInt(queryString, "limit")
+		err = db.ForEachTransaction(f, gettable_transaction_fields, 0,
+			tw.write)
+		tw.close(err)
+		return
 	}
 
 	// perform the database request
-	vals, err := database.GoDB.GetTransactions(
+	vals, err := db.GetTransactions(
 		f,
 		gettable_transaction_fields,
 		uint(limit))
@@ -179,47 +202,143 @@ func handleTransactionRead(w http.ResponseWriter, r *http.Request,
 		return
 	}
 
-	// if an id was given, we're awaiting an object, not an array.
-	if hasIdInUrl {
-		if len(vals) == 0 {
-			fmt.Fprintf(w, "{}")
-		} else {
-			fmt.Fprintf(w, dbTransactionToJSONString(vals[0]))
-		}
+	pg.setHeaders(w, r, total, len(vals), limit,
+		func(property string) interface{} {
+			return transactionSortValue(vals[len(vals)-1], property)
+		})
+
+	// exported spreadsheets have no ETag, as it would be the same as the
+	// JSON response's one
+	if _, isExport := getExportFormat(r); !isExport &&
+		handleNotModified(w, r, listETag(total, len(vals),
+			func(i int) (int, int) { return vals[i].Id, vals[i].Version })) {
 		return
 	}
 
 	// else respond directly with the result
-	if len(vals) == 0 {
-		fmt.Fprintf(w, "[]")
-	} else {
-		fmt.Fprintf(w, dbTransactionsToJSONString(vals))
+	tw, err := newTransactionWriter(db, w, r, t)
+	if err != nil {
+		handleError(w, queryOperationError{})
+		return
+	}
+	for _, val := range vals {
+		if err = tw.write(val); err != nil {
+			break
+		}
 	}
+	tw.close(err)
 }
 
-// handleTransactionCreate handle POST requests on the /accounts API
-func handleTransactionCreate(w http.ResponseWriter, r *http.Request,
-	t *auth.UserToken) {
+// setTransactionFilters sets the filters wanted in the query string of a
+// GET request on the /transactions API (see query_string_properties).
+// Returns an error if the filter expression is not valid.
+func setTransactionFilters(f *database.DBTransactionFilters,
+	queryString url.Values) error {
 
-	// you cannot post on a specific id, reject if you want to do that
-	if _, hasId := getApiId(r.URL.Path); hasId {
-		handleNotSupportedMethod(w, r.Method)
-		return
+	var qsp = query_string_properties
+
+	// if only some transaction ids are wanted, filter
+	wantedTransactionIds, _ :=
+		queryStringPropertyToIntArray(queryString, qsp["Ids"])
+	if len(wantedTransactionIds) > 0 {
+		f.Ids.SetFilter(wantedTransactionIds)
 	}
 
-	// recuperate every bank attached to this user.
-	// (blocking database request here :(, TODO see what I can do, cache?)
-	bankIds, err := getBankIdsForUserId(t.UserId)
-	if err != nil {
-		handleError(w, queryOperationError{})
-		return
+	// if only some category ids are wanted, filter
+	wantedCategoryIds, _ :=
+		queryStringPropertyToIntArray(queryString, qsp["CategoryIds"])
+	if len(wantedCategoryIds) > 0 {
+		f.CategoryIds.SetFilter(wantedCategoryIds)
 	}
 
-	accountIds, err := getAccountIdsForBankIds(bankIds)
-	if err != nil {
-		handleError(w, queryOperationError{})
-		return
+	// if a FromTransactionDate timestamp has been provided, filter
+	if wantedFromTDate, isDefined := queryStringPropertyToTime(queryString,
+		qsp["FromTransactionDate"]); isDefined {
+		f.FromTransactionDate.SetFilter(wantedFromTDate)
+	}
+
+	// if a ToTransactionDate timestamp has been provided, filter
+	if wantedToTDate, isDefined := queryStringPropertyToTime(queryString,
+		qsp["ToTransactionDate"]); isDefined {
+		f.ToTransactionDate.SetFilter(wantedToTDate)
+	}
+
+	// if a FromRecordDate timestamp has been provided, filter
+	if wantedFromRDate, isDefined := queryStringPropertyToTime(queryString,
+		qsp["FromRecordDate"]); isDefined {
+		f.FromRecordDate.SetFilter(wantedFromRDate)
+	}
+
+	// if a ToRecordDate timestamp has been provided, filter
+	if wantedToRDate, isDefined := queryStringPropertyToTime(queryString,
+		qsp["ToRecordDate"]); isDefined {
+		f.ToRecordDate.SetFilter(wantedToRDate)
+	}
+
+	if wantedMinDebit, isDefined := queryStringPropertyToFloat32(queryString,
+		qsp["MinDebit"]); isDefined {
+		f.MinDebit.SetFilter(wantedMinDebit)
+	}
+
+	if wantedMaxDebit, isDefined := queryStringPropertyToFloat32(queryString,
+		qsp["MaxDebit"]); isDefined {
+		f.MaxDebit.SetFilter(wantedMaxDebit)
+	}
+
+	if wantedMinCredit, isDefined := queryStringPropertyToFloat32(queryString,
+		qsp["MinCredit"]); isDefined {
+		f.MinCredit.SetFilter(wantedMinCredit)
+	}
+
+	if wantedMaxCredit, isDefined := queryStringPropertyToFloat32(queryString,
+		qsp["MaxCredit"]); isDefined {
+		f.MaxCredit.SetFilter(wantedMaxCredit)
+	}
+
+	// if only some transaction references are wanted, filter
+	if wantedTransactionReferences, isDefined :=
+		queryStringPropertyToStringArray(queryString,
+			qsp["References"]); isDefined {
+		f.References.SetFilter(wantedTransactionReferences)
+	}
+
+	// if only transactions mentioning some words are wanted, search
+	// them in their label, description and reference
+	if search := queryString.Get(qsp["Search"]); search != "" {
+		f.Search.SetFilter(search)
+	}
+
+	// if a filter expression is given, parse it
+	if filter := queryString.Get(qsp["Expression"]); filter != "" {
+		expr, err := parseFilterExpression(filter,
+			filterable_transaction_fields)
+		if err != nil {
+			return err
+		}
+		f.Expression.SetFilter(expr)
+	}
+
+	// if only transactions with some tags are wanted, filter
+	if wantedTagIds, isDefined := queryStringPropertyToIntArray(queryString,
+		qsp["Tags"]); isDefined {
+		var match = queryString.Get(tags_match_property)
+		if match != "" && match != "all" && match != "any" {
+			return invalidParameterError{tags_match_property,
+				"\"all\" or \"any\""}
+		}
+		f.Tags.SetFilter(database.DBTagMatch{
+			TagIds: wantedTagIds,
+			All:    match == "all",
+		})
 	}
+	return nil
+}
+
+// handleTransactionCreate handle POST requests on the /accounts API
+func handleTransactionCreate(w http.ResponseWriter, r *http.Request,
+	t *auth.UserToken) {
+
+	var db = getDatabase(r)
 
 	// convert body to map[string]interface{}
 	bodyMap, err := readBodyAsStringMap(r.Body)
@@ -236,63 +355,52 @@ func handleTransactionCreate(w http.ResponseWriter, r *http.Request,
 		return
 	}
 
-	// check if the user has the account he tries to add to
-	if !intInArray(transactionElem.AccountId, accountIds) {
+	// check if the user can add transactions to this account
+	ok, err := userCanAccessAccounts(db, t,
+		[]int{transactionElem.AccountId}, editorRole)
+	if err != nil {
+		handleError(w, queryOperationError{})
+		return
+	} else if !ok {
 		handleError(w, notPermittedOperationError{})
 		return
 	}
 
 	// perform database add request
-	transaction, err := database.GoDB.AddTransaction(transactionElem)
+	transaction, err := db.AddTransaction(transactionElem)
 	if err != nil {
 		handleError(w, queryOperationError{})
 		return
 	}
 
+	handleCreated(w, r, transaction.Id)
 	fmt.Fprintf(w, dbTransactionToJSONString(transaction))
 }
 
-// handleTransactionUpdate handle PUT requests on the /transactions API
+// handleTransactionUpdate handle PUT and PATCH requests on the
+// /transactions/{id} API. PUT replaces the whole transaction, PATCH only
+// modifies the properties present in its JSON merge patch body (see
+// transactionPatchToParams).
 func handleTransactionUpdate(w http.ResponseWriter, r *http.Request,
 	t *auth.UserToken) {
 
-	// look if we have an id (GET /transactions/35 => id == 35)
-	var id, hasId = getApiId(r.URL.Path)
+	var db = getDatabase(r)
 
-	// if an id was found, it means that we want to replace an element
-	// redirect to the right function
-	if !hasId {
-		handleTransactionReplace(w, r, t)
-		return
-	}
+	// id of the wanted element (PUT /transactions/35 => id == 35)
+	var id, _ = getApiId(r)
 
-	// recuperate every bank ids associated to this user
-	// (blocking database request here :(, TODO see what I can do, cache?)
-	bankIds, err := getBankIdsForUserId(t.UserId)
-	if err != nil {
-		handleError(w, queryOperationError{})
-		return
-	}
+	setAcceptPatchHeader(w)
 
-	// recuperate every account ids associated to this user
-	// (blocking database request here :(, TODO see what I can do, cache?)
-	accountIds, err := getAccountIdsForBankIds(bankIds)
-	if err != nil {
-		handleError(w, queryOperationError{})
+	// if the user cannot modify the wanted transaction, reject
+	if err := checkTransactionAccess(db, t, id, editorRole); err != nil {
+		handleError(w, err)
 		return
 	}
 
-	// recuperate every transaction ids associated to this user
-	// (blocking database request here :(, TODO see what I can do, cache?)
-	transactionIds, err := getTransactionIdsForAccountIds(accountIds)
+	// the If-Match header gives the versions which can be modified
+	versions, err := readIfMatchVersions(r)
 	if err != nil {
-		handleError(w, queryOperationError{})
-		return
-	}
-
-	// if the wanted transaction does not belong to the user, reject
-	if !intInArray(id, transactionIds) {
-		handleError(w, notPermittedOperationError{})
+		handleError(w, err)
 		return
 	}
 
@@ -303,43 +411,55 @@ func handleTransactionUpdate(w http.ResponseWriter, r *http.Request,
 		return
 	}
 
-	// -- check fields and update only the ones there --
-
-	// TODO
-
 	var fields []string
 	var transactionElem database.DBTransactionParams
 
-	if val, ok := bodyMap["label"]; ok {
-		if str, ok := val.(string); !ok {
-			handleError(w, bodyParsingError{})
-			return
-		} else {
-			transactionElem.Label = str
-			fields = append(fields, "Label")
-		}
+	if r.Method == "PATCH" {
+		transactionElem, fields, err = transactionPatchToParams(bodyMap)
+	} else {
+		transactionElem, err = stringMapInputToDBTransactionParams(bodyMap)
+		fields = updatable_transaction_fields
+	}
+	if err != nil {
+		handleError(w, err)
+		return
 	}
-	if val, ok := bodyMap["description"]; ok {
-		if str, ok := val.(string); !ok {
-			handleError(w, bodyParsingError{})
+
+	// if the transaction is moved, check that the user can add transactions
+	// to its new account
+	if stringInArray("AccountId", fields) {
+		ok, err := userCanAccessAccounts(db, t,
+			[]int{transactionElem.AccountId}, editorRole)
+		if err != nil {
+			handleError(w, queryOperationError{})
+			return
+		} else if !ok {
+			handleError(w, notPermittedOperationError{})
 			return
-		} else {
-			transactionElem.Description = str
-			fields = append(fields, "Description")
 		}
 	}
 
+	// an empty patch does not modify anything
+	if len(fields) == 0 {
+		handleSuccess(w, r)
+		return
+	}
+
 	// Filter the transaction id
 	var f database.DBTransactionFilters
 	f.Ids.SetFilter([]int{id})
+	if len(versions) > 0 {
+		f.Versions.SetFilter(versions)
+	}
 
 	// perform the database request
-	if err = database.GoDB.UpdateTransactions(f, fields,
+	if err = db.UpdateTransactions(f, fields,
 		transactionElem); err != nil {
-		handleError(w, queryOperationError{})
+		handleError(w, versionedWriteError(err))
 		return
 	}
 
+	setUpdatedETag(w, versions)
 	handleSuccess(w, r)
 }
 
@@ -347,84 +467,81 @@ func handleTransactionUpdate(w http.ResponseWriter, r *http.Request,
 func handleTransactionDelete(w http.ResponseWriter, r *http.Request,
 	t *auth.UserToken) {
 
+	var db = getDatabase(r)
+
 	// look if we have an id (GET /banks/35 => id == 35)
-	var id, hasId = getApiId(r.URL.Path)
+	var id, hasId = getApiId(r)
 
 	var f database.DBTransactionFilters
 
-	// recuperate every bank ids associated to this user
-	// (blocking database request here :(, TODO see what I can do, cache?)
-	bankIds, err := getBankIdsForUserId(t.UserId)
-	if err != nil {
-		handleError(w, queryOperationError{})
-		return
-	}
-
-	// recuperate every account ids associated to this user
-	// (blocking database request here :(, TODO see what I can do, cache?)
-	accountIds, err := getAccountIdsForBankIds(bankIds)
-	if err != nil {
-		handleError(w, queryOperationError{})
-		return
+	// removing a single transaction only needs the editor role on its
+	// account, removing them all needs the owner role
+	var minRole = ownerRole
+	if hasId {
+		minRole = editorRole
 	}
 
 	// if we have an id, check permission and set filter
 	if hasId {
-		// recuperate every transaction ids associated to this user
-		// (blocking database request here :(, TODO see what I can do, cache?)
-		transactionIds, err := getTransactionIdsForAccountIds(accountIds)
-		if err != nil {
-			handleError(w, queryOperationError{})
+		if err := checkTransactionAccess(db, t, id, minRole); err != nil {
+			handleError(w, err)
 			return
 		}
 
-		if !intInArray(id, transactionIds) {
-			handleError(w, notPermittedOperationError{})
+		// the If-Match header gives the versions which can be removed
+		versions, err := readIfMatchVersions(r)
+		if err != nil {
+			handleError(w, err)
 			return
 		}
 		f.Ids.SetFilter([]int{id})
+		if len(versions) > 0 {
+			f.Versions.SetFilter(versions)
+		}
 	} else {
-		// filter by accountId
-		f.AccountIds.SetFilter(accountIds)
+		// only remove the transactions of the accounts the user owns
+		setTransactionAccessFilters(&f, t, minRole)
 	}
 
-	// perform the database request
-	if err := database.GoDB.RemoveTransactions(f); err != nil {
+	// the files attached to the transactions are removed after them
+	hashes, err := db.GetTransactionAttachmentHashes(f)
+	if err != nil {
 		handleError(w, queryOperationError{})
 		return
 	}
+
+	// perform the database request
+	if err := db.RemoveTransactions(f); err != nil {
+		handleError(w, versionedWriteError(err))
+		return
+	}
+	removeUnusedAttachmentFiles(database.GoDB, hashes)
 	handleSuccess(w, r)
 }
 
 // handleTransactionReplace handle specifically PUT requests on the main /transactions
 // API.
 // (not restricted to a certain id).
+// As every transaction not given is removed, it has to be confirmed (see
+// checkReplaceConfirmation).
 func handleTransactionReplace(w http.ResponseWriter, r *http.Request,
 	t *auth.UserToken) {
 
-	var bodyMaps, err = readBodyAsArrayOfStringMap(r.Body)
-	if err != nil {
-		handleError(w, queryOperationError{})
-		return
-	}
+	var db = getDatabase(r)
 
-	// recuperate every transaction ids associated to this user
-	// (blocking database request here :(, TODO see what I can do, cache?)
-	bankIds, err := getBankIdsForUserId(t.UserId)
-	if err != nil {
-		handleError(w, queryOperationError{})
+	if err := checkReplaceConfirmation(r); err != nil {
+		handleError(w, err)
 		return
 	}
 
-	// recuperate every account ids associated to this user
-	// (blocking database request here :(, TODO see what I can do, cache?)
-	accountIds, err := getAccountIdsForBankIds(bankIds)
+	var bodyMaps, err = readBodyAsArrayOfStringMap(r.Body)
 	if err != nil {
 		handleError(w, queryOperationError{})
 		return
 	}
 
 	var accs []database.DBTransactionParams
+	var accountIds []int
 
 	// translate data into DBBankParams elements
 	// (also check mandatory fields)
@@ -434,31 +551,51 @@ func handleTransactionReplace(w http.ResponseWriter, r *http.Request,
 			handleError(w, err)
 			return
 		}
-
-		// check that the bankId indicated is attached to this user
-		if !intInArray(transElem.AccountId, accountIds) {
-			handleError(w, notPermittedOperationError{})
-			return
-		}
 		accs = append(accs, transElem)
+		accountIds = append(accountIds, transElem.AccountId)
 	}
 
-	// Remove old transactions linked to this user
-	var f database.DBTransactionFilters
-	f.AccountIds.SetFilter(accountIds)
-
-	if err := database.GoDB.RemoveTransactions(f); err != nil {
+	// check that the user fully owns every account indicated
+	ok, err := userCanAccessAccounts(db, t, accountIds, ownerRole)
+	if err != nil {
 		handleError(w, queryOperationError{})
 		return
+	} else if !ok {
+		handleError(w, notPermittedOperationError{})
+		return
 	}
 
-	// add each transaction indicated to the database
-	for _, acc := range accs {
-		if _, err := database.GoDB.AddTransaction(acc); err != nil {
-			handleError(w, queryOperationError{})
-			return
+	// replace the transactions in a single transaction, to never lose them
+	var hashes []string
+	err = db.WithTx(func(db database.GoBanksDataBase) error {
+		// Remove old transactions linked to this user
+		var f database.DBTransactionFilters
+		setTransactionAccessFilters(&f, t, ownerRole)
+
+		// the files attached to them are removed once committed
+		var err error
+		hashes, err = db.GetTransactionAttachmentHashes(f)
+		if err != nil {
+			return err
+		}
+
+		if err := db.RemoveTransactions(f); err != nil {
+			return err
+		}
+
+		// add each transaction indicated to the database
+		for _, acc := range accs {
+			if _, err := db.AddTransaction(acc); err != nil {
+				return err
+			}
 		}
+		return nil
+	})
+	if err != nil {
+		handleError(w, queryOperationError{})
+		return
 	}
+	removeUnusedAttachmentFiles(database.GoDB, hashes)
 	handleSuccess(w, r)
 }
 
@@ -475,26 +612,12 @@ func dbTransactionToJSONString(trn database.DBTransaction) string {
 	return string(resBytes)
 }
 
-// dbTransactionToJSONString generates a JSON string representing a collection
-// of DBTransaction structs provided for the API user. If the marshalling fails or
-// if the result is nil, an empty JSON array is returned ('[]')
-func dbTransactionsToJSONString(trn []database.DBTransaction) string {
-	var resJson []TransactionJSON
-	for _, t := range trn {
-		resJson = append(resJson, dbTransactionToTransactionJSON(t))
-	}
-	resBytes, err := json.Marshal(resJson)
-	if err != nil || resBytes == nil {
-		return "[]"
-	}
-	return string(resBytes)
-}
-
 // dbTransactionToTransactionJSON takes a DBTransaction and convert it to its
 // corresponding TransactionJSON struct.
 func dbTransactionToTransactionJSON(trn database.DBTransaction) TransactionJSON {
 	return TransactionJSON{
 		Id:              trn.Id,
+		Version:         trn.Version,
 		AccountId:       trn.AccountId,
 		Label:           trn.Label,
 		CategoryId:      trn.CategoryId,
@@ -527,56 +650,170 @@ func stringMapInputToDBTransactionParams(
 	field = "accountId"
 	accountIdStr, valid := input[field].(float64)
 	if stringInArray(field, mandatory_transaction_json_fields) && !valid {
-		return res, missingParameterError{field}
+		return res, missingParameterError{field, "number"}
 	}
 	res.AccountId = int(accountIdStr)
 
 	field = "label"
-	res.Description, valid = input[field].(string)
+	res.Label, valid = input[field].(string)
 	if stringInArray(field, mandatory_transaction_json_fields) && !valid {
-		return res, missingParameterError{field}
+		return res, missingParameterError{field, "string"}
 	}
 
 	field = "categoryId"
 	categoryIdStr, valid := input[field].(float64)
 	if stringInArray(field, mandatory_transaction_json_fields) && !valid {
-		return res, missingParameterError{field}
+		return res, missingParameterError{field, "number"}
 	}
 	res.CategoryId = int(categoryIdStr)
 
 	field = "description"
 	res.Description, valid = input[field].(string)
 	if stringInArray(field, mandatory_transaction_json_fields) && !valid {
-		return res, missingParameterError{field}
+		return res, missingParameterError{field, "string"}
 	}
 
 	field = "transactionDate"
 	tDateStr, valid := input[field].(float64)
 	if stringInArray(field, mandatory_transaction_json_fields) && !valid {
-		return res, missingParameterError{field}
+		return res, missingParameterError{field, "number"}
 	}
 	res.TransactionDate = int64TimeStampToTime(int64(tDateStr))
 
 	field = "recordDate"
 	rDateStr, valid := input[field].(float64)
 	if stringInArray(field, mandatory_transaction_json_fields) && !valid {
-		return res, missingParameterError{field}
+		return res, missingParameterError{field, "number"}
 	}
 	res.RecordDate = int64TimeStampToTime(int64(rDateStr))
 
 	field = "debit"
 	debitStr, valid := input[field].(float64)
 	if stringInArray(field, mandatory_transaction_json_fields) && !valid {
-		return res, missingParameterError{field}
+		return res, missingParameterError{field, "number"}
 	}
 	res.Debit = float32(debitStr)
 
 	field = "credit"
 	creditStr, valid := input[field].(float64)
 	if stringInArray(field, mandatory_transaction_json_fields) && !valid {
-		return res, missingParameterError{field}
+		return res, missingParameterError{field, "number"}
 	}
 	res.Credit = float32(creditStr)
 
+	field = "reference"
+	res.Reference, valid = input[field].(string)
+	if stringInArray(field, mandatory_transaction_json_fields) && !valid {
+		return res, missingParameterError{field, "string"}
+	}
+
 	return res, nil
 }
+
+// transactionPatchToParams reads the JSON merge patch (RFC 7396) given to
+// modify a transaction. It returns the new values and the properties to
+// update.
+func transactionPatchToParams(patch map[string]interface{}) (
+	database.DBTransactionParams, []string, error) {
+
+	var res database.DBTransactionParams
+	var fields []string
+	var present bool
+	var err error
+
+	var mandatory = func(field string) bool {
+		return stringInArray(field, mandatory_transaction_json_fields)
+	}
+
+	if res.AccountId, present, err = readPatchInt(patch, "accountId",
+		mandatory("accountId")); err != nil {
+		return res, nil, err
+	} else if present {
+		fields = append(fields, "AccountId")
+	}
+
+	if res.Label, present, err = readPatchString(patch, "label",
+		mandatory("label")); err != nil {
+		return res, nil, err
+	} else if present {
+		fields = append(fields, "Label")
+	}
+
+	if res.CategoryId, present, err = readPatchInt(patch, "categoryId",
+		mandatory("categoryId")); err != nil {
+		return res, nil, err
+	} else if present {
+		fields = append(fields, "CategoryId")
+	}
+
+	if res.Description, present, err = readPatchString(patch, "description",
+		mandatory("description")); err != nil {
+		return res, nil, err
+	} else if present {
+		fields = append(fields, "Description")
+	}
+
+	if res.TransactionDate, present, err = readPatchTime(patch,
+		"transactionDate", mandatory("transactionDate")); err != nil {
+		return res, nil, err
+	} else if present {
+		fields = append(fields, "TransactionDate")
+	}
+
+	if res.RecordDate, present, err = readPatchTime(patch, "recordDate",
+		mandatory("recordDate")); err != nil {
+		return res, nil, err
+	} else if present {
+		fields = append(fields, "RecordDate")
+	}
+
+	if res.Debit, present, err = readPatchFloat32(patch, "debit",
+		mandatory("debit")); err != nil {
+		return res, nil, err
+	} else if present {
+		fields = append(fields, "Debit")
+	}
+
+	if res.Credit, present, err = readPatchFloat32(patch, "credit",
+		mandatory("credit")); err != nil {
+		return res, nil, err
+	} else if present {
+		fields = append(fields, "Credit")
+	}
+
+	if res.Reference, present, err = readPatchString(patch, "reference",
+		mandatory("reference")); err != nil {
+		return res, nil, err
+	} else if present {
+		fields = append(fields, "Reference")
+	}
+
+	return res, fields, nil
+}
+
+// transactionSortValue returns the value of a sortable DBTransaction
+// property (see sortable_transaction_fields).
+func transactionSortValue(trn database.DBTransaction,
+	property string) interface{} {
+	switch property {
+	case "Id":
+		return trn.Id
+	case "AccountId":
+		return trn.AccountId
+	case "Label":
+		return trn.Label
+	case "CategoryId":
+		return trn.CategoryId
+	case "TransactionDate":
+		return trn.TransactionDate
+	case "RecordDate":
+		return trn.RecordDate
+	case "Debit":
+		return trn.Debit
+	case "Credit":
+		return trn.Credit
+	case "Reference":
+		return trn.Reference
+	}
+	return nil
+}
@@ -0,0 +1,323 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/peaberberian/GoBanks/auth"
+	"github.com/peaberberian/GoBanks/database"
+)
+
+// number of random bytes of a webhook secret
+const webhook_secret_length = 32
+
+// resources and actions of the events a webhook can receive, as
+// "<resource>.<action>"
+var webhook_event_resources = []string{"bank", "account", "category",
+	"transaction", "share"}
+var webhook_event_actions = []string{database.CreatedEventAction,
+	database.UpdatedEventAction, database.DeletedEventAction}
+
+// webhook properties sent by the /webhooks API
+var gettable_webhook_fields = []string{"Id", "Url", "EventTypes",
+	"AccountIds", "MinDebit", "MinCredit", "CreationDate"}
+
+// handleWebhookRead handle GET requests on the /webhooks API
+func handleWebhookRead(w http.ResponseWriter, r *http.Request,
+	t *auth.UserToken) {
+
+	var db = getDatabase(r)
+
+	var f database.DBWebhookFilters
+	f.UserId.SetFilter(t.UserId)
+	whs, err := db.GetWebhooks(f, gettable_webhook_fields, 0)
+	if err != nil {
+		handleError(w, queryOperationError{})
+		return
+	}
+
+	var resJson = []WebhookJSON{}
+	for _, wh := range whs {
+		resJson = append(resJson, dbWebhookToWebhookJSON(wh))
+	}
+	resBytes, err := json.Marshal(resJson)
+	if err != nil {
+		handleError(w, genericOperationError{})
+		return
+	}
+	w.Write(resBytes)
+}
+
+// handleWebhookCreate handle POST requests on the /webhooks API.
+// The secret signing the deliveries is only returned in this response.
+func handleWebhookCreate(w http.ResponseWriter, r *http.Request,
+	t *auth.UserToken) {
+
+	var db = getDatabase(r)
+
+	// convert body to map[string]interface{}
+	bodyMap, err := readBodyAsStringMap(r.Body)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	urlStr, valid := bodyMap["url"].(string)
+	if !valid {
+		handleError(w, missingParameterError{"url", "string"})
+		return
+	}
+	u, err := url.Parse(urlStr)
+	if err != nil || u.Host == "" ||
+		(u.Scheme != "http" && u.Scheme != "https") {
+		handleError(w, invalidParameterError{"url", "http(s) URL"})
+		return
+	}
+	if _, err := resolveWebhookHost(r.Context(), u.Hostname()); err != nil {
+		handleError(w, invalidParameterError{"url",
+			"http(s) URL of a public address"})
+		return
+	}
+
+	var eventTypes []string
+	eventTypesArr, _ := bodyMap["eventTypes"].([]interface{})
+	for _, val := range eventTypesArr {
+		eventType, ok := val.(string)
+		if !ok || !isWebhookEventType(eventType) {
+			handleError(w, invalidParameterError{"eventTypes",
+				"array of event types"})
+			return
+		}
+		eventTypes = append(eventTypes, eventType)
+	}
+
+	// only the events of accounts the user can see can be filtered
+	var accountIds []int
+	accountIdsArr, _ := bodyMap["accountIds"].([]interface{})
+	if len(accountIdsArr) > 0 {
+		userAccountIds, err := getAccountIdsForToken(db, t, viewerRole)
+		if err != nil {
+			handleError(w, queryOperationError{})
+			return
+		}
+		for _, val := range accountIdsArr {
+			accountId, ok := val.(float64)
+			if !ok {
+				handleError(w, invalidParameterError{"accountIds", "array of numbers"})
+				return
+			}
+			if !intInArray(int(accountId), userAccountIds) {
+				handleError(w, notPermittedOperationError{})
+				return
+			}
+			accountIds = append(accountIds, int(accountId))
+		}
+	}
+
+	var minDebit, minCredit float32
+	if val, ok := bodyMap["minDebit"]; ok {
+		fl64, ok := val.(float64)
+		if !ok || fl64 < 0 {
+			handleError(w, invalidParameterError{"minDebit", "positive number"})
+			return
+		}
+		minDebit = float32(fl64)
+	}
+	if val, ok := bodyMap["minCredit"]; ok {
+		fl64, ok := val.(float64)
+		if !ok || fl64 < 0 {
+			handleError(w, invalidParameterError{"minCredit", "positive number"})
+			return
+		}
+		minCredit = float32(fl64)
+	}
+
+	var secret = make([]byte, webhook_secret_length)
+	if _, err := io.ReadFull(rand.Reader, secret); err != nil {
+		handleError(w, genericOperationError{})
+		return
+	}
+
+	wh, err := db.AddWebhook(database.DBWebhookParams{
+		UserId:       t.UserId,
+		Url:          urlStr,
+		Secret:       hex.EncodeToString(secret),
+		EventTypes:   eventTypes,
+		AccountIds:   accountIds,
+		MinDebit:     minDebit,
+		MinCredit:    minCredit,
+		CreationDate: time.Now(),
+	})
+	if err != nil {
+		handleError(w, queryOperationError{})
+		return
+	}
+
+	var resJson = dbWebhookToWebhookJSON(wh)
+	resJson.Secret = wh.Secret
+	resBytes, err := json.Marshal(resJson)
+	if err != nil {
+		handleError(w, genericOperationError{})
+		return
+	}
+	handleCreated(w, r, wh.Id)
+	w.Write(resBytes)
+}
+
+// handleWebhookDelete handle DELETE requests on the /webhooks API. The
+// deliveries of the webhook are removed with it.
+func handleWebhookDelete(w http.ResponseWriter, r *http.Request,
+	t *auth.UserToken) {
+
+	var db = getDatabase(r)
+
+	// id of the wanted element (DELETE /webhooks/35 => id == 35)
+	var id, _ = getApiId(r)
+
+	wh, err := getWebhookForUser(db, t.UserId, id)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	err = db.WithTx(func(db database.GoBanksDataBase) error {
+		var df database.DBWebhookDeliveryFilters
+		df.WebhookIds.SetFilter([]int{wh.Id})
+		if err := db.RemoveWebhookDeliveries(df); err != nil {
+			return err
+		}
+
+		var f database.DBWebhookFilters
+		f.Ids.SetFilter([]int{wh.Id})
+		return db.RemoveWebhooks(f)
+	})
+	if err != nil {
+		handleError(w, queryOperationError{})
+		return
+	}
+	handleSuccess(w, r)
+}
+
+// handleWebhookDeliveryRead handle GET requests on the
+// /webhooks/{id}/deliveries API, returning the deliveries of a webhook, the
+// most recent first.
+func handleWebhookDeliveryRead(w http.ResponseWriter, r *http.Request,
+	t *auth.UserToken) {
+
+	var db = getDatabase(r)
+
+	var id, _ = getApiId(r)
+	wh, err := getWebhookForUser(db, t.UserId, id)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	// obtain limit of wanted records, if set
+	limit, _ := queryStringPropertyToInt(r.URL.Query(), "limit")
+
+	var f database.DBWebhookDeliveryFilters
+	f.WebhookIds.SetFilter([]int{wh.Id})
+	f.Sort.SetFilter([]database.DBSortField{{Field: "Id", Descending: true}})
+	dlvs, err := db.GetWebhookDeliveries(f, webhook_delivery_fields,
+		uint(limit))
+	if err != nil {
+		handleError(w, queryOperationError{})
+		return
+	}
+
+	var resJson = []WebhookDeliveryJSON{}
+	for _, dlv := range dlvs {
+		resJson = append(resJson, dbWebhookDeliveryToWebhookDeliveryJSON(dlv))
+	}
+	resBytes, err := json.Marshal(resJson)
+	if err != nil {
+		handleError(w, genericOperationError{})
+		return
+	}
+	w.Write(resBytes)
+}
+
+// getWebhookForUser returns the webhook with the given id, if it belongs to
+// the given user. Returns a notFoundError else.
+func getWebhookForUser(db database.GoBanksDataBase, userId int,
+	id int) (database.DBWebhook, error) {
+
+	var f database.DBWebhookFilters
+	f.Ids.SetFilter([]int{id})
+	f.UserId.SetFilter(userId)
+	whs, err := db.GetWebhooks(f, gettable_webhook_fields, 1)
+	if err != nil {
+		return database.DBWebhook{}, queryOperationError{}
+	}
+	if len(whs) == 0 {
+		return database.DBWebhook{}, notFoundError{}
+	}
+	return whs[0], nil
+}
+
+// isWebhookEventType returns true if webhooks can receive events of the
+// given type.
+func isWebhookEventType(eventType string) bool {
+	if eventType == alert_fired_event_type {
+		return true
+	}
+	for _, resource := range webhook_event_resources {
+		for _, action := range webhook_event_actions {
+			if eventType == resource+"."+action {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// dbWebhookToWebhookJSON takes a DBWebhook and convert it to its
+// corresponding WebhookJSON response, without its secret.
+func dbWebhookToWebhookJSON(wh database.DBWebhook) WebhookJSON {
+	var res = WebhookJSON{
+		Id:           wh.Id,
+		Url:          wh.Url,
+		EventTypes:   wh.EventTypes,
+		AccountIds:   wh.AccountIds,
+		MinDebit:     wh.MinDebit,
+		MinCredit:    wh.MinCredit,
+		CreationDate: wh.CreationDate.UnixNano() / 1e6,
+	}
+	if res.EventTypes == nil {
+		res.EventTypes = []string{}
+	}
+	if res.AccountIds == nil {
+		res.AccountIds = []int{}
+	}
+	return res
+}
+
+// dbWebhookDeliveryToWebhookDeliveryJSON takes a DBWebhookDelivery and
+// convert it to its corresponding WebhookDeliveryJSON response.
+func dbWebhookDeliveryToWebhookDeliveryJSON(
+	dlv database.DBWebhookDelivery,
+) WebhookDeliveryJSON {
+	var res = WebhookDeliveryJSON{
+		Id:           dlv.Id,
+		EventId:      dlv.EventId,
+		EventType:    dlv.EventType,
+		Status:       dlv.Status,
+		Attempts:     dlv.Attempts,
+		StatusCode:   dlv.StatusCode,
+		Error:        dlv.Error,
+		CreationDate: dlv.CreationDate.UnixNano() / 1e6,
+	}
+	if dlv.Status == pendingDeliveryStatus {
+		res.NextAttemptDate = dlv.NextAttemptDate.UnixNano() / 1e6
+	}
+	if !dlv.LastAttemptDate.IsZero() {
+		res.LastAttemptDate = dlv.LastAttemptDate.UnixNano() / 1e6
+	}
+	return res
+}
@@ -0,0 +1,116 @@
+package api
+
+import (
+	"net/http"
+	"time"
+)
+
+// Media type of JSON merge patches (RFC 7396), accepted by PATCH requests
+// (application/json is also accepted).
+const merge_patch_media_type = "application/merge-patch+json"
+
+// The readPatch* functions read a property of a JSON merge patch
+// (RFC 7396), given as the body of a PATCH request:
+//   - if the property is absent, present is false and the resource should
+//     not be modified
+//   - if the property is null, the zero value of its type is returned, or
+//     an invalidParameterError if it is mandatory (it cannot be removed)
+//   - if the property does not have the expected type, an
+//     invalidParameterError is returned
+
+// readPatchProperty returns the raw value of a property of a JSON merge
+// patch. A nil value means that the property should be removed.
+func readPatchProperty(patch map[string]interface{}, property string,
+	mandatory bool, expectedType string) (interface{}, bool, error) {
+
+	val, present := patch[property]
+	if !present {
+		return nil, false, nil
+	}
+	if val == nil && mandatory {
+		return nil, true, invalidParameterError{property, expectedType}
+	}
+	return val, true, nil
+}
+
+// readPatchString reads a string property of a JSON merge patch.
+func readPatchString(patch map[string]interface{}, property string,
+	mandatory bool) (string, bool, error) {
+
+	val, present, err := readPatchProperty(patch, property, mandatory,
+		"string")
+	if !present || err != nil || val == nil {
+		return "", present, err
+	}
+	str, ok := val.(string)
+	if !ok {
+		return "", true, invalidParameterError{property, "string"}
+	}
+	return str, true, nil
+}
+
+// readPatchInt reads an integer property of a JSON merge patch.
+func readPatchInt(patch map[string]interface{}, property string,
+	mandatory bool) (int, bool, error) {
+
+	val, present, err := readPatchProperty(patch, property, mandatory,
+		"number")
+	if !present || err != nil || val == nil {
+		return 0, present, err
+	}
+	// JSON numbers are always decoded as float64
+	num, ok := val.(float64)
+	if !ok || num != float64(int(num)) {
+		return 0, true, invalidParameterError{property, "number"}
+	}
+	return int(num), true, nil
+}
+
+// readPatchFloat32 reads a decimal number property of a JSON merge patch.
+func readPatchFloat32(patch map[string]interface{}, property string,
+	mandatory bool) (float32, bool, error) {
+
+	val, present, err := readPatchProperty(patch, property, mandatory,
+		"number")
+	if !present || err != nil || val == nil {
+		return 0, present, err
+	}
+	num, ok := val.(float64)
+	if !ok {
+		return 0, true, invalidParameterError{property, "number"}
+	}
+	return float32(num), true, nil
+}
+
+// readPatchTime reads a date property of a JSON merge patch, given as a ms
+// timestamp. A null date is the timestamp 0.
+func readPatchTime(patch map[string]interface{}, property string,
+	mandatory bool) (time.Time, bool, error) {
+
+	val, present, err := readPatchProperty(patch, property, mandatory,
+		"number")
+	if !present || err != nil || val == nil {
+		return int64TimeStampToTime(0), present, err
+	}
+	ts, ok := val.(float64)
+	if !ok {
+		return time.Time{}, true, invalidParameterError{property, "number"}
+	}
+	return int64TimeStampToTime(int64(ts)), true, nil
+}
+
+// setAcceptPatchHeader advertises the media type accepted by PATCH
+// requests on the current route.
+func setAcceptPatchHeader(w http.ResponseWriter) {
+	w.Header().Set("Accept-Patch", merge_patch_media_type)
+}
+
+// checkReplaceConfirmation returns an error if a request replacing a whole
+// collection was not explicitly confirmed with the "confirm=true" query
+// string property, as it removes every element not given.
+func checkReplaceConfirmation(r *http.Request) error {
+	if r.URL.Query().Get("confirm") != "true" {
+		return missingParameterError{"confirm", "true"}
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/smtp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/peaberberian/GoBanks/database"
+)
+
+// Notifier sends the alerts fired by the alert rules to their user.
+type Notifier interface {
+	// Notify tells the user of the given rule about the given alert.
+	Notify(database.DBAlertRule, database.DBAlert) error
+}
+
+// notifiers usable by the alert rules, by name
+var alert_notifiers = map[string]Notifier{}
+
+// RegisterNotifier makes the given notifier usable by the alert rules under
+// the given name. Notifiers should all be registered before StartAlerts is
+// called.
+func RegisterNotifier(name string, n Notifier) {
+	alert_notifiers[name] = n
+}
+
+// getNotifierNames returns the names of the registered notifiers, sorted.
+func getNotifierNames() []string {
+	var names []string
+	for name := range alert_notifiers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// logNotifier writes the alerts in the server's logs.
+type logNotifier struct{}
+
+// NewLogNotifier returns a Notifier writing the alerts in the server's logs.
+func NewLogNotifier() Notifier {
+	return logNotifier{}
+}
+
+func (logNotifier) Notify(rl database.DBAlertRule, alt database.DBAlert) error {
+	log.Printf("Alert %d for user %d (rule %d): %s\n", alt.Id, alt.UserId,
+		rl.Id, alt.Message)
+	return nil
+}
+
+// SmtpConfig is the configuration of the e-mails sent by the Notifier
+// returned by NewSmtpNotifier.
+type SmtpConfig struct {
+	Address string // "host:port" of the SMTP server
+	From    string // sender of the e-mails
+}
+
+// smtpNotifier sends the alerts by e-mail to the address of their rule.
+type smtpNotifier struct {
+	conf SmtpConfig
+}
+
+// NewSmtpNotifier returns a Notifier sending the alerts by e-mail, through
+// the given SMTP server, to the Email of their rule. Rules without an Email
+// are ignored.
+func NewSmtpNotifier(conf SmtpConfig) Notifier {
+	return smtpNotifier{conf: conf}
+}
+
+func (sn smtpNotifier) Notify(rl database.DBAlertRule,
+	alt database.DBAlert) error {
+
+	if rl.Email == "" {
+		return nil
+	}
+
+	// the message comes from user data, which should not add headers
+	var subject = strings.NewReplacer("\r", " ", "\n", " ").Replace(
+		"GoBanks alert: " + alt.Message)
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", sn.conf.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", rl.Email)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", subject)
+	fmt.Fprintf(&msg, "Date: %s\r\n", alt.CreationDate.Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	fmt.Fprintf(&msg, "%s\r\n", alt.Message)
+
+	return smtp.SendMail(sn.conf.Address, nil, sn.conf.From,
+		[]string{rl.Email}, msg.Bytes())
+}
+
+// eventNotifier publishes the alerts as "alert.fired" events, sent to the
+// /events API and to the webhooks of their user.
+type eventNotifier struct {
+	bus *database.EventBus
+}
+
+// NewWebhookNotifier returns a Notifier publishing the alerts on the given
+// bus as "alert.fired" events, delivered to the webhooks of their user (see
+// StartWebhooks).
+func NewWebhookNotifier(bus *database.EventBus) Notifier {
+	return eventNotifier{bus: bus}
+}
+
+func (en eventNotifier) Notify(rl database.DBAlertRule,
+	alt database.DBAlert) error {
+
+	en.bus.Publish(database.Event{
+		Type:       alert_fired_event_type,
+		ResourceId: alt.Id,
+		UserIds:    []int{alt.UserId},
+		Data:       alt,
+		Date:       alt.CreationDate,
+	})
+	return nil
+}
@@ -0,0 +1,185 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/peaberberian/GoBanks/database"
+)
+
+// sortableField describes a field which can be used in the "sort" query
+// string property of a list API.
+type sortableField struct {
+	// name of the property in the database struct (e.g. "TransactionDate")
+	property string
+
+	// true for dates, which are given as ms timestamps in cursors
+	isTime bool
+}
+
+// pagination holds the order and position wanted by the client on a list
+// API, read from the following query string properties:
+//   - sort: comma-separated list of fields, prefixed by "-" for a
+//     descending order (e.g. sort=transactionDate,-debit)
+//   - cursor: opaque cursor given in the "next" link of a previous response
+type pagination struct {
+	sortParam string
+	sort      []database.DBSortField
+	cursor    database.DBCursor
+	hasCursor bool
+}
+
+// Content of a cursor, before being encoded
+type cursorJSON struct {
+	Sort   string        `json:"s"`
+	Values []interface{} `json:"v"`
+	Id     int           `json:"i"`
+}
+
+// readPagination reads the sort and cursor query string properties.
+// Returns an invalidParameterError if a field cannot be sorted on or if the
+// cursor is not valid for this sort.
+func readPagination(qs url.Values,
+	sortable map[string]sortableField) (pagination, error) {
+
+	var pg = pagination{sortParam: qs.Get("sort")}
+
+	if fields, isDefined := queryStringPropertyToStringArray(qs,
+		"sort"); isDefined {
+		for _, field := range fields {
+			var desc = strings.HasPrefix(field, "-")
+			sf, ok := sortable[strings.TrimPrefix(field, "-")]
+			if !ok {
+				return pg, invalidParameterError{"sort",
+					"comma-separated list of " +
+						strings.Join(sortableFieldNames(sortable), ", ")}
+			}
+			pg.sort = append(pg.sort, database.DBSortField{
+				Field:      sf.property,
+				Descending: desc,
+			})
+		}
+	}
+
+	if cursorStr := qs.Get("cursor"); cursorStr != "" {
+		cursor, err := decodeCursor(cursorStr, pg, sortable)
+		if err != nil {
+			return pg, err
+		}
+		pg.cursor = cursor
+		pg.hasCursor = true
+	}
+	return pg, nil
+}
+
+// setFilters sets the sort and cursor filters of a database request.
+func (pg pagination) setFilters(sort *database.DBSortFilter,
+	after *database.DBCursorFilter) {
+	if len(pg.sort) > 0 {
+		sort.SetFilter(pg.sort)
+	}
+	if pg.hasCursor {
+		after.SetFilter(pg.cursor)
+	}
+}
+
+// setHeaders sets the pagination headers of a list response:
+//   - X-Total-Count: the number of results, all pages combined
+//   - Link: the URL of the next page, if the limit was reached
+// lastValue returns the value of a property (e.g. "Id") for the last
+// element received. It is only called if there are more results.
+func (pg pagination) setHeaders(w http.ResponseWriter, r *http.Request,
+	total int, count int, limit int, lastValue func(string) interface{}) {
+
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+
+	if limit <= 0 || count < limit {
+		return
+	}
+
+	var values []interface{}
+	for _, sf := range pg.sort {
+		switch val := lastValue(sf.Field).(type) {
+		case time.Time:
+			values = append(values, val.UnixNano()/1e6)
+		case float32:
+			values = append(values, float64(val))
+		default:
+			values = append(values, val)
+		}
+	}
+
+	var next = *r.URL
+	var qs = next.Query()
+	var lastId, _ = lastValue("Id").(int)
+	qs.Set("cursor", encodeCursor(cursorJSON{pg.sortParam, values, lastId}))
+	next.RawQuery = qs.Encode()
+	w.Header().Set("Link", "<"+next.RequestURI()+">; rel=\"next\"")
+}
+
+// encodeCursor converts a cursor into an opaque string usable in an URL.
+func encodeCursor(c cursorJSON) string {
+	cursorBytes, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(cursorBytes)
+}
+
+// decodeCursor converts a string generated by encodeCursor into a
+// database cursor. The cursor has to be generated for the same sort.
+func decodeCursor(str string, pg pagination,
+	sortable map[string]sortableField) (database.DBCursor, error) {
+
+	var invalidErr = invalidParameterError{"cursor",
+		"cursor from a \"next\" link, with the same sort"}
+
+	cursorBytes, err := base64.RawURLEncoding.DecodeString(str)
+	if err != nil {
+		return database.DBCursor{}, invalidErr
+	}
+
+	var c cursorJSON
+	if err = json.Unmarshal(cursorBytes, &c); err != nil ||
+		c.Sort != pg.sortParam || len(c.Values) != len(pg.sort) {
+		return database.DBCursor{}, invalidErr
+	}
+
+	var values []interface{}
+	for i, sf := range pg.sort {
+		var val = c.Values[i]
+		if isTimeProperty(sf.Field, sortable) {
+			ts, ok := val.(float64)
+			if !ok {
+				return database.DBCursor{}, invalidErr
+			}
+			val = int64TimeStampToTime(int64(ts))
+		}
+		values = append(values, val)
+	}
+	return database.DBCursor{Values: values, Id: c.Id}, nil
+}
+
+// isTimeProperty returns true if the given database property is a date.
+func isTimeProperty(property string, sortable map[string]sortableField) bool {
+	for _, sf := range sortable {
+		if sf.property == property {
+			return sf.isTime
+		}
+	}
+	return false
+}
+
+// sortableFieldNames returns the names usable in the sort query string
+// property.
+func sortableFieldNames(sortable map[string]sortableField) []string {
+	var names []string
+	for name := range sortable {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
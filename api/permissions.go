@@ -0,0 +1,251 @@
+package api
+
+import (
+	"github.com/peaberberian/GoBanks/auth"
+	"github.com/peaberberian/GoBanks/database"
+)
+
+// Roles an user can be given on a bank or an account shared with him, from
+// the least to the most privileged:
+//   - viewer: can read the bank/account and its content
+//   - editor: can also modify them and their content
+//   - owner: can also delete them and share them with other users
+// An user always has the owner role on the banks he created.
+const (
+	viewerRole = "viewer"
+	editorRole = "editor"
+	ownerRole  = "owner"
+)
+
+// every role, from the least to the most privileged
+var share_roles = []string{viewerRole, editorRole, ownerRole}
+
+// rolesFrom returns every role at least as privileged as the one given.
+// rolesFrom("editor") => []string{"editor", "owner"}
+func rolesFrom(minRole string) []string {
+	for i, role := range share_roles {
+		if role == minRole {
+			return share_roles[i:]
+		}
+	}
+	return []string{}
+}
+
+// getBankIdsForUser returns the ids of every bank the given user owns or
+// which have been shared with him with at least the given role.
+func getBankIdsForUser(db database.GoBanksDataBase, userId int,
+	minRole string) ([]int, error) {
+
+	bankIds, err := getBankIdsForUserId(db, userId)
+	if err != nil {
+		return []int{}, err
+	}
+
+	var f database.DBShareFilters
+	f.UserId.SetFilter(userId)
+	f.Roles.SetFilter(rolesFrom(minRole))
+	shrs, err := db.GetShares(f, []string{"BankId"}, 0)
+	if err != nil {
+		return []int{}, err
+	}
+
+	for _, shr := range shrs {
+		if shr.BankId != 0 && !intInArray(shr.BankId, bankIds) {
+			bankIds = append(bankIds, shr.BankId)
+		}
+	}
+	return bankIds, nil
+}
+
+// getAccountIdsForUser returns the ids of every account the given user can
+// access with at least the given role, either because the whole bank was
+// shared (or owned), or because the account itself was shared.
+func getAccountIdsForUser(db database.GoBanksDataBase, userId int,
+	minRole string) ([]int, error) {
+
+	bankIds, err := getBankIdsForUser(db, userId, minRole)
+	if err != nil {
+		return []int{}, err
+	}
+
+	accountIds, err := getAccountIdsForBankIds(db, bankIds)
+	if err != nil {
+		return []int{}, err
+	}
+
+	var f database.DBShareFilters
+	f.UserId.SetFilter(userId)
+	f.Roles.SetFilter(rolesFrom(minRole))
+	shrs, err := db.GetShares(f, []string{"AccountId"}, 0)
+	if err != nil {
+		return []int{}, err
+	}
+
+	for _, shr := range shrs {
+		if shr.AccountId != 0 && !intInArray(shr.AccountId, accountIds) {
+			accountIds = append(accountIds, shr.AccountId)
+		}
+	}
+	return accountIds, nil
+}
+
+// getBankIdsForToken returns the same bank ids than getBankIdsForUser for
+// the token's user, except when the token is restricted to some accounts.
+// Only the banks of those accounts are then returned.
+func getBankIdsForToken(db database.GoBanksDataBase, t *auth.UserToken,
+	minRole string) ([]int, error) {
+
+	bankIds, err := getBankIdsForUser(db, t.UserId, minRole)
+	if err != nil || !t.IsRestricted() {
+		return bankIds, err
+	}
+
+	var f database.DBAccountFilters
+	f.Ids.SetFilter(t.AccountIds)
+	f.BankIds.SetFilter(bankIds)
+	accs, err := db.GetAccounts(f, []string{"BankId"}, 0)
+	if err != nil {
+		return []int{}, err
+	}
+
+	var res = []int{}
+	for _, acc := range accs {
+		if !intInArray(acc.BankId, res) {
+			res = append(res, acc.BankId)
+		}
+	}
+	return res, nil
+}
+
+// getAccountIdsForToken returns the same account ids than
+// getAccountIdsForUser for the token's user, restricted to the accounts the
+// token is limited to, if any.
+func getAccountIdsForToken(db database.GoBanksDataBase, t *auth.UserToken,
+	minRole string) ([]int, error) {
+
+	accountIds, err := getAccountIdsForUser(db, t.UserId, minRole)
+	if err != nil || !t.IsRestricted() {
+		return accountIds, err
+	}
+	return intersectInts(accountIds, t.AccountIds), nil
+}
+
+// setTransactionAccessFilters only keeps the transactions of the accounts
+// the user of the given token can access with at least the given role (the
+// ones returned by getAccountIdsForToken), without loading those first.
+func setTransactionAccessFilters(f *database.DBTransactionFilters,
+	t *auth.UserToken, minRole string) {
+
+	f.UserId.SetFilter(t.UserId)
+	f.Roles.SetFilter(rolesFrom(minRole))
+	if t.IsRestricted() {
+		f.AccountIds.SetFilter(t.AccountIds)
+	}
+}
+
+// userCanAccessAccounts checks, in a single database query, if the user of
+// the given token can access every account given with at least the given
+// role.
+func userCanAccessAccounts(db database.GoBanksDataBase, t *auth.UserToken,
+	accountIds []int, minRole string) (bool, error) {
+
+	var ids []int
+	for _, id := range accountIds {
+		if !intInArray(id, ids) {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return true, nil
+	}
+	if t.IsRestricted() && len(intersectInts(ids, t.AccountIds)) != len(ids) {
+		return false, nil
+	}
+
+	var f database.DBAccountFilters
+	f.Ids.SetFilter(ids)
+	f.UserId.SetFilter(t.UserId)
+	f.Roles.SetFilter(rolesFrom(minRole))
+	count, err := db.CountAccounts(f)
+	if err != nil {
+		return false, err
+	}
+	return count == len(ids), nil
+}
+
+// userCanAccessTransaction checks, in a single database query, if the user
+// of the given token can access the given transaction with at least the
+// given role.
+func userCanAccessTransaction(db database.GoBanksDataBase, t *auth.UserToken,
+	transactionId int, minRole string) (bool, error) {
+
+	var f database.DBTransactionFilters
+	f.Ids.SetFilter([]int{transactionId})
+	setTransactionAccessFilters(&f, t, minRole)
+	count, err := db.CountTransactions(f)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// checkTransactionAccess returns a notFoundError if the user of the given
+// token cannot see the given transaction, and a notPermittedOperationError
+// if he can but without the given role.
+func checkTransactionAccess(db database.GoBanksDataBase, t *auth.UserToken,
+	transactionId int, minRole string) OperationError {
+
+	ok, err := userCanAccessTransaction(db, t, transactionId, viewerRole)
+	if err != nil {
+		return queryOperationError{}
+	} else if !ok {
+		return notFoundError{}
+	}
+	if minRole == viewerRole {
+		return nil
+	}
+
+	ok, err = userCanAccessTransaction(db, t, transactionId, minRole)
+	if err != nil {
+		return queryOperationError{}
+	} else if !ok {
+		return notPermittedOperationError{}
+	}
+	return nil
+}
+
+// userCanAccessTransactions checks, in a single database query, if the user
+// of the given token can access every transaction given with at least the
+// given role.
+func userCanAccessTransactions(db database.GoBanksDataBase,
+	t *auth.UserToken, transactionIds []int, minRole string) (bool, error) {
+
+	var ids []int
+	for _, id := range transactionIds {
+		if !intInArray(id, ids) {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return true, nil
+	}
+
+	var f database.DBTransactionFilters
+	f.Ids.SetFilter(ids)
+	setTransactionAccessFilters(&f, t, minRole)
+	count, err := db.CountTransactions(f)
+	if err != nil {
+		return false, err
+	}
+	return count == len(ids), nil
+}
+
+// checkUnrestrictedToken returns an error if the given token is restricted
+// to some accounts. Used for operations which are not limited to specific
+// accounts (e.g. creating a bank, removing every accounts...).
+func checkUnrestrictedToken(t *auth.UserToken) OperationError {
+	if t.IsRestricted() {
+		return notPermittedOperationError{}
+	}
+	return nil
+}
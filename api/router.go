@@ -0,0 +1,229 @@
+package api
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/peaberberian/GoBanks/auth"
+	"github.com/peaberberian/GoBanks/database"
+)
+
+// routeHandler is the signature of every API handler. The token is the one
+// of the current user, filled by the withAuthentication middleware.
+type routeHandler func(http.ResponseWriter, *http.Request, *auth.UserToken)
+
+// middleware wraps a routeHandler to perform some work before (or instead
+// of) calling it.
+type middleware func(routeHandler) routeHandler
+
+// route is a path pattern with a handler for each supported HTTP method.
+type route struct {
+	// segments of the pattern. Parameters are written between braces:
+	//   - {name} matches any segment
+	//   - {name:int} only matches an integer
+	segments []string
+	handlers map[string]routeHandler
+}
+
+// router dispatches requests to the route matching their path and method.
+// Requests for unknown paths get a 404, requests for known paths but with
+// an unsupported method get a 405 with an Allow header.
+type router struct {
+	// prefix removed from every path before matching (e.g. "/v1")
+	prefix string
+
+	routes *[]*route
+
+	// middlewares applied to every handler added through this router
+	middlewares []middleware
+}
+
+type pathParamsKey struct{}
+type databaseKey struct{}
+
+// newRouter creates a router for paths beginning by the given prefix.
+func newRouter(prefix string) *router {
+	return &router{prefix: strings.TrimSuffix(prefix, "/"),
+		routes: &[]*route{}}
+}
+
+// with returns a router adding routes to the same table, but with the given
+// middlewares applied (after the ones of the current router).
+func (rt *router) with(mws ...middleware) *router {
+	var chained []middleware
+	chained = append(chained, rt.middlewares...)
+	chained = append(chained, mws...)
+	return &router{prefix: rt.prefix, routes: rt.routes, middlewares: chained}
+}
+
+// handle registers a handler for the given method and path pattern.
+// Panics if a handler was already registered for both.
+func (rt *router) handle(method string, pattern string, h routeHandler) {
+	for i := len(rt.middlewares) - 1; i >= 0; i-- {
+		h = rt.middlewares[i](h)
+	}
+
+	var segments = splitPath(pattern)
+	for _, rte := range *rt.routes {
+		if strings.Join(rte.segments, "/") == strings.Join(segments, "/") {
+			if _, ok := rte.handlers[method]; ok {
+				panic("route registered twice: " + method + " " + pattern)
+			}
+			rte.handlers[method] = h
+			return
+		}
+	}
+	*rt.routes = append(*rt.routes, &route{
+		segments: segments,
+		handlers: map[string]routeHandler{method: h},
+	})
+}
+
+// ServeHTTP implements http.Handler.
+func (rt *router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json")
+
+	var path = strings.TrimPrefix(r.URL.Path, rt.prefix)
+	var segments = splitPath(path)
+	log.Println("Request received:", r.Method, path)
+
+	for _, rte := range *rt.routes {
+		params, ok := rte.match(segments)
+		if !ok {
+			continue
+		}
+
+		h, ok := rte.handlers[r.Method]
+		if !ok {
+			w.Header().Set("Allow", strings.Join(rte.methods(), ", "))
+			handleNotSupportedMethod(w, r.Method)
+			return
+		}
+
+		var ctx = context.WithValue(r.Context(), pathParamsKey{}, params)
+		var token auth.UserToken
+		h(w, r.WithContext(ctx), &token)
+		return
+	}
+	handleError(w, notFoundError{})
+}
+
+// match checks if the given path segments match this route. If they do,
+// the path parameters are also returned.
+func (rte *route) match(segments []string) (map[string]string, bool) {
+	if len(segments) != len(rte.segments) {
+		return nil, false
+	}
+
+	var params = map[string]string{}
+	for i, seg := range rte.segments {
+		if !strings.HasPrefix(seg, "{") || !strings.HasSuffix(seg, "}") {
+			if seg != segments[i] {
+				return nil, false
+			}
+			continue
+		}
+
+		var name = seg[1 : len(seg)-1]
+		if strings.HasSuffix(name, ":int") {
+			name = strings.TrimSuffix(name, ":int")
+			if _, err := strconv.Atoi(segments[i]); err != nil {
+				return nil, false
+			}
+		}
+		params[name] = segments[i]
+	}
+	return params, true
+}
+
+// methods returns the sorted list of HTTP methods supported by this route.
+func (rte *route) methods() []string {
+	var methods []string
+	for method := range rte.handlers {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+	return methods
+}
+
+// splitPath splits an URL path into its non-empty segments.
+// example: splitPath("/accounts/3/") => []string{"accounts", "3"}
+func splitPath(path string) []string {
+	var segments = []string{}
+	for _, seg := range strings.Split(path, "/") {
+		if seg != "" {
+			segments = append(segments, seg)
+		}
+	}
+	return segments
+}
+
+// getPathParam returns the value of a parameter of the matched route's
+// pattern. The returned boolean is false if there is no such parameter.
+func getPathParam(r *http.Request, name string) (string, bool) {
+	params, _ := r.Context().Value(pathParamsKey{}).(map[string]string)
+	val, ok := params[name]
+	return val, ok
+}
+
+// getDatabase returns the database handlers should use for the request:
+// the one of the transaction the request is part of (see newBatchHandler)
+// or
+// database.GoDB.
+func getDatabase(r *http.Request) database.GoBanksDataBase {
+	var db, ok = r.Context().Value(databaseKey{}).(database.GoBanksDataBase)
+	if ok {
+		return db
+	}
+	return database.GoDB
+}
+
+// withAuthentication is the middleware rejecting requests without a valid
+// token. The token is then given to the next handlers, which also use a
+// database caching results for its user (see database.CachedForUser).
+func withAuthentication(next routeHandler) routeHandler {
+	return func(w http.ResponseWriter, r *http.Request, t *auth.UserToken) {
+		token, err := auth.ParseToken(getTokenFromRequest(r))
+		if err != nil {
+			handleError(w, err)
+			return
+		}
+		*t = token
+
+		var db = database.CachedForUser(getDatabase(r), token.UserId)
+		next(w, r.WithContext(context.WithValue(r.Context(), databaseKey{},
+			db)), t)
+	}
+}
+
+// withScope returns a middleware limiting personal access tokens to the
+// given resource (see checkTokenScope). An empty resource means that the
+// route cannot be accessed with a personal access token.
+func withScope(resource string) middleware {
+	return func(next routeHandler) routeHandler {
+		return func(w http.ResponseWriter, r *http.Request,
+			t *auth.UserToken) {
+			if err := checkTokenScope(t, resource, r.Method); err != nil {
+				handleError(w, err)
+				return
+			}
+			next(w, r, t)
+		}
+	}
+}
+
+// withUnrestrictedToken is the middleware rejecting personal access tokens
+// restricted to some accounts (see checkUnrestrictedToken).
+func withUnrestrictedToken(next routeHandler) routeHandler {
+	return func(w http.ResponseWriter, r *http.Request, t *auth.UserToken) {
+		if err := checkUnrestrictedToken(t); err != nil {
+			handleError(w, err)
+			return
+		}
+		next(w, r, t)
+	}
+}
@@ -12,7 +12,7 @@ func Start(port int, certPath string, keyPath string) {
 
 	var displayedVersion = "/v" + strconv.Itoa(apiVersion) + "/"
 	mux := http.NewServeMux()
-	mux.Handle(displayedVersion, http.HandlerFunc(handlerV1))
+	mux.Handle(displayedVersion, newV1Router(displayedVersion))
 
 	// Start listing on a given port with these routes on this server.
 	log.Print("Listening on port " + portStr + " ... ")
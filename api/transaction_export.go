@@ -0,0 +1,176 @@
+package api
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/peaberberian/GoBanks/auth"
+	"github.com/peaberberian/GoBanks/database"
+)
+
+// columns of an exported transaction for each of the
+// gettable_transaction_fields. Fields without columns are not exported.
+var transaction_export_columns = map[string][]string{
+	"Id":              {"id"},
+	"AccountId":       {"bank", "account"},
+	"Label":           {"label"},
+	"CategoryId":      {"category"},
+	"Description":     {"description"},
+	"TransactionDate": {"transactionDate"},
+	"RecordDate":      {"recordDate"},
+	"Debit":           {"debit"},
+	"Credit":          {"credit"},
+	"Reference":       {"reference"},
+}
+
+// transactionExport writes the transactions of a response as a spreadsheet
+// (see getExportFormat), with the names of their bank, account and category
+// instead of their ids.
+type transactionExport struct {
+	w     http.ResponseWriter
+	table tableWriter
+
+	// names of the accounts, banks and categories by id
+	accounts   map[int]string
+	banks      map[int]string
+	categories map[int]string
+
+	// bank id of each account, by account id
+	accountBanks map[int]int
+
+	// true once the header row has been written
+	started bool
+}
+
+// newTransactionExport prepares the response to be written as a spreadsheet
+// in the given format, loading the names of the banks, accounts and
+// categories the user of the given token can see.
+func newTransactionExport(db database.GoBanksDataBase, w http.ResponseWriter,
+	t *auth.UserToken, format exportFormat) (*transactionExport, error) {
+
+	var te = &transactionExport{w: w,
+		accounts:     map[int]string{},
+		banks:        map[int]string{},
+		categories:   map[int]string{},
+		accountBanks: map[int]int{},
+	}
+
+	var af database.DBAccountFilters
+	af.UserId.SetFilter(t.UserId)
+	af.Roles.SetFilter(rolesFrom(viewerRole))
+	accs, err := db.GetAccounts(af, []string{"Id", "BankId", "Name"}, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var bankIds []int
+	for _, acc := range accs {
+		te.accounts[acc.Id] = acc.Name
+		te.accountBanks[acc.Id] = acc.BankId
+		if !intInArray(acc.BankId, bankIds) {
+			bankIds = append(bankIds, acc.BankId)
+		}
+	}
+
+	if len(bankIds) > 0 {
+		var bf database.DBBankFilters
+		bf.Ids.SetFilter(bankIds)
+		bnks, err := db.GetBanks(bf, []string{"Id", "Name"}, 0)
+		if err != nil {
+			return nil, err
+		}
+		for _, bnk := range bnks {
+			te.banks[bnk.Id] = bnk.Name
+		}
+	}
+
+	// categories belong to a single user: the ones set by the owner of a
+	// shared account are not known and stay empty.
+	var cf database.DBCategoryFilters
+	cf.UserId.SetFilter(t.UserId)
+	cats, err := db.GetCategories(cf, []string{"Id", "Name"}, 0)
+	if err != nil {
+		return nil, err
+	}
+	for _, cat := range cats {
+		te.categories[cat.Id] = cat.Name
+	}
+
+	setExportHeaders(w, format, "transactions")
+	te.table = format.newWriter(w, "Transactions")
+	return te, nil
+}
+
+// writeHeader writes the header row, with the name of each column, if not
+// already done.
+func (te *transactionExport) writeHeader() error {
+	if te.started {
+		return nil
+	}
+	te.started = true
+
+	var cells []tableCell
+	for _, field := range gettable_transaction_fields {
+		for _, column := range transaction_export_columns[field] {
+			cells = append(cells, textCell(column))
+		}
+	}
+	return te.table.writeRow(cells)
+}
+
+// write writes a single transaction as a row.
+func (te *transactionExport) write(trn database.DBTransaction) error {
+	if err := te.writeHeader(); err != nil {
+		return err
+	}
+
+	var cells []tableCell
+	for _, field := range gettable_transaction_fields {
+		switch field {
+		case "Id":
+			cells = append(cells, intCell(trn.Id))
+		case "AccountId":
+			cells = append(cells,
+				textCell(te.banks[te.accountBanks[trn.AccountId]]),
+				textCell(te.accounts[trn.AccountId]))
+		case "Label":
+			cells = append(cells, textCell(trn.Label))
+		case "CategoryId":
+			cells = append(cells, textCell(te.categories[trn.CategoryId]))
+		case "Description":
+			cells = append(cells, textCell(trn.Description))
+		case "TransactionDate":
+			cells = append(cells, dateCell(trn.TransactionDate))
+		case "RecordDate":
+			cells = append(cells, dateCell(trn.RecordDate))
+		case "Debit":
+			cells = append(cells, amountCell(trn.Debit))
+		case "Credit":
+			cells = append(cells, amountCell(trn.Credit))
+		case "Reference":
+			cells = append(cells, textCell(trn.Reference))
+		}
+	}
+	return te.table.writeRow(cells)
+}
+
+// close ends the spreadsheet. The error which stopped the export, if any,
+// is sent if nothing was written yet. Else the file is left incomplete.
+func (te *transactionExport) close(err error) {
+	if err != nil {
+		if !te.started {
+			unsetExportHeaders(te.w)
+			handleError(te.w, queryOperationError{})
+		} else {
+			log.Println("Transactions export interrupted:", err)
+		}
+		return
+	}
+
+	if err = te.writeHeader(); err == nil {
+		err = te.table.close()
+	}
+	if err != nil {
+		log.Println("Transactions export interrupted:", err)
+	}
+}
@@ -0,0 +1,111 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/peaberberian/GoBanks/auth"
+	"github.com/peaberberian/GoBanks/database"
+)
+
+// media type of newline delimited JSON: one JSON value per line
+const ndjson_media_type = "application/x-ndjson"
+
+// number of transactions written between two flushes of the response
+const stream_flush_interval = 100
+
+// transactionWriter writes the transactions of a response one at a time.
+type transactionWriter interface {
+	write(trn database.DBTransaction) error
+
+	// close ends the response, err being the error which stopped the
+	// writing, if any.
+	close(err error)
+}
+
+// newTransactionWriter returns the transactionWriter writing the response to
+// the given request: a spreadsheet if one is asked through the Accept header
+// (see getExportFormat), a transactionStream else.
+func newTransactionWriter(db database.GoBanksDataBase, w http.ResponseWriter,
+	r *http.Request, t *auth.UserToken) (transactionWriter, error) {
+
+	w.Header().Add("vary", "Accept")
+	if format, ok := getExportFormat(r); ok {
+		return newTransactionExport(db, w, t, format)
+	}
+	return newTransactionStream(w, r), nil
+}
+
+// transactionStream writes transactions in a response one at a time, as a
+// JSON array or, if the request accepts it, as newline delimited JSON.
+type transactionStream struct {
+	w      http.ResponseWriter
+	ndjson bool
+
+	// number of transactions written
+	count int
+}
+
+// newTransactionStream prepares the response to the given request to be
+// written with a transactionStream.
+func newTransactionStream(w http.ResponseWriter,
+	r *http.Request) *transactionStream {
+
+	var ts = &transactionStream{w: w,
+		ndjson: acceptsMediaType(r, ndjson_media_type)}
+	if ts.ndjson {
+		w.Header().Set("content-type", ndjson_media_type)
+	}
+	return ts
+}
+
+// write writes a single transaction in the response.
+func (ts *transactionStream) write(trn database.DBTransaction) error {
+	resBytes, err := json.Marshal(dbTransactionToTransactionJSON(trn))
+	if err != nil {
+		return err
+	}
+
+	if ts.ndjson {
+		resBytes = append(resBytes, '\n')
+	} else if ts.count == 0 {
+		resBytes = append([]byte("["), resBytes...)
+	} else {
+		resBytes = append([]byte(","), resBytes...)
+	}
+	if _, err = ts.w.Write(resBytes); err != nil {
+		return err
+	}
+
+	ts.count++
+	if f, ok := ts.w.(http.Flusher); ok &&
+		ts.count%stream_flush_interval == 0 {
+		f.Flush()
+	}
+	return nil
+}
+
+// close ends the response. The error which stopped the stream, if any, is
+// sent if nothing was written yet. Else the response is left incomplete,
+// for the client to know that it failed.
+func (ts *transactionStream) close(err error) {
+	if err != nil {
+		if ts.count == 0 {
+			ts.w.Header().Set("content-type", "application/json")
+			handleError(ts.w, queryOperationError{})
+		} else {
+			log.Println("Transactions stream interrupted:", err)
+		}
+		return
+	}
+
+	if ts.ndjson {
+		return
+	}
+	if ts.count == 0 {
+		ts.w.Write([]byte("[]"))
+	} else {
+		ts.w.Write([]byte("]"))
+	}
+}
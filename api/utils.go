@@ -14,9 +14,14 @@ import (
 	"github.com/peaberberian/GoBanks/database"
 )
 
-// Respond to the request with the given error message
+// Respond to the request with the given error message and the
+// corresponding HTTP status code (see getErrorStatus)
 func handleError(w http.ResponseWriter, err error) {
-
+	if val, ok := err.(retryableError); ok {
+		var retryAfter = int(val.RetryAfter() / time.Second)
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	}
+	w.WriteHeader(getErrorStatus(err))
 	fmt.Fprintf(w, generateErrorResponse(err))
 }
 
@@ -25,6 +30,15 @@ func handleSuccess(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprintf(w, "{\"success\":true}")
 }
 
+// Prepare the response for a newly created resource: set the Location
+// header to its URL and the status code to 201.
+// The created resource should be written just after.
+func handleCreated(w http.ResponseWriter, r *http.Request, id int) {
+	w.Header().Set("Location",
+		strings.TrimSuffix(r.URL.Path, "/")+"/"+strconv.Itoa(id))
+	w.WriteHeader(http.StatusCreated)
+}
+
 // Respond to the request with a message indicating that the method
 // ("GET"/"POST"/"PUT"/"DELETE") is not supported for the route wanted
 func handleNotSupportedMethod(w http.ResponseWriter, method string) {
@@ -45,6 +59,14 @@ func generateErrorResponse(err error) string {
 		errJson.Error = err.Error()
 	}
 
+	if val, ok := err.(retryableError); ok {
+		errJson.RetryAfter = int(val.RetryAfter() / time.Second)
+	}
+
+	if val, ok := err.(detailedError); ok {
+		errJson.Details = val.ErrorDetails()
+	}
+
 	errBytes, err := json.Marshal(errJson)
 	if err != nil {
 		return "{\"error\":\"internal error\",\"code\":0}"
@@ -53,23 +75,37 @@ func generateErrorResponse(err error) string {
 	}
 }
 
-// getApiRoute reads the url and just returns the API wanted.
-func getApiRoute(url string) string {
-	var paths = strings.Split(url, "/")
-	if len(paths) < 3 {
-		return ""
+// acceptsMediaType returns true if the given media type is listed in the
+// Accept header of the request.
+// example: with "Accept: application/x-ndjson;q=0.9, */*",
+// acceptsMediaType(r, "application/x-ndjson") => true
+func acceptsMediaType(r *http.Request, mediaType string) bool {
+	for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+		accepted = strings.TrimSpace(strings.SplitN(accepted, ";", 2)[0])
+		if strings.EqualFold(accepted, mediaType) {
+			return true
+		}
 	}
-	return paths[2]
+	return false
 }
 
-// getApiId
-// TODO
-func getApiId(url string) (int, bool) {
-	var paths = strings.Split(url, "/")
-	if len(paths) < 4 {
+// getApiId returns the id given in the path of the request, for routes
+// with an {id:int} parameter.
+// The returned boolean is false if the route has no id.
+// example: getApiId on "/v1/transactions/35" => 35, true
+func getApiId(r *http.Request) (int, bool) {
+	return getApiIntParam(r, "id")
+}
+
+// getApiIntParam returns the value of an integer parameter of the route's
+// path (see router).
+// The returned boolean is false if the route has no such parameter.
+func getApiIntParam(r *http.Request, name string) (int, bool) {
+	param, ok := getPathParam(r, name)
+	if !ok {
 		return 0, false
 	}
-	if val, err := strconv.Atoi(paths[3]); err == nil {
+	if val, err := strconv.Atoi(param); err == nil {
 		return val, true
 	}
 	return 0, false
@@ -143,6 +179,18 @@ func intInArray(val int, arr []int) bool {
 	return false
 }
 
+// Returns the ints present in both given arrays
+// intersectInts([]int{1,3,4}, []int{4,1}) -> []int{1,4}
+func intersectInts(arr1 []int, arr2 []int) []int {
+	var res = []int{}
+	for _, val := range arr1 {
+		if intInArray(val, arr2) {
+			res = append(res, val)
+		}
+	}
+	return res
+}
+
 // Returns true if an string was found in an array of string
 // stringInArray(4, []string{1,4} -> true
 // stringInArray(4, []string{1,3} -> false
@@ -228,10 +276,12 @@ func int64TimeStampToTime(ts int64) time.Time {
 	return time.Unix(0, ts*1e6)
 }
 
-func getBankIdsForUserId(userId int) ([]int, error) {
+func getBankIdsForUserId(db database.GoBanksDataBase, userId int) ([]int,
+	error) {
+
 	var banksFilter database.DBBankFilters
 	banksFilter.UserId.SetFilter(userId)
-	bnks, err := database.GoDB.GetBanks(banksFilter, []string{"Id"}, 0)
+	bnks, err := db.GetBanks(banksFilter, []string{"Id"}, 0)
 	if err != nil {
 		return []int{}, err
 	}
@@ -242,26 +292,12 @@ func getBankIdsForUserId(userId int) ([]int, error) {
 	return bnkIds, nil
 }
 
-func getAccountIdsForBankIds(bankIds []int) ([]int, error) {
+func getAccountIdsForBankIds(db database.GoBanksDataBase, bankIds []int) (
+	[]int, error) {
 
 	var accountsFilter database.DBAccountFilters
 	accountsFilter.BankIds.SetFilter(bankIds)
-	accs, err := database.GoDB.GetAccounts(accountsFilter, []string{"Id"}, 0)
-	if err != nil {
-		return []int{}, err
-	}
-	var accIds []int
-	for _, acc := range accs {
-		accIds = append(accIds, acc.Id)
-	}
-	return accIds, nil
-}
-
-func getTransactionIdsForAccountIds(accountIds []int) ([]int, error) {
-
-	var transactionsFilter database.DBTransactionFilters
-	transactionsFilter.AccountIds.SetFilter(accountIds)
-	accs, err := database.GoDB.GetTransactions(transactionsFilter, []string{"Id"}, 0)
+	accs, err := db.GetAccounts(accountsFilter, []string{"Id"}, 0)
 	if err != nil {
 		return []int{}, err
 	}
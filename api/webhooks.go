@@ -0,0 +1,463 @@
+package api
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/peaberberian/GoBanks/database"
+)
+
+// Webhooks receive the events of their user (see database.Event) matching
+// their filters, as POST requests with a WebhookPayloadJSON body, signed
+// with their secret:
+//   - the X-GoBanks-Timestamp header is the time at which the request was
+//     sent, in seconds
+//   - the X-GoBanks-Signature header is "sha256=" followed by the hex
+//     HMAC-SHA256 of "<timestamp>.<body>", keyed with the secret
+//
+// Events are first queued in the database as deliveries, then sent by a
+// background worker. A delivery not answered with a 2xx status is retried
+// with an exponential backoff, until webhook_max_attempts attempts.
+// Deliveries are kept as a log during webhook_log_retention.
+//
+// Webhooks can only reach public addresses: URLs whose host resolves to a
+// loopback, private or link-local address are refused, both when the
+// webhook is created and when a delivery connects. Redirections are not
+// followed.
+
+// status of a webhook delivery
+const (
+	pendingDeliveryStatus   = "pending"
+	deliveredDeliveryStatus = "delivered"
+	failedDeliveryStatus    = "failed"
+)
+
+// number of attempts after which a delivery has failed
+const webhook_max_attempts = 8
+
+// delay before the first retry of a delivery, doubled after each attempt
+const webhook_retry_delay = 30 * time.Second
+
+// maximum duration of a single delivery request
+const webhook_request_timeout = 10 * time.Second
+
+// interval at which the queue is checked for deliveries to retry
+const webhook_poll_interval = 5 * time.Second
+
+// maximum number of deliveries sent at once
+const webhook_deliveries_batch = 50
+
+// time during which delivered and failed deliveries are kept
+const webhook_log_retention = 30 * 24 * time.Hour
+
+// DBWebhookDelivery properties modified after an attempt
+var webhook_attempt_fields = []string{"Status", "Attempts", "StatusCode",
+	"Error", "NextAttemptDate", "LastAttemptDate"}
+
+// every DBWebhookDelivery property
+var webhook_delivery_fields = []string{"Id", "WebhookId", "EventId",
+	"EventType", "Payload", "Status", "Attempts", "StatusCode", "Error",
+	"CreationDate", "NextAttemptDate", "LastAttemptDate"}
+
+// webhookDispatcher queues the events published for the webhooks
+// concerned, and delivers them.
+type webhookDispatcher struct {
+	db     database.GoBanksDataBase
+	client *http.Client
+
+	// signals that new deliveries were queued
+	queued chan struct{}
+}
+
+// StartWebhooks starts delivering the events published on the given bus to
+// the webhooks stored in the given database.
+func StartWebhooks(db database.GoBanksDataBase, bus *database.EventBus) {
+	var wd = &webhookDispatcher{
+		db:     db,
+		client: newWebhookClient(),
+		queued: make(chan struct{}, 1),
+	}
+	go wd.consume(bus)
+	go wd.work()
+}
+
+// Returned when the host of a webhook resolves to an address which is not
+// public
+var errWebhookAddressNotAllowed = errors.New(
+	"webhook host resolves to an address not allowed")
+
+// newWebhookClient returns the client sending the deliveries. It only
+// connects to public addresses (see isPublicWebhookIP) and does not follow
+// redirections.
+func newWebhookClient() *http.Client {
+	var dialer = &net.Dialer{Timeout: webhook_request_timeout}
+	var transport = http.DefaultTransport.(*http.Transport).Clone()
+
+	// a proxy would connect to the receivers without the check below
+	transport.Proxy = nil
+
+	// the address checked is the one connected to, so the host cannot
+	// resolve to another one in between
+	transport.DialContext = func(ctx context.Context, network string,
+		addr string) (net.Conn, error) {
+
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		ips, err := resolveWebhookHost(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		return dialer.DialContext(ctx, network,
+			net.JoinHostPort(ips[0].String(), port))
+	}
+
+	return &http.Client{
+		Timeout:   webhook_request_timeout,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// resolveWebhookHost returns the addresses of the given host. Returns
+// errWebhookAddressNotAllowed if one of them is not public.
+func resolveWebhookHost(ctx context.Context, host string) ([]net.IP, error) {
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	var ips []net.IP
+	for _, addr := range addrs {
+		if !isPublicWebhookIP(addr.IP) {
+			return nil, errWebhookAddressNotAllowed
+		}
+		ips = append(ips, addr.IP)
+	}
+	if len(ips) == 0 {
+		return nil, &net.DNSError{Err: "no address", Name: host,
+			IsNotFound: true}
+	}
+	return ips, nil
+}
+
+// isPublicWebhookIP returns false for the addresses webhooks cannot reach:
+// loopback, private, link-local, unspecified and multicast ones.
+func isPublicWebhookIP(ip net.IP) bool {
+	return !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsUnspecified() &&
+		!ip.IsLinkLocalUnicast() && !ip.IsMulticast()
+}
+
+// consume queues the events published on the given bus. Its subscription
+// is never dropped, so no event is missed however late it gets.
+func (wd *webhookDispatcher) consume(bus *database.EventBus) {
+	var sub = bus.SubscribeReliably(0)
+	for evt := range sub.C {
+		wd.enqueue(evt)
+	}
+}
+
+// work sends the deliveries due, each time new ones are queued and at
+// regular intervals for the retries.
+func (wd *webhookDispatcher) work() {
+	var ticker = time.NewTicker(webhook_poll_interval)
+	defer ticker.Stop()
+	var lastCleanup time.Time
+	for {
+		wd.deliverDue(time.Now())
+		if time.Since(lastCleanup) > time.Hour {
+			wd.cleanup(time.Now())
+			lastCleanup = time.Now()
+		}
+		select {
+		case <-wd.queued:
+		case <-ticker.C:
+		}
+	}
+}
+
+// enqueue queues a delivery of the given event for each webhook it
+// matches.
+func (wd *webhookDispatcher) enqueue(evt database.Event) {
+	var payload []byte
+	for _, userId := range evt.UserIds {
+		var f database.DBWebhookFilters
+		f.UserId.SetFilter(userId)
+		whs, err := wd.db.GetWebhooks(f, []string{"Id", "EventTypes",
+			"AccountIds", "MinDebit", "MinCredit"}, 0)
+		if err != nil {
+			log.Println("Webhooks: could not read the webhooks:", err)
+			continue
+		}
+
+		for _, wh := range whs {
+			if !webhookMatches(wh, evt) {
+				continue
+			}
+			if payload == nil {
+				if payload, err = json.Marshal(eventToWebhookPayload(
+					evt)); err != nil {
+					log.Println("Webhooks: invalid event:", err)
+					return
+				}
+			}
+			_, err = wd.db.AddWebhookDelivery(
+				database.DBWebhookDeliveryParams{
+					WebhookId:       wh.Id,
+					EventId:         evt.Id,
+					EventType:       evt.Type,
+					Payload:         string(payload),
+					Status:          pendingDeliveryStatus,
+					CreationDate:    time.Now(),
+					NextAttemptDate: time.Now(),
+				})
+			if err != nil {
+				log.Println("Webhooks: could not queue a delivery:", err)
+			}
+		}
+	}
+
+	if payload != nil {
+		select {
+		case wd.queued <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// deliverDue sends the pending deliveries whose next attempt is due.
+func (wd *webhookDispatcher) deliverDue(now time.Time) {
+	var f database.DBWebhookDeliveryFilters
+	f.Statuses.SetFilter([]string{pendingDeliveryStatus})
+	f.ToNextAttemptDate.SetFilter(now)
+	f.Sort.SetFilter([]database.DBSortField{{Field: "Id"}})
+	dlvs, err := wd.db.GetWebhookDeliveries(f, webhook_delivery_fields,
+		webhook_deliveries_batch)
+	if err != nil {
+		log.Println("Webhooks: could not read the deliveries:", err)
+		return
+	}
+
+	var webhooks = map[int]database.DBWebhook{}
+	for _, dlv := range dlvs {
+		wh, ok := webhooks[dlv.WebhookId]
+		if !ok {
+			var whf database.DBWebhookFilters
+			whf.Ids.SetFilter([]int{dlv.WebhookId})
+			whs, err := wd.db.GetWebhooks(whf, []string{"Id", "Url",
+				"Secret"}, 1)
+			if err != nil {
+				log.Println("Webhooks: could not read the webhooks:", err)
+				continue
+			}
+			if len(whs) > 0 {
+				wh = whs[0]
+			}
+			webhooks[dlv.WebhookId] = wh
+		}
+
+		var res database.DBWebhookDeliveryParams
+		if wh.Id == 0 {
+			// the webhook was removed in the meantime
+			res = database.DBWebhookDeliveryParams{
+				Status:          failedDeliveryStatus,
+				Attempts:        dlv.Attempts,
+				Error:           "webhook removed",
+				NextAttemptDate: dlv.NextAttemptDate,
+				LastAttemptDate: dlv.LastAttemptDate,
+			}
+		} else {
+			res = attemptDelivery(wd.client, wh, dlv, time.Now())
+		}
+
+		var df database.DBWebhookDeliveryFilters
+		df.Ids.SetFilter([]int{dlv.Id})
+		if err := wd.db.UpdateWebhookDeliveries(df, webhook_attempt_fields,
+			res); err != nil {
+			log.Println("Webhooks: could not update a delivery:", err)
+		}
+	}
+}
+
+// cleanup removes the delivered and failed deliveries older than
+// webhook_log_retention.
+func (wd *webhookDispatcher) cleanup(now time.Time) {
+	var f database.DBWebhookDeliveryFilters
+	f.Statuses.SetFilter([]string{deliveredDeliveryStatus,
+		failedDeliveryStatus})
+	f.ToCreationDate.SetFilter(now.Add(-webhook_log_retention))
+	if err := wd.db.RemoveWebhookDeliveries(f); err != nil {
+		log.Println("Webhooks: could not remove old deliveries:", err)
+	}
+}
+
+// attemptDelivery sends a delivery to its webhook and returns its new
+// state: delivered if the receiver answered with a 2xx status, else pending
+// until a retry or failed after webhook_max_attempts attempts.
+func attemptDelivery(client *http.Client, wh database.DBWebhook,
+	dlv database.DBWebhookDelivery, now time.Time,
+) database.DBWebhookDeliveryParams {
+
+	var res = database.DBWebhookDeliveryParams{
+		Attempts:        dlv.Attempts + 1,
+		LastAttemptDate: now,
+		NextAttemptDate: dlv.NextAttemptDate,
+	}
+
+	status, err := sendWebhook(client, wh.Url, wh.Secret, dlv, now)
+	res.StatusCode = status
+	switch {
+	case err == nil && status >= 200 && status < 300:
+		res.Status = deliveredDeliveryStatus
+		return res
+	case err != nil:
+		res.Error = err.Error()
+	default:
+		res.Error = http.StatusText(status)
+	}
+
+	if res.Attempts >= webhook_max_attempts {
+		res.Status = failedDeliveryStatus
+	} else {
+		res.Status = pendingDeliveryStatus
+		res.NextAttemptDate = now.Add(retryDelay(res.Attempts))
+	}
+	return res
+}
+
+// retryDelay returns the delay before the next attempt of a delivery,
+// after the given number of attempts.
+func retryDelay(attempts int) time.Duration {
+	if attempts < 1 {
+		return 0
+	}
+	return webhook_retry_delay << uint(attempts-1)
+}
+
+// sendWebhook POSTs the payload of a delivery to the given URL, signed with
+// the given secret. Returns the HTTP status of the response.
+func sendWebhook(client *http.Client, url string, secret string,
+	dlv database.DBWebhookDelivery, now time.Time) (int, error) {
+
+	var timestamp = strconv.FormatInt(now.Unix(), 10)
+	req, err := http.NewRequest("POST", url, strings.NewReader(dlv.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("content-type", "application/json")
+	req.Header.Set("user-agent", "GoBanks-Webhooks")
+	req.Header.Set("X-GoBanks-Event", dlv.EventType)
+	req.Header.Set("X-GoBanks-Delivery", strconv.Itoa(dlv.Id))
+	req.Header.Set("X-GoBanks-Timestamp", timestamp)
+	req.Header.Set("X-GoBanks-Signature",
+		signWebhookPayload(secret, timestamp, []byte(dlv.Payload)))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	// read the body so the connection can be reused
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 64*1024))
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+// signWebhookPayload returns the X-GoBanks-Signature header of a payload
+// sent at the given timestamp (in seconds).
+func signWebhookPayload(secret string, timestamp string,
+	payload []byte) string {
+
+	var mac = hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookMatches returns true if the given event should be delivered to the
+// given webhook:
+//   - its type must be one of the EventTypes of the webhook, if any
+//   - with AccountIds, only the transactions, accounts and shares of these
+//     accounts match
+//   - with a MinDebit or a MinCredit, only the transactions with at least
+//     this debit or this credit match
+func webhookMatches(wh database.DBWebhook, evt database.Event) bool {
+	if len(wh.EventTypes) > 0 {
+		var found bool
+		for _, typ := range wh.EventTypes {
+			if typ == evt.Type {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if len(wh.AccountIds) > 0 {
+		var accountId int
+		switch data := evt.Data.(type) {
+		case database.DBTransaction:
+			accountId = data.AccountId
+		case database.DBAccount:
+			accountId = data.Id
+		case database.DBShare:
+			accountId = data.AccountId
+		}
+		if accountId == 0 || !intInArray(accountId, wh.AccountIds) {
+			return false
+		}
+	}
+
+	if wh.MinDebit > 0 || wh.MinCredit > 0 {
+		trn, ok := evt.Data.(database.DBTransaction)
+		if !ok {
+			return false
+		}
+		var bigDebit = wh.MinDebit > 0 && trn.Debit >= wh.MinDebit
+		var bigCredit = wh.MinCredit > 0 && trn.Credit >= wh.MinCredit
+		if !bigDebit && !bigCredit {
+			return false
+		}
+	}
+	return true
+}
+
+// eventToWebhookPayload converts an event to the body sent to webhooks.
+func eventToWebhookPayload(evt database.Event) WebhookPayloadJSON {
+	var payload = WebhookPayloadJSON{
+		Id:         evt.Id,
+		Type:       evt.Type,
+		ResourceId: evt.ResourceId,
+		Date:       evt.Date.UnixNano() / 1e6,
+	}
+	switch data := evt.Data.(type) {
+	case database.DBBank:
+		payload.Data = dbBankToBankJSON(data)
+	case database.DBAccount:
+		payload.Data = dbAccountToAccountJSON(data)
+	case database.DBCategory:
+		payload.Data = dbCategoryToCategoryJSON(data)
+	case database.DBTransaction:
+		payload.Data = dbTransactionToTransactionJSON(data)
+	case database.DBShare:
+		payload.Data = dbShareToShareJSON(data)
+	case database.DBAlert:
+		payload.Data = dbAlertToAlertJSON(data)
+	}
+	return payload
+}
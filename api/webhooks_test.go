@@ -0,0 +1,238 @@
+package api
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/peaberberian/GoBanks/database"
+)
+
+// newWebhookReceiver starts a local HTTP listener answering with the given
+// status, and returning the requests it received.
+func newWebhookReceiver(t *testing.T, status int) (*httptest.Server,
+	chan *http.Request, chan []byte) {
+
+	var reqs = make(chan *http.Request, 10)
+	var bodies = make(chan []byte, 10)
+	var srv = httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			body, _ := ioutil.ReadAll(r.Body)
+			reqs <- r
+			bodies <- body
+			w.WriteHeader(status)
+		}))
+	t.Cleanup(srv.Close)
+	return srv, reqs, bodies
+}
+
+func newTestDelivery(t *testing.T) database.DBWebhookDelivery {
+	payload, err := json.Marshal(eventToWebhookPayload(database.Event{
+		Id:         42,
+		Type:       "transaction.created",
+		ResourceId: 7,
+		Data: database.DBTransaction{Id: 7, AccountId: 3, Label: "rent",
+			Debit: 800},
+		Date: time.Now(),
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return database.DBWebhookDelivery{
+		Id:              5,
+		WebhookId:       1,
+		EventId:         42,
+		EventType:       "transaction.created",
+		Payload:         string(payload),
+		Status:          pendingDeliveryStatus,
+		NextAttemptDate: time.Now(),
+	}
+}
+
+func TestAttemptDeliverySignsPayload(t *testing.T) {
+	srv, reqs, bodies := newWebhookReceiver(t, http.StatusNoContent)
+	var wh = database.DBWebhook{Id: 1, Url: srv.URL, Secret: "s3cr3t"}
+	var dlv = newTestDelivery(t)
+	var now = time.Now()
+
+	var res = attemptDelivery(srv.Client(), wh, dlv, now)
+	if res.Status != deliveredDeliveryStatus || res.Attempts != 1 ||
+		res.StatusCode != http.StatusNoContent || res.Error != "" {
+		t.Fatalf("unexpected delivery result: %+v", res)
+	}
+
+	var req = <-reqs
+	var body = <-bodies
+	if req.Method != "POST" || string(body) != dlv.Payload {
+		t.Fatalf("unexpected request: %s %q", req.Method, body)
+	}
+	if req.Header.Get("X-GoBanks-Event") != "transaction.created" ||
+		req.Header.Get("X-GoBanks-Delivery") != "5" {
+		t.Fatalf("unexpected headers: %v", req.Header)
+	}
+
+	var timestamp = req.Header.Get("X-GoBanks-Timestamp")
+	if timestamp != strconv.FormatInt(now.Unix(), 10) {
+		t.Fatalf("unexpected timestamp %q", timestamp)
+	}
+	var signature = req.Header.Get("X-GoBanks-Signature")
+	if signature != signWebhookPayload("s3cr3t", timestamp, body) {
+		t.Fatalf("invalid signature %q", signature)
+	}
+	if signature == signWebhookPayload("other", timestamp, body) {
+		t.Fatal("signature does not depend on the secret")
+	}
+
+	var payload WebhookPayloadJSON
+	if err := json.Unmarshal(body, &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.Id != 42 || payload.ResourceId != 7 ||
+		payload.Type != "transaction.created" {
+		t.Fatalf("unexpected payload: %+v", payload)
+	}
+}
+
+func TestAttemptDeliveryRetriesThenFails(t *testing.T) {
+	srv, reqs, _ := newWebhookReceiver(t, http.StatusInternalServerError)
+	var wh = database.DBWebhook{Id: 1, Url: srv.URL, Secret: "s3cr3t"}
+	var dlv = newTestDelivery(t)
+	var now = time.Now()
+
+	var res = attemptDelivery(srv.Client(), wh, dlv, now)
+	<-reqs
+	if res.Status != pendingDeliveryStatus || res.Attempts != 1 ||
+		res.StatusCode != http.StatusInternalServerError || res.Error == "" {
+		t.Fatalf("unexpected delivery result: %+v", res)
+	}
+	if !res.NextAttemptDate.Equal(now.Add(webhook_retry_delay)) {
+		t.Fatalf("unexpected next attempt: %v", res.NextAttemptDate)
+	}
+
+	dlv.Attempts = 1
+	res = attemptDelivery(srv.Client(), wh, dlv, now)
+	<-reqs
+	if !res.NextAttemptDate.Equal(now.Add(2 * webhook_retry_delay)) {
+		t.Fatalf("delay not doubled: %v", res.NextAttemptDate)
+	}
+
+	dlv.Attempts = webhook_max_attempts - 1
+	res = attemptDelivery(srv.Client(), wh, dlv, now)
+	<-reqs
+	if res.Status != failedDeliveryStatus ||
+		res.Attempts != webhook_max_attempts {
+		t.Fatalf("unexpected delivery result: %+v", res)
+	}
+}
+
+func TestAttemptDeliveryUnreachable(t *testing.T) {
+	srv, _, _ := newWebhookReceiver(t, http.StatusOK)
+	var wh = database.DBWebhook{Id: 1, Url: srv.URL, Secret: "s3cr3t"}
+	var client = srv.Client()
+	srv.Close()
+
+	var res = attemptDelivery(client, wh, newTestDelivery(t), time.Now())
+	if res.Status != pendingDeliveryStatus || res.StatusCode != 0 ||
+		res.Error == "" {
+		t.Fatalf("unexpected delivery result: %+v", res)
+	}
+}
+
+func TestWebhookClientRefusesLocalAddresses(t *testing.T) {
+	srv, reqs, _ := newWebhookReceiver(t, http.StatusOK)
+	var wh = database.DBWebhook{Id: 1, Url: srv.URL, Secret: "s3cr3t"}
+
+	var res = attemptDelivery(newWebhookClient(), wh, newTestDelivery(t),
+		time.Now())
+	if res.Status != pendingDeliveryStatus ||
+		!strings.Contains(res.Error, errWebhookAddressNotAllowed.Error()) {
+		t.Fatalf("unexpected delivery result: %+v", res)
+	}
+	if len(reqs) != 0 {
+		t.Fatal("the local receiver was reached")
+	}
+}
+
+func TestWebhookClientDoesNotFollowRedirections(t *testing.T) {
+	var client = newWebhookClient()
+	req, _ := http.NewRequest("GET", "http://example.com/", nil)
+	if err := client.CheckRedirect(req, []*http.Request{req}); err !=
+		http.ErrUseLastResponse {
+		t.Fatalf("unexpected redirection policy: %v", err)
+	}
+}
+
+func TestIsPublicWebhookIP(t *testing.T) {
+	var tests = []struct {
+		ip   string
+		want bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"fd00::1", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"0.0.0.0", false},
+		{"::", false},
+		{"224.0.0.1", false},
+		{"::ffff:127.0.0.1", false},
+	}
+	for _, test := range tests {
+		if got := isPublicWebhookIP(net.ParseIP(test.ip)); got != test.want {
+			t.Errorf("%s: got %v, want %v", test.ip, got, test.want)
+		}
+	}
+}
+
+func TestWebhookMatches(t *testing.T) {
+	var trn = database.Event{Type: "transaction.created",
+		Data: database.DBTransaction{AccountId: 3, Debit: 50}}
+	var credit = database.Event{Type: "transaction.updated",
+		Data: database.DBTransaction{AccountId: 4, Credit: 2000}}
+	var bnk = database.Event{Type: "bank.deleted",
+		Data: database.DBBank{Id: 1}}
+	var acc = database.Event{Type: "account.updated",
+		Data: database.DBAccount{Id: 3}}
+
+	var tests = []struct {
+		name string
+		wh   database.DBWebhook
+		evt  database.Event
+		want bool
+	}{
+		{"no filter", database.DBWebhook{}, bnk, true},
+		{"type", database.DBWebhook{
+			EventTypes: []string{"transaction.created"}}, trn, true},
+		{"other type", database.DBWebhook{
+			EventTypes: []string{"transaction.created"}}, credit, false},
+		{"account", database.DBWebhook{AccountIds: []int{3}}, trn, true},
+		{"other account", database.DBWebhook{AccountIds: []int{3}}, credit,
+			false},
+		{"account event", database.DBWebhook{AccountIds: []int{3}}, acc,
+			true},
+		{"bank with accounts", database.DBWebhook{AccountIds: []int{3}}, bnk,
+			false},
+		{"min debit", database.DBWebhook{MinDebit: 20}, trn, true},
+		{"small debit", database.DBWebhook{MinDebit: 100}, trn, false},
+		{"min credit", database.DBWebhook{MinCredit: 1000}, credit, true},
+		{"debit or credit", database.DBWebhook{MinDebit: 100,
+			MinCredit: 1000}, credit, true},
+		{"amount of a bank", database.DBWebhook{MinDebit: 1}, bnk, false},
+	}
+	for _, test := range tests {
+		if got := webhookMatches(test.wh, test.evt); got != test.want {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
@@ -1,10 +1,15 @@
 package auth
 
+import "strconv"
+import "time"
+
+import "github.com/peaberberian/GoBanks/errorcodes"
+
 // Error codes for authentication errors
 // You can retrieve them on returned errors.ErrorCode()
 const (
 	// Every Login error that could not be categorized
-	UnknownAuthenticationErrorCode uint32 = 300 + iota
+	UnknownAuthenticationErrorCode = errorcodes.AuthenticationErrors + iota
 
 	// No user found with the given username
 	UserNotFoundErrorCode
@@ -41,8 +46,87 @@ const (
 	// wrongly modified to a point where we cannot guarantee the security
 	// of our tokens
 	InvalidSigningKeyErrorCode
+
+	// The given two-factor code (TOTP or recovery code) is not valid
+	InvalidMFACodeErrorCode
+
+	// Trying to enroll in two-factor authentication while it is already
+	// enabled
+	MFAAlreadyEnabledErrorCode
+
+	// Trying to use or confirm two-factor authentication while it has not
+	// been enabled / enrolled
+	MFANotEnabledErrorCode
+
+	// Too many failed login attempts were made for this username or from
+	// this IP address. The client has to wait before trying again.
+	TooManyLoginAttemptsErrorCode
+
+	// Trying to create a personal access token with an unknown scope
+	InvalidScopeErrorCode
+
+	// The given password does not respect the password policy (too short,
+	// known to have been breached...)
+	WeakPasswordErrorCode
 )
 
+func init() {
+	errorcodes.Register(errorcodes.AuthenticationErrors,
+		UnknownAuthenticationErrorCode, "UnknownAuthenticationError",
+		"The authentication failed for an unknown reason.")
+	errorcodes.Register(errorcodes.AuthenticationErrors,
+		UserNotFoundErrorCode, "UserNotFound",
+		"No user was found with the given username.")
+	errorcodes.Register(errorcodes.AuthenticationErrors,
+		MultipleUserFoundErrorCode, "MultipleUserFound",
+		"Multiple users were found with the given username.")
+	errorcodes.Register(errorcodes.AuthenticationErrors,
+		AlreadyTakenUsernameErrorCode, "AlreadyTakenUsername",
+		"An user with the given username already exists.")
+	errorcodes.Register(errorcodes.AuthenticationErrors,
+		WrongPasswordErrorCode, "WrongPassword",
+		"The given password is wrong.")
+	errorcodes.Register(errorcodes.AuthenticationErrors,
+		ExpiredTokenErrorCode, "ExpiredToken",
+		"The token has expired, a new one has to be requested.")
+	errorcodes.Register(errorcodes.AuthenticationErrors,
+		InvalidTokenErrorCode, "InvalidToken",
+		"The token is not valid.")
+	errorcodes.Register(errorcodes.AuthenticationErrors,
+		NoTokenErrorCode, "NoToken",
+		"No token was provided.")
+	errorcodes.Register(errorcodes.AuthenticationErrors,
+		InvalidTokenSigningMethodErrorCode, "InvalidTokenSigningMethod",
+		"The token was not signed with the expected method.")
+	errorcodes.Register(errorcodes.AuthenticationErrors,
+		UnreadableTokenErrorCode, "UnreadableToken",
+		"The token could not be parsed.")
+	errorcodes.Register(errorcodes.AuthenticationErrors,
+		TokenSigningErrorCode, "TokenSigning",
+		"The token could not be signed.")
+	errorcodes.Register(errorcodes.AuthenticationErrors,
+		InvalidSigningKeyErrorCode, "InvalidSigningKey",
+		"The key used to sign tokens is not secure enough.")
+	errorcodes.Register(errorcodes.AuthenticationErrors,
+		InvalidMFACodeErrorCode, "InvalidMFACode",
+		"The two-factor authentication code is not valid.")
+	errorcodes.Register(errorcodes.AuthenticationErrors,
+		MFAAlreadyEnabledErrorCode, "MFAAlreadyEnabled",
+		"Two-factor authentication is already enabled.")
+	errorcodes.Register(errorcodes.AuthenticationErrors,
+		MFANotEnabledErrorCode, "MFANotEnabled",
+		"Two-factor authentication is not enabled.")
+	errorcodes.Register(errorcodes.AuthenticationErrors,
+		TooManyLoginAttemptsErrorCode, "TooManyLoginAttempts",
+		"Too many failed login attempts, retry later.")
+	errorcodes.Register(errorcodes.AuthenticationErrors,
+		InvalidScopeErrorCode, "InvalidScope",
+		"The given personal access token scope does not exist.")
+	errorcodes.Register(errorcodes.AuthenticationErrors,
+		WeakPasswordErrorCode, "WeakPassword",
+		"The password does not respect the password policy.")
+}
+
 type AuthenticationError interface {
 	error
 	ErrorCode() uint32
@@ -81,6 +165,12 @@ type invalidTokenSigningMethodError struct{ alg string }
 type unreadableTokenError struct{ field string }
 type tokenSigningError struct{}
 type invalidSigningKeyError struct{ field string }
+type invalidMFACodeError struct{}
+type mfaAlreadyEnabledError struct{}
+type mfaNotEnabledError struct{}
+type tooManyLoginAttemptsError struct{ retryAfter time.Duration }
+type invalidScopeError struct{ scope string }
+type weakPasswordError struct{ reason string }
 
 func (err userNotFoundError) Error() string {
 	if err.username != "" {
@@ -184,3 +274,69 @@ func (err invalidSigningKeyError) Error() string {
 func (err invalidSigningKeyError) ErrorCode() uint32 {
 	return InvalidSigningKeyErrorCode
 }
+
+func (err invalidMFACodeError) Error() string {
+	return "The two-factor authentication code is not valid."
+}
+
+func (err invalidMFACodeError) ErrorCode() uint32 {
+	return InvalidMFACodeErrorCode
+}
+
+func (err mfaAlreadyEnabledError) Error() string {
+	return "Two-factor authentication is already enabled for this user."
+}
+
+func (err mfaAlreadyEnabledError) ErrorCode() uint32 {
+	return MFAAlreadyEnabledErrorCode
+}
+
+func (err mfaNotEnabledError) Error() string {
+	return "Two-factor authentication is not enabled for this user."
+}
+
+func (err mfaNotEnabledError) ErrorCode() uint32 {
+	return MFANotEnabledErrorCode
+}
+
+func (err tooManyLoginAttemptsError) Error() string {
+	var seconds = int(err.RetryAfter() / time.Second)
+	return "Too many failed login attempts. Retry in " +
+		strconv.Itoa(seconds) + " second(s)."
+}
+
+func (err tooManyLoginAttemptsError) ErrorCode() uint32 {
+	return TooManyLoginAttemptsErrorCode
+}
+
+// RetryAfter returns the duration the client has to wait before being able
+// to try to log in again. Always rounded up to the second.
+func (err tooManyLoginAttemptsError) RetryAfter() time.Duration {
+	var rounded = err.retryAfter.Truncate(time.Second)
+	if rounded < err.retryAfter {
+		rounded += time.Second
+	}
+	return rounded
+}
+
+func (err invalidScopeError) Error() string {
+	if err.scope != "" {
+		return "Unknown scope: " + err.scope + "."
+	}
+	return "At least one scope has to be given."
+}
+
+func (err invalidScopeError) ErrorCode() uint32 {
+	return InvalidScopeErrorCode
+}
+
+func (err weakPasswordError) Error() string {
+	if err.reason != "" {
+		return "This password is too weak: " + err.reason + "."
+	}
+	return "This password is too weak."
+}
+
+func (err weakPasswordError) ErrorCode() uint32 {
+	return WeakPasswordErrorCode
+}
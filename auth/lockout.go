@@ -0,0 +1,182 @@
+package auth
+
+import (
+	"log"
+	"sort"
+	"time"
+
+	db "github.com/peaberberian/GoBanks/database"
+)
+
+// LockoutPolicy describes how failed login attempts are throttled.
+//
+// Every failed attempt past the MaxAttempts first ones doubles the delay
+// the client has to wait before trying again, starting from BaseDelay and
+// up to LockoutDuration, at which point the username (or IP address) is
+// temporarily locked out.
+// A successful login resets the counter for the username.
+type LockoutPolicy struct {
+	// Failed attempts allowed per username before any delay is applied
+	MaxAttempts int
+
+	// Failed attempts allowed per IP address before any delay is applied
+	MaxIpAttempts int
+
+	// Delay applied after the first failed attempt past the allowed ones
+	BaseDelay time.Duration
+
+	// Maximum delay applied (temporary lockout)
+	LockoutDuration time.Duration
+
+	// Failed attempts older than that are not taken into account
+	Window time.Duration
+}
+
+// Current login throttling policy
+var lockoutPolicy = LockoutPolicy{
+	MaxAttempts:     5,
+	MaxIpAttempts:   20,
+	BaseDelay:       time.Second,
+	LockoutDuration: 15 * time.Minute,
+	Window:          time.Hour,
+}
+
+// SetLockoutPolicy modifies the policy used to throttle failed logins.
+// Zero values keep the current setting.
+func SetLockoutPolicy(p LockoutPolicy) {
+	if p.MaxAttempts > 0 {
+		lockoutPolicy.MaxAttempts = p.MaxAttempts
+	}
+	if p.MaxIpAttempts > 0 {
+		lockoutPolicy.MaxIpAttempts = p.MaxIpAttempts
+	}
+	if p.BaseDelay > 0 {
+		lockoutPolicy.BaseDelay = p.BaseDelay
+	}
+	if p.LockoutDuration > 0 {
+		lockoutPolicy.LockoutDuration = p.LockoutDuration
+	}
+	if p.Window > 0 {
+		lockoutPolicy.Window = p.Window
+	}
+}
+
+// GetLockoutPolicy returns the current policy used to throttle failed logins.
+func GetLockoutPolicy() LockoutPolicy {
+	return lockoutPolicy
+}
+
+// GetLoginAttempts returns the last login attempts (successful or not) made
+// on the given user's account, the most recent first.
+// The limit is the max number of attempts returned (0 = no limit).
+func GetLoginAttempts(userId int, limit uint) ([]db.DBLoginAttempt,
+	AuthenticationError) {
+
+	var f db.DBLoginAttemptFilters
+	f.UserId.SetFilter(userId)
+
+	var fields = []string{"Id", "UserId", "UserName", "IpAddress", "Success",
+		"AttemptDate"}
+	attempts, err := db.GoDB.GetLoginAttempts(f, fields, limit)
+	if err != nil {
+		return nil, genericAuthenticationError{}
+	}
+	return attempts, nil
+}
+
+// checkLoginThrottling returns an error if the given username or IP address
+// made too many failed login attempts recently. The error indicates how long
+// the client has to wait before trying again.
+func checkLoginThrottling(username string, ip string) AuthenticationError {
+	var now = time.Now()
+	var fields = []string{"Success", "AttemptDate"}
+
+	var uf db.DBLoginAttemptFilters
+	uf.UserName.SetFilter(username)
+	uf.FromDate.SetFilter(now.Add(-lockoutPolicy.Window))
+	userAttempts, err := db.GoDB.GetLoginAttempts(uf, fields, 0)
+	if err != nil {
+		return genericAuthenticationError{}
+	}
+
+	var wait = remainingDelay(failuresSinceLastSuccess(userAttempts),
+		lockoutPolicy.MaxAttempts, now)
+
+	if ip != "" {
+		var ipf db.DBLoginAttemptFilters
+		ipf.IpAddress.SetFilter(ip)
+		ipf.Success.SetFilter(false)
+		ipf.FromDate.SetFilter(now.Add(-lockoutPolicy.Window))
+		ipAttempts, err := db.GoDB.GetLoginAttempts(ipf, fields, 0)
+		if err != nil {
+			return genericAuthenticationError{}
+		}
+
+		var ipWait = remainingDelay(failuresSinceLastSuccess(ipAttempts),
+			lockoutPolicy.MaxIpAttempts, now)
+		if ipWait > wait {
+			wait = ipWait
+		}
+	}
+
+	if wait > 0 {
+		return tooManyLoginAttemptsError{wait}
+	}
+	return nil
+}
+
+// recordLoginAttempt stores a login attempt in the database.
+// userId is 0 if the username is not known.
+func recordLoginAttempt(username string, userId int, ip string,
+	success bool) {
+
+	var params = db.DBLoginAttemptParams{
+		UserId:      userId,
+		UserName:    username,
+		IpAddress:   ip,
+		Success:     success,
+		AttemptDate: time.Now(),
+	}
+	if _, err := db.GoDB.AddLoginAttempt(params); err != nil {
+		log.Println("could not record login attempt for", username, ":", err)
+	}
+}
+
+// failuresSinceLastSuccess returns the dates of the failed attempts which
+// happened after the last successful one, in chronological order.
+func failuresSinceLastSuccess(attempts []db.DBLoginAttempt) []time.Time {
+	sort.Slice(attempts, func(i, j int) bool {
+		return attempts[i].AttemptDate.Before(attempts[j].AttemptDate)
+	})
+
+	var failures []time.Time
+	for _, attempt := range attempts {
+		if attempt.Success {
+			failures = failures[:0]
+		} else {
+			failures = append(failures, attempt.AttemptDate)
+		}
+	}
+	return failures
+}
+
+// remainingDelay calculates how long a client has to wait, from now, before
+// being able to try again, given its failed attempts (in chronological
+// order) and the number of failures allowed without delay.
+func remainingDelay(failures []time.Time, allowed int, now time.Time) time.Duration {
+	var excess = len(failures) - allowed
+	if excess <= 0 {
+		return 0
+	}
+
+	var delay = lockoutPolicy.BaseDelay
+	for i := 1; i < excess && delay < lockoutPolicy.LockoutDuration; i++ {
+		delay *= 2
+	}
+	if delay > lockoutPolicy.LockoutDuration {
+		delay = lockoutPolicy.LockoutDuration
+	}
+
+	var lastFailure = failures[len(failures)-1]
+	return lastFailure.Add(delay).Sub(now)
+}
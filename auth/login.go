@@ -12,15 +12,41 @@ func init() {
 
 // LoginUser logins a particular user from its credentials and returns, if
 // it succeeded, the json web token for this user.
+// If the user enabled two-factor authentication, the returned token is
+// instead a short-lived challenge token and the returned boolean is set to
+// true. This challenge token has to be exchanged through CompleteMFALogin.
+//
+// The IP address of the client is used to throttle failed attempts (see
+// LockoutPolicy). Every attempt is recorded.
 // If the autentication failed, an AuthenticationError is returned.
-func LoginUser(username string, password string) (string,
+func LoginUser(username string, password string, ip string) (string, bool,
 	AuthenticationError) {
 
-	if err := VerifyUser(username, password); err != nil {
-		return "", err
+	if err := checkLoginThrottling(username, ip); err != nil {
+		return "", false, err
+	}
+
+	user, err := getUserFromUsername(username)
+	if err != nil {
+		if _, notFound := err.(userNotFoundError); notFound {
+			recordLoginAttempt(username, 0, ip, false)
+		}
+		return "", false, err
+	}
+	if err = authenticate(user, password); err != nil {
+		recordLoginAttempt(username, user.Id, ip, false)
+		return "", false, err
+	}
+
+	// the attempt will be recorded once the two-factor code is checked
+	if user.TotpEnabled {
+		challenge, err := createMFAChallengeToken(user)
+		return challenge, true, err
 	}
 
-	return createToken(username)
+	recordLoginAttempt(username, user.Id, ip, true)
+	token, err := createTokenForUser(user)
+	return token, false, err
 }
 
 // VerifyUser verifies the password for the given username and returns
@@ -41,6 +67,10 @@ func VerifyUser(username string, password string) AuthenticationError {
 func RegisterUser(username string,
 	password string, administrator bool) (db.DBUser, AuthenticationError) {
 
+	if err := checkPasswordPolicy(password); err != nil {
+		return db.DBUser{}, err
+	}
+
 	usernameTaken, err := isUsernameTaken(username)
 	if err != nil {
 		return db.DBUser{}, genericAuthenticationError{}
@@ -64,12 +94,19 @@ func RegisterUser(username string,
 
 // authenticate tries to authenticates a user based on the db.DBUser object
 // and a password. Returns an error if the password is invalid.
+// Passwords stored with an outdated scheme or cost are transparently
+// rehashed (see PasswordPolicy).
 func authenticate(user db.DBUser, password string) AuthenticationError {
+	// Salt is only set for passwords stored with the previous scheme
 	var err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash),
 		[]byte(user.Salt+password))
 	if err != nil {
 		return wrongPasswordError{user.Name}
 	}
+
+	if needsRehash(user) {
+		rehashPassword(user, password)
+	}
 	return nil
 }
 
@@ -83,7 +120,8 @@ func getUserFromUsername(username string) (db.DBUser, AuthenticationError) {
 	var f db.DBUserFilters
 	f.Name.SetFilter(username)
 
-	var fields = []string{"Id", "Name", "PasswordHash", "Salt", "Administrator"}
+	var fields = []string{"Id", "Name", "PasswordHash", "Salt",
+		"Administrator", "TotpSecret", "TotpEnabled"}
 	user, err := db.GoDB.GetUser(f, fields)
 	if err != nil {
 		return db.DBUser{}, genericAuthenticationError{}
@@ -95,6 +133,25 @@ func getUserFromUsername(username string) (db.DBUser, AuthenticationError) {
 	return user, nil
 }
 
+// getUserFromId returns the corresponding User struct for a given user id.
+// It returns an error if no user was found or for a database error.
+func getUserFromId(userId int) (db.DBUser, AuthenticationError) {
+	var f db.DBUserFilters
+	f.Id.SetFilter(userId)
+
+	var fields = []string{"Id", "Name", "PasswordHash", "Salt",
+		"Administrator", "TotpSecret", "TotpEnabled"}
+	user, err := db.GoDB.GetUser(f, fields)
+	if err != nil {
+		return db.DBUser{}, genericAuthenticationError{}
+	}
+	if user.Name == "" {
+		return db.DBUser{}, userNotFoundError{}
+	}
+
+	return user, nil
+}
+
 func generateRandomKey(size int) (string, error) {
 	byteSalt := make([]byte, size)
 	_, err := io.ReadFull(rand.Reader, byteSalt)
@@ -105,20 +162,18 @@ func generateRandomKey(size int) (string, error) {
 	return salt, nil
 }
 
+// newUser creates the database parameters for a new user, with its
+// password hashed following the current PasswordPolicy.
+// bcrypt already salts the hash, no salt is stored separately.
 func newUser(username string, password string,
 	administrator bool) (db.DBUserParams, error) {
-	salt, err := generateRandomKey(32)
-	if err != nil {
-		return db.DBUserParams{}, err
-	}
-	hash, err := bcrypt.GenerateFromPassword([]byte(salt+password), 4)
+	hash, err := hashPassword(password)
 	if err != nil {
 		return db.DBUserParams{}, err
 	}
 	var user = db.DBUserParams{
 		Name:          username,
-		PasswordHash:  string(hash),
-		Salt:          salt,
+		PasswordHash:  hash,
 		Administrator: administrator,
 	}
 	return user, nil
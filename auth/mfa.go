@@ -0,0 +1,246 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"strings"
+	"time"
+
+	db "github.com/peaberberian/GoBanks/database"
+)
+
+// Number of recovery codes generated when two-factor authentication is
+// enabled
+const recoveryCodesNumber = 10
+
+// Characters used to generate recovery codes.
+// Its length is a power of two so every character is equally likely.
+const recoveryCodeAlphabet = "abcdefghijklmnopqrstuvwxyz234567"
+
+// BeginTOTPEnrollment generates a new TOTP secret for the given user and
+// returns it along with the corresponding otpauth URI.
+// Two-factor authentication is only enabled once ConfirmTOTPEnrollment has
+// been called with a first valid code.
+func BeginTOTPEnrollment(userId int) (string, string, AuthenticationError) {
+	user, err := getUserFromId(userId)
+	if err != nil {
+		return "", "", err
+	}
+	if user.TotpEnabled {
+		return "", "", mfaAlreadyEnabledError{}
+	}
+
+	secret, rerr := generateTOTPSecret()
+	if rerr != nil {
+		return "", "", genericAuthenticationError{}
+	}
+
+	var params = db.DBUserParams{TotpSecret: secret}
+	if dbErr := db.GoDB.UpdateUser(user.Id, []string{"TotpSecret"},
+		params); dbErr != nil {
+		return "", "", genericAuthenticationError{}
+	}
+
+	return secret, totpURI(user.Name, secret), nil
+}
+
+// ConfirmTOTPEnrollment enables two-factor authentication for the given user
+// if the given code is valid for the secret generated by
+// BeginTOTPEnrollment.
+// It returns the newly-generated one-time recovery codes, which are only
+// stored hashed and cannot be retrieved afterwards.
+func ConfirmTOTPEnrollment(userId int, code string) ([]string,
+	AuthenticationError) {
+
+	user, err := getUserFromId(userId)
+	if err != nil {
+		return nil, err
+	}
+	if user.TotpEnabled {
+		return nil, mfaAlreadyEnabledError{}
+	}
+	if user.TotpSecret == "" {
+		return nil, mfaNotEnabledError{}
+	}
+	step, ok := validateTOTPCode(user.TotpSecret, code, time.Now())
+	if !ok {
+		return nil, invalidMFACodeError{}
+	}
+	if err = useTOTPStep(user.Id, step); err != nil {
+		return nil, err
+	}
+
+	codes, err := regenerateRecoveryCodes(user.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	var params = db.DBUserParams{TotpEnabled: true}
+	if dbErr := db.GoDB.UpdateUser(user.Id, []string{"TotpEnabled"},
+		params); dbErr != nil {
+		return nil, genericAuthenticationError{}
+	}
+
+	return codes, nil
+}
+
+// DisableTOTP disables two-factor authentication for the given user, if the
+// given TOTP or recovery code is valid. Its recovery codes are removed.
+func DisableTOTP(userId int, code string) AuthenticationError {
+	user, err := getUserFromId(userId)
+	if err != nil {
+		return err
+	}
+	if !user.TotpEnabled {
+		return mfaNotEnabledError{}
+	}
+	if err = verifyMFACode(user, code); err != nil {
+		return err
+	}
+
+	dbErr := db.GoDB.WithTx(func(gdb db.GoBanksDataBase) error {
+		var params = db.DBUserParams{TotpSecret: "", TotpEnabled: false}
+		if err := gdb.UpdateUser(user.Id,
+			[]string{"TotpSecret", "TotpEnabled"}, params); err != nil {
+			return err
+		}
+
+		var f db.DBRecoveryCodeFilters
+		f.UserId.SetFilter(user.Id)
+		return gdb.RemoveRecoveryCodes(f)
+	})
+	if dbErr != nil {
+		return genericAuthenticationError{}
+	}
+	return nil
+}
+
+// CompleteMFALogin exchanges a challenge token returned by LoginUser and a
+// valid TOTP or recovery code for the real json web token of the user.
+// A recovery code can only be used once.
+// Wrong codes count as failed login attempts (see LockoutPolicy).
+func CompleteMFALogin(challenge string, code string, ip string) (string,
+	AuthenticationError) {
+
+	userId, err := parseMFAChallengeToken(challenge)
+	if err != nil {
+		return "", err
+	}
+
+	user, err := getUserFromId(userId)
+	if err != nil {
+		return "", err
+	}
+	if !user.TotpEnabled {
+		return "", mfaNotEnabledError{}
+	}
+	if err = checkLoginThrottling(user.Name, ip); err != nil {
+		return "", err
+	}
+	if err = verifyMFACode(user, code); err != nil {
+		if _, wrongCode := err.(invalidMFACodeError); wrongCode {
+			recordLoginAttempt(user.Name, user.Id, ip, false)
+		}
+		return "", err
+	}
+
+	recordLoginAttempt(user.Name, user.Id, ip, true)
+	return createTokenForUser(user)
+}
+
+// verifyMFACode checks the given code, either as a TOTP code or as a
+// recovery code, for the given user. Both can only be used once: a matching
+// recovery code is consumed.
+func verifyMFACode(user db.DBUser, code string) AuthenticationError {
+	if step, ok := validateTOTPCode(user.TotpSecret, code, time.Now()); ok {
+		return useTOTPStep(user.Id, step)
+	}
+
+	consumed, dbErr := db.GoDB.ConsumeRecoveryCode(user.Id,
+		hashRecoveryCode(code))
+	if dbErr != nil {
+		return genericAuthenticationError{}
+	}
+	if !consumed {
+		return invalidMFACodeError{}
+	}
+	return nil
+}
+
+// useTOTPStep records the time step of a valid TOTP code of the given user,
+// so it cannot be used again. An invalidMFACodeError is returned if it is at
+// or before the last one accepted.
+func useTOTPStep(userId int, step int64) AuthenticationError {
+	used, dbErr := db.GoDB.UseTotpStep(userId, step)
+	if dbErr != nil {
+		return genericAuthenticationError{}
+	}
+	if !used {
+		return invalidMFACodeError{}
+	}
+	return nil
+}
+
+// regenerateRecoveryCodes removes every recovery codes of the given user and
+// generates recoveryCodesNumber new ones, which are returned in clear.
+func regenerateRecoveryCodes(userId int) ([]string, AuthenticationError) {
+	var codes = make([]string, 0, recoveryCodesNumber)
+	for i := 0; i < recoveryCodesNumber; i++ {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			return nil, genericAuthenticationError{}
+		}
+		codes = append(codes, code)
+	}
+
+	// the old codes are only removed if every new one could be added
+	dbErr := db.GoDB.WithTx(func(gdb db.GoBanksDataBase) error {
+		var f db.DBRecoveryCodeFilters
+		f.UserId.SetFilter(userId)
+		if err := gdb.RemoveRecoveryCodes(f); err != nil {
+			return err
+		}
+
+		for _, code := range codes {
+			var params = db.DBRecoveryCodeParams{
+				UserId:   userId,
+				CodeHash: hashRecoveryCode(code),
+			}
+			if _, err := gdb.AddRecoveryCode(params); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if dbErr != nil {
+		return nil, genericAuthenticationError{}
+	}
+	return codes, nil
+}
+
+// generateRecoveryCode generates a random recovery code.
+// example: generateRecoveryCode() => "k3x9p-2mzqa"
+func generateRecoveryCode() (string, error) {
+	var buf = make([]byte, 10)
+	if _, err := io.ReadFull(rand.Reader, buf); err != nil {
+		return "", err
+	}
+
+	var code = make([]byte, 0, 11)
+	for i, b := range buf {
+		if i == 5 {
+			code = append(code, '-')
+		}
+		code = append(code, recoveryCodeAlphabet[int(b)%len(recoveryCodeAlphabet)])
+	}
+	return string(code), nil
+}
+
+// hashRecoveryCode returns the hash under which a recovery code is stored.
+// Recovery codes are case-insensitive and surrounding spaces are ignored.
+func hashRecoveryCode(code string) string {
+	var sum = sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(code))))
+	return hex.EncodeToString(sum[:])
+}
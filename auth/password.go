@@ -0,0 +1,138 @@
+package auth
+
+import (
+	"bufio"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/bcrypt"
+
+	db "github.com/peaberberian/GoBanks/database"
+)
+
+// PasswordPolicy describes how passwords are checked and hashed.
+type PasswordPolicy struct {
+	// bcrypt cost used to hash new passwords. Passwords hashed with a lower
+	// cost are rehashed on the next successful login.
+	BcryptCost int
+
+	// Minimum number of characters of a new password
+	MinLength int
+
+	// Path to a file listing breached passwords (one per line) which cannot
+	// be used. Optional.
+	BreachedPasswordsFile string
+}
+
+// Current password policy
+var passwordPolicy = PasswordPolicy{
+	BcryptCost: bcrypt.DefaultCost,
+	MinLength:  8,
+}
+
+// Passwords read from the PasswordPolicy's BreachedPasswordsFile
+var breachedPasswords = map[string]bool{}
+
+// SetPasswordPolicy modifies the policy used to check and hash passwords.
+// Zero values keep the current setting.
+// Returns an error if the bcrypt cost is not valid or if the breached
+// passwords file could not be read.
+func SetPasswordPolicy(p PasswordPolicy) error {
+	if p.BcryptCost != 0 {
+		if p.BcryptCost < bcrypt.MinCost || p.BcryptCost > bcrypt.MaxCost {
+			return bcrypt.InvalidCostError(p.BcryptCost)
+		}
+		passwordPolicy.BcryptCost = p.BcryptCost
+	}
+	if p.MinLength > 0 {
+		passwordPolicy.MinLength = p.MinLength
+	}
+	if p.BreachedPasswordsFile != "" {
+		passwords, err := readBreachedPasswords(p.BreachedPasswordsFile)
+		if err != nil {
+			return err
+		}
+		passwordPolicy.BreachedPasswordsFile = p.BreachedPasswordsFile
+		breachedPasswords = passwords
+	}
+	return nil
+}
+
+// GetPasswordPolicy returns the current policy used to check and hash
+// passwords.
+func GetPasswordPolicy() PasswordPolicy {
+	return passwordPolicy
+}
+
+// checkPasswordPolicy returns an error if the given password cannot be used
+// as a new password.
+func checkPasswordPolicy(password string) AuthenticationError {
+	if utf8.RuneCountInString(password) < passwordPolicy.MinLength {
+		return weakPasswordError{"it should contain at least " +
+			strconv.Itoa(passwordPolicy.MinLength) + " characters"}
+	}
+	if breachedPasswords[password] ||
+		breachedPasswords[strings.ToLower(password)] {
+		return weakPasswordError{"it appears in a list of breached passwords"}
+	}
+	return nil
+}
+
+// hashPassword hashes the given password with the configured bcrypt cost.
+func hashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password),
+		passwordPolicy.BcryptCost)
+	return string(hash), err
+}
+
+// needsRehash returns true if the password of the given user has been
+// hashed with an outdated scheme (custom salt) or cost.
+func needsRehash(user db.DBUser) bool {
+	if user.Salt != "" {
+		return true
+	}
+	cost, err := bcrypt.Cost([]byte(user.PasswordHash))
+	return err != nil || cost < passwordPolicy.BcryptCost
+}
+
+// rehashPassword hashes again the password of the given user with the
+// current policy. Errors are only logged as the user is already
+// authenticated at this point.
+func rehashPassword(user db.DBUser, password string) {
+	hash, err := hashPassword(password)
+	if err != nil {
+		log.Println("could not rehash password for", user.Name, ":", err)
+		return
+	}
+
+	var params = db.DBUserParams{PasswordHash: hash, Salt: ""}
+	if err = db.GoDB.UpdateUser(user.Id, []string{"PasswordHash", "Salt"},
+		params); err != nil {
+		log.Println("could not rehash password for", user.Name, ":", err)
+	}
+}
+
+// readBreachedPasswords reads a list of passwords, one per line.
+// checkPasswordPolicy also looks for the lowercased password, so lowercase
+// lists match any casing.
+func readBreachedPasswords(path string) (map[string]bool, error) {
+	var passwords = map[string]bool{}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return passwords, err
+	}
+	defer f.Close()
+
+	var scanner = bufio.NewScanner(f)
+	for scanner.Scan() {
+		var line = strings.TrimRight(scanner.Text(), "\r")
+		if line != "" {
+			passwords[line] = true
+		}
+	}
+	return passwords, scanner.Err()
+}
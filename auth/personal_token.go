@@ -0,0 +1,171 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"time"
+
+	db "github.com/peaberberian/GoBanks/database"
+)
+
+// Prefix of every personal access token, used to differentiate them from
+// json web tokens
+const personalTokenPrefix = "gbp_"
+
+// Number of random bytes in a personal access token
+const personalTokenSize = 32
+
+// Every scope which can be granted to a personal access token
+var PersonalTokenScopes = []string{
+	"banks:read",
+	"banks:write",
+	"accounts:read",
+	"accounts:write",
+	"categories:read",
+	"categories:write",
+	"tags:read",
+	"tags:write",
+	"transactions:read",
+	"transactions:write",
+	"reports:read",
+	"shares:read",
+	"shares:write",
+}
+
+// DBPersonalToken properties returned by GetPersonalTokens
+var personal_token_fields = []string{
+	"Id",
+	"UserId",
+	"Name",
+	"Scopes",
+	"AccountIds",
+	"CreationDate",
+	"ExpirationDate",
+}
+
+// CreatePersonalToken creates a new long-lived personal access token for the
+// given user, with the given scopes (see PersonalTokenScopes).
+// If accountIds is not empty, the token only grants access to those
+// accounts. If the expiration date is zero, the token never expires.
+//
+// The token is returned in clear along with its database representation.
+// Only its hash is stored, it cannot be retrieved afterwards.
+func CreatePersonalToken(userId int, name string, scopes []string,
+	accountIds []int, expiration time.Time) (string, db.DBPersonalToken,
+	AuthenticationError) {
+
+	if len(scopes) == 0 {
+		return "", db.DBPersonalToken{}, invalidScopeError{}
+	}
+	for _, scope := range scopes {
+		if !isKnownScope(scope) {
+			return "", db.DBPersonalToken{}, invalidScopeError{scope}
+		}
+	}
+
+	var raw = make([]byte, personalTokenSize)
+	if _, err := io.ReadFull(rand.Reader, raw); err != nil {
+		return "", db.DBPersonalToken{}, genericAuthenticationError{}
+	}
+	var token = personalTokenPrefix + hex.EncodeToString(raw)
+
+	var params = db.DBPersonalTokenParams{
+		UserId:         userId,
+		Name:           name,
+		TokenHash:      hashPersonalToken(token),
+		Scopes:         scopes,
+		AccountIds:     accountIds,
+		CreationDate:   time.Now(),
+		ExpirationDate: expiration,
+	}
+	tkn, err := db.GoDB.AddPersonalToken(params)
+	if err != nil {
+		return "", db.DBPersonalToken{}, genericAuthenticationError{}
+	}
+
+	return token, tkn, nil
+}
+
+// GetPersonalTokens returns every personal access token of the given user.
+// Their hash is not returned.
+func GetPersonalTokens(userId int) ([]db.DBPersonalToken,
+	AuthenticationError) {
+
+	var f db.DBPersonalTokenFilters
+	f.UserId.SetFilter(userId)
+	tkns, err := db.GoDB.GetPersonalTokens(f, personal_token_fields, 0)
+	if err != nil {
+		return nil, genericAuthenticationError{}
+	}
+	return tkns, nil
+}
+
+// RevokePersonalToken removes the personal access token with the given id,
+// if it belongs to the given user.
+func RevokePersonalToken(userId int, tokenId int) AuthenticationError {
+	var f db.DBPersonalTokenFilters
+	f.UserId.SetFilter(userId)
+	f.Ids.SetFilter([]int{tokenId})
+
+	tkns, err := db.GoDB.GetPersonalTokens(f, []string{"Id"}, 1)
+	if err != nil {
+		return genericAuthenticationError{}
+	}
+	if len(tkns) == 0 {
+		return invalidTokenError{}
+	}
+
+	if err = db.GoDB.RemovePersonalTokens(f); err != nil {
+		return genericAuthenticationError{}
+	}
+	return nil
+}
+
+// parsePersonalToken returns the UserToken corresponding to the given
+// personal access token. Returns an error if it does not exist or has
+// expired.
+func parsePersonalToken(tokenString string) (UserToken, AuthenticationError) {
+	var f db.DBPersonalTokenFilters
+	f.TokenHashes.SetFilter([]string{hashPersonalToken(tokenString)})
+
+	tkns, err := db.GoDB.GetPersonalTokens(f, personal_token_fields, 1)
+	if err != nil {
+		return UserToken{}, genericAuthenticationError{}
+	}
+	if len(tkns) == 0 {
+		return UserToken{}, invalidTokenError{}
+	}
+
+	var tkn = tkns[0]
+	if !tkn.ExpirationDate.IsZero() && !tkn.ExpirationDate.After(time.Now()) {
+		return UserToken{}, expiredTokenError{}
+	}
+
+	return UserToken{
+		UserId:          tkn.UserId,
+		ExpirationDate:  tkn.ExpirationDate,
+		IsPersonalToken: true,
+		Scopes:          tkn.Scopes,
+		AccountIds:      tkn.AccountIds,
+	}, nil
+}
+
+// hashPersonalToken returns the hash under which a personal access token is
+// stored.
+// Tokens are long random strings, a fast hash is thus sufficient.
+func hashPersonalToken(token string) string {
+	var sum = sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// isKnownScope returns true if the given scope is in PersonalTokenScopes.
+func isKnownScope(scope string) bool {
+	for _, s := range PersonalTokenScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -1,21 +1,58 @@
 package auth
 
 import "fmt"
+import "strings"
 import "time"
 
 import jwt "github.com/dgrijalva/jwt-go"
 
+import db "github.com/peaberberian/GoBanks/database"
+
 // Duration of a token lifetime.
 var jwtExpiration int = 1
 
+// Duration of the lifetime of a two-factor challenge token.
+const MFAChallengeExpiration = 5 * time.Minute
+
 // Signing key used for JSON Web Tokens
 var tokenSigningKey string
 
-// Representation of the principal attributes of our json web token
+// Representation of the principal attributes of our json web token, or of
+// a personal access token
 type UserToken struct {
 	ExpirationDate  time.Time
 	UserId          int
 	IsAdministrator bool
+
+	// true if the user authenticated through a personal access token
+	IsPersonalToken bool
+
+	// Scopes granted to a personal access token. Unused for json web tokens,
+	// which have every right.
+	Scopes []string
+
+	// Accounts a personal access token is restricted to, empty if none
+	AccountIds []int
+}
+
+// HasScope returns true if the token grants the given scope.
+// Json web tokens grant every scope.
+func (t UserToken) HasScope(scope string) bool {
+	if !t.IsPersonalToken {
+		return true
+	}
+	for _, s := range t.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// IsRestricted returns true if the token only grants access to some
+// accounts of the user.
+func (t UserToken) IsRestricted() bool {
+	return len(t.AccountIds) > 0
 }
 
 // SetTokenExpiration modifies the duration of a token's lifetime.
@@ -31,12 +68,17 @@ func GetTokenExpiration() int {
 
 // ParseToken takes in argument the token string and returns an easily
 // readable UserToken struct which repeats most of the token properties.
+// Both json web tokens and personal access tokens are accepted.
 // Returns an error if the token is invalid
 func ParseToken(tokenString string) (UserToken, AuthenticationError) {
 	if tokenString == "" {
 		return UserToken{}, noTokenError{}
 	}
 
+	if strings.HasPrefix(tokenString, personalTokenPrefix) {
+		return parsePersonalToken(tokenString)
+	}
+
 	jwToken, err := jwt.Parse(tokenString,
 		func(token *jwt.Token) (interface{}, error) {
 			return []byte(tokenSigningKey), nil
@@ -64,6 +106,11 @@ func ParseToken(tokenString string) (UserToken, AuthenticationError) {
 
 	var claims = jwToken.Claims.(jwt.MapClaims)
 
+	// two-factor challenge tokens are not valid access tokens
+	if _, isChallenge := claims["mfa"]; isChallenge {
+		return UserToken{}, invalidTokenError{}
+	}
+
 	if userId64, ok := claims["uid"].(float64); !ok {
 		return createUnreadableError("uid")
 	} else {
@@ -95,17 +142,22 @@ func ParseToken(tokenString string) (UserToken, AuthenticationError) {
 // Returns an error if a problem with the databases was encountered or if
 // the signing key is not secure enough.
 func createToken(username string) (string, AuthenticationError) {
-	if tokenSigningKey == "" {
-		return "", invalidSigningKeyError{}
-	}
-
 	user, err := getUserFromUsername(username)
 	if err != nil {
 		return "", err
 	}
+	return createTokenForUser(user)
+}
+
+// createTokenForUser creates a new token string for the given db.DBUser.
+// Returns an error if the signing key is not secure enough.
+func createTokenForUser(user db.DBUser) (string, AuthenticationError) {
+	if tokenSigningKey == "" {
+		return "", invalidSigningKeyError{}
+	}
 
 	var dur = time.Hour * time.Duration(GetTokenExpiration())
-	var expirationDate = time.Now().Add(dur).UnixNano() / 1e6
+	var expirationDate = time.Now().Add(dur).Unix()
 	var userId = user.Id
 	var isAdmin = user.Administrator
 
@@ -122,6 +174,66 @@ func createToken(username string) (string, AuthenticationError) {
 	return tokenString, nil
 }
 
+// createMFAChallengeToken creates a short-lived token proving that the given
+// user already gave the right password. It has to be exchanged, with a valid
+// two-factor code, for a real token (see CompleteMFALogin).
+func createMFAChallengeToken(user db.DBUser) (string, AuthenticationError) {
+	if tokenSigningKey == "" {
+		return "", invalidSigningKeyError{}
+	}
+
+	jwToken := jwt.New(jwt.SigningMethodHS256)
+	claims := jwToken.Claims.(jwt.MapClaims)
+	claims["exp"] = time.Now().Add(MFAChallengeExpiration).Unix()
+	claims["uid"] = user.Id
+	claims["mfa"] = true
+	tokenString, serr := jwToken.SignedString([]byte(tokenSigningKey))
+	if serr != nil {
+		return "", tokenSigningError{}
+	}
+
+	return tokenString, nil
+}
+
+// parseMFAChallengeToken checks a token created through
+// createMFAChallengeToken and returns the user id it was created for.
+func parseMFAChallengeToken(tokenString string) (int, AuthenticationError) {
+	if tokenString == "" {
+		return 0, noTokenError{}
+	}
+
+	jwToken, err := jwt.Parse(tokenString,
+		func(token *jwt.Token) (interface{}, error) {
+			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+				return nil, fmt.Errorf("unexpected signing method")
+			}
+			return []byte(tokenSigningKey), nil
+		})
+	if err != nil || !jwToken.Valid {
+		return 0, invalidTokenError{}
+	}
+
+	var claims = jwToken.Claims.(jwt.MapClaims)
+	if isChallenge, ok := claims["mfa"].(bool); !ok || !isChallenge {
+		return 0, invalidTokenError{}
+	}
+
+	userId64, ok := claims["uid"].(float64)
+	if !ok {
+		return 0, unreadableTokenError{"uid"}
+	}
+
+	exp64, ok := claims["exp"].(float64)
+	if !ok {
+		return 0, unreadableTokenError{"exp"}
+	}
+	if int64(exp64) <= time.Now().Unix() {
+		return 0, expiredTokenError{}
+	}
+
+	return int(userId64), nil
+}
+
 // TODO put back like it was
 // This is done right now for faster tests
 func generateSigningKey() error {
@@ -0,0 +1,107 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Issuer displayed by authenticator applications
+const totpIssuer = "GoBanks"
+
+// Duration of a single TOTP time step, in seconds (RFC 6238 default)
+const totpPeriod = 30
+
+// Number of digits of a TOTP code
+const totpDigits = 6
+
+// Number of time steps accepted before and after the current one, to
+// compensate for clock drifts between the server and the user's device.
+const totpSkew = 1
+
+// Size, in bytes, of a generated TOTP secret (RFC 4226 recommends 160 bits)
+const totpSecretSize = 20
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// generateTOTPSecret generates a new random base32-encoded TOTP secret.
+func generateTOTPSecret() (string, error) {
+	var secret = make([]byte, totpSecretSize)
+	if _, err := io.ReadFull(rand.Reader, secret); err != nil {
+		return "", err
+	}
+	return totpEncoding.EncodeToString(secret), nil
+}
+
+// totpURI constructs the otpauth URI for the given user and secret, which
+// can be displayed as a QR code to be scanned by authenticator applications.
+// example: totpURI("toto", "ABC") =>
+// "otpauth://totp/GoBanks:toto?secret=ABC&issuer=GoBanks&..."
+func totpURI(username string, secret string) string {
+	var values = url.Values{}
+	values.Set("secret", secret)
+	values.Set("issuer", totpIssuer)
+	values.Set("algorithm", "SHA1")
+	values.Set("digits", fmt.Sprintf("%d", totpDigits))
+	values.Set("period", fmt.Sprintf("%d", totpPeriod))
+
+	var label = url.PathEscape(totpIssuer + ":" + username)
+	return "otpauth://totp/" + label + "?" + values.Encode()
+}
+
+// hotpCode computes the RFC 4226 HOTP code for the given base32 secret and
+// counter.
+func hotpCode(secret string, counter uint64) (string, error) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", err
+	}
+
+	var msg = make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, counter)
+
+	var mac = hmac.New(sha1.New, key)
+	mac.Write(msg)
+	var sum = mac.Sum(nil)
+
+	// dynamic truncation
+	var offset = sum[len(sum)-1] & 0xf
+	var bin = binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	var mod uint32 = 1
+	for i := 0; i < totpDigits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", totpDigits, bin%mod), nil
+}
+
+// validateTOTPCode returns true if the given code is valid for the given
+// secret at the given time, with a tolerance of totpSkew time steps. The
+// time step matched is also returned, as a code can only be used once (see
+// useTOTPStep).
+func validateTOTPCode(secret string, code string, t time.Time) (int64, bool) {
+	code = strings.TrimSpace(code)
+	if len(code) != totpDigits {
+		return 0, false
+	}
+
+	var counter = t.Unix() / totpPeriod
+	for i := int64(-totpSkew); i <= totpSkew; i++ {
+		expected, err := hotpCode(secret, uint64(counter+i))
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return counter + i, true
+		}
+	}
+	return 0, false
+}
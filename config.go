@@ -5,6 +5,9 @@ import "os"
 
 const config_file_path = "./config/config.json"
 
+// directory of the attached files if not set in the config file
+const default_attachments_path = "./attachments"
+
 // Exact structure of the config.json file
 type configFile struct {
 	// Databases map[string]interface{} `json:"databases"`
@@ -13,6 +16,43 @@ type configFile struct {
 	ServerPort      int         `json:"port"`
 	CertPath        string      `json:"certificate"`
 	KeyPath         string      `json:"key"`
+	LoginProtection struct {
+		MaxAttempts     int `json:"maxAttempts"`
+		MaxIpAttempts   int `json:"maxIpAttempts"`
+		BaseDelay       int `json:"baseDelay"`       // in seconds
+		LockoutDuration int `json:"lockoutDuration"` // in seconds
+		Window          int `json:"window"`          // in seconds
+	} `json:"loginProtection"`
+	Password struct {
+		BcryptCost            int    `json:"bcryptCost"`
+		MinLength             int    `json:"minLength"`
+		BreachedPasswordsFile string `json:"breachedPasswordsFile"`
+	} `json:"password"`
+	Cache struct {
+		TTL               int `json:"ttl"` // in seconds, 0 disables the cache
+		MaxUsers          int `json:"maxUsers"`
+		MaxEntriesPerUser int `json:"maxEntriesPerUser"`
+	} `json:"cache"`
+	Events struct {
+		BufferSize int `json:"bufferSize"` // events kept for resuming
+	} `json:"events"`
+	Export struct {
+		DecimalSeparator string `json:"decimalSeparator"`
+		DateFormat       string `json:"dateFormat"` // Go time layout
+		CsvSeparator     string `json:"csvSeparator"`
+	} `json:"export"`
+	Alerts struct {
+		EvaluationInterval int `json:"evaluationInterval"` // in seconds
+		Smtp               struct {
+			Address string `json:"address"` // "host:port", no e-mails if empty
+			From    string `json:"from"`
+		} `json:"smtp"`
+	} `json:"alerts"`
+	Attachments struct {
+		StoragePath string   `json:"storagePath"`
+		MaxSize     int64    `json:"maxSize"` // in bytes
+		MimeTypes   []string `json:"mimeTypes"`
+	} `json:"attachments"`
 }
 
 // getConfig parse the config file. See config_file_path.
@@ -0,0 +1,417 @@
+package database
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Configuration of the cache created by NewCachedDataBase
+type CacheConfig struct {
+	// Time during which a result stays in the cache
+	TTL time.Duration
+
+	// Maximum number of users whose results are cached. The least recently
+	// used user is removed from the cache when exceeded. 0 = no limit
+	MaxUsers int
+
+	// Maximum number of results cached for a single user. The least recently
+	// used result is removed when exceeded. 0 = no limit
+	MaxEntriesPerUser int
+}
+
+// Statistics about the use of the cache created by NewCachedDataBase
+type CacheStats struct {
+	Hits          uint64 // results read from the cache
+	Misses        uint64 // results read from the database and cached
+	Evictions     uint64 // results removed because of the size limits
+	Invalidations uint64 // results removed after a modification
+	Users         int    // users currently having results in the cache
+	Entries       int    // results currently in the cache
+}
+
+// cachedDataBase is the GoBanksDataBase returned by NewCachedDataBase.
+// Every method not redefined here directly calls the wrapped database.
+type cachedDataBase struct {
+	GoBanksDataBase
+
+	cache *resultCache
+
+	// user the results are cached for (see CachedForUser). Nothing is
+	// cached if 0.
+	userId int
+}
+
+// resultCache stores the results read from the database for each user.
+type resultCache struct {
+	config CacheConfig
+	mutex  sync.Mutex
+	users  map[int]*userCache
+	stats  CacheStats
+
+	// incremented on every invalidation, so that results read from the
+	// database before it are not cached after
+	generation uint64
+}
+
+// userCache contains the results cached for a single user, by key (see
+// cacheKey).
+type userCache struct {
+	entries map[string]*cacheEntry
+	lastUse time.Time
+}
+
+type cacheEntry struct {
+	value   interface{}
+	expires time.Time
+	lastUse time.Time
+}
+
+// NewCachedDataBase wraps the given database in a cache for banks, accounts
+// and categories, which are read on almost every request but rarely
+// modified.
+//
+// Results are only cached for the views returned by CachedForUser, one per
+// user. They are removed from the cache:
+//   - after the configured TTL
+//   - when the size limits of the configuration are exceeded
+//   - when a category of the same user is added, updated or removed
+//   - for every user when a bank, account or share is added, updated or
+//     removed, as they can concern multiple users
+//   - for every user after a transaction is committed through WithTx
+func NewCachedDataBase(db GoBanksDataBase,
+	config CacheConfig) GoBanksDataBase {
+
+	return &cachedDataBase{
+		GoBanksDataBase: db,
+		cache: &resultCache{
+			config: config,
+			users:  map[int]*userCache{},
+		},
+	}
+}
+
+// CachedForUser returns a view of the given database caching its results
+// for the given user (see NewCachedDataBase). The database is returned as
+// is if it was not created by NewCachedDataBase.
+func CachedForUser(db GoBanksDataBase, userId int) GoBanksDataBase {
+	if cdb, ok := db.(*cachedDataBase); ok {
+		return &cachedDataBase{GoBanksDataBase: cdb.GoBanksDataBase,
+			cache: cdb.cache, userId: userId}
+	}
+	return db
+}
+
+// GetCacheStats returns the statistics of the given database's cache. The
+// returned boolean is false if it was not created by NewCachedDataBase.
+func GetCacheStats(db GoBanksDataBase) (CacheStats, bool) {
+	if cdb, ok := db.(*cachedDataBase); ok {
+		return cdb.cache.getStats(), true
+	}
+	return CacheStats{}, false
+}
+
+func (cdb *cachedDataBase) WithTx(fn func(GoBanksDataBase) error) error {
+	// what was modified in the transaction is not known
+	var err = cdb.GoBanksDataBase.WithTx(fn)
+	if err == nil {
+		cdb.cache.invalidate(0)
+	}
+	return err
+}
+
+func (cdb *cachedDataBase) GetBanks(f DBBankFilters, fields []string,
+	limit uint) ([]DBBank, error) {
+
+	var key = cacheKey("GetBanks", f, fields, limit)
+	val, gen, ok := cdb.cache.get(cdb.userId, key)
+	if ok {
+		return append([]DBBank(nil), val.([]DBBank)...), nil
+	}
+	bnks, err := cdb.GoBanksDataBase.GetBanks(f, fields, limit)
+	if err == nil {
+		cdb.cache.set(cdb.userId, key, gen,
+			append([]DBBank(nil), bnks...))
+	}
+	return bnks, err
+}
+
+func (cdb *cachedDataBase) CountBanks(f DBBankFilters) (int, error) {
+	var key = cacheKey("CountBanks", f)
+	val, gen, ok := cdb.cache.get(cdb.userId, key)
+	if ok {
+		return val.(int), nil
+	}
+	count, err := cdb.GoBanksDataBase.CountBanks(f)
+	if err == nil {
+		cdb.cache.set(cdb.userId, key, gen, count)
+	}
+	return count, err
+}
+
+func (cdb *cachedDataBase) AddBank(bnk DBBankParams) (DBBank, error) {
+	defer cdb.cache.invalidate(0)
+	return cdb.GoBanksDataBase.AddBank(bnk)
+}
+
+func (cdb *cachedDataBase) UpdateBanks(f DBBankFilters, fields []string,
+	bnk DBBankParams) error {
+	defer cdb.cache.invalidate(0)
+	return cdb.GoBanksDataBase.UpdateBanks(f, fields, bnk)
+}
+
+func (cdb *cachedDataBase) RemoveBanks(f DBBankFilters) error {
+	defer cdb.cache.invalidate(0)
+	return cdb.GoBanksDataBase.RemoveBanks(f)
+}
+
+func (cdb *cachedDataBase) GetAccounts(f DBAccountFilters, fields []string,
+	limit uint) ([]DBAccount, error) {
+
+	var key = cacheKey("GetAccounts", f, fields, limit)
+	val, gen, ok := cdb.cache.get(cdb.userId, key)
+	if ok {
+		return append([]DBAccount(nil), val.([]DBAccount)...), nil
+	}
+	accs, err := cdb.GoBanksDataBase.GetAccounts(f, fields, limit)
+	if err == nil {
+		cdb.cache.set(cdb.userId, key, gen,
+			append([]DBAccount(nil), accs...))
+	}
+	return accs, err
+}
+
+func (cdb *cachedDataBase) CountAccounts(f DBAccountFilters) (int, error) {
+	var key = cacheKey("CountAccounts", f)
+	val, gen, ok := cdb.cache.get(cdb.userId, key)
+	if ok {
+		return val.(int), nil
+	}
+	count, err := cdb.GoBanksDataBase.CountAccounts(f)
+	if err == nil {
+		cdb.cache.set(cdb.userId, key, gen, count)
+	}
+	return count, err
+}
+
+func (cdb *cachedDataBase) AddAccount(acc DBAccountParams) (DBAccount, error) {
+	defer cdb.cache.invalidate(0)
+	return cdb.GoBanksDataBase.AddAccount(acc)
+}
+
+func (cdb *cachedDataBase) UpdateAccounts(f DBAccountFilters, fields []string,
+	acc DBAccountParams) error {
+	defer cdb.cache.invalidate(0)
+	return cdb.GoBanksDataBase.UpdateAccounts(f, fields, acc)
+}
+
+func (cdb *cachedDataBase) RemoveAccounts(f DBAccountFilters) error {
+	defer cdb.cache.invalidate(0)
+	return cdb.GoBanksDataBase.RemoveAccounts(f)
+}
+
+func (cdb *cachedDataBase) GetCategories(f DBCategoryFilters,
+	fields []string, limit uint) ([]DBCategory, error) {
+
+	var key = cacheKey("GetCategories", f, fields, limit)
+	val, gen, ok := cdb.cache.get(cdb.userId, key)
+	if ok {
+		return append([]DBCategory(nil), val.([]DBCategory)...), nil
+	}
+	ctgs, err := cdb.GoBanksDataBase.GetCategories(f, fields, limit)
+	if err == nil {
+		cdb.cache.set(cdb.userId, key, gen,
+			append([]DBCategory(nil), ctgs...))
+	}
+	return ctgs, err
+}
+
+func (cdb *cachedDataBase) CountCategories(f DBCategoryFilters) (int,
+	error) {
+
+	var key = cacheKey("CountCategories", f)
+	val, gen, ok := cdb.cache.get(cdb.userId, key)
+	if ok {
+		return val.(int), nil
+	}
+	count, err := cdb.GoBanksDataBase.CountCategories(f)
+	if err == nil {
+		cdb.cache.set(cdb.userId, key, gen, count)
+	}
+	return count, err
+}
+
+// categories are never shared: only the results of the current user are
+// removed
+func (cdb *cachedDataBase) AddCategory(ctg DBCategoryParams) (DBCategory,
+	error) {
+	defer cdb.cache.invalidate(cdb.userId)
+	return cdb.GoBanksDataBase.AddCategory(ctg)
+}
+
+func (cdb *cachedDataBase) UpdateCategories(f DBCategoryFilters,
+	fields []string, ctg DBCategoryParams) error {
+	defer cdb.cache.invalidate(cdb.userId)
+	return cdb.GoBanksDataBase.UpdateCategories(f, fields, ctg)
+}
+
+func (cdb *cachedDataBase) RemoveCategories(f DBCategoryFilters) error {
+	defer cdb.cache.invalidate(cdb.userId)
+	return cdb.GoBanksDataBase.RemoveCategories(f)
+}
+
+// shares change which banks and accounts users can see
+func (cdb *cachedDataBase) AddShare(shr DBShareParams) (DBShare, error) {
+	defer cdb.cache.invalidate(0)
+	return cdb.GoBanksDataBase.AddShare(shr)
+}
+
+func (cdb *cachedDataBase) UpdateShares(f DBShareFilters, fields []string,
+	shr DBShareParams) error {
+	defer cdb.cache.invalidate(0)
+	return cdb.GoBanksDataBase.UpdateShares(f, fields, shr)
+}
+
+func (cdb *cachedDataBase) RemoveShares(f DBShareFilters) error {
+	defer cdb.cache.invalidate(0)
+	return cdb.GoBanksDataBase.RemoveShares(f)
+}
+
+// cacheKey returns the key of a method's result in the cache of an user,
+// from the method name and its arguments.
+// example: cacheKey("CountBanks", f) =>
+// "CountBanks []interface {}{database.DBBankFilters{...}}"
+func cacheKey(method string, args ...interface{}) string {
+	return method + fmt.Sprintf(" %#v", args)
+}
+
+// get returns the value cached for the given user and key. The returned
+// boolean is false if there is none (nothing is cached for user 0). The
+// current generation of the cache, needed to then set the value, is also
+// returned.
+func (rc *resultCache) get(userId int, key string) (interface{}, uint64,
+	bool) {
+
+	if userId == 0 {
+		return nil, 0, false
+	}
+
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+
+	var now = time.Now()
+	if uc, ok := rc.users[userId]; ok {
+		if entry, ok := uc.entries[key]; ok && now.Before(entry.expires) {
+			entry.lastUse = now
+			uc.lastUse = now
+			rc.stats.Hits++
+			return entry.value, rc.generation, true
+		}
+	}
+	rc.stats.Misses++
+	return nil, rc.generation, false
+}
+
+// set caches a value for the given user and key, removing the least
+// recently used users and entries if the size limits are exceeded.
+// Nothing is done if the cache was invalidated since the given generation
+// (see get).
+func (rc *resultCache) set(userId int, key string, generation uint64,
+	value interface{}) {
+
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+
+	if userId == 0 || generation != rc.generation {
+		return
+	}
+
+	var now = time.Now()
+	var uc, ok = rc.users[userId]
+	if !ok {
+		if rc.config.MaxUsers > 0 && len(rc.users) >= rc.config.MaxUsers {
+			rc.evictUser()
+		}
+		uc = &userCache{entries: map[string]*cacheEntry{}}
+		rc.users[userId] = uc
+	}
+	uc.lastUse = now
+
+	if _, ok := uc.entries[key]; !ok && rc.config.MaxEntriesPerUser > 0 &&
+		len(uc.entries) >= rc.config.MaxEntriesPerUser {
+		rc.evictEntry(uc, now)
+	}
+	uc.entries[key] = &cacheEntry{value: value,
+		expires: now.Add(rc.config.TTL), lastUse: now}
+}
+
+// evictUser removes the results of the least recently used user.
+// The mutex has to be locked.
+func (rc *resultCache) evictUser() {
+	var oldest *userCache
+	var oldestId int
+	for id, uc := range rc.users {
+		if oldest == nil || uc.lastUse.Before(oldest.lastUse) {
+			oldest, oldestId = uc, id
+		}
+	}
+	if oldest != nil {
+		rc.stats.Evictions += uint64(len(oldest.entries))
+		delete(rc.users, oldestId)
+	}
+}
+
+// evictEntry removes an expired entry of the given user's cache, or the
+// least recently used one if none expired.
+// The mutex has to be locked.
+func (rc *resultCache) evictEntry(uc *userCache, now time.Time) {
+	var oldest *cacheEntry
+	var oldestKey string
+	for key, entry := range uc.entries {
+		if !now.Before(entry.expires) {
+			oldest, oldestKey = entry, key
+			break
+		}
+		if oldest == nil || entry.lastUse.Before(oldest.lastUse) {
+			oldest, oldestKey = entry, key
+		}
+	}
+	if oldest != nil {
+		rc.stats.Evictions++
+		delete(uc.entries, oldestKey)
+	}
+}
+
+// invalidate removes every result cached for the given user, or for every
+// user if 0.
+func (rc *resultCache) invalidate(userId int) {
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+
+	rc.generation++
+	if userId != 0 {
+		if uc, ok := rc.users[userId]; ok {
+			rc.stats.Invalidations += uint64(len(uc.entries))
+			delete(rc.users, userId)
+		}
+		return
+	}
+
+	for _, uc := range rc.users {
+		rc.stats.Invalidations += uint64(len(uc.entries))
+	}
+	rc.users = map[int]*userCache{}
+}
+
+// getStats returns the current statistics of the cache.
+func (rc *resultCache) getStats() CacheStats {
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+
+	var stats = rc.stats
+	stats.Users = len(rc.users)
+	for _, uc := range rc.users {
+		stats.Entries += len(uc.entries)
+	}
+	return stats
+}
@@ -2,6 +2,10 @@ package database
 
 var GoDB GoBanksDataBase
 
+// Bus on which the modifications of the data are published, nil if they are
+// not (see NewPublishingDataBase)
+var GoEvents *EventBus
+
 // Connect connect to the chosen database.
 // This is needed to then be able to use the exported GoDB afterwards.
 //
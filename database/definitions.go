@@ -21,6 +21,11 @@ type UserDataBase interface {
 	// Get a single user based on filters.
 	// The second param is the wanted field
 	GetUser(DBUserFilters, []string) (DBUser, error)
+
+	// Record the given TOTP time step (second param) as the last one
+	// accepted for the given user, if it follows the previous one. Returns
+	// false else: the code was already used.
+	UseTotpStep(int, int64) (bool, error)
 }
 
 // Perform operations on the DataBase relative to Categories
@@ -39,6 +44,60 @@ type CategoryDataBase interface {
 	// The second param is  the wanted fields TODO Remove?
 	// The third is the max number of item you wish to receive (0 = no limit)
 	GetCategories(DBCategoryFilters, []string, uint) ([]DBCategory, error)
+
+	// Count the categories corresponding to the given filters, regardless of
+	// their After filter.
+	CountCategories(DBCategoryFilters) (int, error)
+}
+
+// Perform operations on the DataBase relative to tags and the transactions
+// they are set on
+type TagDataBase interface {
+	// Add a single tag
+	AddTag(DBTagParams) (DBTag, error)
+
+	// Update the attributes of multiple tags, based on filters and field
+	// names.
+	UpdateTags(DBTagFilters, []string, DBTagParams) error
+
+	// Remove multiple tags, based on filters. They are removed from their
+	// transactions.
+	RemoveTags(DBTagFilters) error
+
+	// Get multiple tags, based on filters
+	// The second param is  the wanted fields
+	// The third is the max number of item you wish to receive (0 = no limit)
+	GetTags(DBTagFilters, []string, uint) ([]DBTag, error)
+
+	// Set each of the given tags (second param) on each of the given
+	// transactions (first param). Tags already set are ignored.
+	AddTransactionTags([]int, []int) error
+
+	// Remove tags from transactions, based on filters
+	RemoveTransactionTags(DBTransactionTagFilters) error
+
+	// Get the tags set on transactions, based on filters
+	GetTransactionTags(DBTransactionTagFilters) ([]DBTransactionTag, error)
+}
+
+// Perform operations on the DataBase relative to the files attached to
+// transactions. Only their metadata are stored here, their content being in
+// a storage.Storage.
+type AttachmentDataBase interface {
+	// Add a single attachment
+	AddAttachment(DBAttachmentParams) (DBAttachment, error)
+
+	// Remove multiple attachments, based on filters
+	RemoveAttachments(DBAttachmentFilters) error
+
+	// Get multiple attachments, based on filters
+	// The second param is  the wanted fields
+	// The third is the max number of item you wish to receive (0 = no limit)
+	GetAttachments(DBAttachmentFilters, []string, uint) ([]DBAttachment, error)
+
+	// Get the hashes of the files attached to the transactions
+	// corresponding to the given filters, each hash once
+	GetTransactionAttachmentHashes(DBTransactionFilters) ([]string, error)
 }
 
 // Perform operations on the DataBase relative to Bank Accounts
@@ -57,6 +116,10 @@ type BankAccountDataBase interface {
 	// The second param is  the wanted fields TODO Remove?
 	// The third is the max number of item you wish to receive (0 = no limit)
 	GetAccounts(DBAccountFilters, []string, uint) ([]DBAccount, error)
+
+	// Count the accounts corresponding to the given filters, regardless of
+	// their After filter.
+	CountAccounts(DBAccountFilters) (int, error)
 }
 
 // Perform operations on the DataBase relative to Bank Accounts
@@ -74,6 +137,10 @@ type BankDatabase interface {
 	// The second param is  the wanted fields TODO Remove?
 	// The third is the max number of item you wish to receive (0 = no limit)
 	GetBanks(DBBankFilters, []string, uint) ([]DBBank, error)
+
+	// Count the banks corresponding to the given filters, regardless of
+	// their After filter.
+	CountBanks(DBBankFilters) (int, error)
 }
 
 // Perform operations on the DataBase relative to Transactions
@@ -93,6 +160,20 @@ type TransactionDataBase interface {
 	// The third is the max number of item you wish to receive (0 = no limit)
 	GetTransactions(DBTransactionFilters, []string, uint) ([]DBTransaction, error)
 
+	// Call the given function with each transaction corresponding to the
+	// filters, read one at a time instead of all being loaded in memory.
+	// Stops at the first error returned by the function, which is returned.
+	// The database should not be used by the function: in a transaction,
+	// the rows being read still hold the connection.
+	// The second param is  the wanted fields
+	// The third is the max number of item you wish to receive (0 = no limit)
+	ForEachTransaction(DBTransactionFilters, []string, uint,
+		func(DBTransaction) error) error
+
+	// Count the transactions corresponding to the given filters, regardless
+	// of their After filter.
+	CountTransactions(DBTransactionFilters) (int, error)
+
 	// Get the sum of all debits for the given filters
 	// GetDebit(DBTransactionFilters)
 
@@ -100,17 +181,171 @@ type TransactionDataBase interface {
 	// GetCredit(DBTransactionFilters)
 
 	// Get Report for the given filters (debit and credit)
-	// GetReport(DBTransactionFilters)
+	GetReport(DBTransactionFilters) (DBReport, error)
+
+	// Get a Report for each of the given tags (second param), by tag id,
+	// on the transactions corresponding to the given filters having this
+	// tag. Tags set on no such transaction are not returned.
+	GetTagReports(DBTransactionFilters, []int) (map[int]DBReport, error)
+}
+
+// Perform operations on the DataBase relative to two-factor authentication
+// recovery codes
+type RecoveryCodeDataBase interface {
+	// Add a single recovery code
+	AddRecoveryCode(DBRecoveryCodeParams) (DBRecoveryCode, error)
+
+	// Remove multiple recovery codes, based on filters
+	RemoveRecoveryCodes(DBRecoveryCodeFilters) error
+
+	// Remove the recovery code of the given user with the given hash.
+	// Returns false if there was none: the code was not valid or was
+	// already used.
+	ConsumeRecoveryCode(int, string) (bool, error)
+
+	// Get multiple recovery codes, based on filters
+	// The second param is  the wanted fields
+	// The third is the max number of item you wish to receive (0 = no limit)
+	GetRecoveryCodes(DBRecoveryCodeFilters, []string, uint) ([]DBRecoveryCode,
+		error)
+}
+
+// Perform operations on the DataBase relative to login attempts
+type LoginAttemptDataBase interface {
+	// Add a single login attempt
+	AddLoginAttempt(DBLoginAttemptParams) (DBLoginAttempt, error)
+
+	// Remove multiple login attempts, based on filters
+	RemoveLoginAttempts(DBLoginAttemptFilters) error
+
+	// Get multiple login attempts, based on filters
+	// The second param is  the wanted fields
+	// The third is the max number of item you wish to receive (0 = no limit)
+	GetLoginAttempts(DBLoginAttemptFilters, []string, uint) ([]DBLoginAttempt,
+		error)
+}
+
+// Perform operations on the DataBase relative to banks and accounts shared
+// with other users
+type ShareDataBase interface {
+	// Add a single share
+	AddShare(DBShareParams) (DBShare, error)
+
+	// Update the attributes of multiple shares, based on filters and field
+	// names.
+	UpdateShares(DBShareFilters, []string, DBShareParams) error
+
+	// Remove multiple shares, based on filters
+	RemoveShares(DBShareFilters) error
+
+	// Get multiple shares, based on filters
+	// The second param is  the wanted fields
+	// The third is the max number of item you wish to receive (0 = no limit)
+	GetShares(DBShareFilters, []string, uint) ([]DBShare, error)
+}
+
+// Perform operations on the DataBase relative to personal access tokens
+type PersonalTokenDataBase interface {
+	// Add a single personal access token
+	AddPersonalToken(DBPersonalTokenParams) (DBPersonalToken, error)
+
+	// Remove multiple personal access tokens, based on filters
+	RemovePersonalTokens(DBPersonalTokenFilters) error
+
+	// Get multiple personal access tokens, based on filters
+	// The second param is  the wanted fields
+	// The third is the max number of item you wish to receive (0 = no limit)
+	GetPersonalTokens(DBPersonalTokenFilters, []string, uint) (
+		[]DBPersonalToken, error)
+}
+
+// Perform operations on the DataBase relative to webhooks and their
+// deliveries
+type WebhookDataBase interface {
+	// Add a single webhook
+	AddWebhook(DBWebhookParams) (DBWebhook, error)
+
+	// Remove multiple webhooks, based on filters
+	RemoveWebhooks(DBWebhookFilters) error
+
+	// Get multiple webhooks, based on filters
+	// The second param is  the wanted fields
+	// The third is the max number of item you wish to receive (0 = no limit)
+	GetWebhooks(DBWebhookFilters, []string, uint) ([]DBWebhook, error)
+
+	// Add a single delivery to the queue of a webhook
+	AddWebhookDelivery(DBWebhookDeliveryParams) (DBWebhookDelivery, error)
+
+	// Update the attributes of multiple deliveries, based on filters and
+	// field names.
+	UpdateWebhookDeliveries(DBWebhookDeliveryFilters, []string,
+		DBWebhookDeliveryParams) error
+
+	// Remove multiple deliveries, based on filters
+	RemoveWebhookDeliveries(DBWebhookDeliveryFilters) error
+
+	// Get multiple deliveries, based on filters
+	// The second param is  the wanted fields
+	// The third is the max number of item you wish to receive (0 = no limit)
+	GetWebhookDeliveries(DBWebhookDeliveryFilters, []string, uint) (
+		[]DBWebhookDelivery, error)
+}
+
+// Perform operations on the DataBase relative to alert rules and the alerts
+// they fired
+type AlertDataBase interface {
+	// Add a single alert rule
+	AddAlertRule(DBAlertRuleParams) (DBAlertRule, error)
+
+	// Remove multiple alert rules, based on filters
+	RemoveAlertRules(DBAlertRuleFilters) error
+
+	// Get multiple alert rules, based on filters
+	// The second param is  the wanted fields
+	// The third is the max number of item you wish to receive (0 = no limit)
+	GetAlertRules(DBAlertRuleFilters, []string, uint) ([]DBAlertRule, error)
+
+	// Add a single fired alert
+	AddAlert(DBAlertParams) (DBAlert, error)
+
+	// Remove multiple alerts, based on filters
+	RemoveAlerts(DBAlertFilters) error
+
+	// Get multiple alerts, based on filters
+	// The second param is  the wanted fields
+	// The third is the max number of item you wish to receive (0 = no limit)
+	GetAlerts(DBAlertFilters, []string, uint) ([]DBAlert, error)
 }
 
 // Interface GoBanks databases must implement
+//
+// Banks, accounts, categories, transactions and shares have a Version,
+// incremented each time they are updated. When their Versions filter is
+// set, updating or removing them returns an error with the
+// VersionMismatchErrorCode if no element has one of these versions anymore.
 type GoBanksDataBase interface {
 	Close() error // Free/close the db if needed
+
+	// Call the given function with a database performing every operation in
+	// a single transaction: they are all committed if it returns nil, and
+	// all rolled back otherwise. Its error is then returned.
+	// Calling WithTx on the database given to the function nests a new
+	// transaction: only its own operations are rolled back on failure.
+	WithTx(func(GoBanksDataBase) error) error
+
 	UserDataBase
+	RecoveryCodeDataBase
+	LoginAttemptDataBase
+	PersonalTokenDataBase
+	WebhookDataBase
+	AlertDataBase
 	CategoryDataBase
+	TagDataBase
+	AttachmentDataBase
 	BankAccountDataBase
 	BankDatabase
 	TransactionDataBase
+	ShareDataBase
 }
 
 // Representation of a single User as returned by the UserDatabase
@@ -120,20 +355,150 @@ type DBUser struct {
 	PasswordHash  string // Hash of the user's password
 	Salt          string // Password's salt
 	Administrator bool   // True if the user is an administrator TODO remove
+	TotpSecret    string // base32 TOTP secret, empty if never enrolled
+	TotpEnabled   bool   // True once the TOTP enrollment has been confirmed
+	TotpLastStep  int64  // Time step of the last TOTP code accepted
+}
+
+// Representation of a single two-factor recovery code as returned by the
+// RecoveryCodeDataBase
+type DBRecoveryCode struct {
+	Id       int    // Id of the recovery code in the database
+	UserId   int    // User linked to this recovery code
+	CodeHash string // Hash of the recovery code
+}
+
+// Representation of a single login attempt as returned by the
+// LoginAttemptDataBase
+type DBLoginAttempt struct {
+	Id          int       // Id of the login attempt in the database
+	UserId      int       // User concerned, 0 if the username is unknown
+	UserName    string    // Username given for this attempt
+	IpAddress   string    // IP address of the client
+	Success     bool      // True if the user was successfully logged in
+	AttemptDate time.Time // Date at which the attempt was made
+}
+
+// Representation of a single personal access token as returned by the
+// PersonalTokenDataBase
+type DBPersonalToken struct {
+	Id             int       // Id of the token in the database
+	UserId         int       // User owning this token
+	Name           string    // Name given by the user
+	TokenHash      string    // Hash of the token
+	Scopes         []string  // Scopes granted (e.g. "transactions:write")
+	AccountIds     []int     // Accounts the token is restricted to, if any
+	CreationDate   time.Time // Date at which the token was created
+	ExpirationDate time.Time // Date at which the token expires, zero if never
+}
+
+// Representation of a single webhook as returned by the WebhookDataBase.
+// A webhook receives the events (see Event) of its user matching its
+// filters.
+type DBWebhook struct {
+	Id           int       // Id of the webhook in the database
+	UserId       int       // User owning this webhook
+	Url          string    // URL the events are sent to
+	Secret       string    // Key of the HMAC signing the payloads
+	EventTypes   []string  // Types of the events wanted, all if empty
+	AccountIds   []int     // Only events of these accounts, all if empty
+	MinDebit     float32   // Only transactions with at least this debit
+	MinCredit    float32   // Only transactions with at least this credit
+	CreationDate time.Time // Date at which the webhook was created
+}
+
+// Representation of a single delivery of an event to a webhook, as returned
+// by the WebhookDataBase.
+type DBWebhookDelivery struct {
+	Id              int       // Id of the delivery in the database
+	WebhookId       int       // Webhook the event is delivered to
+	EventId         uint64    // Id of the event delivered
+	EventType       string    // Type of the event delivered
+	Payload         string    // JSON body sent
+	Status          string    // "pending", "delivered" or "failed"
+	Attempts        int       // Number of attempts made
+	StatusCode      int       // HTTP status of the last attempt, 0 if none
+	Error           string    // Error of the last attempt, if any
+	CreationDate    time.Time // Date at which the event was queued
+	NextAttemptDate time.Time // Date of the next attempt, while pending
+	LastAttemptDate time.Time // Date of the last attempt, zero if none
+}
+
+// Representation of a single alert rule as returned by the AlertDataBase.
+// Which of AccountId and CategoryId are needed depends on the Kind.
+type DBAlertRule struct {
+	Id           int       // Id of the rule in the database
+	UserId       int       // User owning this rule
+	Kind         string    // Condition checked, e.g. "balanceBelow"
+	AccountId    int       // Account concerned, 0 if none
+	CategoryId   int       // Category concerned, 0 if none
+	Threshold    float32   // Amount (or ratio) compared by the condition
+	Notifiers    []string  // Names of the notifiers used, all if empty
+	Email        string    // Address the e-mail notifications are sent to
+	CreationDate time.Time // Date at which the rule was created
+}
+
+// Representation of a single alert fired by a rule, as returned by the
+// AlertDataBase.
+type DBAlert struct {
+	Id           int       // Id of the alert in the database
+	RuleId       int       // Rule which fired this alert
+	UserId       int       // User owning the rule
+	Kind         string    // Kind of the rule
+	Period       string    // A rule fires a single alert per period
+	Value        float32   // Value which crossed the threshold
+	Threshold    float32   // Threshold of the rule at that time
+	Message      string    // Human-readable description of the alert
+	CreationDate time.Time // Date at which the alert was fired
+}
+
+// Sums of the transactions corresponding to some filters
+type DBReport struct {
+	Debit  float32 // Sum of the debits
+	Credit float32 // Sum of the credits
 }
 
 // Representation of a single Category as returned by the CategoryDatabase
 type DBCategory struct {
 	Id          int    // Id of the category in the database
+	Version     int    // Incremented each time the category is updated
 	UserId      int    // User linked to this category
 	Name        string // Name of the category
 	Description string // Optional description
 	ParentId    int    // Id of the parent category, 0 if none (TODO remove)
 }
 
+// Representation of a single tag as returned by the TagDataBase. Unlike
+// categories, many tags can be set on a transaction.
+type DBTag struct {
+	Id     int    // Id of the tag in the database
+	UserId int    // User linked to this tag
+	Name   string // Name of the tag, unique for its user
+}
+
+// A tag set on a transaction, as returned by the TagDataBase
+type DBTransactionTag struct {
+	TransactionId int // Transaction tagged
+	TagId         int // Tag set on the transaction
+}
+
+// Representation of a single file attached to a transaction, as returned by
+// the AttachmentDataBase
+type DBAttachment struct {
+	Id            int       // Id of the attachment in the database
+	TransactionId int       // Transaction the file is attached to
+	UserId        int       // User who attached the file
+	Name          string    // Name of the file
+	MimeType      string    // Type of the content of the file
+	Size          int64     // Size of the file, in bytes
+	Hash          string    // SHA-256 hash of the content, its storage key
+	CreationDate  time.Time // Date at which the file was attached
+}
+
 // Representation of a single Account as returned by the BankAccountDatabase
 type DBAccount struct {
 	Id          int    // Id of the bank account in the database
+	Version     int    // Incremented each time the account is updated
 	BankId      int    // Bank Id linked to this account
 	Name        string // Name of the bank account
 	Description string // Optional description
@@ -142,6 +507,7 @@ type DBAccount struct {
 // Representation of a single Bank as returned by the BankDatabase
 type DBBank struct {
 	Id          int    // Id of the bank in the database
+	Version     int    // Incremented each time the bank is updated
 	UserId      int    // User linked to this Bank
 	Name        string // Name of the bank
 	Description string // Optional description
@@ -150,6 +516,7 @@ type DBBank struct {
 // Representation of a single Transaction as returned by the TransactionDatabase
 type DBTransaction struct {
 	Id              int       // Id of the transaction in the database
+	Version         int       // Incremented each time the transaction is updated
 	AccountId       int       // Id for the account concerned by this transaction
 	Label           string    // Label describing the transaction
 	CategoryId      int       // Category of the transaction
@@ -161,12 +528,122 @@ type DBTransaction struct {
 	Reference       string    // Bank Reference (id)
 }
 
+// Representation of a single share as returned by the ShareDataBase.
+// A share grants a user access to a bank (and all its accounts) or to a
+// single account he does not own.
+type DBShare struct {
+	Id        int    // Id of the share in the database
+	Version   int    // Incremented each time the share is updated
+	UserId    int    // User the bank or account is shared with
+	BankId    int    // Bank shared, 0 if an account is shared
+	AccountId int    // Account shared, 0 if a bank is shared
+	Role      string // "viewer", "editor" or "owner"
+}
+
 // Parameters awaited to create a new User in the UserDatabase
 type DBUserParams struct {
 	Name          string // User's Name
 	PasswordHash  string // Hash of the user's password
 	Salt          string // Password's salt
 	Administrator bool   // True if the user is an administrator (TODO Remove)
+	TotpSecret    string // base32 TOTP secret, empty if never enrolled
+	TotpEnabled   bool   // True once the TOTP enrollment has been confirmed
+}
+
+// Parameters awaited to create a new recovery code in the RecoveryCodeDataBase
+type DBRecoveryCodeParams struct {
+	UserId   int    // The user owning the recovery code
+	CodeHash string // Hash of the recovery code
+}
+
+// Parameters awaited to create a new login attempt in the
+// LoginAttemptDataBase
+type DBLoginAttemptParams struct {
+	UserId      int       // User concerned, 0 if the username is unknown
+	UserName    string    // Username given for this attempt
+	IpAddress   string    // IP address of the client
+	Success     bool      // True if the user was successfully logged in
+	AttemptDate time.Time // Date at which the attempt was made
+}
+
+// Parameters awaited to create a new personal access token in the
+// PersonalTokenDataBase
+type DBPersonalTokenParams struct {
+	UserId         int       // User owning this token
+	Name           string    // Name given by the user
+	TokenHash      string    // Hash of the token
+	Scopes         []string  // Scopes granted (e.g. "transactions:write")
+	AccountIds     []int     // Accounts the token is restricted to, if any
+	CreationDate   time.Time // Date at which the token was created
+	ExpirationDate time.Time // Date at which the token expires, zero if never
+}
+
+// Parameters awaited to create a new webhook in the WebhookDataBase
+type DBWebhookParams struct {
+	UserId       int       // User owning this webhook
+	Url          string    // URL the events are sent to
+	Secret       string    // Key of the HMAC signing the payloads
+	EventTypes   []string  // Types of the events wanted, all if empty
+	AccountIds   []int     // Only events of these accounts, all if empty
+	MinDebit     float32   // Only transactions with at least this debit
+	MinCredit    float32   // Only transactions with at least this credit
+	CreationDate time.Time // Date at which the webhook was created
+}
+
+// Parameters awaited to queue a new delivery in the WebhookDataBase
+type DBWebhookDeliveryParams struct {
+	WebhookId       int       // Webhook the event is delivered to
+	EventId         uint64    // Id of the event delivered
+	EventType       string    // Type of the event delivered
+	Payload         string    // JSON body sent
+	Status          string    // "pending", "delivered" or "failed"
+	Attempts        int       // Number of attempts made
+	StatusCode      int       // HTTP status of the last attempt, 0 if none
+	Error           string    // Error of the last attempt, if any
+	CreationDate    time.Time // Date at which the event was queued
+	NextAttemptDate time.Time // Date of the next attempt, while pending
+	LastAttemptDate time.Time // Date of the last attempt, zero if none
+}
+
+// Parameters awaited to create a new alert rule in the AlertDataBase
+type DBAlertRuleParams struct {
+	UserId       int       // User owning this rule
+	Kind         string    // Condition checked, e.g. "balanceBelow"
+	AccountId    int       // Account concerned, 0 if none
+	CategoryId   int       // Category concerned, 0 if none
+	Threshold    float32   // Amount (or ratio) compared by the condition
+	Notifiers    []string  // Names of the notifiers used, all if empty
+	Email        string    // Address the e-mail notifications are sent to
+	CreationDate time.Time // Date at which the rule was created
+}
+
+// Parameters awaited to record a fired alert in the AlertDataBase
+type DBAlertParams struct {
+	RuleId       int       // Rule which fired this alert
+	UserId       int       // User owning the rule
+	Kind         string    // Kind of the rule
+	Period       string    // A rule fires a single alert per period
+	Value        float32   // Value which crossed the threshold
+	Threshold    float32   // Threshold of the rule at that time
+	Message      string    // Human-readable description of the alert
+	CreationDate time.Time // Date at which the alert was fired
+}
+
+// Parameters awaited to create a new tag in the TagDataBase
+type DBTagParams struct {
+	UserId int    // The user adding the tag
+	Name   string // The 'name' of the tag
+}
+
+// Parameters awaited to attach a new file in the AttachmentDataBase
+type DBAttachmentParams struct {
+	TransactionId int       // Transaction the file is attached to
+	UserId        int       // User attaching the file
+	Name          string    // Name of the file
+	MimeType      string    // Type of the content of the file
+	Size          int64     // Size of the file, in bytes
+	Hash          string    // SHA-256 hash of the content, its storage key
+	CreationDate  time.Time // Date at which the file is attached
 }
 
 // Parameters awaited to create a new Category in the CategoryDatabase
@@ -204,6 +681,14 @@ type DBTransactionParams struct {
 	Reference       string    // Bank Reference (id)
 }
 
+// Parameters awaited to create a new share in the ShareDataBase
+type DBShareParams struct {
+	UserId    int    // User the bank or account is shared with
+	BankId    int    // Bank shared, 0 if an account is shared
+	AccountId int    // Account shared, 0 if a bank is shared
+	Role      string // "viewer", "editor" or "owner"
+}
+
 // Filters that can be used to filter Users when doing operations on the
 // UserDatabase
 // example: filters.Id.SetValue(5)
@@ -213,6 +698,102 @@ type DBUserFilters struct {
 	Administrator DBBoolFilter   // Filters only Administrators TODO Remove
 }
 
+// Filters that can be used to filter recovery codes when doing operations on
+// the RecoveryCodeDataBase
+// example: filters.UserId.SetValue(5)
+type DBRecoveryCodeFilters struct {
+	Ids        DBIntArrayFilter    // by recovery code Ids
+	UserId     DBIntFilter         // by User Id
+	CodeHashes DBStringArrayFilter // by code hashes
+}
+
+// Filters that can be used to filter login attempts when doing operations on
+// the LoginAttemptDataBase
+// example: filters.UserName.SetValue("toto")
+type DBLoginAttemptFilters struct {
+	Ids       DBIntArrayFilter // by login attempt Ids
+	UserId    DBIntFilter      // by User Id
+	UserName  DBStringFilter   // by given username
+	IpAddress DBStringFilter   // by client IP address
+	Success   DBBoolFilter     // by result
+	FromDate  DBTimeFilter     // by minimum attempt date
+	ToDate    DBTimeFilter     // by maximum attempt date
+}
+
+// Filters that can be used to filter personal access tokens when doing
+// operations on the PersonalTokenDataBase
+// example: filters.UserId.SetValue(5)
+type DBPersonalTokenFilters struct {
+	Ids         DBIntArrayFilter    // by token Ids
+	UserId      DBIntFilter         // by User Id
+	TokenHashes DBStringArrayFilter // by token hashes
+}
+
+// Filters that can be used to filter webhooks when doing operations on the
+// WebhookDataBase
+// example: filters.UserId.SetValue(5)
+type DBWebhookFilters struct {
+	Ids    DBIntArrayFilter // by webhook Ids
+	UserId DBIntFilter      // by User Id
+}
+
+// Filters that can be used to filter webhook deliveries when doing
+// operations on the WebhookDataBase
+// example: filters.WebhookIds.SetValue([]int{5})
+type DBWebhookDeliveryFilters struct {
+	Ids               DBIntArrayFilter    // by delivery Ids
+	WebhookIds        DBIntArrayFilter    // by webhook Ids
+	Statuses          DBStringArrayFilter // by status
+	ToNextAttemptDate DBTimeFilter        // by maximum next attempt date
+	ToCreationDate    DBTimeFilter        // by maximum creation date
+	Sort              DBSortFilter        // order of the results
+}
+
+// Filters that can be used to filter alert rules when doing operations on
+// the AlertDataBase
+// example: filters.UserId.SetValue(5)
+type DBAlertRuleFilters struct {
+	Ids    DBIntArrayFilter // by rule Ids
+	UserId DBIntFilter      // by User Id
+}
+
+// Filters that can be used to filter fired alerts when doing operations on
+// the AlertDataBase
+// example: filters.RuleIds.SetValue([]int{5})
+type DBAlertFilters struct {
+	Ids     DBIntArrayFilter    // by alert Ids
+	UserId  DBIntFilter         // by User Id
+	RuleIds DBIntArrayFilter    // by rule Ids
+	Periods DBStringArrayFilter // by periods
+	Sort    DBSortFilter        // order of the results
+}
+
+// Filters that can be used to filter tags when doing operations on the
+// TagDataBase
+// example: filters.Names.SetValue([]string{"vacation"})
+type DBTagFilters struct {
+	Ids    DBIntArrayFilter    // by tag Ids
+	UserId DBIntFilter         // by User Id
+	Names  DBStringArrayFilter // by tag names
+}
+
+// Filters that can be used to filter the tags set on transactions when
+// doing operations on the TagDataBase
+// example: filters.TransactionIds.SetValue([]int{5})
+type DBTransactionTagFilters struct {
+	TransactionIds DBIntArrayFilter // by transaction Ids
+	TagIds         DBIntArrayFilter // by tag Ids
+}
+
+// Filters that can be used to filter attachments when doing operations on
+// the AttachmentDataBase
+// example: filters.TransactionIds.SetValue([]int{5})
+type DBAttachmentFilters struct {
+	Ids            DBIntArrayFilter    // by attachment Ids
+	TransactionIds DBIntArrayFilter    // by transaction Ids
+	Hashes         DBStringArrayFilter // by content hashes
+}
+
 // Filters that can be used to filter Categories when doing operations on the
 // CategoryDatabase
 // example: filters.Ids.SetValue([]int{5})
@@ -221,33 +802,49 @@ type DBCategoryFilters struct {
 	Names     DBStringArrayFilter // by Categories names
 	UserId    DBIntFilter         // by User Id
 	ParentIds DBIntArrayFilter    // by Parent Categories Ids (TODO Remove)
+	Versions  DBIntArrayFilter    // by versions
+	Sort      DBSortFilter        // order of the results
+	After     DBCursorFilter      // only the results following a cursor
 }
 
 // Filters that can be used to filter Bank Accounts when doing operations on the
 // BankAccountDataBase
 // example: filters.Ids.SetValue([]int{5})
+// UserId only keeps the accounts of the banks the user owns and of the
+// banks and accounts shared with him, with one of the Roles if set.
 type DBAccountFilters struct {
-	Ids     DBIntArrayFilter    // by Bank Account Ids
-	UserId  DBIntFilter         // by User Id (TODO Remove?)
-	BankIds DBIntArrayFilter    // by Bank Ids corresponding to the accounts
-	Names   DBStringArrayFilter // by Bank Account names
+	Ids      DBIntArrayFilter    // by Bank Account Ids
+	UserId   DBIntFilter         // by User able to access them
+	Roles    DBStringArrayFilter // with UserId, by roles of the shares used
+	BankIds  DBIntArrayFilter    // by Bank Ids corresponding to the accounts
+	Names    DBStringArrayFilter // by Bank Account names
+	Versions DBIntArrayFilter    // by versions
+	Sort     DBSortFilter        // order of the results
+	After    DBCursorFilter      // only the results following a cursor
 }
 
 // Filters that can be used to filter Banks when doing operations on the
 // BankDataBase
 // example: filters.Ids.SetValue([]int{5})
 type DBBankFilters struct {
-	Ids    DBIntArrayFilter    // by Bank Ids
-	UserId DBIntFilter         // by User Id
-	Names  DBStringArrayFilter // by Bank names
+	Ids      DBIntArrayFilter    // by Bank Ids
+	UserId   DBIntFilter         // by User Id
+	Names    DBStringArrayFilter // by Bank names
+	Versions DBIntArrayFilter    // by versions
+	Sort     DBSortFilter        // order of the results
+	After    DBCursorFilter      // only the results following a cursor
 }
 
 // Filters that can be used to filter Transactions when doing operations on the
 // TransactionDataBase
 // example: filters.Ids.SetValue([]int{5})
+// UserId only keeps the transactions of the accounts of the banks the user
+// owns and of the banks and accounts shared with him, with one of the Roles
+// if set.
 type DBTransactionFilters struct {
 	Ids                 DBIntArrayFilter    // by Transactions Ids
-	UserId              DBIntFilter         // by User Id (TODO Remove)
+	UserId              DBIntFilter         // by User able to access them
+	Roles               DBStringArrayFilter // with UserId, by roles of the shares used
 	BankIds             DBIntArrayFilter    // by Bank Ids (TODO Remove)
 	AccountIds          DBIntArrayFilter    // by Bank Accounts Ids
 	CategoryIds         DBIntArrayFilter    // by Categories Ids
@@ -260,6 +857,76 @@ type DBTransactionFilters struct {
 	MinCredit           DBFloatFilter       // by minimum credit
 	MaxCredit           DBFloatFilter       // by maximum credit
 	References          DBStringArrayFilter // by bank's reference
+	Search              DBStringFilter      // by words in label/description/reference
+	Expression          DBExpressionFilter  // by a free boolean expression
+	Tags                DBTagFilter         // by tags set on them
+	Versions            DBIntArrayFilter    // by versions
+	Sort                DBSortFilter        // order of the results
+	After               DBCursorFilter      // only the results following a cursor
+}
+
+// Filters that can be used to filter shares when doing operations on the
+// ShareDataBase
+// example: filters.UserId.SetValue(5)
+type DBShareFilters struct {
+	Ids        DBIntArrayFilter    // by share Ids
+	UserId     DBIntFilter         // by User the resource is shared with
+	BankIds    DBIntArrayFilter    // by shared Bank Ids
+	AccountIds DBIntArrayFilter    // by shared Account Ids
+	Roles      DBStringArrayFilter // by roles
+	Versions   DBIntArrayFilter    // by versions
+}
+
+// A single field used to sort results. Field is the name of the property in
+// the returned struct (e.g. "TransactionDate").
+type DBSortField struct {
+	Field      string
+	Descending bool
+}
+
+// Tags wanted on the results: any of TagIds, or all of them if All is set.
+// With a UserId filter, only the tags of this user are considered.
+type DBTagMatch struct {
+	TagIds []int
+	All    bool
+}
+
+// Position in sorted results, used for pagination.
+// Values are the values of the sort fields (in the same order) for the last
+// element received, Id is its id.
+type DBCursor struct {
+	Values []interface{}
+	Id     int
+}
+
+// Operators of a DBFilterExpression
+const (
+	ExpressionAnd      = "and"
+	ExpressionOr       = "or"
+	ExpressionEq       = "="
+	ExpressionNotEq    = "!="
+	ExpressionGt       = ">"
+	ExpressionGEq      = ">="
+	ExpressionLt       = "<"
+	ExpressionLEq      = "<="
+	ExpressionIn       = "in"
+	ExpressionContains = "~"
+)
+
+// Boolean expression on the properties of the returned struct, for filters
+// which cannot be expressed with the other ones.
+//   - ExpressionAnd and ExpressionOr combine their Operands
+//   - the other operators compare the Field property (e.g. "Debit") to
+//     Values. ExpressionIn takes one or more values, the others a single one
+//
+// example: debit > 20 ->
+// DBFilterExpression{Operator: ExpressionGt, Field: "Debit",
+// Values: []interface{}{float32(20)}}
+type DBFilterExpression struct {
+	Operator string
+	Operands []DBFilterExpression
+	Field    string
+	Values   []interface{}
 }
 
 // Common base of filters
@@ -309,6 +976,31 @@ type DBTimeFilter struct {
 	value time.Time
 }
 
+// Sort results by setting a []DBSortField value. Results are always sorted
+// by Id last, so the order is stable.
+type DBSortFilter struct {
+	dbBaseFilter
+	value []DBSortField
+}
+
+// Only return the results following a DBCursor, for the same DBSortFilter
+type DBCursorFilter struct {
+	dbBaseFilter
+	value DBCursor
+}
+
+// Filter by setting a DBFilterExpression value
+type DBExpressionFilter struct {
+	dbBaseFilter
+	value DBFilterExpression
+}
+
+// Filter by setting a DBTagMatch value
+type DBTagFilter struct {
+	dbBaseFilter
+	value DBTagMatch
+}
+
 // About to get really ugly
 
 // Activate and set the value for a DBIntFilter
@@ -353,6 +1045,30 @@ func (d *DBTimeFilter) SetFilter(val time.Time) {
 	d.value = val
 }
 
+// Activate and set the value for a DBSortFilter
+func (d *DBSortFilter) SetFilter(val []DBSortField) {
+	d.activated = true
+	d.value = val
+}
+
+// Activate and set the value for a DBCursorFilter
+func (d *DBCursorFilter) SetFilter(val DBCursor) {
+	d.activated = true
+	d.value = val
+}
+
+// Activate and set the value for a DBExpressionFilter
+func (d *DBExpressionFilter) SetFilter(val DBFilterExpression) {
+	d.activated = true
+	d.value = val
+}
+
+// Activate and set the value for a DBTagFilter
+func (d *DBTagFilter) SetFilter(val DBTagMatch) {
+	d.activated = true
+	d.value = val
+}
+
 // ugly generic dbFilter interface for using them in generic helpers
 type dbFilterInterface interface {
 	isFilterActivated() bool
@@ -366,3 +1082,7 @@ func (d DBStringArrayFilter) getFilterValue() interface{} { return d.value }
 func (d DBBoolFilter) getFilterValue() interface{}        { return d.value }
 func (d DBFloatFilter) getFilterValue() interface{}       { return d.value }
 func (d DBTimeFilter) getFilterValue() interface{}        { return d.value }
+func (d DBSortFilter) getFilterValue() interface{}        { return d.value }
+func (d DBCursorFilter) getFilterValue() interface{}      { return d.value }
+func (d DBExpressionFilter) getFilterValue() interface{}  { return d.value }
+func (d DBTagFilter) getFilterValue() interface{}         { return d.value }
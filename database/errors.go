@@ -1,14 +1,41 @@
 package database
 
+import "github.com/peaberberian/GoBanks/errorcodes"
+
 const (
-	UnknownDatabaseErrorCode = 700 + iota
+	UnknownDatabaseErrorCode = errorcodes.DatabaseErrors + iota
 	DatabaseConfigurationErrorCode
 	UnsupportedDatabaseErrorCode
 	MissingInformationsErrorCode
 	DatabaseQueryErrorCode
 	DatabaseConnectionErrorCode
+	VersionMismatchErrorCode
 )
 
+func init() {
+	errorcodes.Register(errorcodes.DatabaseErrors,
+		UnknownDatabaseErrorCode, "UnknownDatabaseError",
+		"The database encountered an error.")
+	errorcodes.Register(errorcodes.DatabaseErrors,
+		DatabaseConfigurationErrorCode, "DatabaseConfiguration",
+		"The database configuration is not valid.")
+	errorcodes.Register(errorcodes.DatabaseErrors,
+		UnsupportedDatabaseErrorCode, "UnsupportedDatabase",
+		"The configured database is not supported.")
+	errorcodes.Register(errorcodes.DatabaseErrors,
+		MissingInformationsErrorCode, "MissingInformations",
+		"A field needed by the database was not filled.")
+	errorcodes.Register(errorcodes.DatabaseErrors,
+		DatabaseQueryErrorCode, "DatabaseQuery",
+		"The database query failed.")
+	errorcodes.Register(errorcodes.DatabaseErrors,
+		DatabaseConnectionErrorCode, "DatabaseConnection",
+		"The database could not be reached.")
+	errorcodes.Register(errorcodes.DatabaseErrors,
+		VersionMismatchErrorCode, "VersionMismatch",
+		"The resource was modified since the version given.")
+}
+
 type databaseError interface {
 	error
 	ErrorCode() uint32
@@ -22,6 +49,7 @@ type databaseConfigurationError struct{}
 type unsupportedDatabaseError struct{ database string }
 type missingInformationsError struct{ field string }
 type databaseQueryError struct{ err string }
+type versionMismatchError struct{}
 
 func (dbe genericDatabaseError) Error() string {
 	if dbe.err != "" {
@@ -53,7 +81,7 @@ func (d unsupportedDatabaseError) Error() string {
 }
 
 func (e unsupportedDatabaseError) ErrorCode() uint32 {
-	return MissingInformationsErrorCode
+	return UnsupportedDatabaseErrorCode
 }
 
 func (e missingInformationsError) Error() string {
@@ -64,7 +92,7 @@ func (e missingInformationsError) Error() string {
 }
 
 func (d missingInformationsError) ErrorCode() uint32 {
-	return UnsupportedDatabaseErrorCode
+	return MissingInformationsErrorCode
 }
 
 func (e databaseQueryError) Error() string {
@@ -77,3 +105,11 @@ func (e databaseQueryError) Error() string {
 func (e databaseQueryError) ErrorCode() uint32 {
 	return DatabaseQueryErrorCode
 }
+
+func (e versionMismatchError) Error() string {
+	return "The resource was modified since the version given."
+}
+
+func (e versionMismatchError) ErrorCode() uint32 {
+	return VersionMismatchErrorCode
+}
@@ -0,0 +1,794 @@
+package database
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// Actions of the events published by NewPublishingDataBase. The type of an
+// event is the name of the resource concerned followed by its action (e.g.
+// "transaction.created").
+const (
+	CreatedEventAction = "created"
+	UpdatedEventAction = "updated"
+	DeletedEventAction = "deleted"
+)
+
+// number of events kept by an EventBus when 0 is given
+const default_event_buffer_size = 1000
+
+// number of events a subscriber can be late before being dropped
+const event_subscription_size = 100
+
+// Event is a modification of a bank, account, category, transaction or
+// share, published on an EventBus.
+type Event struct {
+	// Given by the EventBus, higher for every new event
+	Id uint64
+
+	// "<resource>.<action>", e.g. "transaction.created"
+	Type string
+
+	// Id of the bank, account, category, transaction or share concerned
+	ResourceId int
+
+	// Users who can access the resource
+	UserIds []int
+
+	// Resource as stored after the modification (before for a deletion):
+	// a DBBank, DBAccount, DBCategory, DBTransaction or DBShare
+	Data interface{}
+
+	Date time.Time
+}
+
+// EventBus gives the events published to its subscribers, and keeps the
+// most recent ones for subscribers to resume from the last event they
+// received (see Subscribe).
+type EventBus struct {
+	mutex       sync.Mutex
+	lastId      uint64
+	size        int
+	buffer      []Event // most recent events, oldest first
+	subscribers map[*EventSubscription]bool
+}
+
+// EventSubscription receives the events published on an EventBus for a
+// single user, through C, until it is closed.
+// C is closed if the subscriber does not read its events fast enough,
+// unless it was returned by SubscribeReliably.
+type EventSubscription struct {
+	C <-chan Event
+
+	// Id of the last event published before the subscription
+	LastEventId uint64
+
+	events chan Event
+	userId int
+	bus    *EventBus
+
+	// with SubscribeReliably, events not given to C yet, and signal that
+	// some were added. nil else.
+	pending []Event
+	wake    chan struct{}
+}
+
+// publishingDataBase is the GoBanksDataBase returned by
+// NewPublishingDataBase.
+// Every method not redefined here directly calls the wrapped database.
+type publishingDataBase struct {
+	GoBanksDataBase
+
+	bus *EventBus
+
+	// events of the current transaction, published once it is committed.
+	// nil outside of a transaction.
+	pending *[]Event
+}
+
+// NewEventBus creates an EventBus keeping the given number of most recent
+// events (default_event_buffer_size if 0).
+// Event ids start from the current time in milliseconds, so that they keep
+// increasing after a restart.
+func NewEventBus(bufferSize int) *EventBus {
+	if bufferSize <= 0 {
+		bufferSize = default_event_buffer_size
+	}
+	return &EventBus{
+		lastId:      uint64(time.Now().UnixNano() / 1e6),
+		size:        bufferSize,
+		subscribers: map[*EventSubscription]bool{},
+	}
+}
+
+// Publish gives an id to the given events and sends them to the
+// subscribers of the users concerned.
+func (b *EventBus) Publish(evts ...Event) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	for _, evt := range evts {
+		b.lastId++
+		evt.Id = b.lastId
+		if evt.Date.IsZero() {
+			evt.Date = time.Now()
+		}
+
+		if len(b.buffer) >= b.size {
+			copy(b.buffer, b.buffer[1:])
+			b.buffer = b.buffer[:len(b.buffer)-1]
+		}
+		b.buffer = append(b.buffer, evt)
+
+		for sub := range b.subscribers {
+			if !evt.concerns(sub.userId) {
+				continue
+			}
+			if sub.wake != nil {
+				sub.pending = append(sub.pending, evt)
+				select {
+				case sub.wake <- struct{}{}:
+				default:
+				}
+				continue
+			}
+			select {
+			case sub.events <- evt:
+			default:
+				// the subscriber can resume from its last event
+				delete(b.subscribers, sub)
+				close(sub.events)
+			}
+		}
+	}
+}
+
+// Subscribe returns a subscription to the events concerning the given user,
+// or every event if 0.
+// If lastId is not 0, the events following the one with this id are also
+// returned. The returned boolean is then false if some of them are not
+// known anymore (or if lastId is not known at all): the subscriber should
+// read its data again instead.
+func (b *EventBus) Subscribe(userId int, lastId uint64) (*EventSubscription,
+	[]Event, bool) {
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	var events = make(chan Event, event_subscription_size)
+	var sub = &EventSubscription{C: events, LastEventId: b.lastId,
+		events: events, userId: userId, bus: b}
+	b.subscribers[sub] = true
+
+	if lastId == 0 || lastId == b.lastId {
+		return sub, nil, true
+	}
+	if lastId > b.lastId || len(b.buffer) == 0 || lastId < b.buffer[0].Id-1 {
+		return sub, nil, false
+	}
+
+	var missed []Event
+	for _, evt := range b.buffer {
+		if evt.Id > lastId && evt.concerns(userId) {
+			missed = append(missed, evt)
+		}
+	}
+	return sub, missed, true
+}
+
+// SubscribeReliably returns a subscription to the events concerning the
+// given user, or every event if 0, which is never dropped: the events not
+// read yet are kept, however many they are. It is meant for the consumers
+// which must see every event, such as the webhooks.
+func (b *EventBus) SubscribeReliably(userId int) *EventSubscription {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	var events = make(chan Event, event_subscription_size)
+	var sub = &EventSubscription{C: events, LastEventId: b.lastId,
+		events: events, userId: userId, bus: b,
+		wake: make(chan struct{}, 1)}
+	b.subscribers[sub] = true
+	go sub.forward()
+	return sub
+}
+
+// forward gives the pending events of a subscription returned by
+// SubscribeReliably to C, until it is closed.
+func (sub *EventSubscription) forward() {
+	for {
+		_, open := <-sub.wake
+
+		sub.bus.mutex.Lock()
+		var evts = sub.pending
+		sub.pending = nil
+		sub.bus.mutex.Unlock()
+
+		for _, evt := range evts {
+			sub.events <- evt
+		}
+		if !open {
+			close(sub.events)
+			return
+		}
+	}
+}
+
+// Close stops the subscription. C is closed if not already.
+func (sub *EventSubscription) Close() {
+	sub.bus.mutex.Lock()
+	defer sub.bus.mutex.Unlock()
+
+	if sub.bus.subscribers[sub] {
+		delete(sub.bus.subscribers, sub)
+		if sub.wake != nil {
+			// C is closed once the pending events are given
+			close(sub.wake)
+		} else {
+			close(sub.events)
+		}
+	}
+}
+
+// concerns returns true if the given user can access the resource of the
+// event. Every event concerns user 0.
+func (evt Event) concerns(userId int) bool {
+	return userId == 0 || intInArray(userId, evt.UserIds)
+}
+
+// NewPublishingDataBase wraps the given database to publish an Event on the
+// given bus each time a bank, account, category, transaction or share is
+// added, updated or removed.
+// In a transaction (see WithTx), events are only published once it is
+// committed.
+// Events are published on a best effort basis: a modification is not
+// failed if the users concerned could not be read, it is only logged.
+func NewPublishingDataBase(db GoBanksDataBase,
+	bus *EventBus) GoBanksDataBase {
+	return &publishingDataBase{GoBanksDataBase: db, bus: bus}
+}
+
+func (pdb *publishingDataBase) WithTx(fn func(GoBanksDataBase) error) error {
+	// in a savepoint, the events of a rolled back fn are dropped
+	if pdb.pending != nil {
+		var count = len(*pdb.pending)
+		var err = pdb.GoBanksDataBase.WithTx(func(db GoBanksDataBase) error {
+			return fn(&publishingDataBase{db, pdb.bus, pdb.pending})
+		})
+		if err != nil {
+			*pdb.pending = (*pdb.pending)[:count]
+		}
+		return err
+	}
+
+	var pending []Event
+	var err = pdb.GoBanksDataBase.WithTx(func(db GoBanksDataBase) error {
+		return fn(&publishingDataBase{db, pdb.bus, &pending})
+	})
+	if err == nil {
+		pdb.bus.Publish(pending...)
+	}
+	return err
+}
+
+// publish publishes the given events, or keeps them until the current
+// transaction is committed.
+func (pdb *publishingDataBase) publish(evts []Event, err error) {
+	if err != nil {
+		log.Println("Events could not be published:", err)
+		return
+	}
+	if pdb.pending != nil {
+		*pdb.pending = append(*pdb.pending, evts...)
+	} else {
+		pdb.bus.Publish(evts...)
+	}
+}
+
+func (pdb *publishingDataBase) AddBank(bnk DBBankParams) (DBBank, error) {
+	res, err := pdb.GoBanksDataBase.AddBank(bnk)
+	if err == nil {
+		pdb.publish(pdb.bankEvents(CreatedEventAction, []DBBank{res}))
+	}
+	return res, err
+}
+
+func (pdb *publishingDataBase) UpdateBanks(f DBBankFilters, fields []string,
+	bnk DBBankParams) error {
+
+	before, err := pdb.GoBanksDataBase.GetBanks(f, []string{"Id"}, 0)
+	if err != nil {
+		return err
+	}
+	if err = pdb.GoBanksDataBase.UpdateBanks(f, fields, bnk); err != nil {
+		return err
+	}
+	if len(before) == 0 {
+		return nil
+	}
+
+	var af DBBankFilters
+	af.Ids.SetFilter(bankIds(before))
+	after, err := pdb.GoBanksDataBase.GetBanks(af, allFields(bank_fields), 0)
+	if err != nil {
+		pdb.publish(nil, err)
+	} else {
+		pdb.publish(pdb.bankEvents(UpdatedEventAction, after))
+	}
+	return nil
+}
+
+func (pdb *publishingDataBase) RemoveBanks(f DBBankFilters) error {
+	before, err := pdb.GoBanksDataBase.GetBanks(f, allFields(bank_fields), 0)
+	if err != nil {
+		return err
+	}
+	evts, evtErr := pdb.bankEvents(DeletedEventAction, before)
+	if err = pdb.GoBanksDataBase.RemoveBanks(f); err == nil {
+		pdb.publish(evts, evtErr)
+	}
+	return err
+}
+
+func (pdb *publishingDataBase) AddAccount(acc DBAccountParams) (DBAccount,
+	error) {
+	res, err := pdb.GoBanksDataBase.AddAccount(acc)
+	if err == nil {
+		pdb.publish(pdb.accountEvents(CreatedEventAction, []DBAccount{res}))
+	}
+	return res, err
+}
+
+func (pdb *publishingDataBase) UpdateAccounts(f DBAccountFilters,
+	fields []string, acc DBAccountParams) error {
+
+	before, err := pdb.GoBanksDataBase.GetAccounts(f, []string{"Id"}, 0)
+	if err != nil {
+		return err
+	}
+	if err = pdb.GoBanksDataBase.UpdateAccounts(f, fields, acc); err != nil {
+		return err
+	}
+	if len(before) == 0 {
+		return nil
+	}
+
+	var af DBAccountFilters
+	af.Ids.SetFilter(accountIds(before))
+	after, err := pdb.GoBanksDataBase.GetAccounts(af,
+		allFields(account_fields), 0)
+	if err != nil {
+		pdb.publish(nil, err)
+	} else {
+		pdb.publish(pdb.accountEvents(UpdatedEventAction, after))
+	}
+	return nil
+}
+
+func (pdb *publishingDataBase) RemoveAccounts(f DBAccountFilters) error {
+	before, err := pdb.GoBanksDataBase.GetAccounts(f,
+		allFields(account_fields), 0)
+	if err != nil {
+		return err
+	}
+	evts, evtErr := pdb.accountEvents(DeletedEventAction, before)
+	if err = pdb.GoBanksDataBase.RemoveAccounts(f); err == nil {
+		pdb.publish(evts, evtErr)
+	}
+	return err
+}
+
+func (pdb *publishingDataBase) AddCategory(ctg DBCategoryParams) (DBCategory,
+	error) {
+	res, err := pdb.GoBanksDataBase.AddCategory(ctg)
+	if err == nil {
+		pdb.publish(categoryEvents(CreatedEventAction, []DBCategory{res}),
+			nil)
+	}
+	return res, err
+}
+
+func (pdb *publishingDataBase) UpdateCategories(f DBCategoryFilters,
+	fields []string, ctg DBCategoryParams) error {
+
+	before, err := pdb.GoBanksDataBase.GetCategories(f, []string{"Id"}, 0)
+	if err != nil {
+		return err
+	}
+	if err = pdb.GoBanksDataBase.UpdateCategories(f, fields, ctg); err != nil {
+		return err
+	}
+	if len(before) == 0 {
+		return nil
+	}
+
+	var af DBCategoryFilters
+	af.Ids.SetFilter(categoryIds(before))
+	after, err := pdb.GoBanksDataBase.GetCategories(af,
+		allFields(category_fields), 0)
+	if err != nil {
+		pdb.publish(nil, err)
+	} else {
+		pdb.publish(categoryEvents(UpdatedEventAction, after), nil)
+	}
+	return nil
+}
+
+func (pdb *publishingDataBase) RemoveCategories(f DBCategoryFilters) error {
+	before, err := pdb.GoBanksDataBase.GetCategories(f,
+		allFields(category_fields), 0)
+	if err != nil {
+		return err
+	}
+	if err = pdb.GoBanksDataBase.RemoveCategories(f); err == nil {
+		pdb.publish(categoryEvents(DeletedEventAction, before), nil)
+	}
+	return err
+}
+
+func (pdb *publishingDataBase) AddTransaction(trn DBTransactionParams) (
+	DBTransaction, error) {
+	res, err := pdb.GoBanksDataBase.AddTransaction(trn)
+	if err == nil {
+		pdb.publish(pdb.transactionEvents(CreatedEventAction,
+			[]DBTransaction{res}))
+	}
+	return res, err
+}
+
+func (pdb *publishingDataBase) UpdateTransactions(f DBTransactionFilters,
+	fields []string, trn DBTransactionParams) error {
+
+	before, err := pdb.GoBanksDataBase.GetTransactions(f, []string{"Id"}, 0)
+	if err != nil {
+		return err
+	}
+	err = pdb.GoBanksDataBase.UpdateTransactions(f, fields, trn)
+	if err != nil {
+		return err
+	}
+	if len(before) == 0 {
+		return nil
+	}
+
+	var af DBTransactionFilters
+	af.Ids.SetFilter(transactionIds(before))
+	after, err := pdb.GoBanksDataBase.GetTransactions(af,
+		allFields(transaction_fields), 0)
+	if err != nil {
+		pdb.publish(nil, err)
+	} else {
+		pdb.publish(pdb.transactionEvents(UpdatedEventAction, after))
+	}
+	return nil
+}
+
+func (pdb *publishingDataBase) RemoveTransactions(
+	f DBTransactionFilters) error {
+
+	before, err := pdb.GoBanksDataBase.GetTransactions(f,
+		allFields(transaction_fields), 0)
+	if err != nil {
+		return err
+	}
+	evts, evtErr := pdb.transactionEvents(DeletedEventAction, before)
+	if err = pdb.GoBanksDataBase.RemoveTransactions(f); err == nil {
+		pdb.publish(evts, evtErr)
+	}
+	return err
+}
+
+func (pdb *publishingDataBase) AddShare(shr DBShareParams) (DBShare, error) {
+	res, err := pdb.GoBanksDataBase.AddShare(shr)
+	if err == nil {
+		pdb.publish(pdb.shareEvents(CreatedEventAction, []DBShare{res}))
+	}
+	return res, err
+}
+
+func (pdb *publishingDataBase) UpdateShares(f DBShareFilters,
+	fields []string, shr DBShareParams) error {
+
+	before, err := pdb.GoBanksDataBase.GetShares(f, []string{"Id"}, 0)
+	if err != nil {
+		return err
+	}
+	if err = pdb.GoBanksDataBase.UpdateShares(f, fields, shr); err != nil {
+		return err
+	}
+	if len(before) == 0 {
+		return nil
+	}
+
+	var af DBShareFilters
+	af.Ids.SetFilter(shareIds(before))
+	after, err := pdb.GoBanksDataBase.GetShares(af, allFields(share_fields),
+		0)
+	if err != nil {
+		pdb.publish(nil, err)
+	} else {
+		pdb.publish(pdb.shareEvents(UpdatedEventAction, after))
+	}
+	return nil
+}
+
+func (pdb *publishingDataBase) RemoveShares(f DBShareFilters) error {
+	before, err := pdb.GoBanksDataBase.GetShares(f, allFields(share_fields),
+		0)
+	if err != nil {
+		return err
+	}
+	evts, evtErr := pdb.shareEvents(DeletedEventAction, before)
+	if err = pdb.GoBanksDataBase.RemoveShares(f); err == nil {
+		pdb.publish(evts, evtErr)
+	}
+	return err
+}
+
+// bankEvents returns the events of the given action on the given banks.
+func (pdb *publishingDataBase) bankEvents(action string,
+	bnks []DBBank) ([]Event, error) {
+
+	users, err := pdb.bankUsers(bankIds(bnks))
+	if err != nil {
+		return nil, err
+	}
+	var evts []Event
+	for _, bnk := range bnks {
+		evts = append(evts, Event{Type: "bank." + action,
+			ResourceId: bnk.Id, UserIds: users[bnk.Id], Data: bnk})
+	}
+	return evts, nil
+}
+
+// accountEvents returns the events of the given action on the given
+// accounts.
+func (pdb *publishingDataBase) accountEvents(action string,
+	accs []DBAccount) ([]Event, error) {
+
+	users, err := pdb.accountUsers(accs)
+	if err != nil {
+		return nil, err
+	}
+	var evts []Event
+	for _, acc := range accs {
+		evts = append(evts, Event{Type: "account." + action,
+			ResourceId: acc.Id, UserIds: users[acc.Id], Data: acc})
+	}
+	return evts, nil
+}
+
+// categoryEvents returns the events of the given action on the given
+// categories. Categories are never shared: they only concern their user.
+func categoryEvents(action string, ctgs []DBCategory) []Event {
+	var evts []Event
+	for _, ctg := range ctgs {
+		evts = append(evts, Event{Type: "category." + action,
+			ResourceId: ctg.Id, UserIds: []int{ctg.UserId}, Data: ctg})
+	}
+	return evts
+}
+
+// transactionEvents returns the events of the given action on the given
+// transactions.
+func (pdb *publishingDataBase) transactionEvents(action string,
+	trns []DBTransaction) ([]Event, error) {
+
+	var ids []int
+	for _, trn := range trns {
+		if !intInArray(trn.AccountId, ids) {
+			ids = append(ids, trn.AccountId)
+		}
+	}
+	var accs []DBAccount
+	if len(ids) > 0 {
+		var f DBAccountFilters
+		f.Ids.SetFilter(ids)
+		var err error
+		accs, err = pdb.GoBanksDataBase.GetAccounts(f,
+			[]string{"Id", "BankId"}, 0)
+		if err != nil {
+			return nil, err
+		}
+	}
+	users, err := pdb.accountUsers(accs)
+	if err != nil {
+		return nil, err
+	}
+
+	var evts []Event
+	for _, trn := range trns {
+		evts = append(evts, Event{Type: "transaction." + action,
+			ResourceId: trn.Id, UserIds: users[trn.AccountId], Data: trn})
+	}
+	return evts, nil
+}
+
+// shareEvents returns the events of the given action on the given shares.
+// They concern the users of the bank or account shared, including the one
+// it is shared with.
+func (pdb *publishingDataBase) shareEvents(action string,
+	shrs []DBShare) ([]Event, error) {
+
+	var bnkIds, accIds []int
+	for _, shr := range shrs {
+		if shr.BankId != 0 {
+			bnkIds = append(bnkIds, shr.BankId)
+		} else if shr.AccountId != 0 {
+			accIds = append(accIds, shr.AccountId)
+		}
+	}
+
+	bankUsers, err := pdb.bankUsers(bnkIds)
+	if err != nil {
+		return nil, err
+	}
+	var accs []DBAccount
+	if len(accIds) > 0 {
+		var f DBAccountFilters
+		f.Ids.SetFilter(accIds)
+		accs, err = pdb.GoBanksDataBase.GetAccounts(f,
+			[]string{"Id", "BankId"}, 0)
+		if err != nil {
+			return nil, err
+		}
+	}
+	accountUsers, err := pdb.accountUsers(accs)
+	if err != nil {
+		return nil, err
+	}
+
+	var evts []Event
+	for _, shr := range shrs {
+		var users []int
+		if shr.BankId != 0 {
+			users = bankUsers[shr.BankId]
+		} else {
+			users = accountUsers[shr.AccountId]
+		}
+		evts = append(evts, Event{Type: "share." + action,
+			ResourceId: shr.Id, UserIds: addUserId(users, shr.UserId),
+			Data: shr})
+	}
+	return evts, nil
+}
+
+// bankUsers returns the users who can access each of the given banks (their
+// owner and the users they are shared with), by bank id.
+func (pdb *publishingDataBase) bankUsers(ids []int) (map[int][]int, error) {
+	var users = map[int][]int{}
+	if len(ids) == 0 {
+		return users, nil
+	}
+
+	var bf DBBankFilters
+	bf.Ids.SetFilter(ids)
+	bnks, err := pdb.GoBanksDataBase.GetBanks(bf, []string{"Id", "UserId"}, 0)
+	if err != nil {
+		return nil, err
+	}
+	for _, bnk := range bnks {
+		users[bnk.Id] = addUserId(users[bnk.Id], bnk.UserId)
+	}
+
+	var sf DBShareFilters
+	sf.BankIds.SetFilter(ids)
+	shrs, err := pdb.GoBanksDataBase.GetShares(sf,
+		[]string{"BankId", "UserId"}, 0)
+	if err != nil {
+		return nil, err
+	}
+	for _, shr := range shrs {
+		users[shr.BankId] = addUserId(users[shr.BankId], shr.UserId)
+	}
+	return users, nil
+}
+
+// accountUsers returns the users who can access each of the given accounts
+// (the ones of their bank and the users they are shared with), by account
+// id. The accounts need their Id and BankId.
+func (pdb *publishingDataBase) accountUsers(
+	accs []DBAccount) (map[int][]int, error) {
+
+	var users = map[int][]int{}
+	if len(accs) == 0 {
+		return users, nil
+	}
+
+	var bnkIds []int
+	for _, acc := range accs {
+		if !intInArray(acc.BankId, bnkIds) {
+			bnkIds = append(bnkIds, acc.BankId)
+		}
+	}
+	bankUsers, err := pdb.bankUsers(bnkIds)
+	if err != nil {
+		return nil, err
+	}
+	for _, acc := range accs {
+		for _, userId := range bankUsers[acc.BankId] {
+			users[acc.Id] = addUserId(users[acc.Id], userId)
+		}
+	}
+
+	var sf DBShareFilters
+	sf.AccountIds.SetFilter(accountIds(accs))
+	shrs, err := pdb.GoBanksDataBase.GetShares(sf,
+		[]string{"AccountId", "UserId"}, 0)
+	if err != nil {
+		return nil, err
+	}
+	for _, shr := range shrs {
+		users[shr.AccountId] = addUserId(users[shr.AccountId], shr.UserId)
+	}
+	return users, nil
+}
+
+// addUserId adds the given user id to the list if not already in it.
+func addUserId(userIds []int, userId int) []int {
+	if userId == 0 || intInArray(userId, userIds) {
+		return userIds
+	}
+	return append(userIds, userId)
+}
+
+// allFields returns every field name of the given fields map (e.g.
+// bank_fields).
+func allFields(fields map[string]string) []string {
+	var res []string
+	for field := range fields {
+		res = append(res, field)
+	}
+	return res
+}
+
+func bankIds(bnks []DBBank) []int {
+	var ids = []int{}
+	for _, bnk := range bnks {
+		ids = append(ids, bnk.Id)
+	}
+	return ids
+}
+
+func accountIds(accs []DBAccount) []int {
+	var ids = []int{}
+	for _, acc := range accs {
+		ids = append(ids, acc.Id)
+	}
+	return ids
+}
+
+func categoryIds(ctgs []DBCategory) []int {
+	var ids = []int{}
+	for _, ctg := range ctgs {
+		ids = append(ids, ctg.Id)
+	}
+	return ids
+}
+
+func transactionIds(trns []DBTransaction) []int {
+	var ids = []int{}
+	for _, trn := range trns {
+		ids = append(ids, trn.Id)
+	}
+	return ids
+}
+
+func shareIds(shrs []DBShare) []int {
+	var ids = []int{}
+	for _, shr := range shrs {
+		ids = append(ids, shr.Id)
+	}
+	return ids
+}
+
+// intInArray returns true if the given int is in the given array.
+func intInArray(val int, arr []int) bool {
+	for _, v := range arr {
+		if v == val {
+			return true
+		}
+	}
+	return false
+}
@@ -1,6 +1,7 @@
 package database
 
 import "database/sql"
+import "strconv"
 import "sync"
 import _ "github.com/go-sql-driver/mysql"
 
@@ -8,6 +9,12 @@ import _ "github.com/go-sql-driver/mysql"
 type goBanksSql struct {
 	db    *sql.DB
 	mutex sync.Mutex
+
+	// transaction in which every query is performed, nil if none
+	tx *sql.Tx
+
+	// number of savepoints created in tx by nested calls to WithTx
+	savepoints int
 }
 
 func newMySqlDB(user string, pw string, access string,
@@ -33,6 +40,70 @@ func (gbs *goBanksSql) Close() (err error) {
 	return gbs.db.Close()
 }
 
+// WithTx calls fn with a goBanksSql performing every query in a new sql
+// transaction. The transaction is committed if fn returns nil and rolled
+// back otherwise, including when fn panics (the panic then goes on).
+// If gbs is already in a transaction, a savepoint is used instead: only the
+// queries made by fn are rolled back if it fails.
+func (gbs *goBanksSql) WithTx(fn func(GoBanksDataBase) error) error {
+	if gbs.tx != nil {
+		return gbs.withSavepoint(fn)
+	}
+
+	tx, err := gbs.db.Begin()
+	if err != nil {
+		return databaseQueryError{err.Error()}
+	}
+
+	// rolled back on errors and panics, which would else leak the
+	// connection and its locks
+	var committed bool
+	defer func() {
+		if !committed {
+			tx.Rollback()
+		}
+	}()
+
+	if err = fn(&goBanksSql{db: gbs.db, tx: tx}); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return databaseQueryError{err.Error()}
+	}
+	committed = true
+	return nil
+}
+
+// withSavepoint is WithTx for a goBanksSql already in a transaction.
+func (gbs *goBanksSql) withSavepoint(fn func(GoBanksDataBase) error) error {
+	var nested = &goBanksSql{db: gbs.db, tx: gbs.tx,
+		savepoints: gbs.savepoints + 1}
+	var name = "sp" + strconv.Itoa(nested.savepoints)
+
+	if _, err := gbs.execQuery("SAVEPOINT " + name); err != nil {
+		return databaseQueryError{err.Error()}
+	}
+
+	// rolled back on errors and panics, like in WithTx
+	var released bool
+	defer func() {
+		if !released {
+			gbs.execQuery("ROLLBACK TO SAVEPOINT " + name)
+		}
+	}()
+
+	if err := fn(nested); err != nil {
+		return err
+	}
+
+	if _, err := gbs.execQuery("RELEASE SAVEPOINT " + name); err != nil {
+		return databaseQueryError{err.Error()}
+	}
+	released = true
+	return nil
+}
+
 // setMysqlDB connect to the mysql database from the given config.
 func setMysqlDB(c map[string]interface{}) (GoBanksDataBase, databaseError) {
 
@@ -5,15 +5,18 @@ func (gbs *goBanksSql) AddAccount(acc DBAccountParams) (DBAccount, error) {
 		return DBAccount{}, missingInformationsError{"BankId"}
 	}
 
+	var fields = filterFields([]string{"BankId", "Name", "Description",
+		"Version"}, account_fields)
+
 	values := make([]interface{}, 0)
 	values = append(values,
 		acc.BankId,
 		acc.Name,
 		acc.Description,
+		1,
 	)
 
-	id, err := gbs.insertInTable(account_table,
-		stripIdField(account_fields), values)
+	id, err := gbs.insertInTable(account_table, fields, values)
 
 	if err != nil {
 		return DBAccount{}, databaseQueryError{err: err.Error()}
@@ -21,6 +24,7 @@ func (gbs *goBanksSql) AddAccount(acc DBAccountParams) (DBAccount, error) {
 
 	return DBAccount{
 		Id:          id,
+		Version:     1,
 		BankId:      acc.BankId,
 		Name:        acc.Name,
 		Description: acc.Description,
@@ -52,7 +56,8 @@ func (gbs *goBanksSql) UpdateAccounts(f DBAccountFilters,
 		}
 	}
 
-	return gbs.updateTable(account_table, whereString, args, filteredFields, values)
+	return gbs.updateVersionedTable(account_table, whereString, args,
+		filteredFields, values, f.Versions)
 }
 
 func (gbs *goBanksSql) RemoveAccounts(f DBAccountFilters) error {
@@ -64,8 +69,8 @@ func (gbs *goBanksSql) RemoveAccounts(f DBAccountFilters) error {
 
 	var queryString = joinStringsWithSpace(deleteString, whereString)
 
-	_, err := gbs.execQuery(queryString, args...)
-	return err
+	res, err := gbs.execQuery(queryString, args...)
+	return checkVersionMatched(res, err, f.Versions)
 }
 
 func (gbs *goBanksSql) GetAccounts(f DBAccountFilters,
@@ -79,16 +84,18 @@ func (gbs *goBanksSql) GetAccounts(f DBAccountFilters,
 		return []DBAccount{}, nil
 	}
 
-	var queryString = joinStringsWithSpace(selectString, whereString)
+	var queryString = joinStringsWithSpace(selectString, whereString,
+		constructOrderString(f.Sort, account_fields))
 	if limit != 0 {
-		queryString = joinStringsWithSpace(queryString, "LIMIT ?")
-		args = append(args, limit)
+		queryString = joinStringsWithSpace(queryString,
+			constructLimitString(limit))
 	}
 
 	rows, err := gbs.getRows(queryString, args...)
 	if err != nil {
 		return []DBAccount{}, databaseQueryError{err.Error()}
 	}
+	defer rows.Close()
 
 	var accs []DBAccount
 
@@ -101,6 +108,8 @@ func (gbs *goBanksSql) GetAccounts(f DBAccountFilters,
 			switch field {
 			case "Id":
 				values = append(values, &acc.Id)
+			case "Version":
+				values = append(values, &acc.Version)
 			case "BankId":
 				values = append(values, &acc.BankId)
 			case "Name":
@@ -119,6 +128,17 @@ func (gbs *goBanksSql) GetAccounts(f DBAccountFilters,
 	return accs, nil
 }
 
+// CountAccounts returns the number of accounts corresponding to the
+// given filters, without taking their After filter into account.
+func (gbs *goBanksSql) CountAccounts(f DBAccountFilters) (int, error) {
+	f.After = DBCursorFilter{}
+	var whereString, args, valid = constructAccountFilterQuery(f)
+	if !valid {
+		return 0, nil
+	}
+	return gbs.countRows(account_table, whereString, args)
+}
+
 // constructAccountFilterQuery takes your filters and returns two elements
 // usable for the final sql query:
 // - The "WHERE" string
@@ -144,5 +164,17 @@ func constructAccountFilterQuery(f DBAccountFilters) (string,
 		f.Names,
 		f.BankIds)
 
+	if !addFilterOneOf(&conditionString, &args, account_fields["Version"],
+		f.Versions) {
+		return "", nil, false
+	}
+
+	addFilterAccountAccess(&conditionString, &args, f.UserId, f.Roles)
+
+	if !addFilterAfter(&conditionString, &args, f.Sort, f.After,
+		account_fields) {
+		return "", nil, false
+	}
+
 	return processFilterQuery(conditionString, args, ok)
 }
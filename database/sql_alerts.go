@@ -0,0 +1,296 @@
+package database
+
+import "database/sql"
+import "strings"
+
+func (gbs *goBanksSql) AddAlertRule(rl DBAlertRuleParams) (DBAlertRule, error) {
+	if rl.UserId == 0 {
+		return DBAlertRule{}, missingInformationsError{"UserId"}
+	}
+	if rl.Kind == "" {
+		return DBAlertRule{}, missingInformationsError{"Kind"}
+	}
+
+	var fields = filterFields([]string{"UserId", "Kind", "AccountId",
+		"CategoryId", "Threshold", "Notifiers", "Email", "CreationDate"},
+		alert_rule_fields)
+
+	values := make([]interface{}, 0)
+	values = append(values,
+		rl.UserId,
+		rl.Kind,
+		nullableId(rl.AccountId),
+		nullableId(rl.CategoryId),
+		rl.Threshold,
+		strings.Join(rl.Notifiers, ","),
+		rl.Email,
+		rl.CreationDate,
+	)
+
+	id, err := gbs.insertInTable(alert_rule_table, fields, values)
+	if err != nil {
+		return DBAlertRule{}, databaseQueryError{err.Error()}
+	}
+
+	return DBAlertRule{
+		Id:           id,
+		UserId:       rl.UserId,
+		Kind:         rl.Kind,
+		AccountId:    rl.AccountId,
+		CategoryId:   rl.CategoryId,
+		Threshold:    rl.Threshold,
+		Notifiers:    rl.Notifiers,
+		Email:        rl.Email,
+		CreationDate: rl.CreationDate,
+	}, nil
+}
+
+func (gbs *goBanksSql) RemoveAlertRules(f DBAlertRuleFilters) error {
+	var deleteString = constructDeleteString(alert_rule_table)
+	var whereString, args, valid = constructAlertRuleFilterQuery(f)
+	if !valid {
+		return nil
+	}
+
+	queryString := joinStringsWithSpace(deleteString, whereString)
+	_, err := gbs.execQuery(queryString, args...)
+	return err
+}
+
+func (gbs *goBanksSql) GetAlertRules(f DBAlertRuleFilters, fields []string,
+	limit uint) ([]DBAlertRule, error) {
+
+	var selectString = constructSelectString(alert_rule_table,
+		filterFields(fields, alert_rule_fields))
+
+	var whereString, args, valid = constructAlertRuleFilterQuery(f)
+	if !valid {
+		return []DBAlertRule{}, nil
+	}
+
+	var queryString = joinStringsWithSpace(selectString, whereString)
+	if limit != 0 {
+		queryString = joinStringsWithSpace(queryString, "LIMIT ?")
+		args = append(args, limit)
+	}
+
+	rows, err := gbs.getRows(queryString, args...)
+	if err != nil {
+		return []DBAlertRule{}, databaseQueryError{err.Error()}
+	}
+	defer rows.Close()
+
+	var rls []DBAlertRule
+
+	for rows.Next() {
+		var rl DBAlertRule
+		var notifiers string
+
+		// the account or category not set is NULL
+		var accountId, categoryId sql.NullInt64
+
+		var values = make([]interface{}, 0)
+
+		for _, field := range fields {
+			switch field {
+			case "Id":
+				values = append(values, &rl.Id)
+			case "UserId":
+				values = append(values, &rl.UserId)
+			case "Kind":
+				values = append(values, &rl.Kind)
+			case "AccountId":
+				values = append(values, &accountId)
+			case "CategoryId":
+				values = append(values, &categoryId)
+			case "Threshold":
+				values = append(values, &rl.Threshold)
+			case "Notifiers":
+				values = append(values, &notifiers)
+			case "Email":
+				values = append(values, &rl.Email)
+			case "CreationDate":
+				values = append(values, &rl.CreationDate)
+			}
+		}
+
+		if err = rows.Scan(values...); err != nil {
+			return []DBAlertRule{}, err
+		}
+
+		rl.AccountId = int(accountId.Int64)
+		rl.CategoryId = int(categoryId.Int64)
+		rl.Notifiers = splitCommaToStrings(notifiers)
+		rls = append(rls, rl)
+	}
+	return rls, rows.Err()
+}
+
+func (gbs *goBanksSql) AddAlert(alt DBAlertParams) (DBAlert, error) {
+	if alt.RuleId == 0 {
+		return DBAlert{}, missingInformationsError{"RuleId"}
+	}
+	if alt.UserId == 0 {
+		return DBAlert{}, missingInformationsError{"UserId"}
+	}
+
+	var fields = filterFields([]string{"RuleId", "UserId", "Kind", "Period",
+		"Value", "Threshold", "Message", "CreationDate"}, alert_fields)
+
+	values := make([]interface{}, 0)
+	values = append(values,
+		alt.RuleId,
+		alt.UserId,
+		alt.Kind,
+		alt.Period,
+		alt.Value,
+		alt.Threshold,
+		alt.Message,
+		alt.CreationDate,
+	)
+
+	id, err := gbs.insertInTable(alert_table, fields, values)
+	if err != nil {
+		return DBAlert{}, databaseQueryError{err.Error()}
+	}
+
+	return DBAlert{
+		Id:           id,
+		RuleId:       alt.RuleId,
+		UserId:       alt.UserId,
+		Kind:         alt.Kind,
+		Period:       alt.Period,
+		Value:        alt.Value,
+		Threshold:    alt.Threshold,
+		Message:      alt.Message,
+		CreationDate: alt.CreationDate,
+	}, nil
+}
+
+func (gbs *goBanksSql) RemoveAlerts(f DBAlertFilters) error {
+	var deleteString = constructDeleteString(alert_table)
+	var whereString, args, valid = constructAlertFilterQuery(f)
+	if !valid {
+		return nil
+	}
+
+	queryString := joinStringsWithSpace(deleteString, whereString)
+	_, err := gbs.execQuery(queryString, args...)
+	return err
+}
+
+func (gbs *goBanksSql) GetAlerts(f DBAlertFilters, fields []string,
+	limit uint) ([]DBAlert, error) {
+
+	var selectString = constructSelectString(alert_table,
+		filterFields(fields, alert_fields))
+
+	var whereString, args, valid = constructAlertFilterQuery(f)
+	if !valid {
+		return []DBAlert{}, nil
+	}
+
+	var queryString = joinStringsWithSpace(selectString, whereString,
+		constructOrderString(f.Sort, alert_fields))
+	if limit != 0 {
+		queryString = joinStringsWithSpace(queryString, "LIMIT ?")
+		args = append(args, limit)
+	}
+
+	rows, err := gbs.getRows(queryString, args...)
+	if err != nil {
+		return []DBAlert{}, databaseQueryError{err.Error()}
+	}
+	defer rows.Close()
+
+	var alts []DBAlert
+
+	for rows.Next() {
+		var alt DBAlert
+
+		var values = make([]interface{}, 0)
+
+		for _, field := range fields {
+			switch field {
+			case "Id":
+				values = append(values, &alt.Id)
+			case "RuleId":
+				values = append(values, &alt.RuleId)
+			case "UserId":
+				values = append(values, &alt.UserId)
+			case "Kind":
+				values = append(values, &alt.Kind)
+			case "Period":
+				values = append(values, &alt.Period)
+			case "Value":
+				values = append(values, &alt.Value)
+			case "Threshold":
+				values = append(values, &alt.Threshold)
+			case "Message":
+				values = append(values, &alt.Message)
+			case "CreationDate":
+				values = append(values, &alt.CreationDate)
+			}
+		}
+
+		if err = rows.Scan(values...); err != nil {
+			return []DBAlert{}, err
+		}
+
+		alts = append(alts, alt)
+	}
+	return alts, rows.Err()
+}
+
+// constructAlertRuleFilterQuery takes your filters and returns two elements
+// usable for the final sql query:
+// - The "WHERE" string
+//   For example -> "WHERE user_id=? AND ( id = ? )"
+// - An array on interfaces for the sql arguments.
+//   For example -> 3, 5
+// Also returns a boolean if the resulting query is not doable (ex: trying to
+// filter rules with an empty array of int).
+func constructAlertRuleFilterQuery(f DBAlertRuleFilters) (string,
+	[]interface{}, bool) {
+
+	var conditionString string
+	var args = make([]interface{}, 0)
+
+	addFilterEq(&conditionString, &args, alert_rule_fields["UserId"],
+		f.UserId)
+
+	ok := addFilterOneOf(&conditionString, &args, alert_rule_fields["Id"],
+		f.Ids)
+
+	return processFilterQuery(conditionString, args, ok)
+}
+
+// constructAlertFilterQuery takes your filters and returns two elements
+// usable for the final sql query:
+// - The "WHERE" string
+//   For example -> "WHERE user_id=? AND ( rule_id = ? ) AND ( period = ? )"
+// - An array on interfaces for the sql arguments.
+//   For example -> 3, 5, "2016-02"
+// Also returns a boolean if the resulting query is not doable (ex: trying to
+// filter alerts with an empty array of int).
+func constructAlertFilterQuery(f DBAlertFilters) (string,
+	[]interface{}, bool) {
+
+	var conditionString string
+	var args = make([]interface{}, 0)
+
+	addFilterEq(&conditionString, &args, alert_fields["UserId"], f.UserId)
+
+	var fieldsOneOf = []string{
+		alert_fields["Id"],
+		alert_fields["RuleId"],
+		alert_fields["Period"],
+	}
+	ok := addFiltersOneOf(&conditionString, &args, fieldsOneOf,
+		f.Ids,
+		f.RuleIds,
+		f.Periods,
+	)
+
+	return processFilterQuery(conditionString, args, ok)
+}
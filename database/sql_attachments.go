@@ -0,0 +1,175 @@
+package database
+
+func (gbs *goBanksSql) AddAttachment(att DBAttachmentParams) (DBAttachment,
+	error) {
+
+	if att.TransactionId == 0 {
+		return DBAttachment{}, missingInformationsError{"TransactionId"}
+	}
+	if att.Hash == "" {
+		return DBAttachment{}, missingInformationsError{"Hash"}
+	}
+
+	var fields = filterFields([]string{"TransactionId", "UserId", "Name",
+		"MimeType", "Size", "Hash", "CreationDate"}, attachment_fields)
+
+	values := make([]interface{}, 0)
+	values = append(values,
+		att.TransactionId,
+		att.UserId,
+		att.Name,
+		att.MimeType,
+		att.Size,
+		att.Hash,
+		att.CreationDate,
+	)
+
+	id, err := gbs.insertInTable(attachment_table, fields, values)
+	if err != nil {
+		return DBAttachment{}, databaseQueryError{err.Error()}
+	}
+
+	return DBAttachment{
+		Id:            id,
+		TransactionId: att.TransactionId,
+		UserId:        att.UserId,
+		Name:          att.Name,
+		MimeType:      att.MimeType,
+		Size:          att.Size,
+		Hash:          att.Hash,
+		CreationDate:  att.CreationDate,
+	}, nil
+}
+
+func (gbs *goBanksSql) RemoveAttachments(f DBAttachmentFilters) error {
+	var deleteString = constructDeleteString(attachment_table)
+	var whereString, args, valid = constructAttachmentFilterQuery(f)
+	if !valid {
+		return nil
+	}
+
+	queryString := joinStringsWithSpace(deleteString, whereString)
+	_, err := gbs.execQuery(queryString, args...)
+	return err
+}
+
+func (gbs *goBanksSql) GetAttachments(f DBAttachmentFilters, fields []string,
+	limit uint) ([]DBAttachment, error) {
+
+	var selectString = constructSelectString(attachment_table,
+		filterFields(fields, attachment_fields))
+
+	var whereString, args, valid = constructAttachmentFilterQuery(f)
+	if !valid {
+		return []DBAttachment{}, nil
+	}
+
+	var queryString = joinStringsWithSpace(selectString, whereString)
+	if limit != 0 {
+		queryString = joinStringsWithSpace(queryString, "LIMIT ?")
+		args = append(args, limit)
+	}
+
+	rows, err := gbs.getRows(queryString, args...)
+	if err != nil {
+		return []DBAttachment{}, databaseQueryError{err.Error()}
+	}
+	defer rows.Close()
+
+	var atts []DBAttachment
+
+	for rows.Next() {
+		var att DBAttachment
+
+		var values = make([]interface{}, 0)
+
+		for _, field := range fields {
+			switch field {
+			case "Id":
+				values = append(values, &att.Id)
+			case "TransactionId":
+				values = append(values, &att.TransactionId)
+			case "UserId":
+				values = append(values, &att.UserId)
+			case "Name":
+				values = append(values, &att.Name)
+			case "MimeType":
+				values = append(values, &att.MimeType)
+			case "Size":
+				values = append(values, &att.Size)
+			case "Hash":
+				values = append(values, &att.Hash)
+			case "CreationDate":
+				values = append(values, &att.CreationDate)
+			}
+		}
+
+		if err = rows.Scan(values...); err != nil {
+			return []DBAttachment{}, err
+		}
+
+		atts = append(atts, att)
+	}
+	return atts, rows.Err()
+}
+
+func (gbs *goBanksSql) GetTransactionAttachmentHashes(
+	filters DBTransactionFilters) ([]string, error) {
+	filters.After = DBCursorFilter{}
+	var whereString, args, valid = constructTransactionFilterQuery(filters)
+	if !valid {
+		return []string{}, nil
+	}
+
+	// the transactions are filtered in a subquery, as they may be too many
+	// to be given as arguments
+	var queryString = "SELECT DISTINCT " + attachment_fields["Hash"] +
+		" FROM " + attachment_table + " WHERE " +
+		attachment_fields["TransactionId"] + " IN ( " +
+		joinStringsWithSpace("SELECT "+transaction_fields["Id"]+" FROM "+
+			transaction_table, whereString) + " )"
+
+	rows, err := gbs.getRows(queryString, args...)
+	if err != nil {
+		return []string{}, databaseQueryError{err.Error()}
+	}
+	defer rows.Close()
+
+	var hashes []string
+	for rows.Next() {
+		var hash string
+		if err = rows.Scan(&hash); err != nil {
+			return []string{}, err
+		}
+		hashes = append(hashes, hash)
+	}
+	return hashes, rows.Err()
+}
+
+// constructAttachmentFilterQuery takes your filters and returns two elements
+// usable for the final sql query:
+// - The "WHERE" string
+//   For example -> "WHERE ( transaction_id = ? ) AND ( hash = ? )"
+// - An array on interfaces for the sql arguments.
+//   For example -> 3, "9f86d081..."
+// Also returns a boolean if the resulting query is not doable (ex: trying to
+// filter attachments with an empty array of int).
+func constructAttachmentFilterQuery(f DBAttachmentFilters) (string,
+	[]interface{}, bool) {
+
+	var conditionString string
+	var args = make([]interface{}, 0)
+
+	var fieldsOneOf = []string{
+		attachment_fields["Id"],
+		attachment_fields["TransactionId"],
+		attachment_fields["Hash"],
+	}
+	ok := addFiltersOneOf(&conditionString, &args, fieldsOneOf,
+		f.Ids,
+		f.TransactionIds,
+		f.Hashes,
+	)
+
+	return processFilterQuery(conditionString, args, ok)
+}
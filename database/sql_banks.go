@@ -5,10 +5,13 @@ func (gbs *goBanksSql) AddBank(bnk DBBankParams) (DBBank, error) {
 		return DBBank{}, missingInformationsError{"UserId"}
 	}
 
+	var fields = filterFields([]string{"UserId", "Name", "Description",
+		"Version"}, bank_fields)
+
 	values := make([]interface{}, 0)
-	values = append(values, bnk.UserId, bnk.Name, bnk.Description)
+	values = append(values, bnk.UserId, bnk.Name, bnk.Description, 1)
 
-	id, err := gbs.insertInTable(bank_table, stripIdField(bank_fields), values)
+	id, err := gbs.insertInTable(bank_table, fields, values)
 
 	if err != nil {
 		return DBBank{}, databaseQueryError{err.Error()}
@@ -16,6 +19,7 @@ func (gbs *goBanksSql) AddBank(bnk DBBankParams) (DBBank, error) {
 
 	return DBBank{
 		Id:          id,
+		Version:     1,
 		UserId:      bnk.UserId,
 		Name:        bnk.Name,
 		Description: bnk.Description,
@@ -48,7 +52,8 @@ func (gbs *goBanksSql) UpdateBanks(f DBBankFilters, fields []string,
 		}
 	}
 
-	return gbs.updateTable(bank_table, whereString, args, filteredFields, values)
+	return gbs.updateVersionedTable(bank_table, whereString, args,
+		filteredFields, values, f.Versions)
 }
 
 func (gbs *goBanksSql) RemoveBanks(f DBBankFilters) error {
@@ -59,8 +64,8 @@ func (gbs *goBanksSql) RemoveBanks(f DBBankFilters) error {
 	}
 
 	queryString := joinStringsWithSpace(deleteString, whereString)
-	_, err := gbs.execQuery(queryString, args...)
-	return err
+	res, err := gbs.execQuery(queryString, args...)
+	return checkVersionMatched(res, err, f.Versions)
 }
 
 func (gbs *goBanksSql) GetBanks(f DBBankFilters, fields []string,
@@ -74,16 +79,18 @@ func (gbs *goBanksSql) GetBanks(f DBBankFilters, fields []string,
 		return []DBBank{}, nil
 	}
 
-	var queryString = joinStringsWithSpace(selectString, whereString)
+	var queryString = joinStringsWithSpace(selectString, whereString,
+		constructOrderString(f.Sort, bank_fields))
 	if limit != 0 {
-		queryString = joinStringsWithSpace(queryString, "LIMIT ?")
-		args = append(args, limit)
+		queryString = joinStringsWithSpace(queryString,
+			constructLimitString(limit))
 	}
 
 	rows, err := gbs.getRows(queryString, args...)
 	if err != nil {
 		return []DBBank{}, databaseQueryError{err.Error()}
 	}
+	defer rows.Close()
 
 	var bnks []DBBank
 
@@ -96,6 +103,8 @@ func (gbs *goBanksSql) GetBanks(f DBBankFilters, fields []string,
 			switch field {
 			case "Id":
 				values = append(values, &bnk.Id)
+			case "Version":
+				values = append(values, &bnk.Version)
 			case "UserId":
 				values = append(values, &bnk.UserId)
 			case "Name":
@@ -114,6 +123,17 @@ func (gbs *goBanksSql) GetBanks(f DBBankFilters, fields []string,
 	return bnks, nil
 }
 
+// CountBanks returns the number of banks corresponding to the
+// given filters, without taking their After filter into account.
+func (gbs *goBanksSql) CountBanks(f DBBankFilters) (int, error) {
+	f.After = DBCursorFilter{}
+	var whereString, args, valid = constructBankFilterQuery(f)
+	if !valid {
+		return 0, nil
+	}
+	return gbs.countRows(bank_table, whereString, args)
+}
+
 // constructBankFilterQuery takes your filters and returns two elements
 // usable for the final sql query:
 // - The "WHERE" string
@@ -134,5 +154,15 @@ func constructBankFilterQuery(f DBBankFilters) (string, []interface{}, bool) {
 		f.Names,
 	)
 
+	if !addFilterOneOf(&conditionString, &args, bank_fields["Version"],
+		f.Versions) {
+		return "", nil, false
+	}
+
+	if !addFilterAfter(&conditionString, &args, f.Sort, f.After,
+		bank_fields) {
+		return "", nil, false
+	}
+
 	return processFilterQuery(conditionString, args, ok)
 }
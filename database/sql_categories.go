@@ -5,10 +5,14 @@ func (gbs *goBanksSql) AddCategory(ctg DBCategoryParams) (DBCategory, error) {
 		return DBCategory{}, missingInformationsError{"UserId"}
 	}
 
+	var fields = filterFields([]string{"UserId", "Name", "Description",
+		"ParentId", "Version"}, category_fields)
+
 	values := make([]interface{}, 0)
-	values = append(values, ctg.UserId, ctg.Name, ctg.Description, ctg.ParentId)
+	values = append(values, ctg.UserId, ctg.Name, ctg.Description, ctg.ParentId,
+		1)
 
-	id, err := gbs.insertInTable(category_table, stripIdField(category_fields), values)
+	id, err := gbs.insertInTable(category_table, fields, values)
 
 	if err != nil {
 		return DBCategory{}, databaseQueryError{err.Error()}
@@ -16,6 +20,7 @@ func (gbs *goBanksSql) AddCategory(ctg DBCategoryParams) (DBCategory, error) {
 
 	return DBCategory{
 		Id:          id,
+		Version:     1,
 		UserId:      ctg.UserId,
 		Name:        ctg.Name,
 		Description: ctg.Description,
@@ -52,7 +57,8 @@ func (gbs *goBanksSql) UpdateCategories(f DBCategoryFilters, fields []string,
 		}
 	}
 
-	return gbs.updateTable(category_table, whereString, args, filteredFields, values)
+	return gbs.updateVersionedTable(category_table, whereString, args,
+		filteredFields, values, f.Versions)
 }
 
 func (gbs *goBanksSql) RemoveCategories(f DBCategoryFilters) error {
@@ -63,8 +69,8 @@ func (gbs *goBanksSql) RemoveCategories(f DBCategoryFilters) error {
 	}
 
 	queryString := joinStringsWithSpace(deleteString, whereString)
-	_, err := gbs.execQuery(queryString, args...)
-	return err
+	res, err := gbs.execQuery(queryString, args...)
+	return checkVersionMatched(res, err, f.Versions)
 }
 
 func (gbs *goBanksSql) GetCategories(f DBCategoryFilters, fields []string,
@@ -78,16 +84,18 @@ func (gbs *goBanksSql) GetCategories(f DBCategoryFilters, fields []string,
 		return []DBCategory{}, nil
 	}
 
-	var queryString = joinStringsWithSpace(selectString, whereString)
+	var queryString = joinStringsWithSpace(selectString, whereString,
+		constructOrderString(f.Sort, category_fields))
 	if limit != 0 {
-		queryString = joinStringsWithSpace(queryString, "LIMIT ?")
-		args = append(args, limit)
+		queryString = joinStringsWithSpace(queryString,
+			constructLimitString(limit))
 	}
 
 	rows, err := gbs.getRows(queryString, args...)
 	if err != nil {
 		return []DBCategory{}, databaseQueryError{err.Error()}
 	}
+	defer rows.Close()
 
 	var bnks []DBCategory
 
@@ -100,6 +108,8 @@ func (gbs *goBanksSql) GetCategories(f DBCategoryFilters, fields []string,
 			switch field {
 			case "Id":
 				values = append(values, &ctg.Id)
+			case "Version":
+				values = append(values, &ctg.Version)
 			case "UserId":
 				values = append(values, &ctg.UserId)
 			case "Name":
@@ -120,6 +130,17 @@ func (gbs *goBanksSql) GetCategories(f DBCategoryFilters, fields []string,
 	return bnks, nil
 }
 
+// CountCategories returns the number of categories corresponding to the
+// given filters, without taking their After filter into account.
+func (gbs *goBanksSql) CountCategories(f DBCategoryFilters) (int, error) {
+	f.After = DBCursorFilter{}
+	var whereString, args, valid = constructCategoryFilterQuery(f)
+	if !valid {
+		return 0, nil
+	}
+	return gbs.countRows(category_table, whereString, args)
+}
+
 // constructCategoryFilterQuery takes your filters and returns two elements
 // usable for the final sql query:
 // - The "WHERE" string
@@ -146,5 +167,15 @@ func constructCategoryFilterQuery(f DBCategoryFilters) (string, []interface{}, b
 		f.ParentIds,
 	)
 
+	if !addFilterOneOf(&conditionString, &args, category_fields["Version"],
+		f.Versions) {
+		return "", nil, false
+	}
+
+	if !addFilterAfter(&conditionString, &args, f.Sort, f.After,
+		category_fields) {
+		return "", nil, false
+	}
+
 	return processFilterQuery(conditionString, args, ok)
 }
@@ -1,5 +1,6 @@
 package database
 
+// totp_last_step is expected to default to 0
 const user_table = "user"
 
 var user_fields = map[string]string{
@@ -8,12 +9,120 @@ var user_fields = map[string]string{
 	"PasswordHash":  "password",
 	"Salt":          "salt",
 	"Administrator": "administrator",
+	"TotpSecret":    "totp_secret",
+	"TotpEnabled":   "totp_enabled",
+	"TotpLastStep":  "totp_last_step",
 }
 
+const recovery_code_table = "recovery_code"
+
+var recovery_code_fields = map[string]string{
+	"Id":       "id",
+	"UserId":   "user_id",
+	"CodeHash": "code_hash",
+}
+
+const login_attempt_table = "login_attempt"
+
+var login_attempt_fields = map[string]string{
+	"Id":          "id",
+	"UserId":      "user_id",
+	"UserName":    "user_name",
+	"IpAddress":   "ip_address",
+	"Success":     "success",
+	"AttemptDate": "attempt_date",
+}
+
+// scopes and account_ids are stored as comma-separated lists
+const personal_token_table = "personal_token"
+
+var personal_token_fields = map[string]string{
+	"Id":             "id",
+	"UserId":         "user_id",
+	"Name":           "name",
+	"TokenHash":      "token_hash",
+	"Scopes":         "scopes",
+	"AccountIds":     "account_ids",
+	"CreationDate":   "creation_date",
+	"ExpirationDate": "expiration_date",
+}
+
+// event_types and account_ids are stored as comma-separated lists
+const webhook_table = "webhook"
+
+var webhook_fields = map[string]string{
+	"Id":           "id",
+	"UserId":       "user_id",
+	"Url":          "url",
+	"Secret":       "secret",
+	"EventTypes":   "event_types",
+	"AccountIds":   "account_ids",
+	"MinDebit":     "min_debit",
+	"MinCredit":    "min_credit",
+	"CreationDate": "creation_date",
+}
+
+// deliveries are both the queue of the events to send to the webhooks and
+// the log of the ones sent. Pending deliveries due are found through an
+// index on (status, next_attempt_date).
+const webhook_delivery_table = "webhook_delivery"
+
+var webhook_delivery_fields = map[string]string{
+	"Id":              "id",
+	"WebhookId":       "webhook_id",
+	"EventId":         "event_id",
+	"EventType":       "event_type",
+	"Payload":         "payload",
+	"Status":          "status",
+	"Attempts":        "attempts",
+	"StatusCode":      "status_code",
+	"Error":           "error",
+	"CreationDate":    "creation_date",
+	"NextAttemptDate": "next_attempt_date",
+	"LastAttemptDate": "last_attempt_date",
+}
+
+// notifiers are stored as a comma-separated list.
+// Alert rules are expected to be removed along with their user, account or
+// category (foreign keys with ON DELETE CASCADE). The account or category
+// not set is NULL.
+const alert_rule_table = "alert_rule"
+
+var alert_rule_fields = map[string]string{
+	"Id":           "id",
+	"UserId":       "user_id",
+	"Kind":         "kind",
+	"AccountId":    "account_id",
+	"CategoryId":   "category_id",
+	"Threshold":    "threshold",
+	"Notifiers":    "notifiers",
+	"Email":        "email",
+	"CreationDate": "creation_date",
+}
+
+// an alert is fired at most once per rule and period, found through an
+// index on (rule_id, period).
+const alert_table = "alert"
+
+var alert_fields = map[string]string{
+	"Id":           "id",
+	"RuleId":       "rule_id",
+	"UserId":       "user_id",
+	"Kind":         "kind",
+	"Period":       "period",
+	"Value":        "value",
+	"Threshold":    "threshold",
+	"Message":      "message",
+	"CreationDate": "creation_date",
+}
+
+// Banks, accounts, categories, shares and transactions have a version,
+// starting at 1 and incremented on every update (see updateVersionedTable).
 const bank_table = "bank"
 
 var bank_fields = map[string]string{
 	"Id":          "id",
+	"Version":     "version",
 	"UserId":      "user_id",
 	"Name":        "name",
 	"Description": "description",
@@ -23,6 +132,7 @@ const account_table = "account"
 
 var account_fields = map[string]string{
 	"Id":          "id",
+	"Version":     "version",
 	"BankId":      "bank_id",
 	"Name":        "name",
 	"Description": "description",
@@ -32,16 +142,73 @@ const category_table = "category"
 
 var category_fields = map[string]string{
 	"Id":          "id",
+	"Version":     "version",
 	"UserId":      "user_id",
 	"Name":        "name",
 	"Description": "description",
 	"ParentId":    "parent_id",
 }
 
+// tag names are unique for a user (index on (user_id, name))
+const tag_table = "tag"
+
+var tag_fields = map[string]string{
+	"Id":     "id",
+	"UserId": "user_id",
+	"Name":   "name",
+}
+
+// Tags set on transactions are expected to be removed along with their tag
+// or transaction (foreign keys with ON DELETE CASCADE). The primary key is
+// (transaction_id, tag_id), with an index on tag_id.
+const transaction_tag_table = "transaction_tag"
+
+var transaction_tag_fields = map[string]string{
+	"TransactionId": "transaction_id",
+	"TagId":         "tag_id",
+}
+
+// Attachments are expected to be removed along with their transaction
+// (foreign key with ON DELETE CASCADE), their files being removed from the
+// storage by the API. Indexes on transaction_id and hash are expected, the
+// latter to find the attachments sharing the same file.
+const attachment_table = "attachment"
+
+var attachment_fields = map[string]string{
+	"Id":            "id",
+	"TransactionId": "transaction_id",
+	"UserId":        "user_id",
+	"Name":          "name",
+	"MimeType":      "mime_type",
+	"Size":          "size",
+	"Hash":          "hash",
+	"CreationDate":  "creation_date",
+}
+
+// Shares are expected to be removed along with their bank or account
+// (foreign keys with ON DELETE CASCADE). The side not shared is NULL.
+// UNIQUE indexes on (user_id, bank_id) and (user_id, account_id) are
+// expected: a bank or account is shared once with a user. They also serve
+// the UserId filter of accounts and transactions, as well as indexes on
+// bank.user_id, account.bank_id and transaction.account_id.
+const share_table = "share"
+
+var share_fields = map[string]string{
+	"Id":        "id",
+	"Version":   "version",
+	"UserId":    "user_id",
+	"BankId":    "bank_id",
+	"AccountId": "account_id",
+	"Role":      "role",
+}
+
+// A FULLTEXT index on (label, description, reference) is expected for the
+// Search filter.
 const transaction_table = "transaction"
 
 var transaction_fields = map[string]string{
 	"Id":              "id",
+	"Version":         "version",
 	"AccountId":       "account_id",
 	"Label":           "label",
 	"CategoryId":      "category_id",
@@ -2,23 +2,34 @@ package database
 
 import (
 	"database/sql"
+	"strconv"
 	"strings"
 
 	"fmt"
 )
 
-// execQuery is a simple wrapper for the "Exec" sql method.
+// execQuery is a simple wrapper for the "Exec" sql method, called on the
+// current transaction if any.
 func (gbs *goBanksSql) execQuery(query string, args ...interface{},
 ) (sql.Result, error) {
-	fmt.Printf("%s : %+v\n", query, args)
+	// the arguments are not printed, as they may be secrets
+	fmt.Println(query)
+	if gbs.tx != nil {
+		return gbs.tx.Exec(query, args...)
+	}
 	return gbs.db.Exec(query, args...)
 }
 
-// getRows is a simple wrapper for the "Query" sql method.
+// getRows is a simple wrapper for the "Query" sql method, called on the
+// current transaction if any.
 func (gbs *goBanksSql) getRows(query string,
 	args ...interface{}) (*sql.Rows, error) {
 
-	fmt.Printf("%s : %+v\n", query, args)
+	// the arguments are not printed, as they may be secrets
+	fmt.Println(query)
+	if gbs.tx != nil {
+		return gbs.tx.Query(query, args...)
+	}
 	return gbs.db.Query(query, args...)
 }
 
@@ -28,6 +39,51 @@ func joinStringsWithSpace(queries ...string) string {
 	return strings.Join(queries, " ")
 }
 
+// joinIntsWithComma joins ints into a comma-separated string, used to store
+// lists in a single column.
+// example: joinIntsWithComma([]int{1, 2}) => "1,2"
+func joinIntsWithComma(ints []int) string {
+	var strs = make([]string, 0, len(ints))
+	for _, i := range ints {
+		strs = append(strs, strconv.Itoa(i))
+	}
+	return strings.Join(strs, ",")
+}
+
+// nullableId returns the given id as an sql argument, NULL for 0, used for
+// the optional foreign keys.
+func nullableId(id int) interface{} {
+	if id == 0 {
+		return nil
+	}
+	return id
+}
+
+// splitCommaToInts is the inverse of joinIntsWithComma. Invalid values are
+// ignored.
+// example: splitCommaToInts("1,2") => []int{1, 2}
+func splitCommaToInts(str string) []int {
+	var ints = make([]int, 0)
+	for _, part := range splitCommaToStrings(str) {
+		if i, err := strconv.Atoi(part); err == nil {
+			ints = append(ints, i)
+		}
+	}
+	return ints
+}
+
+// splitCommaToStrings splits a comma-separated string, ignoring empty values.
+// example: splitCommaToStrings("a,,b") => []string{"a", "b"}
+func splitCommaToStrings(str string) []string {
+	var strs = make([]string, 0)
+	for _, part := range strings.Split(str, ",") {
+		if part != "" {
+			strs = append(strs, part)
+		}
+	}
+	return strs
+}
+
 // constructSelectString constructs the beginning of a SELECT sql request
 // based on the wanted fields.
 // example: constructSelectString("foo", []{"aa","bb") ->
@@ -56,9 +112,258 @@ func constructDeleteString(tablename string) string {
 }
 
 // constructLimitString constructs a simple SQL LIMIT instruction.
-// example: constructDeleteString(100) -> "LIMIT 100"
+// example: constructLimitString(100) -> "LIMIT 100"
 func constructLimitString(limit uint) string {
-	return "LIMIT " + string(limit)
+	return "LIMIT " + strconv.FormatUint(uint64(limit), 10)
+}
+
+// constructOrderString constructs a SQL ORDER BY instruction from the wanted
+// sort. Unknown fields are ignored. Rows are always sorted by id last so the
+// order is stable, which is needed for cursors (see addFilterAfter).
+// example: constructOrderString(DBSortFilter{{"Debit", true}}, fieldsMap)
+// -> "ORDER BY debit DESC, id ASC"
+func constructOrderString(sort DBSortFilter,
+	fieldsMap map[string]string) string {
+
+	var orders []string
+	for _, sf := range getSortFields(sort, fieldsMap) {
+		if sf.Descending {
+			orders = append(orders, sf.Field+" DESC")
+		} else {
+			orders = append(orders, sf.Field+" ASC")
+		}
+	}
+	return "ORDER BY " + strings.Join(orders, ", ")
+}
+
+// getSortFields translates the fields of a DBSortFilter into column names
+// and adds the id as the last sort field if it is not already sorted on.
+func getSortFields(sort DBSortFilter,
+	fieldsMap map[string]string) []DBSortField {
+
+	var res []DBSortField
+	var hasId bool
+	if sort.isFilterActivated() {
+		for _, sf := range sort.value {
+			if col, ok := fieldsMap[sf.Field]; ok {
+				res = append(res, DBSortField{col, sf.Descending})
+				hasId = hasId || sf.Field == "Id"
+			}
+		}
+	}
+	if !hasId {
+		res = append(res, DBSortField{fieldsMap["Id"], false})
+	}
+	return res
+}
+
+// addFilterAfter adds a condition only selecting the rows following the
+// cursor for the given sort (keyset pagination).
+// example, for a sort on "Debit" descending:
+// ( debit < ? OR ( debit = ? AND id > ? ) )
+// Returns false if the cursor does not correspond to the sort.
+func addFilterAfter(cString *string, args *[]interface{},
+	sort DBSortFilter, after DBCursorFilter,
+	fieldsMap map[string]string) bool {
+
+	if !after.isFilterActivated() {
+		return true
+	}
+
+	var sortFields = getSortFields(sort, fieldsMap)
+	var values = append([]interface{}{}, after.value.Values...)
+	if len(values) == len(sortFields)-1 {
+		values = append(values, after.value.Id)
+	}
+	if len(values) != len(sortFields) {
+		return false
+	}
+
+	var conditions []string
+	var condArgs []interface{}
+	for i, sf := range sortFields {
+		var operator = ">"
+		if sf.Descending {
+			operator = "<"
+		}
+
+		var parts []string
+		for j := 0; j < i; j++ {
+			parts = append(parts, sortFields[j].Field+" = ?")
+			condArgs = append(condArgs, values[j])
+		}
+		parts = append(parts, sf.Field+" "+operator+" ?")
+		condArgs = append(condArgs, values[i])
+		conditions = append(conditions,
+			"( "+strings.Join(parts, " AND ")+" )")
+	}
+
+	if len(*cString) > 0 {
+		*cString += "AND "
+	}
+	*cString += "( " + strings.Join(conditions, " OR ") + " ) "
+	*args = append(*args, condArgs...)
+	return true
+}
+
+// addFilterAccountAccess adds a condition only selecting the accounts the
+// user given by the UserId filter can access, see
+// constructAccountAccessCondition.
+func addFilterAccountAccess(cString *string, args *[]interface{},
+	userId DBIntFilter, roles DBStringArrayFilter) {
+	if !userId.isFilterActivated() {
+		return
+	}
+
+	var condition, condArgs = constructAccountAccessCondition(userId, roles)
+	if len(*cString) > 0 {
+		*cString += "AND "
+	}
+	*cString += condition + " "
+	*args = append(*args, condArgs...)
+}
+
+// addFilterTransactionAccess adds a condition only selecting the
+// transactions of the accounts the user given by the UserId filter can
+// access, see constructAccountAccessCondition.
+func addFilterTransactionAccess(cString *string, args *[]interface{},
+	userId DBIntFilter, roles DBStringArrayFilter) {
+	if !userId.isFilterActivated() {
+		return
+	}
+
+	var condition, condArgs = constructAccountAccessCondition(userId, roles)
+	if len(*cString) > 0 {
+		*cString += "AND "
+	}
+	*cString += transaction_fields["AccountId"] + " IN ( SELECT " +
+		account_fields["Id"] + " FROM " + account_table + " WHERE " +
+		condition + " ) "
+	*args = append(*args, condArgs...)
+}
+
+// addFilterTags adds a condition only selecting the transactions with any of
+// the wanted tags, or all of them. With the userId filter set, only the tags
+// of this user are considered.
+// Returns false if no tag is wanted, as no transaction can then match.
+// example, for all the tags 3 and 5 of the user 2:
+// id IN ( SELECT transaction_id FROM transaction_tag
+//   WHERE ( tag_id = ? OR tag_id = ? )
+//   AND tag_id IN ( SELECT id FROM tag WHERE user_id = ? )
+//   GROUP BY transaction_id HAVING COUNT(DISTINCT tag_id) = ? )
+func addFilterTags(cString *string, args *[]interface{}, tags DBTagFilter,
+	userId DBIntFilter) bool {
+	if !tags.isFilterActivated() {
+		return true
+	}
+
+	var tagIds []int
+	for _, tagId := range tags.value.TagIds {
+		if !intInArray(tagId, tagIds) {
+			tagIds = append(tagIds, tagId)
+		}
+	}
+	if len(tagIds) == 0 {
+		return false
+	}
+
+	var tagsCondition, tagsArgs = addSqlFilterIntArray(
+		transaction_tag_fields["TagId"], tagIds...)
+	var condition = transaction_fields["Id"] + " IN ( SELECT " +
+		transaction_tag_fields["TransactionId"] + " FROM " +
+		transaction_tag_table + " WHERE " + tagsCondition
+	var condArgs = tagsArgs
+
+	if userId.isFilterActivated() {
+		condition += " AND " + transaction_tag_fields["TagId"] +
+			" IN ( SELECT " + tag_fields["Id"] + " FROM " + tag_table +
+			" WHERE " + tag_fields["UserId"] + " = ? )"
+		condArgs = append(condArgs, userId.value)
+	}
+
+	if tags.value.All {
+		condition += " GROUP BY " + transaction_tag_fields["TransactionId"] +
+			" HAVING COUNT(DISTINCT " + transaction_tag_fields["TagId"] +
+			") = ?"
+		condArgs = append(condArgs, len(tagIds))
+	}
+
+	if len(*cString) > 0 {
+		*cString += "AND "
+	}
+	*cString += condition + " ) "
+	*args = append(*args, condArgs...)
+	return true
+}
+
+// constructAccountAccessCondition constructs a condition on the account
+// table only selecting the accounts an user can access: the ones of the
+// banks he owns and the banks and accounts shared with him. If the roles
+// filter is set, only the shares with one of those roles are considered.
+// example, with the roles filter set to []string{"owner"}:
+// ( bank_id IN ( SELECT id FROM bank WHERE user_id = ? )
+//   OR bank_id IN ( SELECT bank_id FROM share WHERE user_id = ?
+//     AND ( role = ? ) )
+//   OR id IN ( SELECT account_id FROM share WHERE user_id = ?
+//     AND ( role = ? ) ) )
+func constructAccountAccessCondition(userId DBIntFilter,
+	roles DBStringArrayFilter) (string, []interface{}) {
+
+	var condition = "( " + account_fields["BankId"] + " IN ( SELECT " +
+		bank_fields["Id"] + " FROM " + bank_table + " WHERE " +
+		bank_fields["UserId"] + " = ? )"
+	var args = []interface{}{userId.value}
+
+	// no share can give access with an empty list of roles
+	if roles.isFilterActivated() && len(roles.value) == 0 {
+		return condition + " )", args
+	}
+
+	var shareCondition = share_fields["UserId"] + " = ?"
+	var shareArgs = []interface{}{userId.value}
+	if roles.isFilterActivated() {
+		var roleValues []interface{}
+		for _, role := range roles.value {
+			roleValues = append(roleValues, role)
+		}
+		rolesString, rolesArgs := addSqlFilterArray(share_fields["Role"],
+			roleValues...)
+		shareCondition += " AND " + rolesString
+		shareArgs = append(shareArgs, rolesArgs...)
+	}
+
+	condition += " OR " + account_fields["BankId"] + " IN ( SELECT " +
+		share_fields["BankId"] + " FROM " + share_table + " WHERE " +
+		shareCondition + " )"
+	args = append(args, shareArgs...)
+
+	condition += " OR " + account_fields["Id"] + " IN ( SELECT " +
+		share_fields["AccountId"] + " FROM " + share_table + " WHERE " +
+		shareCondition + " )"
+	args = append(args, shareArgs...)
+
+	return condition + " )", args
+}
+
+// countRows performs a SELECT COUNT(*) on any database table, with an
+// optional "where string" and its arguments.
+func (gbs *goBanksSql) countRows(tablename string, conditions string,
+	args []interface{}) (int, error) {
+
+	var count int
+	var queryString = joinStringsWithSpace("SELECT COUNT(*) FROM "+tablename,
+		conditions)
+
+	rows, err := gbs.getRows(queryString, args...)
+	if err != nil {
+		return 0, databaseQueryError{err.Error()}
+	}
+	defer rows.Close()
+
+	if rows.Next() {
+		err = rows.Scan(&count)
+	}
+	return count, err
 }
 
 // updateTable performs a UPDATE request on any database table.
@@ -72,27 +377,61 @@ func (gbs *goBanksSql) updateTable(tablename string,
 	conditions string, conditionsArgs []interface{}, fields []string,
 	args []interface{}) (err error) {
 
-	var sqlQuery string
-	var requestStr string = "UPDATE " + tablename + " SET "
+	_, err = gbs.updateRows(tablename, conditions, conditionsArgs, fields,
+		args)
+	return
+}
 
-	var valuesStr string = ""
+// updateVersionedTable performs the same UPDATE request than updateTable,
+// on a table having a version column which is incremented at the same time.
+// If the given versions filter is set (and is part of the conditions), a
+// versionMismatchError is returned when no row was updated.
+func (gbs *goBanksSql) updateVersionedTable(tablename string,
+	conditions string, conditionsArgs []interface{}, fields []string,
+	args []interface{}, versions DBIntArrayFilter) error {
 
-	var fieldsLength = len(fields)
-	for i, field := range fields {
-		valuesStr += field + "=?"
+	res, err := gbs.updateRows(tablename, conditions, conditionsArgs, fields,
+		args, "version")
+	return checkVersionMatched(res, err, versions)
+}
 
-		if i < fieldsLength-1 {
-			valuesStr += ", "
-		}
+// updateRows performs the UPDATE request of updateTable. The given
+// incremented fields are also incremented by one.
+func (gbs *goBanksSql) updateRows(tablename string,
+	conditions string, conditionsArgs []interface{}, fields []string,
+	args []interface{}, incremented ...string) (sql.Result, error) {
+
+	var sets []string
+	for _, field := range fields {
+		sets = append(sets, field+"=?")
+	}
+	for _, field := range incremented {
+		sets = append(sets, field+"="+field+"+1")
 	}
-	valuesStr += " " + conditions
 
-	args = append(args, conditionsArgs...)
+	var sqlQuery = "UPDATE " + tablename + " SET " +
+		strings.Join(sets, ", ") + " " + conditions
 
-	sqlQuery = requestStr + " " + valuesStr
+	args = append(args, conditionsArgs...)
+	return gbs.execQuery(sqlQuery, args...)
+}
 
-	_, err = gbs.execQuery(sqlQuery, args...)
-	return
+// checkVersionMatched returns a versionMismatchError if a write request
+// filtered on row versions (see updateVersionedTable) did not affect any
+// row. Other errors are returned as is.
+func checkVersionMatched(res sql.Result, err error,
+	versions DBIntArrayFilter) error {
+	if err != nil || !versions.isFilterActivated() {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return versionMismatchError{}
+	}
+	return nil
 }
 
 // removeElemFromTable remove sql row(s) based on the table name, a single
@@ -141,20 +480,6 @@ func (gbs *goBanksSql) insertInTable(tablename string, fields []string,
 	return int(id64), err
 }
 
-// stripIdField browse a map[string]string and delete the one(s) having the
-// value "id".
-// example: stripIdField(map[string]string{"toto":"foo", "tutu":"id",
-// "titi": "bar"}) => map[string]string{"toto": "foo", "titi": "bar"}
-func stripIdField(fields map[string]string) []string {
-	var res = make([]string, 0)
-	for _, field := range fields {
-		if field != "id" {
-			res = append(res, field)
-		}
-	}
-	return res
-}
-
 // Returns a []string by obtaining values from a map[string]string while
 // filtering the keys through a []string
 func filterFields(fields []string, fieldsMap map[string]string) []string {
@@ -297,8 +622,8 @@ func processFilterQuery(conditionString string,
 		return "", nil, false
 	}
 
-	if len(conditionString) < 0 {
-		return "", nil, true
+	if len(conditionString) == 0 {
+		return "", args, true
 	}
 
 	return joinStringsWithSpace("WHERE", conditionString), args, true
@@ -345,3 +670,154 @@ func addFilterEq(cString *string, args *[]interface{}, field string,
 		addConditionEq(cString, args, field, filter.getFilterValue())
 	}
 }
+
+// addFilterMatch adds a full-text search condition on the given fields
+// (which need a FULLTEXT index), see constructFullTextQuery.
+// Nothing is added if the search contains no word.
+func addFilterMatch(cString *string, args *[]interface{}, fields []string,
+	filter dbFilterInterface) {
+	if !filter.isFilterActivated() {
+		return
+	}
+
+	search, _ := filter.getFilterValue().(string)
+	var query = constructFullTextQuery(search)
+	if query == "" {
+		return
+	}
+
+	if len(*cString) > 0 {
+		*cString += "AND "
+	}
+	*cString += "MATCH (" + strings.Join(fields, ", ") +
+		") AGAINST (? IN BOOLEAN MODE) "
+	*args = append(*args, query)
+}
+
+// constructFullTextQuery converts a search typed by a user into a MySQL
+// boolean mode full-text query:
+//   - every word is mandatory and matches words beginning by it
+//   - text between double quotes is a mandatory phrase
+// Characters having a meaning in boolean mode are removed from the words.
+// example: constructFullTextQuery(`amaz "gift card"`) ->
+// `+amaz* +"gift card"`
+func constructFullTextQuery(search string) string {
+	var terms []string
+
+	var parts = strings.Split(search, "\"")
+	for i, part := range parts {
+		var words = strings.Fields(strings.Map(func(r rune) rune {
+			if strings.ContainsRune("+-<>()~*\"@", r) {
+				return ' '
+			}
+			return r
+		}, part))
+		if len(words) == 0 {
+			continue
+		}
+
+		// odd parts are between double quotes (an unclosed quote is
+		// considered closed at the end of the search)
+		if i%2 == 1 {
+			terms = append(terms, "+\""+strings.Join(words, " ")+"\"")
+		} else {
+			for _, word := range words {
+				terms = append(terms, "+"+word+"*")
+			}
+		}
+	}
+	return strings.Join(terms, " ")
+}
+
+// addFilterExpression adds the condition corresponding to a
+// DBFilterExpression (see constructExpressionString).
+// Returns false if the expression is not valid.
+func addFilterExpression(cString *string, args *[]interface{},
+	filter DBExpressionFilter, fieldsMap map[string]string) bool {
+	if !filter.isFilterActivated() {
+		return true
+	}
+
+	exprString, exprArgs, ok := constructExpressionString(filter.value,
+		fieldsMap)
+	if !ok {
+		return false
+	}
+
+	if len(*cString) > 0 {
+		*cString += "AND "
+	}
+	*cString += exprString + " "
+	*args = append(*args, exprArgs...)
+	return true
+}
+
+// constructExpressionString converts a DBFilterExpression into a SQL
+// condition. Properties are translated into columns through fieldsMap and
+// values are always given as arguments, never written in the condition.
+// Returns false for unknown properties or operators, or if an expression
+// has the wrong number of values.
+// example: (Debit > 20 or Label ~ "uber") ->
+// "( debit > ? OR label LIKE ? )", []interface{}{20, "%uber%"}
+func constructExpressionString(expr DBFilterExpression,
+	fieldsMap map[string]string) (string, []interface{}, bool) {
+
+	switch expr.Operator {
+	case ExpressionAnd, ExpressionOr:
+		if len(expr.Operands) == 0 {
+			return "", nil, false
+		}
+		var parts []string
+		var args []interface{}
+		for _, operand := range expr.Operands {
+			str, operandArgs, ok := constructExpressionString(operand,
+				fieldsMap)
+			if !ok {
+				return "", nil, false
+			}
+			parts = append(parts, str)
+			args = append(args, operandArgs...)
+		}
+		var separator = " " + strings.ToUpper(expr.Operator) + " "
+		return "( " + strings.Join(parts, separator) + " )", args, true
+	}
+
+	field, ok := fieldsMap[expr.Field]
+	if !ok {
+		return "", nil, false
+	}
+
+	switch expr.Operator {
+	case ExpressionIn:
+		if len(expr.Values) == 0 {
+			return "", nil, false
+		}
+		str, args := addSqlFilterArray(field, expr.Values...)
+		return str, args, true
+	case ExpressionContains:
+		if len(expr.Values) != 1 {
+			return "", nil, false
+		}
+		str, isString := expr.Values[0].(string)
+		if !isString {
+			return "", nil, false
+		}
+		return field + " LIKE ?",
+			[]interface{}{"%" + escapeLikePattern(str) + "%"}, true
+	case ExpressionEq, ExpressionNotEq, ExpressionGt, ExpressionGEq,
+		ExpressionLt, ExpressionLEq:
+		if len(expr.Values) != 1 {
+			return "", nil, false
+		}
+		return field + " " + expr.Operator + " ?", expr.Values, true
+	}
+	return "", nil, false
+}
+
+// escapeLikePattern escapes the characters having a meaning in a LIKE
+// pattern, so the given string is matched literally.
+// example: escapeLikePattern("100%") -> "100\%"
+func escapeLikePattern(str string) string {
+	return strings.NewReplacer("\\", "\\\\", "%", "\\%", "_", "\\_").
+		Replace(str)
+}
@@ -0,0 +1,135 @@
+package database
+
+func (gbs *goBanksSql) AddLoginAttempt(la DBLoginAttemptParams) (
+	DBLoginAttempt, error) {
+
+	var fields = filterFields([]string{"UserId", "UserName", "IpAddress",
+		"Success", "AttemptDate"}, login_attempt_fields)
+
+	values := make([]interface{}, 0)
+	values = append(values,
+		la.UserId,
+		la.UserName,
+		la.IpAddress,
+		la.Success,
+		la.AttemptDate,
+	)
+
+	id, err := gbs.insertInTable(login_attempt_table, fields, values)
+	if err != nil {
+		return DBLoginAttempt{}, databaseQueryError{err.Error()}
+	}
+
+	return DBLoginAttempt{
+		Id:          id,
+		UserId:      la.UserId,
+		UserName:    la.UserName,
+		IpAddress:   la.IpAddress,
+		Success:     la.Success,
+		AttemptDate: la.AttemptDate,
+	}, nil
+}
+
+func (gbs *goBanksSql) RemoveLoginAttempts(f DBLoginAttemptFilters) error {
+	var deleteString = constructDeleteString(login_attempt_table)
+	var whereString, args, valid = constructLoginAttemptFilterQuery(f)
+	if !valid {
+		return nil
+	}
+
+	queryString := joinStringsWithSpace(deleteString, whereString)
+	_, err := gbs.execQuery(queryString, args...)
+	return err
+}
+
+// GetLoginAttempts returns login attempts based on filters, the most recent
+// first.
+func (gbs *goBanksSql) GetLoginAttempts(f DBLoginAttemptFilters,
+	fields []string, limit uint) ([]DBLoginAttempt, error) {
+
+	var selectString = constructSelectString(login_attempt_table,
+		filterFields(fields, login_attempt_fields))
+
+	var whereString, args, valid = constructLoginAttemptFilterQuery(f)
+	if !valid {
+		return []DBLoginAttempt{}, nil
+	}
+
+	var queryString = joinStringsWithSpace(selectString, whereString,
+		"ORDER BY", login_attempt_fields["AttemptDate"], "DESC")
+	if limit != 0 {
+		queryString = joinStringsWithSpace(queryString, "LIMIT ?")
+		args = append(args, limit)
+	}
+
+	rows, err := gbs.getRows(queryString, args...)
+	if err != nil {
+		return []DBLoginAttempt{}, databaseQueryError{err.Error()}
+	}
+	defer rows.Close()
+
+	var las []DBLoginAttempt
+
+	for rows.Next() {
+		var la DBLoginAttempt
+
+		var values = make([]interface{}, 0)
+
+		for _, field := range fields {
+			switch field {
+			case "Id":
+				values = append(values, &la.Id)
+			case "UserId":
+				values = append(values, &la.UserId)
+			case "UserName":
+				values = append(values, &la.UserName)
+			case "IpAddress":
+				values = append(values, &la.IpAddress)
+			case "Success":
+				values = append(values, &la.Success)
+			case "AttemptDate":
+				values = append(values, &la.AttemptDate)
+			}
+		}
+
+		if err = rows.Scan(values...); err != nil {
+			return []DBLoginAttempt{}, err
+		}
+
+		las = append(las, la)
+	}
+	return las, nil
+}
+
+// constructLoginAttemptFilterQuery takes your filters and returns two
+// elements usable for the final sql query:
+// - The "WHERE" string
+//   For example -> "WHERE user_name=? AND attempt_date >= ?"
+// - An array on interfaces for the sql arguments.
+//   For example -> "toto", time.Time{}
+// Also returns a boolean if the resulting query is not doable (ex: trying to
+// filter attempts with an empty array of int).
+func constructLoginAttemptFilterQuery(f DBLoginAttemptFilters) (string,
+	[]interface{}, bool) {
+
+	var conditionString string
+	var args = make([]interface{}, 0)
+
+	addFilterEq(&conditionString, &args, login_attempt_fields["UserId"],
+		f.UserId)
+	addFilterEq(&conditionString, &args, login_attempt_fields["UserName"],
+		f.UserName)
+	addFilterEq(&conditionString, &args, login_attempt_fields["IpAddress"],
+		f.IpAddress)
+	addFilterEq(&conditionString, &args, login_attempt_fields["Success"],
+		f.Success)
+	addFilterGEq(&conditionString, &args, login_attempt_fields["AttemptDate"],
+		f.FromDate)
+	addFilterLEq(&conditionString, &args, login_attempt_fields["AttemptDate"],
+		f.ToDate)
+
+	ok := addFilterOneOf(&conditionString, &args, login_attempt_fields["Id"],
+		f.Ids)
+
+	return processFilterQuery(conditionString, args, ok)
+}
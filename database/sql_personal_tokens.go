@@ -0,0 +1,146 @@
+package database
+
+import "strings"
+
+func (gbs *goBanksSql) AddPersonalToken(tkn DBPersonalTokenParams) (
+	DBPersonalToken, error) {
+
+	if tkn.UserId == 0 {
+		return DBPersonalToken{}, missingInformationsError{"UserId"}
+	}
+
+	var fields = filterFields([]string{"UserId", "Name", "TokenHash",
+		"Scopes", "AccountIds", "CreationDate", "ExpirationDate"},
+		personal_token_fields)
+
+	values := make([]interface{}, 0)
+	values = append(values,
+		tkn.UserId,
+		tkn.Name,
+		tkn.TokenHash,
+		strings.Join(tkn.Scopes, ","),
+		joinIntsWithComma(tkn.AccountIds),
+		tkn.CreationDate,
+		tkn.ExpirationDate,
+	)
+
+	id, err := gbs.insertInTable(personal_token_table, fields, values)
+	if err != nil {
+		return DBPersonalToken{}, databaseQueryError{err.Error()}
+	}
+
+	return DBPersonalToken{
+		Id:             id,
+		UserId:         tkn.UserId,
+		Name:           tkn.Name,
+		TokenHash:      tkn.TokenHash,
+		Scopes:         tkn.Scopes,
+		AccountIds:     tkn.AccountIds,
+		CreationDate:   tkn.CreationDate,
+		ExpirationDate: tkn.ExpirationDate,
+	}, nil
+}
+
+func (gbs *goBanksSql) RemovePersonalTokens(f DBPersonalTokenFilters) error {
+	var deleteString = constructDeleteString(personal_token_table)
+	var whereString, args, valid = constructPersonalTokenFilterQuery(f)
+	if !valid {
+		return nil
+	}
+
+	queryString := joinStringsWithSpace(deleteString, whereString)
+	_, err := gbs.execQuery(queryString, args...)
+	return err
+}
+
+func (gbs *goBanksSql) GetPersonalTokens(f DBPersonalTokenFilters,
+	fields []string, limit uint) ([]DBPersonalToken, error) {
+
+	var selectString = constructSelectString(personal_token_table,
+		filterFields(fields, personal_token_fields))
+
+	var whereString, args, valid = constructPersonalTokenFilterQuery(f)
+	if !valid {
+		return []DBPersonalToken{}, nil
+	}
+
+	var queryString = joinStringsWithSpace(selectString, whereString)
+	if limit != 0 {
+		queryString = joinStringsWithSpace(queryString, "LIMIT ?")
+		args = append(args, limit)
+	}
+
+	rows, err := gbs.getRows(queryString, args...)
+	if err != nil {
+		return []DBPersonalToken{}, databaseQueryError{err.Error()}
+	}
+	defer rows.Close()
+
+	var tkns []DBPersonalToken
+
+	for rows.Next() {
+		var tkn DBPersonalToken
+		var scopes, accountIds string
+
+		var values = make([]interface{}, 0)
+
+		for _, field := range fields {
+			switch field {
+			case "Id":
+				values = append(values, &tkn.Id)
+			case "UserId":
+				values = append(values, &tkn.UserId)
+			case "Name":
+				values = append(values, &tkn.Name)
+			case "TokenHash":
+				values = append(values, &tkn.TokenHash)
+			case "Scopes":
+				values = append(values, &scopes)
+			case "AccountIds":
+				values = append(values, &accountIds)
+			case "CreationDate":
+				values = append(values, &tkn.CreationDate)
+			case "ExpirationDate":
+				values = append(values, &tkn.ExpirationDate)
+			}
+		}
+
+		if err = rows.Scan(values...); err != nil {
+			return []DBPersonalToken{}, err
+		}
+
+		tkn.Scopes = splitCommaToStrings(scopes)
+		tkn.AccountIds = splitCommaToInts(accountIds)
+		tkns = append(tkns, tkn)
+	}
+	return tkns, nil
+}
+
+// constructPersonalTokenFilterQuery takes your filters and returns two
+// elements usable for the final sql query:
+// - The "WHERE" string
+//   For example -> "WHERE user_id=? AND ( token_hash = ? )"
+// - An array on interfaces for the sql arguments.
+//   For example -> 3, "4fe1..."
+// Also returns a boolean if the resulting query is not doable (ex: trying to
+// filter tokens with an empty array of int).
+func constructPersonalTokenFilterQuery(f DBPersonalTokenFilters) (string,
+	[]interface{}, bool) {
+
+	var conditionString string
+	var args = make([]interface{}, 0)
+
+	addFilterEq(&conditionString, &args, personal_token_fields["UserId"],
+		f.UserId)
+
+	var fieldsOneOf = []string{
+		personal_token_fields["Id"],
+		personal_token_fields["TokenHash"],
+	}
+	ok := addFiltersOneOf(&conditionString, &args, fieldsOneOf,
+		f.Ids,
+		f.TokenHashes,
+	)
+
+	return processFilterQuery(conditionString, args, ok)
+}
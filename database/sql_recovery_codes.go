@@ -0,0 +1,141 @@
+package database
+
+func (gbs *goBanksSql) AddRecoveryCode(rc DBRecoveryCodeParams) (
+	DBRecoveryCode, error) {
+
+	if rc.UserId == 0 {
+		return DBRecoveryCode{}, missingInformationsError{"UserId"}
+	}
+
+	var fields = filterFields([]string{"UserId", "CodeHash"},
+		recovery_code_fields)
+
+	values := make([]interface{}, 0)
+	values = append(values, rc.UserId, rc.CodeHash)
+
+	id, err := gbs.insertInTable(recovery_code_table, fields, values)
+	if err != nil {
+		return DBRecoveryCode{}, databaseQueryError{err.Error()}
+	}
+
+	return DBRecoveryCode{
+		Id:       id,
+		UserId:   rc.UserId,
+		CodeHash: rc.CodeHash,
+	}, nil
+}
+
+func (gbs *goBanksSql) RemoveRecoveryCodes(f DBRecoveryCodeFilters) error {
+	var deleteString = constructDeleteString(recovery_code_table)
+	var whereString, args, valid = constructRecoveryCodeFilterQuery(f)
+	if !valid {
+		return nil
+	}
+
+	queryString := joinStringsWithSpace(deleteString, whereString)
+	_, err := gbs.execQuery(queryString, args...)
+	return err
+}
+
+func (gbs *goBanksSql) ConsumeRecoveryCode(userId int, codeHash string) (bool,
+	error) {
+
+	var f DBRecoveryCodeFilters
+	f.UserId.SetFilter(userId)
+	f.CodeHashes.SetFilter([]string{codeHash})
+
+	var deleteString = constructDeleteString(recovery_code_table)
+	var whereString, args, _ = constructRecoveryCodeFilterQuery(f)
+
+	// the code is removed and checked in a single request, so a code used
+	// concurrently is only accepted once
+	queryString := joinStringsWithSpace(deleteString, whereString, "LIMIT 1")
+	res, err := gbs.execQuery(queryString, args...)
+	if err != nil {
+		return false, databaseQueryError{err.Error()}
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, databaseQueryError{err.Error()}
+	}
+	return affected == 1, nil
+}
+
+func (gbs *goBanksSql) GetRecoveryCodes(f DBRecoveryCodeFilters,
+	fields []string, limit uint) ([]DBRecoveryCode, error) {
+
+	var selectString = constructSelectString(recovery_code_table,
+		filterFields(fields, recovery_code_fields))
+
+	var whereString, args, valid = constructRecoveryCodeFilterQuery(f)
+	if !valid {
+		return []DBRecoveryCode{}, nil
+	}
+
+	var queryString = joinStringsWithSpace(selectString, whereString)
+	if limit != 0 {
+		queryString = joinStringsWithSpace(queryString, "LIMIT ?")
+		args = append(args, limit)
+	}
+
+	rows, err := gbs.getRows(queryString, args...)
+	if err != nil {
+		return []DBRecoveryCode{}, databaseQueryError{err.Error()}
+	}
+	defer rows.Close()
+
+	var rcs []DBRecoveryCode
+
+	for rows.Next() {
+		var rc DBRecoveryCode
+
+		var values = make([]interface{}, 0)
+
+		for _, field := range fields {
+			switch field {
+			case "Id":
+				values = append(values, &rc.Id)
+			case "UserId":
+				values = append(values, &rc.UserId)
+			case "CodeHash":
+				values = append(values, &rc.CodeHash)
+			}
+		}
+
+		if err = rows.Scan(values...); err != nil {
+			return []DBRecoveryCode{}, err
+		}
+
+		rcs = append(rcs, rc)
+	}
+	return rcs, nil
+}
+
+// constructRecoveryCodeFilterQuery takes your filters and returns two
+// elements usable for the final sql query:
+// - The "WHERE" string
+//   For example -> "WHERE user_id=? AND code_hash=?"
+// - An array on interfaces for the sql arguments.
+//   For example -> 3, "toto"
+// Also returns a boolean if the resulting query is not doable (ex: trying to
+// filter codes with an empty array of int).
+func constructRecoveryCodeFilterQuery(f DBRecoveryCodeFilters) (string,
+	[]interface{}, bool) {
+
+	var conditionString string
+	var args = make([]interface{}, 0)
+
+	addFilterEq(&conditionString, &args, recovery_code_fields["UserId"],
+		f.UserId)
+
+	var fieldsOneOf = []string{
+		recovery_code_fields["Id"],
+		recovery_code_fields["CodeHash"],
+	}
+	ok := addFiltersOneOf(&conditionString, &args, fieldsOneOf,
+		f.Ids,
+		f.CodeHashes,
+	)
+
+	return processFilterQuery(conditionString, args, ok)
+}
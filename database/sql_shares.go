@@ -0,0 +1,180 @@
+package database
+
+import "database/sql"
+
+func (gbs *goBanksSql) AddShare(shr DBShareParams) (DBShare, error) {
+	if shr.UserId == 0 {
+		return DBShare{}, missingInformationsError{"UserId"}
+	}
+	if shr.BankId == 0 && shr.AccountId == 0 {
+		return DBShare{}, missingInformationsError{"BankId"}
+	}
+
+	var fields = filterFields([]string{"UserId", "BankId", "AccountId",
+		"Role", "Version"}, share_fields)
+
+	values := make([]interface{}, 0)
+	values = append(values,
+		shr.UserId,
+		nullableId(shr.BankId),
+		nullableId(shr.AccountId),
+		shr.Role,
+		1,
+	)
+
+	id, err := gbs.insertInTable(share_table, fields, values)
+	if err != nil {
+		return DBShare{}, databaseQueryError{err.Error()}
+	}
+
+	return DBShare{
+		Id:        id,
+		Version:   1,
+		UserId:    shr.UserId,
+		BankId:    shr.BankId,
+		AccountId: shr.AccountId,
+		Role:      shr.Role,
+	}, nil
+}
+
+func (gbs *goBanksSql) UpdateShares(f DBShareFilters, fields []string,
+	shr DBShareParams) error {
+
+	var whereString, args, valid = constructShareFilterQuery(f)
+	if !valid {
+		return nil
+	}
+
+	var values = make([]interface{}, 0)
+	var filteredFields = make([]string, 0)
+
+	for _, field := range fields {
+		switch field {
+		case "UserId":
+			values = append(values, shr.UserId)
+			filteredFields = append(filteredFields, share_fields["UserId"])
+		case "BankId":
+			values = append(values, nullableId(shr.BankId))
+			filteredFields = append(filteredFields, share_fields["BankId"])
+		case "AccountId":
+			values = append(values, nullableId(shr.AccountId))
+			filteredFields = append(filteredFields, share_fields["AccountId"])
+		case "Role":
+			values = append(values, shr.Role)
+			filteredFields = append(filteredFields, share_fields["Role"])
+		}
+	}
+
+	return gbs.updateVersionedTable(share_table, whereString, args,
+		filteredFields, values, f.Versions)
+}
+
+func (gbs *goBanksSql) RemoveShares(f DBShareFilters) error {
+	var deleteString = constructDeleteString(share_table)
+	var whereString, args, valid = constructShareFilterQuery(f)
+	if !valid {
+		return nil
+	}
+
+	queryString := joinStringsWithSpace(deleteString, whereString)
+	res, err := gbs.execQuery(queryString, args...)
+	return checkVersionMatched(res, err, f.Versions)
+}
+
+func (gbs *goBanksSql) GetShares(f DBShareFilters, fields []string,
+	limit uint) ([]DBShare, error) {
+
+	var selectString = constructSelectString(share_table,
+		filterFields(fields, share_fields))
+
+	var whereString, args, valid = constructShareFilterQuery(f)
+	if !valid {
+		return []DBShare{}, nil
+	}
+
+	var queryString = joinStringsWithSpace(selectString, whereString)
+	if limit != 0 {
+		queryString = joinStringsWithSpace(queryString, "LIMIT ?")
+		args = append(args, limit)
+	}
+
+	rows, err := gbs.getRows(queryString, args...)
+	if err != nil {
+		return []DBShare{}, databaseQueryError{err.Error()}
+	}
+	defer rows.Close()
+
+	var shrs []DBShare
+
+	for rows.Next() {
+		var shr DBShare
+
+		// the bank or account not shared is NULL
+		var bankId, accountId sql.NullInt64
+
+		var values = make([]interface{}, 0)
+
+		for _, field := range fields {
+			switch field {
+			case "Id":
+				values = append(values, &shr.Id)
+			case "Version":
+				values = append(values, &shr.Version)
+			case "UserId":
+				values = append(values, &shr.UserId)
+			case "BankId":
+				values = append(values, &bankId)
+			case "AccountId":
+				values = append(values, &accountId)
+			case "Role":
+				values = append(values, &shr.Role)
+			}
+		}
+
+		if err = rows.Scan(values...); err != nil {
+			return []DBShare{}, err
+		}
+
+		shr.BankId = int(bankId.Int64)
+		shr.AccountId = int(accountId.Int64)
+		shrs = append(shrs, shr)
+	}
+	return shrs, nil
+}
+
+// constructShareFilterQuery takes your filters and returns two elements
+// usable for the final sql query:
+// - The "WHERE" string
+//   For example -> "WHERE user_id=? AND ( bank_id = ? )"
+// - An array on interfaces for the sql arguments.
+//   For example -> 3, 5
+// Also returns a boolean if the resulting query is not doable (ex: trying to
+// filter shares with an empty array of int).
+func constructShareFilterQuery(f DBShareFilters) (string, []interface{},
+	bool) {
+
+	var conditionString string
+	var args = make([]interface{}, 0)
+
+	addFilterEq(&conditionString, &args, share_fields["UserId"], f.UserId)
+
+	var fieldsOneOf = []string{
+		share_fields["Id"],
+		share_fields["BankId"],
+		share_fields["AccountId"],
+		share_fields["Role"],
+	}
+	ok := addFiltersOneOf(&conditionString, &args, fieldsOneOf,
+		f.Ids,
+		f.BankIds,
+		f.AccountIds,
+		f.Roles,
+	)
+
+	if !addFilterOneOf(&conditionString, &args, share_fields["Version"],
+		f.Versions) {
+		return "", nil, false
+	}
+
+	return processFilterQuery(conditionString, args, ok)
+}
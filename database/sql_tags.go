@@ -0,0 +1,238 @@
+package database
+
+func (gbs *goBanksSql) AddTag(tag DBTagParams) (DBTag, error) {
+	if tag.UserId == 0 {
+		return DBTag{}, missingInformationsError{"UserId"}
+	}
+	if tag.Name == "" {
+		return DBTag{}, missingInformationsError{"Name"}
+	}
+
+	var fields = filterFields([]string{"UserId", "Name"}, tag_fields)
+
+	values := make([]interface{}, 0)
+	values = append(values, tag.UserId, tag.Name)
+
+	id, err := gbs.insertInTable(tag_table, fields, values)
+	if err != nil {
+		return DBTag{}, databaseQueryError{err.Error()}
+	}
+
+	return DBTag{
+		Id:     id,
+		UserId: tag.UserId,
+		Name:   tag.Name,
+	}, nil
+}
+
+func (gbs *goBanksSql) UpdateTags(f DBTagFilters, fields []string,
+	tag DBTagParams) error {
+
+	var whereString, args, valid = constructTagFilterQuery(f)
+	if !valid {
+		return nil
+	}
+
+	var filteredFields = make([]string, 0)
+	var values = make([]interface{}, 0)
+
+	// update only wanted fields
+	for _, field := range fields {
+		switch field {
+		case "Name":
+			values = append(values, tag.Name)
+			filteredFields = append(filteredFields, tag_fields["Name"])
+		}
+	}
+
+	return gbs.updateTable(tag_table, whereString, args, filteredFields,
+		values)
+}
+
+func (gbs *goBanksSql) RemoveTags(f DBTagFilters) error {
+	var deleteString = constructDeleteString(tag_table)
+	var whereString, args, valid = constructTagFilterQuery(f)
+	if !valid {
+		return nil
+	}
+
+	queryString := joinStringsWithSpace(deleteString, whereString)
+	_, err := gbs.execQuery(queryString, args...)
+	return err
+}
+
+func (gbs *goBanksSql) GetTags(f DBTagFilters, fields []string,
+	limit uint) ([]DBTag, error) {
+
+	var selectString = constructSelectString(tag_table,
+		filterFields(fields, tag_fields))
+
+	var whereString, args, valid = constructTagFilterQuery(f)
+	if !valid {
+		return []DBTag{}, nil
+	}
+
+	var queryString = joinStringsWithSpace(selectString, whereString)
+	if limit != 0 {
+		queryString = joinStringsWithSpace(queryString, "LIMIT ?")
+		args = append(args, limit)
+	}
+
+	rows, err := gbs.getRows(queryString, args...)
+	if err != nil {
+		return []DBTag{}, databaseQueryError{err.Error()}
+	}
+	defer rows.Close()
+
+	var tags []DBTag
+
+	for rows.Next() {
+		var tag DBTag
+
+		var values = make([]interface{}, 0)
+
+		for _, field := range fields {
+			switch field {
+			case "Id":
+				values = append(values, &tag.Id)
+			case "UserId":
+				values = append(values, &tag.UserId)
+			case "Name":
+				values = append(values, &tag.Name)
+			}
+		}
+
+		if err = rows.Scan(values...); err != nil {
+			return []DBTag{}, err
+		}
+
+		tags = append(tags, tag)
+	}
+	return tags, rows.Err()
+}
+
+func (gbs *goBanksSql) AddTransactionTags(transactionIds []int,
+	tagIds []int) error {
+
+	if len(transactionIds) == 0 || len(tagIds) == 0 {
+		return nil
+	}
+
+	var queryString = "INSERT IGNORE INTO " + transaction_tag_table + "(" +
+		transaction_tag_fields["TransactionId"] + ", " +
+		transaction_tag_fields["TagId"] + ") values "
+	var args = make([]interface{}, 0, 2*len(transactionIds)*len(tagIds))
+	for _, transactionId := range transactionIds {
+		for _, tagId := range tagIds {
+			if len(args) > 0 {
+				queryString += ", "
+			}
+			queryString += "(?, ?)"
+			args = append(args, transactionId, tagId)
+		}
+	}
+
+	_, err := gbs.execQuery(queryString, args...)
+	if err != nil {
+		return databaseQueryError{err.Error()}
+	}
+	return nil
+}
+
+func (gbs *goBanksSql) RemoveTransactionTags(
+	f DBTransactionTagFilters) error {
+
+	var deleteString = constructDeleteString(transaction_tag_table)
+	var whereString, args, valid = constructTransactionTagFilterQuery(f)
+	if !valid {
+		return nil
+	}
+
+	queryString := joinStringsWithSpace(deleteString, whereString)
+	_, err := gbs.execQuery(queryString, args...)
+	return err
+}
+
+func (gbs *goBanksSql) GetTransactionTags(f DBTransactionTagFilters) (
+	[]DBTransactionTag, error) {
+
+	var selectString = constructSelectString(transaction_tag_table,
+		[]string{transaction_tag_fields["TransactionId"],
+			transaction_tag_fields["TagId"]})
+
+	var whereString, args, valid = constructTransactionTagFilterQuery(f)
+	if !valid {
+		return []DBTransactionTag{}, nil
+	}
+
+	var queryString = joinStringsWithSpace(selectString, whereString)
+
+	rows, err := gbs.getRows(queryString, args...)
+	if err != nil {
+		return []DBTransactionTag{}, databaseQueryError{err.Error()}
+	}
+	defer rows.Close()
+
+	var tts []DBTransactionTag
+
+	for rows.Next() {
+		var tt DBTransactionTag
+		if err = rows.Scan(&tt.TransactionId, &tt.TagId); err != nil {
+			return []DBTransactionTag{}, err
+		}
+		tts = append(tts, tt)
+	}
+	return tts, rows.Err()
+}
+
+// constructTagFilterQuery takes your filters and returns two elements
+// usable for the final sql query:
+// - The "WHERE" string
+//   For example -> "WHERE user_id=? AND ( name = ? )"
+// - An array on interfaces for the sql arguments.
+//   For example -> 3, "vacation"
+// Also returns a boolean if the resulting query is not doable (ex: trying to
+// filter tags with an empty array of int).
+func constructTagFilterQuery(f DBTagFilters) (string, []interface{}, bool) {
+	var conditionString string
+	var args = make([]interface{}, 0)
+
+	addFilterEq(&conditionString, &args, tag_fields["UserId"], f.UserId)
+
+	var fieldsOneOf = []string{
+		tag_fields["Id"],
+		tag_fields["Name"],
+	}
+	ok := addFiltersOneOf(&conditionString, &args, fieldsOneOf,
+		f.Ids,
+		f.Names,
+	)
+
+	return processFilterQuery(conditionString, args, ok)
+}
+
+// constructTransactionTagFilterQuery takes your filters and returns two
+// elements usable for the final sql query:
+// - The "WHERE" string
+//   For example -> "WHERE ( transaction_id = ? ) AND ( tag_id = ? )"
+// - An array on interfaces for the sql arguments.
+//   For example -> 3, 5
+// Also returns a boolean if the resulting query is not doable (ex: trying to
+// filter tags with an empty array of int).
+func constructTransactionTagFilterQuery(f DBTransactionTagFilters) (string,
+	[]interface{}, bool) {
+
+	var conditionString string
+	var args = make([]interface{}, 0)
+
+	var fieldsOneOf = []string{
+		transaction_tag_fields["TransactionId"],
+		transaction_tag_fields["TagId"],
+	}
+	ok := addFiltersOneOf(&conditionString, &args, fieldsOneOf,
+		f.TransactionIds,
+		f.TagIds,
+	)
+
+	return processFilterQuery(conditionString, args, ok)
+}
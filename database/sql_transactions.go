@@ -12,6 +12,10 @@ func (gbs *goBanksSql) AddTransaction(trn DBTransactionParams) (
 		return DBTransaction{}, missingInformationsError{"AccountId"}
 	}
 
+	var fields = filterFields([]string{"AccountId", "Label", "CategoryId",
+		"Description", "TransactionDate", "RecordDate", "Debit", "Credit",
+		"Reference", "Version"}, transaction_fields)
+
 	values := make([]interface{}, 0)
 	values = append(values,
 		trn.AccountId,
@@ -23,16 +27,17 @@ func (gbs *goBanksSql) AddTransaction(trn DBTransactionParams) (
 		trn.Debit,
 		trn.Credit,
 		trn.Reference,
+		1,
 	)
 
-	id, err := gbs.insertInTable(transaction_table,
-		stripIdField(transaction_fields), values)
+	id, err := gbs.insertInTable(transaction_table, fields, values)
 	if err != nil {
 		return DBTransaction{}, databaseQueryError{err: err.Error()}
 	}
 
 	return DBTransaction{
 		Id:              id,
+		Version:         1,
 		AccountId:       trn.AccountId,
 		Label:           trn.Label,
 		CategoryId:      trn.CategoryId,
@@ -96,7 +101,8 @@ func (gbs *goBanksSql) UpdateTransactions(filters DBTransactionFilters,
 		}
 	}
 
-	return gbs.updateTable(transaction_table, whereString, args, filteredFields, values)
+	return gbs.updateVersionedTable(transaction_table, whereString, args,
+		filteredFields, values, filters.Versions)
 }
 
 // RemoveTransaction removes one or multiple transactions from the database
@@ -111,8 +117,8 @@ func (gbs *goBanksSql) RemoveTransactions(filters DBTransactionFilters) error {
 
 	var queryString = joinStringsWithSpace(deleteString, whereString)
 
-	_, err := gbs.execQuery(queryString, args...)
-	return err
+	res, err := gbs.execQuery(queryString, args...)
+	return checkVersionMatched(res, err, filters.Versions)
 }
 
 // GetTransactions returns one or multiple transactions from the database
@@ -124,26 +130,44 @@ func (gbs *goBanksSql) GetTransactions(filters DBTransactionFilters,
 	fields []string, limit uint) ([]DBTransaction,
 	error) {
 
+	var trns []DBTransaction
+	err := gbs.ForEachTransaction(filters, fields, limit,
+		func(trn DBTransaction) error {
+			trns = append(trns, trn)
+			return nil
+		})
+	if err != nil {
+		return []DBTransaction{}, err
+	}
+	return trns, nil
+}
+
+// ForEachTransaction calls fn with each transaction corresponding to the
+// filters, scanned one row at a time so that they are never all in memory.
+// It stops at the first error returned by fn, which is then returned.
+func (gbs *goBanksSql) ForEachTransaction(filters DBTransactionFilters,
+	fields []string, limit uint, fn func(DBTransaction) error) error {
+
 	var selectString = constructSelectString(transaction_table,
 		filterFields(fields, transaction_fields))
 
 	var whereString, args, valid = constructTransactionFilterQuery(filters)
 	if !valid {
-		return []DBTransaction{}, nil
+		return nil
 	}
 
-	var queryString = joinStringsWithSpace(selectString, whereString)
+	var queryString = joinStringsWithSpace(selectString, whereString,
+		constructOrderString(filters.Sort, transaction_fields))
 	if limit != 0 {
-		queryString = joinStringsWithSpace(queryString, "LIMIT ?")
-		args = append(args, limit)
+		queryString = joinStringsWithSpace(queryString,
+			constructLimitString(limit))
 	}
 
 	rows, err := gbs.getRows(queryString, args...)
 	if err != nil {
-		return []DBTransaction{}, databaseQueryError{err.Error()}
+		return databaseQueryError{err.Error()}
 	}
-
-	var trns []DBTransaction
+	defer rows.Close()
 
 	for rows.Next() {
 		var trn DBTransaction
@@ -154,6 +178,8 @@ func (gbs *goBanksSql) GetTransactions(filters DBTransactionFilters,
 			switch field {
 			case "Id":
 				values = append(values, &trn.Id)
+			case "Version":
+				values = append(values, &trn.Version)
 			case "AccountId":
 				values = append(values, &trn.AccountId)
 			case "Label":
@@ -176,12 +202,101 @@ func (gbs *goBanksSql) GetTransactions(filters DBTransactionFilters,
 		}
 
 		if err = rows.Scan(values...); err != nil {
-			return []DBTransaction{}, err
+			return err
 		}
 
-		trns = append(trns, trn)
+		if err = fn(trn); err != nil {
+			return err
+		}
 	}
-	return trns, nil
+	if err = rows.Err(); err != nil {
+		return databaseQueryError{err.Error()}
+	}
+	return nil
+}
+
+// CountTransactions returns the number of transactions corresponding to the
+// given filters, without taking their After filter into account.
+func (gbs *goBanksSql) CountTransactions(
+	filters DBTransactionFilters) (int, error) {
+	filters.After = DBCursorFilter{}
+	var whereString, args, valid = constructTransactionFilterQuery(filters)
+	if !valid {
+		return 0, nil
+	}
+	return gbs.countRows(transaction_table, whereString, args)
+}
+
+func (gbs *goBanksSql) GetReport(
+	filters DBTransactionFilters) (DBReport, error) {
+	filters.After = DBCursorFilter{}
+	var whereString, args, valid = constructTransactionFilterQuery(filters)
+	if !valid {
+		return DBReport{}, nil
+	}
+
+	var queryString = joinStringsWithSpace("SELECT COALESCE(SUM("+
+		transaction_fields["Debit"]+"), 0), COALESCE(SUM("+
+		transaction_fields["Credit"]+"), 0) FROM "+transaction_table,
+		whereString)
+
+	rows, err := gbs.getRows(queryString, args...)
+	if err != nil {
+		return DBReport{}, databaseQueryError{err.Error()}
+	}
+	defer rows.Close()
+
+	var report DBReport
+	if rows.Next() {
+		err = rows.Scan(&report.Debit, &report.Credit)
+	}
+	return report, err
+}
+
+func (gbs *goBanksSql) GetTagReports(filters DBTransactionFilters,
+	tagIds []int) (map[int]DBReport, error) {
+	filters.After = DBCursorFilter{}
+	var reports = map[int]DBReport{}
+	var whereString, args, valid = constructTransactionFilterQuery(filters)
+	if !valid || len(tagIds) == 0 {
+		return reports, nil
+	}
+
+	var tagIdField = transaction_tag_table + "." +
+		transaction_tag_fields["TagId"]
+	var tagsCondition, tagsArgs = addSqlFilterIntArray(tagIdField,
+		tagIds...)
+	if whereString == "" {
+		whereString = "WHERE " + tagsCondition
+	} else {
+		whereString += " AND " + tagsCondition
+	}
+	args = append(args, tagsArgs...)
+
+	var queryString = joinStringsWithSpace("SELECT "+tagIdField+
+		", COALESCE(SUM("+transaction_table+"."+transaction_fields["Debit"]+
+		"), 0), COALESCE(SUM("+transaction_table+"."+
+		transaction_fields["Credit"]+"), 0) FROM "+transaction_table+
+		" JOIN "+transaction_tag_table+" ON "+transaction_tag_table+"."+
+		transaction_tag_fields["TransactionId"]+" = "+transaction_table+"."+
+		transaction_fields["Id"], whereString, "GROUP BY "+tagIdField)
+
+	rows, err := gbs.getRows(queryString, args...)
+	if err != nil {
+		return nil, databaseQueryError{err.Error()}
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var tagId int
+		var report DBReport
+		if err := rows.Scan(&tagId, &report.Debit,
+			&report.Credit); err != nil {
+			return nil, err
+		}
+		reports[tagId] = report
+	}
+	return reports, rows.Err()
 }
 
 // constructTransactionFilterQuery takes your filters and returns two elements
@@ -234,5 +349,33 @@ func constructTransactionFilterQuery(filters DBTransactionFilters) (string,
 	addFilterLEq(&conditionString, &args,
 		transaction_fields["Credit"], filters.MaxCredit)
 
+	addFilterMatch(&conditionString, &args, []string{
+		transaction_fields["Label"],
+		transaction_fields["Description"],
+		transaction_fields["Reference"]}, filters.Search)
+
+	if !addFilterExpression(&conditionString, &args, filters.Expression,
+		transaction_fields) {
+		return "", nil, false
+	}
+
+	if !addFilterOneOf(&conditionString, &args, transaction_fields["Version"],
+		filters.Versions) {
+		return "", nil, false
+	}
+
+	addFilterTransactionAccess(&conditionString, &args, filters.UserId,
+		filters.Roles)
+
+	if !addFilterTags(&conditionString, &args, filters.Tags,
+		filters.UserId) {
+		return "", nil, false
+	}
+
+	if !addFilterAfter(&conditionString, &args, filters.Sort, filters.After,
+		transaction_fields) {
+		return "", nil, false
+	}
+
 	return processFilterQuery(conditionString, args, ok)
 }
@@ -15,12 +15,16 @@ func (gbs *goBanksSql) UserLength() (int, error) {
 }
 
 func (gbs *goBanksSql) AddUser(usr DBUserParams) (DBUser, error) {
+	// fields are listed explicitely to keep them in the same order than the
+	// values
+	var fields = filterFields([]string{"Name", "PasswordHash", "Salt",
+		"Administrator", "TotpSecret", "TotpEnabled"}, user_fields)
+
 	values := make([]interface{}, 0)
 	values = append(values, usr.Name, usr.PasswordHash,
-		usr.Salt, usr.Administrator)
+		usr.Salt, usr.Administrator, usr.TotpSecret, usr.TotpEnabled)
 
-	var id, err = gbs.insertInTable(user_table,
-		stripIdField(user_fields), values)
+	var id, err = gbs.insertInTable(user_table, fields, values)
 
 	if err != nil {
 		return DBUser{}, databaseQueryError{err.Error()}
@@ -32,12 +36,18 @@ func (gbs *goBanksSql) AddUser(usr DBUserParams) (DBUser, error) {
 		PasswordHash:  usr.PasswordHash,
 		Salt:          usr.Salt,
 		Administrator: usr.Administrator,
+		TotpSecret:    usr.TotpSecret,
+		TotpEnabled:   usr.TotpEnabled,
 	}, nil
 }
 
 func (gbs *goBanksSql) UpdateUser(id int, fields []string,
 	usr DBUserParams) error {
 
+	var f DBUserFilters
+	f.Id.SetFilter(id)
+	var whereString, args, _ = constructUserFilterQuery(f)
+
 	var values = make([]interface{}, 0)
 	var filteredFields = make([]string, 0)
 
@@ -45,21 +55,26 @@ func (gbs *goBanksSql) UpdateUser(id int, fields []string,
 		switch field {
 		case "Name":
 			values = append(values, usr.Name)
-			filteredFields = append(filteredFields, bank_fields["Name"])
+			filteredFields = append(filteredFields, user_fields["Name"])
 		case "PasswordHash":
 			values = append(values, usr.PasswordHash)
-			filteredFields = append(filteredFields, bank_fields["PasswordHash"])
+			filteredFields = append(filteredFields, user_fields["PasswordHash"])
 		case "Salt":
 			values = append(values, usr.Salt)
-			filteredFields = append(filteredFields, bank_fields["Salt"])
+			filteredFields = append(filteredFields, user_fields["Salt"])
 		case "Administrator":
 			values = append(values, usr.Administrator)
-			filteredFields = append(filteredFields, bank_fields["Administrator"])
+			filteredFields = append(filteredFields, user_fields["Administrator"])
+		case "TotpSecret":
+			values = append(values, usr.TotpSecret)
+			filteredFields = append(filteredFields, user_fields["TotpSecret"])
+		case "TotpEnabled":
+			values = append(values, usr.TotpEnabled)
+			filteredFields = append(filteredFields, user_fields["TotpEnabled"])
 		}
 	}
 
-	return gbs.updateTable(user_table, "", make([]interface{}, 0),
-		filteredFields, values)
+	return gbs.updateTable(user_table, whereString, args, filteredFields, values)
 }
 
 func (gbs *goBanksSql) RemoveUser(id int) error {
@@ -87,6 +102,7 @@ func (gbs *goBanksSql) GetUser(f DBUserFilters, fields []string) (DBUser, error)
 	if err != nil {
 		return DBUser{}, databaseQueryError{err.Error()}
 	}
+	defer rows.Close()
 
 	for rows.Next() {
 		var usr DBUser
@@ -105,6 +121,12 @@ func (gbs *goBanksSql) GetUser(f DBUserFilters, fields []string) (DBUser, error)
 				values = append(values, &usr.Salt)
 			case "Administrator":
 				values = append(values, &usr.Administrator)
+			case "TotpSecret":
+				values = append(values, &usr.TotpSecret)
+			case "TotpEnabled":
+				values = append(values, &usr.TotpEnabled)
+			case "TotpLastStep":
+				values = append(values, &usr.TotpLastStep)
 			}
 		}
 
@@ -138,3 +160,20 @@ func constructUserFilterQuery(f DBUserFilters) (string,
 
 	return processFilterQuery(conditionString, args, true)
 }
+
+func (gbs *goBanksSql) UseTotpStep(id int, step int64) (bool, error) {
+	// a single conditional UPDATE, so a code used concurrently is only
+	// accepted once
+	var queryString = "UPDATE " + user_table + " SET " +
+		user_fields["TotpLastStep"] + "=? WHERE " + user_fields["Id"] +
+		"=? AND " + user_fields["TotpLastStep"] + "<?"
+	res, err := gbs.execQuery(queryString, step, id, step)
+	if err != nil {
+		return false, databaseQueryError{err.Error()}
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, databaseQueryError{err.Error()}
+	}
+	return affected == 1, nil
+}
@@ -0,0 +1,346 @@
+package database
+
+import "strings"
+
+func (gbs *goBanksSql) AddWebhook(wh DBWebhookParams) (DBWebhook, error) {
+	if wh.UserId == 0 {
+		return DBWebhook{}, missingInformationsError{"UserId"}
+	}
+	if wh.Url == "" {
+		return DBWebhook{}, missingInformationsError{"Url"}
+	}
+
+	var fields = filterFields([]string{"UserId", "Url", "Secret",
+		"EventTypes", "AccountIds", "MinDebit", "MinCredit", "CreationDate"},
+		webhook_fields)
+
+	values := make([]interface{}, 0)
+	values = append(values,
+		wh.UserId,
+		wh.Url,
+		wh.Secret,
+		strings.Join(wh.EventTypes, ","),
+		joinIntsWithComma(wh.AccountIds),
+		wh.MinDebit,
+		wh.MinCredit,
+		wh.CreationDate,
+	)
+
+	id, err := gbs.insertInTable(webhook_table, fields, values)
+	if err != nil {
+		return DBWebhook{}, databaseQueryError{err.Error()}
+	}
+
+	return DBWebhook{
+		Id:           id,
+		UserId:       wh.UserId,
+		Url:          wh.Url,
+		Secret:       wh.Secret,
+		EventTypes:   wh.EventTypes,
+		AccountIds:   wh.AccountIds,
+		MinDebit:     wh.MinDebit,
+		MinCredit:    wh.MinCredit,
+		CreationDate: wh.CreationDate,
+	}, nil
+}
+
+func (gbs *goBanksSql) RemoveWebhooks(f DBWebhookFilters) error {
+	var deleteString = constructDeleteString(webhook_table)
+	var whereString, args, valid = constructWebhookFilterQuery(f)
+	if !valid {
+		return nil
+	}
+
+	queryString := joinStringsWithSpace(deleteString, whereString)
+	_, err := gbs.execQuery(queryString, args...)
+	return err
+}
+
+func (gbs *goBanksSql) GetWebhooks(f DBWebhookFilters, fields []string,
+	limit uint) ([]DBWebhook, error) {
+
+	var selectString = constructSelectString(webhook_table,
+		filterFields(fields, webhook_fields))
+
+	var whereString, args, valid = constructWebhookFilterQuery(f)
+	if !valid {
+		return []DBWebhook{}, nil
+	}
+
+	var queryString = joinStringsWithSpace(selectString, whereString)
+	if limit != 0 {
+		queryString = joinStringsWithSpace(queryString, "LIMIT ?")
+		args = append(args, limit)
+	}
+
+	rows, err := gbs.getRows(queryString, args...)
+	if err != nil {
+		return []DBWebhook{}, databaseQueryError{err.Error()}
+	}
+	defer rows.Close()
+
+	var whs []DBWebhook
+
+	for rows.Next() {
+		var wh DBWebhook
+		var eventTypes, accountIds string
+
+		var values = make([]interface{}, 0)
+
+		for _, field := range fields {
+			switch field {
+			case "Id":
+				values = append(values, &wh.Id)
+			case "UserId":
+				values = append(values, &wh.UserId)
+			case "Url":
+				values = append(values, &wh.Url)
+			case "Secret":
+				values = append(values, &wh.Secret)
+			case "EventTypes":
+				values = append(values, &eventTypes)
+			case "AccountIds":
+				values = append(values, &accountIds)
+			case "MinDebit":
+				values = append(values, &wh.MinDebit)
+			case "MinCredit":
+				values = append(values, &wh.MinCredit)
+			case "CreationDate":
+				values = append(values, &wh.CreationDate)
+			}
+		}
+
+		if err = rows.Scan(values...); err != nil {
+			return []DBWebhook{}, err
+		}
+
+		wh.EventTypes = splitCommaToStrings(eventTypes)
+		wh.AccountIds = splitCommaToInts(accountIds)
+		whs = append(whs, wh)
+	}
+	return whs, rows.Err()
+}
+
+func (gbs *goBanksSql) AddWebhookDelivery(dlv DBWebhookDeliveryParams) (
+	DBWebhookDelivery, error) {
+
+	if dlv.WebhookId == 0 {
+		return DBWebhookDelivery{}, missingInformationsError{"WebhookId"}
+	}
+
+	var fields = filterFields([]string{"WebhookId", "EventId", "EventType",
+		"Payload", "Status", "Attempts", "StatusCode", "Error",
+		"CreationDate", "NextAttemptDate", "LastAttemptDate"},
+		webhook_delivery_fields)
+
+	values := make([]interface{}, 0)
+	values = append(values,
+		dlv.WebhookId,
+		dlv.EventId,
+		dlv.EventType,
+		dlv.Payload,
+		dlv.Status,
+		dlv.Attempts,
+		dlv.StatusCode,
+		dlv.Error,
+		dlv.CreationDate,
+		dlv.NextAttemptDate,
+		dlv.LastAttemptDate,
+	)
+
+	id, err := gbs.insertInTable(webhook_delivery_table, fields, values)
+	if err != nil {
+		return DBWebhookDelivery{}, databaseQueryError{err.Error()}
+	}
+
+	return DBWebhookDelivery{
+		Id:              id,
+		WebhookId:       dlv.WebhookId,
+		EventId:         dlv.EventId,
+		EventType:       dlv.EventType,
+		Payload:         dlv.Payload,
+		Status:          dlv.Status,
+		Attempts:        dlv.Attempts,
+		StatusCode:      dlv.StatusCode,
+		Error:           dlv.Error,
+		CreationDate:    dlv.CreationDate,
+		NextAttemptDate: dlv.NextAttemptDate,
+		LastAttemptDate: dlv.LastAttemptDate,
+	}, nil
+}
+
+func (gbs *goBanksSql) UpdateWebhookDeliveries(f DBWebhookDeliveryFilters,
+	fields []string, dlv DBWebhookDeliveryParams) error {
+
+	var whereString, args, valid = constructWebhookDeliveryFilterQuery(f)
+	if !valid {
+		return nil
+	}
+
+	var values = make([]interface{}, 0)
+	var filteredFields = make([]string, 0)
+
+	for _, field := range fields {
+		var value interface{}
+		switch field {
+		case "Status":
+			value = dlv.Status
+		case "Attempts":
+			value = dlv.Attempts
+		case "StatusCode":
+			value = dlv.StatusCode
+		case "Error":
+			value = dlv.Error
+		case "NextAttemptDate":
+			value = dlv.NextAttemptDate
+		case "LastAttemptDate":
+			value = dlv.LastAttemptDate
+		default:
+			continue
+		}
+		values = append(values, value)
+		filteredFields = append(filteredFields,
+			webhook_delivery_fields[field])
+	}
+
+	return gbs.updateTable(webhook_delivery_table, whereString, args,
+		filteredFields, values)
+}
+
+func (gbs *goBanksSql) RemoveWebhookDeliveries(
+	f DBWebhookDeliveryFilters) error {
+
+	var deleteString = constructDeleteString(webhook_delivery_table)
+	var whereString, args, valid = constructWebhookDeliveryFilterQuery(f)
+	if !valid {
+		return nil
+	}
+
+	queryString := joinStringsWithSpace(deleteString, whereString)
+	_, err := gbs.execQuery(queryString, args...)
+	return err
+}
+
+func (gbs *goBanksSql) GetWebhookDeliveries(f DBWebhookDeliveryFilters,
+	fields []string, limit uint) ([]DBWebhookDelivery, error) {
+
+	var selectString = constructSelectString(webhook_delivery_table,
+		filterFields(fields, webhook_delivery_fields))
+
+	var whereString, args, valid = constructWebhookDeliveryFilterQuery(f)
+	if !valid {
+		return []DBWebhookDelivery{}, nil
+	}
+
+	var queryString = joinStringsWithSpace(selectString, whereString,
+		constructOrderString(f.Sort, webhook_delivery_fields))
+	if limit != 0 {
+		queryString = joinStringsWithSpace(queryString, "LIMIT ?")
+		args = append(args, limit)
+	}
+
+	rows, err := gbs.getRows(queryString, args...)
+	if err != nil {
+		return []DBWebhookDelivery{}, databaseQueryError{err.Error()}
+	}
+	defer rows.Close()
+
+	var dlvs []DBWebhookDelivery
+
+	for rows.Next() {
+		var dlv DBWebhookDelivery
+
+		var values = make([]interface{}, 0)
+
+		for _, field := range fields {
+			switch field {
+			case "Id":
+				values = append(values, &dlv.Id)
+			case "WebhookId":
+				values = append(values, &dlv.WebhookId)
+			case "EventId":
+				values = append(values, &dlv.EventId)
+			case "EventType":
+				values = append(values, &dlv.EventType)
+			case "Payload":
+				values = append(values, &dlv.Payload)
+			case "Status":
+				values = append(values, &dlv.Status)
+			case "Attempts":
+				values = append(values, &dlv.Attempts)
+			case "StatusCode":
+				values = append(values, &dlv.StatusCode)
+			case "Error":
+				values = append(values, &dlv.Error)
+			case "CreationDate":
+				values = append(values, &dlv.CreationDate)
+			case "NextAttemptDate":
+				values = append(values, &dlv.NextAttemptDate)
+			case "LastAttemptDate":
+				values = append(values, &dlv.LastAttemptDate)
+			}
+		}
+
+		if err = rows.Scan(values...); err != nil {
+			return []DBWebhookDelivery{}, err
+		}
+
+		dlvs = append(dlvs, dlv)
+	}
+	return dlvs, rows.Err()
+}
+
+// constructWebhookFilterQuery takes your filters and returns two elements
+// usable for the final sql query:
+// - The "WHERE" string
+//   For example -> "WHERE user_id=? AND ( id = ? )"
+// - An array on interfaces for the sql arguments.
+//   For example -> 3, 5
+// Also returns a boolean if the resulting query is not doable (ex: trying to
+// filter webhooks with an empty array of int).
+func constructWebhookFilterQuery(f DBWebhookFilters) (string,
+	[]interface{}, bool) {
+
+	var conditionString string
+	var args = make([]interface{}, 0)
+
+	addFilterEq(&conditionString, &args, webhook_fields["UserId"], f.UserId)
+
+	ok := addFilterOneOf(&conditionString, &args, webhook_fields["Id"],
+		f.Ids)
+
+	return processFilterQuery(conditionString, args, ok)
+}
+
+// constructWebhookDeliveryFilterQuery takes your filters and returns two
+// elements usable for the final sql query:
+// - The "WHERE" string
+//   For example -> "WHERE next_attempt_date <= ? AND ( status = ? )"
+// - An array on interfaces for the sql arguments.
+//   For example -> time.Time{}, "pending"
+// Also returns a boolean if the resulting query is not doable (ex: trying to
+// filter deliveries with an empty array of int).
+func constructWebhookDeliveryFilterQuery(f DBWebhookDeliveryFilters) (string,
+	[]interface{}, bool) {
+
+	var conditionString string
+	var args = make([]interface{}, 0)
+
+	addFilterLEq(&conditionString, &args,
+		webhook_delivery_fields["NextAttemptDate"], f.ToNextAttemptDate)
+	addFilterLEq(&conditionString, &args,
+		webhook_delivery_fields["CreationDate"], f.ToCreationDate)
+
+	var fieldsOneOf = []string{
+		webhook_delivery_fields["Id"],
+		webhook_delivery_fields["WebhookId"],
+		webhook_delivery_fields["Status"],
+	}
+	ok := addFiltersOneOf(&conditionString, &args, fieldsOneOf,
+		f.Ids,
+		f.WebhookIds,
+		f.Statuses,
+	)
+
+	return processFilterQuery(conditionString, args, ok)
+}
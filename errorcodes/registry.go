@@ -0,0 +1,69 @@
+// Package errorcodes is the registry of every error code which can be
+// returned by GoBanks.
+//
+// Each package has its own range of codes and registers them, with a short
+// description, when it is initialized. Registering the same code twice or a
+// code outside of the package's range panics, so two packages can never
+// give the same code different meanings.
+package errorcodes
+
+import "sort"
+import "strconv"
+
+// First code of each package's range. A range contains range_size codes.
+const (
+	// auth package
+	AuthenticationErrors uint32 = 300
+
+	// api package
+	OperationErrors uint32 = 700
+
+	// database package
+	DatabaseErrors uint32 = 800
+)
+
+const range_size = 100
+
+// ErrorCode describes a single registered error code.
+type ErrorCode struct {
+	Code        uint32
+	Name        string
+	Description string
+}
+
+var registry = map[uint32]ErrorCode{}
+
+// Register adds an error code to the registry. rangeStart is the first code
+// of the range of the calling package (e.g. AuthenticationErrors).
+// Panics if the code is outside of this range or was already registered.
+func Register(rangeStart uint32, code uint32, name string,
+	description string) {
+	if code < rangeStart || code >= rangeStart+range_size {
+		panic("error code " + strconv.Itoa(int(code)) +
+			" (" + name + ") is outside of its range")
+	}
+	if prev, ok := registry[code]; ok {
+		panic("error code " + strconv.Itoa(int(code)) +
+			" registered twice: " + prev.Name + " and " + name)
+	}
+	registry[code] = ErrorCode{Code: code, Name: name, Description: description}
+}
+
+// Get returns the registered error code corresponding to the given code.
+// The returned boolean is false if this code is not registered.
+func Get(code uint32) (ErrorCode, bool) {
+	c, ok := registry[code]
+	return c, ok
+}
+
+// Catalogue returns every registered error code, sorted by code.
+func Catalogue() []ErrorCode {
+	var codes = make([]ErrorCode, 0, len(registry))
+	for _, c := range registry {
+		codes = append(codes, c)
+	}
+	sort.Slice(codes, func(i, j int) bool {
+		return codes[i].Code < codes[j].Code
+	})
+	return codes
+}
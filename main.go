@@ -1,8 +1,11 @@
 package main
 
+import "time"
+
 import "github.com/peaberberian/GoBanks/auth"
 import "github.com/peaberberian/GoBanks/database"
 import "github.com/peaberberian/GoBanks/api"
+import "github.com/peaberberian/GoBanks/storage"
 
 func main() {
 	// Read the config file
@@ -16,9 +19,88 @@ func main() {
 		panic(err)
 	}
 
+	// Publish the modifications of the data, for the /events API
+	database.GoEvents = database.NewEventBus(conf.Events.BufferSize)
+	database.GoDB = database.NewPublishingDataBase(database.GoDB,
+		database.GoEvents)
+
+	// Cache banks, accounts and categories if enabled in the config
+	var cc = conf.Cache
+	if cc.TTL > 0 {
+		database.GoDB = database.NewCachedDataBase(database.GoDB,
+			database.CacheConfig{
+				TTL:               time.Duration(cc.TTL) * time.Second,
+				MaxUsers:          cc.MaxUsers,
+				MaxEntriesPerUser: cc.MaxEntriesPerUser,
+			})
+	}
+
+	// Send the published events to the webhooks of the users
+	api.StartWebhooks(database.GoDB, database.GoEvents)
+
 	// Update token expiration from config
 	auth.SetTokenExpiration(conf.TokenExpiration)
 
+	// Update failed logins throttling from config
+	var lp = conf.LoginProtection
+	auth.SetLockoutPolicy(auth.LockoutPolicy{
+		MaxAttempts:     lp.MaxAttempts,
+		MaxIpAttempts:   lp.MaxIpAttempts,
+		BaseDelay:       time.Duration(lp.BaseDelay) * time.Second,
+		LockoutDuration: time.Duration(lp.LockoutDuration) * time.Second,
+		Window:          time.Duration(lp.Window) * time.Second,
+	})
+
+	// Update password hashing and requirements from config
+	var pp = conf.Password
+	if err := auth.SetPasswordPolicy(auth.PasswordPolicy{
+		BcryptCost:            pp.BcryptCost,
+		MinLength:             pp.MinLength,
+		BreachedPasswordsFile: pp.BreachedPasswordsFile,
+	}); err != nil {
+		panic(err)
+	}
+
+	// Update how spreadsheets are exported from config
+	var ec = conf.Export
+	if err := api.SetExportLocale(api.ExportLocale{
+		DecimalSeparator: ec.DecimalSeparator,
+		DateFormat:       ec.DateFormat,
+		CsvSeparator:     ec.CsvSeparator,
+	}); err != nil {
+		panic(err)
+	}
+
+	// Evaluate the alert rules of the users and notify the alerts fired
+	var alc = conf.Alerts
+	api.RegisterNotifier("log", api.NewLogNotifier())
+	api.RegisterNotifier("webhook", api.NewWebhookNotifier(database.GoEvents))
+	if alc.Smtp.Address != "" {
+		api.RegisterNotifier("smtp", api.NewSmtpNotifier(api.SmtpConfig{
+			Address: alc.Smtp.Address,
+			From:    alc.Smtp.From,
+		}))
+	}
+	api.StartAlerts(database.GoDB, database.GoEvents,
+		time.Duration(alc.EvaluationInterval)*time.Second)
+
+	// Store the files attached to transactions in a local directory
+	var atc = conf.Attachments
+	var attachmentsPath = atc.StoragePath
+	if attachmentsPath == "" {
+		attachmentsPath = default_attachments_path
+	}
+	store, err := storage.NewLocalStorage(attachmentsPath)
+	if err != nil {
+		panic(err)
+	}
+	api.SetAttachmentConfig(api.AttachmentConfig{
+		Storage:   store,
+		MaxSize:   atc.MaxSize,
+		MimeTypes: atc.MimeTypes,
+	})
+	api.StartAttachmentCleanup(database.GoDB)
+
 	api.Start(conf.ServerPort, conf.CertPath, conf.KeyPath)
 	database.GoDB.Close()
 }
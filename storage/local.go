@@ -0,0 +1,100 @@
+package storage
+
+import "io"
+import "os"
+import "path/filepath"
+import "time"
+
+// localStorage stores the files in a directory of the local filesystem.
+// They are spread in sub-directories named after the first two characters
+// of their key, to keep directories small.
+type localStorage struct {
+	dir string
+}
+
+// NewLocalStorage returns a Storage keeping the files in the given
+// directory, which is created if needed.
+func NewLocalStorage(dir string) (Storage, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &localStorage{dir: dir}, nil
+}
+
+func (ls *localStorage) Put(key string, r io.Reader) error {
+	if !IsValidKey(key) {
+		return ErrInvalidKey
+	}
+
+	// a file already stored is kept, as if it was just stored
+	var path = ls.path(key)
+	if _, err := os.Stat(path); err == nil {
+		var now = time.Now()
+		return os.Chtimes(path, now, now)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	// write in a temporary file first, so a file is either stored entirely
+	// or not at all
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (ls *localStorage) Open(key string) (io.ReadSeekCloser, error) {
+	if !IsValidKey(key) {
+		return nil, ErrInvalidKey
+	}
+
+	f, err := os.Open(ls.path(key))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	return f, err
+}
+
+func (ls *localStorage) Remove(key string) error {
+	if !IsValidKey(key) {
+		return ErrInvalidKey
+	}
+
+	err := os.Remove(ls.path(key))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (ls *localStorage) Walk(fn func(string, time.Time) error) error {
+	return filepath.Walk(ls.dir, func(path string, info os.FileInfo,
+		err error) error {
+
+		if err != nil {
+			return err
+		}
+
+		// ignore directories and temporary files
+		if info.IsDir() || !IsValidKey(info.Name()) {
+			return nil
+		}
+		return fn(info.Name(), info.ModTime())
+	})
+}
+
+// path returns the path of the file stored under the given key
+func (ls *localStorage) path(key string) string {
+	return filepath.Join(ls.dir, key[:2], key)
+}
@@ -0,0 +1,49 @@
+// Package storage stores the files sent to GoBanks, such as the attachments
+// of transactions, outside of the database.
+//
+// Files are content-addressed: their key is the hexadecimal SHA-256 hash of
+// their content, which means that the same file is only stored once.
+package storage
+
+import "errors"
+import "io"
+import "time"
+
+// Returned when no file is stored with the wanted key
+var ErrNotFound = errors.New("storage: file not found")
+
+// Returned when a key is not a hexadecimal SHA-256 hash
+var ErrInvalidKey = errors.New("storage: invalid key")
+
+// Interface the storage backends must implement
+type Storage interface {
+	// Store the content read from the given reader under the given key.
+	// Storing a key already stored only updates its modification date.
+	Put(string, io.Reader) error
+
+	// Open the file stored under the given key. Returns ErrNotFound if
+	// there is none.
+	Open(string) (io.ReadSeekCloser, error)
+
+	// Remove the file stored under the given key. Removing a key not stored
+	// does nothing.
+	Remove(string) error
+
+	// Call the given function with the key and the modification date of
+	// every stored file, stopping at the first error returned.
+	Walk(func(string, time.Time) error) error
+}
+
+// IsValidKey returns true if the given key can be used to store a file: a
+// lowercase hexadecimal SHA-256 hash.
+func IsValidKey(key string) bool {
+	if len(key) != 64 {
+		return false
+	}
+	for _, c := range key {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}